@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Network-level access control for operators who must restrict the instance to
+// their LAN or country. IP_ALLOW and IP_DENY are comma-separated CIDRs or addresses;
+// "lan" stands for all private and link-local ranges. GeoIP restrictions use a CSV
+// database (GEOIP_DB) of "start,end,country" rows, as published by DB-IP and
+// IP2Location (LITE); addresses may be written as IPs or IPv4 integers.
+// Loopback is always allowed so health checks keep working. If GEOIP_ALLOW_COUNTRIES
+// is set but the database cannot be loaded, all public addresses are refused.
+var (
+	ipAllowList      = parsePrefixList("IP_ALLOW")
+	ipDenyList       = parsePrefixList("IP_DENY")
+	geoAllowCountry  = parseCountryList(getenv("GEOIP_ALLOW_COUNTRIES")) // e.g. "DE,AT,CH"
+	geoDenyCountry   = parseCountryList(getenv("GEOIP_DENY_COUNTRIES"))
+	geoIPDatabase    = loadGeoIPDatabase(getenv("GEOIP_DB"))
+	lanPrefixStrings = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "fc00::/7", "fe80::/10"}
+	ipAccessLog      = componentLogger("access")
+)
+
+// geoIPRange maps an address range to an ISO country code
+type geoIPRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+func parsePrefixList(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case strings.EqualFold(entry, "lan"):
+			for _, lan := range lanPrefixStrings {
+				prefixes = append(prefixes, netip.MustParsePrefix(lan))
+			}
+		case strings.Contains(entry, "/"):
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				configLog.Warn("Invalid entry", "key", key, "entry", entry, "error", err)
+				continue
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		default:
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				configLog.Warn("Invalid entry", "key", key, "entry", entry, "error", err)
+				continue
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	return prefixes
+}
+
+func parseCountryList(value string) map[string]bool {
+	countries := make(map[string]bool)
+	for _, code := range strings.Split(value, ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			countries[code] = true
+		}
+	}
+	return countries
+}
+
+// loadGeoIPDatabase reads the country CSV into ranges sorted by start address
+func loadGeoIPDatabase(path string) []geoIPRange {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		configLog.Warn("Cannot open GEOIP_DB", "path", path, "error", err)
+		return nil
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	var ranges []geoIPRange
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			configLog.Warn("GEOIP_DB is not a valid CSV", "path", path, "error", err)
+			return nil
+		}
+		if len(record) < 3 {
+			continue
+		}
+		start, errStart := parseGeoIPAddr(record[0])
+		end, errEnd := parseGeoIPAddr(record[1])
+		if errStart != nil || errEnd != nil {
+			continue // Header line or garbage
+		}
+		ranges = append(ranges, geoIPRange{start: start, end: end, country: strings.ToUpper(strings.TrimSpace(record[2]))})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start.Less(ranges[j].start) })
+	ipAccessLog.Info("Loaded GeoIP ranges", "ranges", len(ranges), "path", path)
+	return ranges
+}
+
+// parseGeoIPAddr accepts "1.2.3.4", "2001:db8::1" or an IPv4 integer like "16909060"
+func parseGeoIPAddr(value string) (netip.Addr, error) {
+	value = strings.TrimSpace(value)
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap(), nil
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", value)
+	}
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}), nil
+}
+
+// lookupCountry returns the country code of a public address, or "" if unknown
+func lookupCountry(addr netip.Addr) string {
+	i := sort.Search(len(geoIPDatabase), func(i int) bool { return addr.Less(geoIPDatabase[i].start) })
+	if i == 0 {
+		return ""
+	}
+	candidate := geoIPDatabase[i-1]
+	if candidate.start.BitLen() != addr.BitLen() || candidate.end.Less(addr) {
+		return ""
+	}
+	return candidate.country
+}
+
+func matchesPrefix(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAccessAllowed applies the deny list, the allow list and the GeoIP rules, in that order.
+// The reason is logged when access is refused.
+func ipAccessAllowed(addr netip.Addr) (bool, string) {
+	if addr.IsLoopback() {
+		return true, ""
+	}
+	if matchesPrefix(ipDenyList, addr) {
+		return false, "IP_DENY"
+	}
+	if len(ipAllowList) > 0 && !matchesPrefix(ipAllowList, addr) {
+		return false, "not in IP_ALLOW"
+	}
+
+	// Private addresses have no country
+	if len(geoAllowCountry)+len(geoDenyCountry) == 0 || addr.IsPrivate() || addr.IsLinkLocalUnicast() {
+		return true, ""
+	}
+	// Without a database an allow list cannot be checked, so it fails closed
+	if len(geoIPDatabase) == 0 {
+		if len(geoAllowCountry) > 0 {
+			return false, "GeoIP database unavailable"
+		}
+		return true, ""
+	}
+	country := lookupCountry(addr)
+	if geoDenyCountry[country] {
+		return false, "country " + country + " in GEOIP_DENY_COUNTRIES"
+	}
+	if len(geoAllowCountry) > 0 && !geoAllowCountry[country] {
+		return false, fmt.Sprintf("country %q not in GEOIP_ALLOW_COUNTRIES", country)
+	}
+	return true, ""
+}
+
+// ipAccessMiddleware refuses requests from addresses outside the configured networks
+// and countries
+func ipAccessMiddleware(next http.Handler) http.Handler {
+	if len(ipAllowList) == 0 && len(ipDenyList) == 0 && len(geoAllowCountry)+len(geoDenyCountry) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := netip.ParseAddr(remoteIP(r))
+		if err != nil {
+			http.Error(w, "Zugriff verweigert", http.StatusForbidden)
+			return
+		}
+		if allowed, reason := ipAccessAllowed(addr.Unmap().WithZone("")); !allowed {
+			ipAccessLog.Warn("Refused request", "method", r.Method, "path", r.URL.Path, "ip", addr.String(), "reason", reason)
+			http.Error(w, "Zugriff von dieser Adresse ist nicht erlaubt", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// API keys keep a server on the public internet from becoming an open downloader:
+// with API_KEYS (or API_KEYS_FILE, e.g. a Docker secret) set, every endpoint that
+// starts a job or runs yt-dlp, and /download-file/, needs one of the keys. Keys are
+// written as "label:key", comma-separated in API_KEYS and one per line in the file;
+// the label only shows up in the logs. Clients send the key as "X-API-Key: <key>" or
+// "Authorization: Bearer <key>", links to /download-file/ and aria2 frontends may
+// carry it as ?api_key=<key>. Users authenticated by the
+// auth proxy (AUTH_USER_HEADER) need no key.
+const minAPIKeyLength = 16
+
+// APIKey is one accepted key
+type APIKey struct {
+	Label string
+	Key   string
+}
+
+var (
+	apiKeys   = loadAPIKeys(getenv("API_KEYS"), getenv("API_KEYS_FILE"))
+	apiKeyLog = componentLogger("apikeys")
+)
+
+type apiKeyLabelKey struct{}
+
+// loadAPIKeys reads the keys from the variable and the file
+func loadAPIKeys(value, path string) []APIKey {
+	entries := strings.Split(value, ",")
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			// Failing open would expose the server the keys were meant to protect
+			configLog.Error("Cannot read API_KEYS_FILE, all protected endpoints are locked", "path", path, "error", err)
+			return []APIKey{{Label: "unreadable", Key: ""}}
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+	}
+
+	var keys []APIKey
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		label, key, ok := strings.Cut(entry, ":")
+		label, key = strings.TrimSpace(label), strings.TrimSpace(key)
+		if !ok || label == "" || key == "" {
+			configLog.Warn("Ignoring API key: expected label:key", "label", label)
+			continue
+		}
+		if seen[key] {
+			configLog.Warn("Ignoring duplicate API key", "label", label)
+			continue
+		}
+		if len(key) < minAPIKeyLength {
+			configLog.Warn("API key is shorter than 16 characters", "label", label)
+		}
+		seen[key] = true
+		keys = append(keys, APIKey{Label: label, Key: key})
+	}
+	if len(keys) > 0 {
+		configLog.Info("API keys required", "keys", len(keys))
+	}
+	return keys
+}
+
+func apiKeysEnabled() bool {
+	return len(apiKeys) > 0
+}
+
+// requestAPIKey returns the key sent with the request, "" if there is none
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return bearer
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// matchAPIKey returns the label of the key; every key is compared, so the time taken
+// does not tell which one almost matched
+func matchAPIKey(given string) (string, bool) {
+	label, found := "", false
+	for _, key := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(key.Key)) == 1 && key.Key != "" {
+			label, found = key.Label, true
+		}
+	}
+	return label, found
+}
+
+// requireAPIKey lets requests with a valid key or an authenticated user through
+func requireAPIKey(next http.Handler) http.Handler {
+	if !apiKeysEnabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authenticatedUser(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		label, ok := matchAPIKey(requestAPIKey(r))
+		if !ok {
+			apiKeyLog.Warn("Rejected request: missing or wrong API key", "method", r.Method, "path", r.URL.Path, "ip", remoteIP(r))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ytdownloader"`)
+			writeJSONStatus(w, http.StatusUnauthorized, map[string]interface{}{
+				"success": false,
+				"message": "Gültiger API-Schlüssel erforderlich",
+			})
+			return
+		}
+		apiKeyLog.Debug("Request with API key", "label", label, "path", r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyLabelKey{}, label)))
+	})
+}
+
+// apiKeyLabel returns the label of the key the request was sent with, "" if none
+func apiKeyLabel(r *http.Request) string {
+	label, _ := r.Context().Value(apiKeyLabelKey{}).(string)
+	return label
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// aria2-compatible JSON-RPC at /jsonrpc, so aria2 frontends (AriaNg, Aria2App, ...)
+// can add and watch downloads. GIDs are the session IDs in hex. Sizes are not known
+// while yt-dlp runs, so running jobs report progress as completedLength of 100.
+// Frontends have no session tokens, so they only see and remove jobs added via RPC.
+var aria2Secret = getenv("ARIA2_RPC_SECRET") // Sent by clients as "token:<secret>"
+
+const (
+	maxAria2BodyBytes = 256 << 10
+	aria2Requester    = "aria2" // Marks the jobs added via RPC
+)
+
+// aria2 error codes used in JSON-RPC faults
+const (
+	aria2ErrParse   = -32700
+	aria2ErrMethod  = -32601
+	aria2ErrGeneric = 1
+)
+
+type aria2Request struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type aria2Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *aria2Error     `json:"error,omitempty"`
+}
+
+type aria2Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *aria2Error) Error() string {
+	return e.Message
+}
+
+type aria2Status struct {
+	GID             string      `json:"gid"`
+	Status          string      `json:"status"` // active, complete, error
+	TotalLength     string      `json:"totalLength"`
+	CompletedLength string      `json:"completedLength"`
+	UploadLength    string      `json:"uploadLength"`
+	DownloadSpeed   string      `json:"downloadSpeed"`
+	UploadSpeed     string      `json:"uploadSpeed"`
+	Connections     string      `json:"connections"`
+	NumPieces       string      `json:"numPieces"`
+	PieceLength     string      `json:"pieceLength"`
+	ErrorCode       string      `json:"errorCode,omitempty"`
+	ErrorMessage    string      `json:"errorMessage,omitempty"`
+	Dir             string      `json:"dir"`
+	Files           []aria2File `json:"files"`
+}
+
+type aria2File struct {
+	Index           string     `json:"index"`
+	Path            string     `json:"path"`
+	Length          string     `json:"length"`
+	CompletedLength string     `json:"completedLength"`
+	Selected        string     `json:"selected"`
+	URIs            []aria2URI `json:"uris"`
+}
+
+type aria2URI struct {
+	URI    string `json:"uri"`
+	Status string `json:"status"`
+}
+
+var aria2Methods = []string{
+	"aria2.addUri", "aria2.tellStatus", "aria2.remove", "aria2.forceRemove",
+	"aria2.removeDownloadResult", "aria2.tellActive", "aria2.tellWaiting", "aria2.tellStopped",
+	"aria2.getVersion", "aria2.getGlobalStat", "system.multicall", "system.listMethods",
+}
+
+// handleAria2RPC serves single and batch JSON-RPC requests: POST /jsonrpc
+func handleAria2RPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAria2BodyBytes))
+	if err != nil {
+		http.Error(w, "Anfrage zu groß", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		var batch []aria2Request
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, aria2Response{JSONRPC: "2.0", Error: &aria2Error{aria2ErrParse, "Parse error"}})
+			return
+		}
+		responses := make([]aria2Response, len(batch))
+		for i, req := range batch {
+			responses[i] = dispatchAria2(r, req)
+		}
+		writeJSONStatus(w, http.StatusOK, responses)
+		return
+	}
+
+	var req aria2Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, aria2Response{JSONRPC: "2.0", Error: &aria2Error{aria2ErrParse, "Parse error"}})
+		return
+	}
+	resp := dispatchAria2(r, req)
+	status := http.StatusOK
+	if resp.Error != nil {
+		status = http.StatusBadRequest
+	}
+	writeJSONStatus(w, status, resp)
+}
+
+func dispatchAria2(r *http.Request, req aria2Request) aria2Response {
+	resp := aria2Response{JSONRPC: "2.0", ID: req.ID}
+	result, err := callAria2(r, req.Method, req.Params)
+	if err != nil {
+		resp.Error = err
+		return resp
+	}
+	resp.Result = result
+	return resp
+}
+
+// callAria2 runs one method; the secret token is checked and stripped for aria2.* methods
+func callAria2(r *http.Request, method string, params []json.RawMessage) (interface{}, *aria2Error) {
+	if strings.HasPrefix(method, "aria2.") {
+		var token string
+		if len(params) > 0 && json.Unmarshal(params[0], &token) == nil && strings.HasPrefix(token, "token:") {
+			params = params[1:]
+		} else {
+			token = ""
+		}
+		if aria2Secret != "" && token != "token:"+aria2Secret {
+			return nil, &aria2Error{aria2ErrGeneric, "Unauthorized"}
+		}
+	}
+
+	switch method {
+	case "aria2.addUri":
+		return aria2AddURI(r, params)
+	case "aria2.tellStatus":
+		job, err := aria2Job(params)
+		if err != nil {
+			return nil, err
+		}
+		return toAria2Status(job), nil
+	case "aria2.remove", "aria2.forceRemove":
+		job, err := aria2Job(params)
+		if err != nil {
+			return nil, err
+		}
+		if job.isActive() {
+			if err := cancelJob(job.SessionID); err != nil {
+				return nil, &aria2Error{aria2ErrGeneric, err.Error()}
+			}
+			return aria2GID(job.SessionID), nil
+		}
+		return nil, &aria2Error{aria2ErrGeneric, fmt.Sprintf("Active Download not found for GID#%s", aria2GID(job.SessionID))}
+	case "aria2.removeDownloadResult":
+		job, err := aria2Job(params)
+		if err != nil {
+			return nil, err
+		}
+		if !deleteJob(job.SessionID) {
+			return nil, &aria2Error{aria2ErrGeneric, "Could not remove download result of an active download"}
+		}
+		return "OK", nil
+	case "aria2.tellActive":
+		return aria2List(func(job Job) bool { return job.Status == JobStatusRunning }), nil
+	case "aria2.tellWaiting":
+		return aria2List(func(job Job) bool { return job.Status == JobStatusQueued }), nil
+	case "aria2.tellStopped":
+		return aria2List(func(job Job) bool { return !job.isActive() }), nil
+	case "aria2.getVersion":
+		return map[string]interface{}{"version": "1.37.0", "enabledFeatures": []string{}}, nil
+	case "aria2.getGlobalStat":
+		active, waiting, stopped := 0, 0, 0
+		for _, job := range aria2Jobs() {
+			switch job.Status {
+			case JobStatusRunning:
+				active++
+			case JobStatusQueued:
+				waiting++
+			default:
+				stopped++
+			}
+		}
+		return map[string]string{
+			"downloadSpeed":   "0",
+			"uploadSpeed":     "0",
+			"numActive":       strconv.Itoa(active),
+			"numWaiting":      strconv.Itoa(waiting),
+			"numStopped":      strconv.Itoa(stopped),
+			"numStoppedTotal": strconv.Itoa(stopped),
+		}, nil
+	case "system.multicall":
+		return aria2Multicall(r, params)
+	case "system.listMethods":
+		return aria2Methods, nil
+	}
+	return nil, &aria2Error{aria2ErrMethod, "Method not found"}
+}
+
+// aria2AddURI starts a job for the first URI; the format is taken from the "ytdown-format" option (default mp4)
+func aria2AddURI(r *http.Request, params []json.RawMessage) (interface{}, *aria2Error) {
+	var uris []string
+	if len(params) == 0 || json.Unmarshal(params[0], &uris) != nil || len(uris) == 0 {
+		return nil, &aria2Error{aria2ErrGeneric, "No URI to download."}
+	}
+	options := map[string]string{}
+	if len(params) > 1 {
+		json.Unmarshal(params[1], &options)
+	}
+
+	req := DownloadRequest{URL: uris[0], Format: "mp4"}
+	if format := options["ytdown-format"]; format != "" {
+		req.Format = format
+	}
+	cleanedURL, msg := validateDownloadRequest(req)
+	if msg != "" {
+		return nil, &aria2Error{aria2ErrGeneric, msg}
+	}
+	// The route isn't rate limited, as frontends poll it every second; new downloads are
+	if downloadRateLimiter != nil {
+		if ok, _ := downloadRateLimiter.take(remoteIP(r)); !ok {
+			return nil, &aria2Error{aria2ErrGeneric, "Too many requests, try again later"}
+		}
+	}
+	return aria2GID(startJob(cleanedURL, req, aria2Requester, nil)), nil
+}
+
+func aria2Multicall(r *http.Request, params []json.RawMessage) (interface{}, *aria2Error) {
+	var calls []struct {
+		MethodName string            `json:"methodName"`
+		Params     []json.RawMessage `json:"params"`
+	}
+	if len(params) == 0 || json.Unmarshal(params[0], &calls) != nil {
+		return nil, &aria2Error{aria2ErrGeneric, "Bad multicall parameters"}
+	}
+
+	results := make([]interface{}, len(calls))
+	for i, call := range calls {
+		if call.MethodName == "system.multicall" {
+			results[i] = aria2Error{aria2ErrGeneric, "Recursive system.multicall forbidden."}
+			continue
+		}
+		result, err := callAria2(r, call.MethodName, call.Params)
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		// Successful results are wrapped in a one-element array
+		results[i] = []interface{}{result}
+	}
+	return results, nil
+}
+
+func aria2Job(params []json.RawMessage) (Job, *aria2Error) {
+	var gid string
+	if len(params) == 0 || json.Unmarshal(params[0], &gid) != nil {
+		return Job{}, &aria2Error{aria2ErrGeneric, "Bad GID"}
+	}
+	id, err := strconv.ParseUint(gid, 16, 64)
+	if err != nil {
+		return Job{}, &aria2Error{aria2ErrGeneric, fmt.Sprintf("Bad GID %s", gid)}
+	}
+	job, ok := getJob(strconv.FormatUint(id, 10))
+	if !ok || job.Requester != aria2Requester {
+		return Job{}, &aria2Error{aria2ErrGeneric, fmt.Sprintf("No such download for GID#%s", gid)}
+	}
+	return job, nil
+}
+
+// aria2GID converts a session ID (Unix nanoseconds) to a 16 digit hex GID
+func aria2GID(sessionID string) string {
+	id, _ := strconv.ParseUint(sessionID, 10, 64)
+	return fmt.Sprintf("%016x", id)
+}
+
+// aria2Jobs returns the jobs added via RPC
+func aria2Jobs() []Job {
+	list := []Job{}
+	for _, job := range listJobs() {
+		if job.Requester == aria2Requester {
+			list = append(list, job)
+		}
+	}
+	return list
+}
+
+func aria2List(match func(job Job) bool) []aria2Status {
+	list := []aria2Status{}
+	for _, job := range aria2Jobs() {
+		if match(job) {
+			list = append(list, toAria2Status(job))
+		}
+	}
+	return list
+}
+
+func toAria2Status(job Job) aria2Status {
+	dir, _ := filepath.Abs(downloadsDir)
+	status := aria2Status{
+		GID:             aria2GID(job.SessionID),
+		Status:          "active",
+		TotalLength:     "100",
+		CompletedLength: strconv.Itoa(job.Progress),
+		UploadLength:    "0",
+		DownloadSpeed:   "0",
+		UploadSpeed:     "0",
+		Connections:     "1",
+		NumPieces:       "1",
+		PieceLength:     "1048576",
+		Dir:             dir,
+	}
+
+	file := aria2File{
+		Index:           "1",
+		Path:            "",
+		Length:          status.TotalLength,
+		CompletedLength: status.CompletedLength,
+		Selected:        "true",
+		URIs:            []aria2URI{{URI: job.URL, Status: "used"}},
+	}
+
+	switch job.Status {
+	case JobStatusQueued:
+		status.Status = "waiting"
+	case JobStatusCompleted:
+		status.Status = "complete"
+		file.Path = filepath.Join(dir, job.Filename)
+		if info, err := os.Stat(file.Path); err == nil {
+			size := strconv.FormatInt(info.Size(), 10)
+			status.TotalLength, status.CompletedLength = size, size
+			file.Length, file.CompletedLength = size, size
+		}
+	case JobStatusFailed:
+		status.Status = "error"
+		status.ErrorCode = strconv.Itoa(aria2ErrGeneric)
+		status.ErrorMessage = job.Error
+	}
+	status.Files = []aria2File{file}
+	return status
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// losslessFormats support explicit sample rate and channel layout
+var losslessFormats = map[string]bool{
+	"wav":  true,
+	"flac": true,
+}
+
+// validSampleRates are the sample rates accepted for lossless output
+var validSampleRates = map[int]bool{
+	8000:   true,
+	16000:  true,
+	22050:  true,
+	32000:  true,
+	44100:  true,
+	48000:  true,
+	88200:  true,
+	96000:  true,
+	192000: true,
+}
+
+// AudioPresetVoice is made for talks and podcasts: mono, a speech bitrate and a
+// highpass that removes rumble below the voice range. Long recordings shrink to a
+// fraction of the default quality-0 encode.
+const AudioPresetVoice = "voice"
+
+const voiceFilter = "highpass=f=80"
+
+// voiceBitrates are the voice preset bitrates per format
+var voiceBitrates = map[string]string{
+	"mp3":  "64k",
+	"m4a":  "80k",
+	"opus": "48k",
+}
+
+// voiceEncoderArgs re-encode voice preset files without raising the bitrate again
+var voiceEncoderArgs = map[string][]string{
+	".mp3":  {"-c:a", "libmp3lame", "-b:a", voiceBitrates["mp3"]},
+	".m4a":  {"-c:a", "aac", "-b:a", voiceBitrates["m4a"]},
+	".opus": {"-c:a", "libopus", "-b:a", voiceBitrates["opus"], "-application", "voip"},
+}
+
+// audioQuality is yt-dlp's --audio-quality for a request
+func audioQuality(req DownloadRequest) string {
+	if bitrate, ok := voiceBitrates[req.Format]; ok && req.AudioPreset == AudioPresetVoice {
+		return strings.ToUpper(bitrate)
+	}
+	return "0"
+}
+
+// audioEncoder returns the encoder args to re-encode an audio file after filtering
+func audioEncoder(ext, preset string) ([]string, bool) {
+	if preset == AudioPresetVoice {
+		if args, ok := voiceEncoderArgs[ext]; ok {
+			return args, true
+		}
+	}
+	args, ok := audioEncoderArgs[ext]
+	return args, ok
+}
+
+// Accepted range for the tempo option
+const (
+	minTempo = 0.5
+	maxTempo = 4.0
+)
+
+// validateAudioOptions checks sampleRate/channels/tempo and returns a user-facing message if invalid
+func validateAudioOptions(req DownloadRequest) string {
+	if req.Tempo != 0 {
+		if !isAudioFormat(req.Format) {
+			return "Das Tempo kann nur für Audioformate gewählt werden."
+		}
+		if req.Tempo < minTempo || req.Tempo > maxTempo {
+			return fmt.Sprintf("Das Tempo muss zwischen %.1f und %.1f liegen.", minTempo, maxTempo)
+		}
+	}
+
+	if req.AudioPreset != "" {
+		if req.AudioPreset != AudioPresetVoice {
+			return fmt.Sprintf("Unbekanntes Audio-Profil: %s", req.AudioPreset)
+		}
+		if _, ok := voiceBitrates[req.Format]; !ok {
+			return "Das Sprachprofil ist nur für MP3, M4A und Opus verfügbar."
+		}
+	}
+
+	if req.SampleRate == 0 && req.Channels == 0 {
+		return ""
+	}
+	if !losslessFormats[req.Format] {
+		return "Abtastrate und Kanäle können nur für verlustfreie Formate (WAV, FLAC) gewählt werden."
+	}
+	if req.SampleRate != 0 && !validSampleRates[req.SampleRate] {
+		return fmt.Sprintf("Ungültige Abtastrate: %d Hz", req.SampleRate)
+	}
+	if req.Channels != 0 && req.Channels != 1 && req.Channels != 2 {
+		return "Kanäle müssen 1 (Mono) oder 2 (Stereo) sein."
+	}
+	return ""
+}
+
+// audioOutputArgs returns the ffmpeg output args for the requested sample rate,
+// channels and audio preset
+func audioOutputArgs(req DownloadRequest) string {
+	if req.AudioPreset == AudioPresetVoice {
+		return "-ac 1 -af " + voiceFilter
+	}
+	if !losslessFormats[req.Format] {
+		return ""
+	}
+
+	var args []string
+	if req.SampleRate != 0 {
+		args = append(args, "-ar", fmt.Sprintf("%d", req.SampleRate))
+	}
+	if req.Channels != 0 {
+		args = append(args, "-ac", fmt.Sprintf("%d", req.Channels))
+	}
+	return strings.Join(args, " ")
+}
+
+// atempoFilter builds the atempo chain for a tempo. A single atempo instance only
+// accepts 0.5-2.0 on older ffmpeg builds, so larger factors are chained.
+func atempoFilter(tempo float64) string {
+	var filters []string
+	for tempo > 2.0 {
+		filters = append(filters, "atempo=2.0")
+		tempo /= 2.0
+	}
+	for tempo < 0.5 {
+		filters = append(filters, "atempo=0.5")
+		tempo /= 0.5
+	}
+	filters = append(filters, fmt.Sprintf("atempo=%.4f", tempo))
+	return strings.Join(filters, ",")
+}
+
+// changeTempo re-encodes an audio file in place at the given speed without changing the pitch
+func changeTempo(mediaPath string, tempo float64, preset string) error {
+	ext := strings.ToLower(filepath.Ext(mediaPath))
+	encoderArgs, ok := audioEncoder(ext, preset)
+	if !ok {
+		return fmt.Errorf("unsupported audio format %s", ext)
+	}
+
+	tmpPath := strings.TrimSuffix(mediaPath, ext) + ".tempo" + ext
+	args := []string{"-v", "error", "-y", "-i", mediaPath, "-map", "0:a", "-filter:a", atempoFilter(tempo)}
+	args = append(args, encoderArgs...)
+	args = append(args, "-map_metadata", "0", tmpPath)
+
+	if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg atempo failed: %v: %s", err, truncateString(string(output), 500))
+	}
+
+	if err := syncFile(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, mediaPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	postProcessLog.Info("Changed tempo", "file", filepath.Base(mediaPath), "tempo", tempo)
+	return nil
+}
+
+// scaleChapters adjusts chapter times to a changed playback speed
+func scaleChapters(chapters []Chapter, tempo float64) []Chapter {
+	scaled := make([]Chapter, len(chapters))
+	for i, chapter := range chapters {
+		chapter.StartTime /= tempo
+		chapter.EndTime /= tempo
+		scaled[i] = chapter
+	}
+	return scaled
+}
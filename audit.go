@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The audit log records every job lifecycle transition except progress updates, and
+// acceptances of the terms of use (see terms.go).
+// The most recent entries are kept in memory for GET /audit (ADMIN_TOKEN, or the
+// session token to list one session's entries); AUDIT_LOG additionally
+// appends them as JSON lines to a file that survives restarts.
+var auditLogPath = getenv("AUDIT_LOG")
+
+const maxAuditEntries = 1000
+
+// AuditEntry is one recorded transition
+type AuditEntry struct {
+	At        time.Time `json:"at"`
+	Event     string    `json:"event"`
+	SessionID string    `json:"sessionId,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Format    string    `json:"format,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+var (
+	auditEntries []AuditEntry
+	auditMutex   sync.Mutex
+	auditFile    *os.File
+	auditLog     = componentLogger("audit")
+)
+
+// recordAuditEvent records a lifecycle event
+func recordAuditEvent(event LifecycleEvent) {
+	entry := AuditEntry{
+		At:        event.At,
+		Event:     event.Type,
+		SessionID: event.SessionID,
+		URL:       event.Job.URL,
+		Format:    event.Job.Format,
+		Status:    event.Job.Status,
+		Detail:    event.Detail,
+	}
+	if entry.Detail == "" && event.Update != nil {
+		entry.Detail = event.Update.Status
+	}
+	appendAuditEntry(entry)
+}
+
+// appendAuditEntry stores an entry in memory and, if configured, in AUDIT_LOG
+func appendAuditEntry(entry AuditEntry) {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	auditEntries = append(auditEntries, entry)
+	if len(auditEntries) > maxAuditEntries {
+		auditEntries = auditEntries[len(auditEntries)-maxAuditEntries:]
+	}
+
+	if auditLogPath == "" {
+		return
+	}
+	if auditFile == nil {
+		file, err := os.OpenFile(auditLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			auditLog.Error("Cannot open the audit log", "path", auditLogPath, "error", err)
+			return
+		}
+		auditFile = file
+	}
+	line, _ := json.Marshal(entry)
+	if _, err := auditFile.Write(append(line, '\n')); err != nil {
+		auditLog.Error("Writing the audit log failed", "path", auditLogPath, "error", err)
+	}
+}
+
+// handleAudit lists recent audit entries, newest first: GET /audit?session=&limit=
+// with the session token, or without session with ADMIN_TOKEN
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	session := query.Get("session")
+	// Entries of other sessions name users and addresses, so the full log is for the admin
+	if session != "" && !requireSessionOwner(w, r, session) {
+		return
+	}
+	if session == "" && !requireAdmin(w, r) {
+		return
+	}
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Ungültiges Limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxAuditEntries) // The ring holds no more
+	}
+
+	auditMutex.Lock()
+	entries := []AuditEntry{}
+	for i := len(auditEntries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if session == "" || auditEntries[i].SessionID == session {
+			entries = append(entries, auditEntries[i])
+		}
+	}
+	auditMutex.Unlock()
+
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "entries": entries})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Music library import for audio downloads, configured via BEETS_MODE:
+//   - "import": run "beet import -q -s <file>" (BEETS_BINARY, default "beet")
+//   - "folder": copy the file into BEETS_IMPORT_DIR, e.g. a folder watched by beets or Lidarr
+var (
+	beetsMode      = strings.ToLower(getenv("BEETS_MODE"))
+	beetsBinary    = getEnvDefault("BEETS_BINARY", "beet")
+	beetsImportDir = getenv("BEETS_IMPORT_DIR")
+	beetsTimeout   = 5 * time.Minute
+	beetsLog       = componentLogger("beets")
+)
+
+// Library import results stored on the job
+const (
+	LibraryImported = "imported"
+	LibraryQueued   = "queued" // Copied into the watched import folder
+	LibraryFailed   = "failed"
+)
+
+func libraryImportEnabled() bool {
+	switch beetsMode {
+	case "import":
+		return true
+	case "folder":
+		return beetsImportDir != ""
+	}
+	return false
+}
+
+// importToLibrary hands a finished audio file to the music library and records the result on the job
+func importToLibrary(sessionID, mediaPath string) {
+	var err error
+	status := LibraryImported
+	if beetsMode == "folder" {
+		status = LibraryQueued
+		err = copyToImportDir(mediaPath)
+	} else {
+		err = runBeetImport(sessionID, mediaPath)
+	}
+
+	if err != nil {
+		status = LibraryFailed
+		appendJobLog(sessionID, fmt.Sprintf("[beets] %v", err))
+		jobLogger(beetsLog, sessionID, "postprocess").Warn("Import failed", "error", err)
+	} else {
+		jobLogger(beetsLog, sessionID, "postprocess").Info("Imported", "file", filepath.Base(mediaPath), "status", status)
+	}
+	updateJob(sessionID, func(job *Job) { job.LibraryImport = status })
+}
+
+// runBeetImport imports a single track non-interactively; beets output goes to the job log
+func runBeetImport(sessionID, mediaPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), beetsTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, beetsBinary, "import", "-q", "-s", mediaPath).CombinedOutput()
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			appendJobLog(sessionID, "[beets] "+line)
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("beet import timed out after %s", beetsTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("beet import failed: %v", err)
+	}
+	// beets exits 0 even when -q skips a track it could not match
+	if strings.Contains(string(output), "Skipping") {
+		return fmt.Errorf("beet import skipped the track")
+	}
+	return nil
+}
+
+// copyToImportDir copies the file (and its .lrc sidecar) into the import folder.
+// Files are written under a temporary name first so watchers never see partial files.
+func copyToImportDir(mediaPath string) error {
+	if err := os.MkdirAll(beetsImportDir, 0755); err != nil {
+		return err
+	}
+	paths := []string{mediaPath}
+	if _, err := os.Stat(lyricsPath(mediaPath)); err == nil {
+		paths = append(paths, lyricsPath(mediaPath))
+	}
+
+	for _, src := range paths {
+		dst := filepath.Join(beetsImportDir, filepath.Base(src))
+		if err := copyFileAtomic(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFileAtomic(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
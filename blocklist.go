@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"ytdownloader/resolver"
+)
+
+// The blocklist lets operators honor takedown requests: blocked videos, channels and
+// URL patterns are refused by /download (451 with code "blocked_by_policy") and
+// /stream-url, and jobs from other entry points fail with the same code. Channels are
+// only known once yt-dlp read the video, so their downloads fail before the file is
+// published. BLOCKLIST_FILE holds entries like "video:dQw4w9WgXcQ", "channel:UC..."
+// (or "channel:@handle") and "url:<regexp>", one per line, with an optional reason
+// after "#". Entries added via /admin/blocklist (ADMIN_TOKEN) are kept in the job store.
+const (
+	BlockVideo   = "video"
+	BlockChannel = "channel"
+	BlockURL     = "url"
+
+	blocklistBucket   = "blocklist"
+	blockedPolicyCode = "blocked_by_policy"
+)
+
+// BlockEntry is one blocked video, channel or URL pattern
+type BlockEntry struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	Reason    string    `json:"reason,omitempty"` // E.g. the takedown reference, never shown to users
+	Source    string    `json:"source"`           // "file" or "admin"
+	CreatedAt time.Time `json:"createdAt"`
+
+	pattern *regexp.Regexp
+}
+
+var (
+	blocklist      = loadBlocklistFile(getenv("BLOCKLIST_FILE")) // Keyed by ID
+	blocklistMutex sync.RWMutex
+	blocklistLog   = componentLogger("blocklist")
+
+	errBlockedByPolicy = &downloadError{Code: blockedPolicyCode, Message: "Dieses Video wurde vom Betreiber gesperrt."}
+)
+
+// blockEntryID identifies an entry by its type and value
+func blockEntryID(kind, value string) string {
+	sum := sha256.Sum256([]byte(kind + ":" + value))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// newBlockEntry checks and normalizes an entry
+func newBlockEntry(kind, value, reason, source string) (*BlockEntry, error) {
+	kind, value = strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("Wert fehlt")
+	}
+	entry := &BlockEntry{Type: kind, Value: value, Reason: strings.TrimSpace(reason), Source: source, CreatedAt: time.Now()}
+	switch kind {
+	case BlockVideo:
+		// A link is accepted in place of the ID
+		if watchURL, ok := resolver.Canonical(value); ok && resolver.VideoID(watchURL) != "" {
+			entry.Value = resolver.VideoID(watchURL)
+		}
+	case BlockChannel:
+	case BlockURL:
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("Ungültiges Muster: %v", err)
+		}
+		entry.pattern = pattern
+	default:
+		return nil, fmt.Errorf("Unbekannter Typ %q (video, channel oder url)", kind)
+	}
+	entry.ID = blockEntryID(entry.Type, entry.Value)
+	return entry, nil
+}
+
+// loadBlocklistFile reads BLOCKLIST_FILE
+func loadBlocklistFile(path string) map[string]*BlockEntry {
+	entries := make(map[string]*BlockEntry)
+	if path == "" {
+		return entries
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		configLog.Error("Cannot read BLOCKLIST_FILE", "path", path, "error", err)
+		return entries
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, reason, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		kind, value, _ := strings.Cut(line, ":")
+		entry, err := newBlockEntry(kind, value, reason, "file")
+		if err != nil {
+			configLog.Warn("Ignoring blocklist entry", "entry", line, "error", err)
+			continue
+		}
+		entries[entry.ID] = entry
+	}
+	configLog.Info("Blocklist loaded", "path", path, "entries", len(entries))
+	return entries
+}
+
+// loadStoredBlocklist adds the entries made via the admin API
+func loadStoredBlocklist() {
+	err := jobStore.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(blocklistBucket)).ForEach(func(key, value []byte) error {
+			var stored BlockEntry
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return nil
+			}
+			entry, err := newBlockEntry(stored.Type, stored.Value, stored.Reason, stored.Source)
+			if err != nil {
+				blocklistLog.Warn("Skipping stored entry", "id", string(key), "error", err)
+				return nil
+			}
+			entry.CreatedAt = stored.CreatedAt
+			blocklistMutex.Lock()
+			if _, exists := blocklist[entry.ID]; !exists {
+				blocklist[entry.ID] = entry
+			}
+			blocklistMutex.Unlock()
+			return nil
+		})
+	})
+	if err != nil {
+		blocklistLog.Error("Failed to load blocklist", "error", err)
+	}
+}
+
+// blockedURL returns the entry that blocks a video or URL, if any. Patterns are
+// matched against the URL as sent as well as the cleaned up one.
+func blockedURL(urls ...string) (*BlockEntry, bool) {
+	blocklistMutex.RLock()
+	defer blocklistMutex.RUnlock()
+	for _, rawURL := range urls {
+		videoID := ""
+		if watchURL, ok := resolver.Canonical(rawURL); ok {
+			videoID = resolver.VideoID(watchURL)
+		}
+		for _, entry := range blocklist {
+			switch entry.Type {
+			case BlockVideo:
+				if videoID != "" && entry.Value == videoID {
+					return entry, true
+				}
+			case BlockURL:
+				if entry.pattern.MatchString(rawURL) {
+					return entry, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// blockedMetadata returns the entry that blocks a video by its ID or channel, if any
+func blockedMetadata(metadata *VideoMetadata) (*BlockEntry, bool) {
+	if metadata == nil {
+		return nil, false
+	}
+	blocklistMutex.RLock()
+	defer blocklistMutex.RUnlock()
+	for _, entry := range blocklist {
+		switch entry.Type {
+		case BlockVideo:
+			if entry.Value == metadata.ID {
+				return entry, true
+			}
+		case BlockChannel:
+			if entry.Value == metadata.ChannelID || strings.EqualFold(entry.Value, metadata.UploaderID) {
+				return entry, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// writeBlocked answers a request for a blocked video
+func writeBlocked(w http.ResponseWriter, r *http.Request, rawURL string, entry *BlockEntry) {
+	blocklistLog.Warn("Refused blocked video", "url", rawURL, "entry", entry.ID, "type", entry.Type, "ip", remoteIP(r))
+	writeJSONStatus(w, http.StatusUnavailableForLegalReasons, map[string]interface{}{
+		"success": false,
+		"message": errBlockedByPolicy.Message,
+		"code":    blockedPolicyCode,
+	})
+}
+
+// snapshotBlocklist returns the entries, newest first
+func snapshotBlocklist() []BlockEntry {
+	blocklistMutex.RLock()
+	list := make([]BlockEntry, 0, len(blocklist))
+	for _, entry := range blocklist {
+		list = append(list, *entry)
+	}
+	blocklistMutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// handleListBlocklist lists the entries: GET /admin/blocklist
+func handleListBlocklist(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "entries": snapshotBlocklist()})
+}
+
+type addBlockRequest struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// handleAddBlock adds an entry: POST /admin/blocklist {"type", "value", "reason"}
+func handleAddBlock(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var body addBlockRequest
+	if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+		return
+	}
+	entry, err := newBlockEntry(body.Type, body.Value, body.Reason, "admin")
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": err.Error()})
+		return
+	}
+
+	if jobStore != nil {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			err = jobStore.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket([]byte(blocklistBucket)).Put([]byte(entry.ID), data)
+			})
+		}
+		if err != nil {
+			blocklistLog.Error("Failed to store entry", "id", entry.ID, "error", err)
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Eintrag konnte nicht gespeichert werden"})
+			return
+		}
+	}
+	blocklistMutex.Lock()
+	blocklist[entry.ID] = entry
+	blocklistMutex.Unlock()
+	adminLog.Info("Blocklist entry added", "id", entry.ID, "type", entry.Type, "value", entry.Value, "ip", remoteIP(r))
+
+	writeJSONStatus(w, http.StatusCreated, map[string]interface{}{"success": true, "entry": entry})
+}
+
+// handleDeleteBlock removes an entry made via the API: DELETE /admin/blocklist/{id}
+func handleDeleteBlock(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	id := pathParam(r, "id")
+	blocklistMutex.Lock()
+	entry, ok := blocklist[id]
+	if ok && entry.Source == "file" {
+		blocklistMutex.Unlock()
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": "Der Eintrag stammt aus BLOCKLIST_FILE und kann nur dort entfernt werden"})
+		return
+	}
+	delete(blocklist, id)
+	blocklistMutex.Unlock()
+	if !ok {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Eintrag nicht gefunden"})
+		return
+	}
+
+	if jobStore != nil {
+		jobStore.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(blocklistBucket)).Delete([]byte(id))
+		})
+	}
+	adminLog.Info("Blocklist entry removed", "id", id, "type", entry.Type, "value", entry.Value, "ip", remoteIP(r))
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+// yt-dlp release channels used for canary comparisons
+const (
+	ChannelStable = "stable"
+	ChannelCanary = "canary"
+)
+
+var (
+	ytdlpBinary        = getEnvDefault("YTDLP_BINARY", "yt-dlp")            // Replaced by a stub in the end-to-end tests
+	ytdlpCanaryBinary  = getenv("YTDLP_CANARY_BINARY")                      // Path to the "next" yt-dlp, e.g. /opt/yt-dlp-nightly/yt-dlp
+	ytdlpCanaryPercent = parseCanaryPercent(getenv("YTDLP_CANARY_PERCENT")) // Share of jobs routed to the canary (0-100)
+)
+
+// parseCanaryPercent parses the canary share and clamps it to 0-100
+func parseCanaryPercent(value string) int {
+	if value == "" {
+		return 0
+	}
+	percent, err := strconv.Atoi(value)
+	if err != nil {
+		configLog.Warn("Invalid YTDLP_CANARY_PERCENT, canary disabled", "value", value)
+		return 0
+	}
+	if percent < 0 {
+		return 0
+	}
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// canaryEnabled reports whether a canary binary is configured and receives traffic
+func canaryEnabled() bool {
+	return ytdlpCanaryBinary != "" && ytdlpCanaryPercent > 0
+}
+
+// pickYtDlpChannel decides which yt-dlp binary a new job runs with
+func pickYtDlpChannel() (string, string) {
+	if canaryEnabled() && rand.Intn(100) < ytdlpCanaryPercent {
+		return ChannelCanary, ytdlpCanaryBinary
+	}
+	return ChannelStable, ytdlpBinary
+}
+
+// logCanaryConfig prints the canary setup at startup
+func logCanaryConfig() {
+	if !canaryEnabled() {
+		return
+	}
+	serverLog.Info("Canary enabled", "percent", ytdlpCanaryPercent, "binary", ytdlpCanaryBinary,
+		"version", getToolVersion(ytdlpCanaryBinary, "--version"), "stable", getYtDlpVersion())
+}
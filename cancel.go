@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os/exec"
+	"sync"
+)
+
+// A job can be cancelled while it waits in the queue or downloads. Cancelling kills
+// the yt-dlp process group (including ffmpeg), the staging directory with the partial
+// files is removed as usual and the job ends with status "cancelled". Once the
+// download finished, post-processing runs to the end. A downloading job can also be
+// paused: its process group is stopped with SIGSTOP until it is resumed.
+
+var errJobCancelled = &downloadError{Code: "cancelled", Message: "Download abgebrochen"}
+
+var errNotCancellable = errors.New("Der Job läuft nicht mehr oder wird bereits nachbearbeitet")
+
+var (
+	errNotPausable      = errors.New("Nur laufende Downloads können pausiert werden")
+	errPauseUnsupported = errors.New("Pausieren wird auf diesem System nicht unterstützt")
+)
+
+// cancelState is a job that can still be cancelled
+type cancelState struct {
+	cmd       *exec.Cmd // Running yt-dlp process, if any
+	cancelled bool
+	paused    bool
+}
+
+var (
+	cancellableJobs = make(map[string]*cancelState) // Keyed by session ID
+	cancelMutex     sync.Mutex
+)
+
+// allowCancel makes a job cancellable until finishCancellable is called
+func allowCancel(sessionID string) {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	cancellableJobs[sessionID] = &cancelState{}
+}
+
+// finishCancellable ends the cancellable phase and reports whether the job was cancelled
+func finishCancellable(sessionID string) bool {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	state, ok := cancellableJobs[sessionID]
+	delete(cancellableJobs, sessionID)
+	return ok && state.cancelled
+}
+
+// isCancelled reports whether the job was cancelled
+func isCancelled(sessionID string) bool {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	state, ok := cancellableJobs[sessionID]
+	return ok && state.cancelled
+}
+
+// trackJobProcess registers the started yt-dlp process of a job; the returned
+// function unregisters it once the process exited
+func trackJobProcess(sessionID string, cmd *exec.Cmd) func() {
+	cancelMutex.Lock()
+	state, ok := cancellableJobs[sessionID]
+	if ok {
+		state.cmd = cmd
+	}
+	cancelled := ok && state.cancelled
+	cancelMutex.Unlock()
+
+	// Cancelled between the start of the job and the start of the process
+	if cancelled {
+		killProcessGroup(cmd)
+	}
+	return func() {
+		cancelMutex.Lock()
+		wasPaused := false
+		if state, ok := cancellableJobs[sessionID]; ok && state.cmd == cmd {
+			state.cmd = nil
+			wasPaused = state.paused
+			state.paused = false
+		}
+		cancelMutex.Unlock()
+
+		// Killed while paused, e.g. by a cancel
+		if wasPaused {
+			updateJob(sessionID, func(job *Job) { job.Paused = false })
+		}
+	}
+}
+
+// cancelJob stops a queued or downloading job
+func cancelJob(sessionID string) error {
+	if _, ok := getJob(sessionID); !ok {
+		return errJobNotFound
+	}
+
+	cancelMutex.Lock()
+	state, ok := cancellableJobs[sessionID]
+	if !ok {
+		cancelMutex.Unlock()
+		return errNotCancellable
+	}
+	alreadyCancelled := state.cancelled
+	state.cancelled = true
+	cmd := state.cmd
+	cancelMutex.Unlock()
+
+	if alreadyCancelled {
+		return nil
+	}
+	jobLogger(jobLog, sessionID, "cancel").Info("Cancelling job")
+	if cmd != nil {
+		if err := killProcessGroup(cmd); err != nil {
+			jobLog.Error("Failed to kill yt-dlp", "session", sessionID, "error", err)
+		}
+	}
+	// A queued job finishes right away instead of waiting for a worker
+	if run, ok := removeQueuedJob(sessionID); ok {
+		goGuarded("cancelled job", run)
+	}
+	return nil
+}
+
+// pauseJob stops or resumes the yt-dlp process of a downloading job
+func pauseJob(sessionID string, pause bool) error {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+
+	cancelMutex.Lock()
+	state, ok := cancellableJobs[sessionID]
+	if !ok || state.cmd == nil || state.cancelled {
+		cancelMutex.Unlock()
+		return errNotPausable
+	}
+	if state.paused == pause {
+		cancelMutex.Unlock()
+		return nil
+	}
+	var err error
+	if pause {
+		err = stopProcessGroup(state.cmd)
+	} else {
+		err = continueProcessGroup(state.cmd)
+	}
+	if err == nil {
+		state.paused = pause
+	}
+	cancelMutex.Unlock()
+
+	if errors.Is(err, errors.ErrUnsupported) {
+		return errPauseUnsupported
+	}
+	if err != nil {
+		jobLog.Error("Failed to pause or resume yt-dlp", "session", sessionID, "pause", pause, "error", err)
+		return err
+	}
+
+	status := "Download pausiert"
+	if !pause {
+		status = "Download wird fortgesetzt"
+	}
+	jobLog.Info(status, "session", sessionID)
+	updateJob(sessionID, func(job *Job) { job.Paused = pause })
+	publishEvent(LifecycleEvent{Type: EventJobProgress, SessionID: sessionID, Update: &ProgressUpdate{Progress: job.Progress, Status: status, Paused: pause}})
+	return nil
+}
+
+type cancelRequest struct {
+	SessionID string `json:"sessionId"`
+}
+
+// handleCancel cancels a job: POST /cancel with {"sessionId": "..."} and the session token.
+// POST /jobs/{id}/cancel does the same.
+func handleCancel(w http.ResponseWriter, r *http.Request) {
+	var body cancelRequest
+	if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+		return
+	}
+	if body.SessionID == "" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "sessionId fehlt"})
+		return
+	}
+	if !requireSessionOwner(w, r, body.SessionID) {
+		return
+	}
+
+	respondJobAction(w, cancelJob(body.SessionID))
+}
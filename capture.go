@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Capture mode records a fixed duration from a live stream (24/7 radio, lofi streams)
+// instead of downloading a finished video. yt-dlp hands the stream to ffmpeg, which
+// stops after the requested duration; a watchdog enforces the limit if ffmpeg does not.
+var maxCaptureMinutes = parseMaxCaptureMinutes(getenv("MAX_CAPTURE_MINUTES"))
+
+// captureGrace is the time on top of the capture duration for extraction and conversion
+const captureGrace = 5 * time.Minute
+
+var ffmpegTimePattern = regexp.MustCompile(`time=(\d+):(\d+):(\d+(?:\.\d+)?)`)
+
+func parseMaxCaptureMinutes(value string) int {
+	if value == "" {
+		return 180
+	}
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes <= 0 {
+		configLog.Warn("Invalid MAX_CAPTURE_MINUTES, using 180", "value", value)
+		return 180
+	}
+	return minutes
+}
+
+// validateCapture checks the capture options of a request, returning a user-facing message
+func validateCapture(req DownloadRequest) string {
+	if req.CaptureMinutes == 0 {
+		return ""
+	}
+	if req.CaptureMinutes < 0 || req.CaptureMinutes > maxCaptureMinutes {
+		return fmt.Sprintf("Aufnahmedauer muss zwischen 1 und %d Minuten liegen.", maxCaptureMinutes)
+	}
+	if !isAudioFormat(req.Format) {
+		return "Aufnahmen sind nur für Audioformate möglich."
+	}
+	return ""
+}
+
+// captureArgs limits the ffmpeg recording of a live stream to the requested duration
+func captureArgs(req DownloadRequest) []string {
+	seconds := req.CaptureMinutes * 60
+	return []string{
+		"--downloader", "ffmpeg",
+		"--downloader-args", fmt.Sprintf("ffmpeg:-t %d", seconds),
+	}
+}
+
+// startCaptureWatchdog kills the download, including the ffmpeg that records the stream
+// and holds the pipes open, once the capture duration plus grace is exceeded.
+// The returned function stops the watchdog.
+func startCaptureWatchdog(sessionID string, req DownloadRequest, cmd *exec.Cmd) func() bool {
+	limit := time.Duration(req.CaptureMinutes)*time.Minute + captureGrace
+	timer := time.AfterFunc(limit, func() {
+		jobLogger(ytdlpLog, sessionID, "download").Info("Capture exceeded its limit, stopping", "limit", limit.String())
+		appendJobLog(sessionID, fmt.Sprintf("[capture] stopped after %s", limit))
+		killProcessGroup(cmd)
+	})
+	return timer.Stop
+}
+
+// captureProgress maps ffmpeg's "time=" output to the 20-90% download range
+func captureProgress(line string, captureMinutes int) (int, float64, bool) {
+	match := ffmpegTimePattern.FindStringSubmatch(line)
+	if match == nil {
+		return 0, 0, false
+	}
+	hours, _ := strconv.ParseFloat(match[1], 64)
+	minutes, _ := strconv.ParseFloat(match[2], 64)
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	elapsed := hours*3600 + minutes*60 + seconds
+
+	progress := 20 + int(elapsed/float64(captureMinutes*60)*70)
+	if progress > 90 {
+		progress = 90
+	}
+	return progress, elapsed, true
+}
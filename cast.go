@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Casting plays completed downloads on Chromecast or DLNA renderers in the LAN.
+// The device fetches the file itself from a signed /preview/{id} URL, so it must be
+// able to reach this server: set CAST_BASE_URL (or PUBLIC_BASE_URL) to an address the TV can open.
+// Discovery uses multicast, which needs host networking when running in Docker.
+var (
+	castEnabled = getenv("CAST_ENABLED") == "true"
+	castBaseURL = strings.TrimSuffix(getenv("CAST_BASE_URL"), "/")
+	castLog     = componentLogger("cast")
+)
+
+// Device kinds
+const (
+	CastKindChromecast = "chromecast"
+	CastKindDLNA       = "dlna"
+)
+
+const (
+	castDiscoveryTimeout = 3 * time.Second
+	castDeviceTTL        = 5 * time.Minute // Cached devices are rediscovered after this
+)
+
+// CastDevice is a discovered renderer
+type CastDevice struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Kind       string    `json:"kind"`
+	Address    string    `json:"address"` // host:port of the device
+	ControlURL string    `json:"-"`       // DLNA AVTransport control endpoint
+	SeenAt     time.Time `json:"seenAt"`
+}
+
+var (
+	castDevices      = make(map[string]CastDevice)
+	castDevicesMutex sync.Mutex
+	castDiscoveredAt time.Time
+)
+
+// discoverCastDevices searches the LAN for Chromecast and DLNA renderers in parallel
+func discoverCastDevices() []CastDevice {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		devices []CastDevice
+	)
+	for kind, discover := range map[string]func(time.Duration) ([]CastDevice, error){
+		CastKindChromecast: discoverChromecasts,
+		CastKindDLNA:       discoverDLNARenderers,
+	} {
+		wg.Add(1)
+		go func(kind string, discover func(time.Duration) ([]CastDevice, error)) {
+			defer wg.Done()
+			found, err := discover(castDiscoveryTimeout)
+			if err != nil {
+				castLog.Warn("Discovery failed", "kind", kind, "error", err)
+			}
+			mu.Lock()
+			devices = append(devices, found...)
+			mu.Unlock()
+		}(kind, discover)
+	}
+	wg.Wait()
+
+	castDevicesMutex.Lock()
+	defer castDevicesMutex.Unlock()
+	now := time.Now()
+	for _, device := range devices {
+		device.SeenAt = now
+		castDevices[device.ID] = device
+	}
+	for id, device := range castDevices {
+		if now.Sub(device.SeenAt) > castDeviceTTL {
+			delete(castDevices, id)
+		}
+	}
+	castDiscoveredAt = now
+	castLog.Info("Discovery finished", "devices", len(devices))
+	return listCastDevicesLocked()
+}
+
+// listCastDevices returns cached devices, discovering them first if the cache is stale
+func listCastDevices(refresh bool) []CastDevice {
+	castDevicesMutex.Lock()
+	stale := refresh || time.Since(castDiscoveredAt) > castDeviceTTL
+	if !stale {
+		defer castDevicesMutex.Unlock()
+		return listCastDevicesLocked()
+	}
+	castDevicesMutex.Unlock()
+	return discoverCastDevices()
+}
+
+func listCastDevicesLocked() []CastDevice {
+	list := make([]CastDevice, 0, len(castDevices))
+	for _, device := range castDevices {
+		list = append(list, device)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// findCastDevice looks a device up by ID or (case-insensitive) name
+func findCastDevice(key string) (CastDevice, bool) {
+	for _, refresh := range []bool{false, true} {
+		for _, device := range listCastDevices(refresh) {
+			if device.ID == key || strings.EqualFold(device.Name, key) {
+				return device, true
+			}
+		}
+	}
+	return CastDevice{}, false
+}
+
+// castMediaURL builds the URL the device loads the job's file from
+func castMediaURL(jobID string, device CastDevice) (string, error) {
+	base := castBaseURL
+	if base == "" {
+		base = publicBaseURL
+	}
+	if base == "" {
+		// Use the local address the device would reach us on
+		host, _, err := net.SplitHostPort(device.Address)
+		if err != nil {
+			return "", err
+		}
+		conn, err := net.Dial("udp", net.JoinHostPort(host, "9"))
+		if err != nil {
+			return "", fmt.Errorf("no route to device: %v", err)
+		}
+		local := conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+		base = "http://" + net.JoinHostPort(local, serverPort) + basePath
+	}
+	return base + "/preview/" + url.PathEscape(jobID) + "?" + signPreviewQuery(jobID), nil
+}
+
+// handleCastDevices lists renderers: GET /cast/devices?refresh=true
+func handleCastDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !castEnabled {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Casting ist nicht aktiviert"})
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"devices": listCastDevices(r.URL.Query().Get("refresh") == "true"),
+	})
+}
+
+// handleCast plays a completed job on a device: POST /jobs/{id}/cast?device=
+func handleCast(w http.ResponseWriter, r *http.Request, jobID string) {
+	if !castEnabled {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Casting ist nicht aktiviert"})
+		return
+	}
+
+	job, ok := getJob(jobID)
+	if !ok || job.DeletedAt != nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Job nicht gefunden"})
+		return
+	}
+	if job.Status != JobStatusCompleted || job.Filename == "" {
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": "Download ist noch nicht abgeschlossen"})
+		return
+	}
+	contentType, ok := previewContentTypes[strings.ToLower(filepath.Ext(job.Filename))]
+	if !ok {
+		writeJSONStatus(w, http.StatusUnprocessableEntity, map[string]interface{}{"success": false, "message": "Dieses Format kann nicht gestreamt werden"})
+		return
+	}
+
+	device, ok := findCastDevice(r.URL.Query().Get("device"))
+	if !ok {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Gerät nicht gefunden"})
+		return
+	}
+
+	mediaURL, err := castMediaURL(jobID, device)
+	if err == nil {
+		title := filepath.Base(job.Filename)
+		if job.Metadata != nil && job.Metadata.Title != "" {
+			title = job.Metadata.Title
+		}
+		switch device.Kind {
+		case CastKindChromecast:
+			err = castToChromecast(device, mediaURL, contentType, title)
+		case CastKindDLNA:
+			err = castToDLNA(device, mediaURL, contentType, title)
+		default:
+			err = fmt.Errorf("unknown device kind %q", device.Kind)
+		}
+	}
+	if err != nil {
+		castLog.Error("Casting failed", "session", jobID, "device", device.Name, "error", err)
+		writeJSONStatus(w, http.StatusBadGateway, map[string]interface{}{"success": false, "message": "Wiedergabe auf dem Gerät fehlgeschlagen"})
+		return
+	}
+
+	castLog.Info("Playing", "session", jobID, "device", device.Name, "kind", device.Kind)
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "device": device, "mediaUrl": mediaURL})
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Chapter is a named time range, in the shape of yt-dlp's "chapters" info field
+type Chapter struct {
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Title     string  `json:"title"`
+}
+
+// Chapter sources recorded in VideoMetadata.ChapterSource
+const (
+	ChapterSourceYouTube     = "youtube"
+	ChapterSourceDescription = "description"
+	ChapterSourceComment     = "comment"
+)
+
+// YouTube's own rules for description chapters: at least three, starting at 0:00,
+// each at least ten seconds long
+const (
+	minInferredChapters  = 3
+	minChapterSeconds    = 10
+	commentsForChapters  = 20 // Top comments fetched when inferring chapters
+	maxChapterTitleChars = 100
+)
+
+// infoComment is the subset of a yt-dlp comment used for chapter inference
+type infoComment struct {
+	Text             string `json:"text"`
+	LikeCount        int    `json:"like_count"`
+	AuthorIsUploader bool   `json:"author_is_uploader"`
+}
+
+// chapterLinePattern matches "0:00 Intro", "[1:02:03] - Title", "12. 3:45 Title" and "Title 3:45"
+var (
+	chapterLinePattern     = regexp.MustCompile(`^\s*(?:\d+[.)]\s*)?[\[(]?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?\s*[-–—:|.]?\s*(.+?)\s*$`)
+	chapterTrailingPattern = regexp.MustCompile(`^\s*(.+?)\s*[-–—:|]?\s*[\[(]?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?\s*$`)
+)
+
+// commentArgs asks yt-dlp for the top comments, used when chapters should be inferred
+func commentArgs() []string {
+	return []string{
+		"--write-comments",
+		"--extractor-args", fmt.Sprintf("youtube:max_comments=%d,%d,0,0;comment_sort=top", commentsForChapters, commentsForChapters),
+	}
+}
+
+// parseChapterList extracts a timestamp list from free text. It returns nil unless the
+// list looks like real chapters: starts at 0:00, increases, and has enough entries.
+func parseChapterList(text string, duration float64) []Chapter {
+	var chapters []Chapter
+	for _, line := range strings.Split(text, "\n") {
+		var stamp, title string
+		if match := chapterLinePattern.FindStringSubmatch(line); match != nil {
+			stamp, title = match[1], match[2]
+		} else if match := chapterTrailingPattern.FindStringSubmatch(line); match != nil {
+			title, stamp = match[1], match[2]
+		} else {
+			continue
+		}
+
+		start, err := parseTimestamp(stamp)
+		if err != nil {
+			continue
+		}
+		title = strings.Trim(title, " -–—:|")
+		if title == "" {
+			continue
+		}
+		if len(chapters) > 0 && start <= chapters[len(chapters)-1].StartTime {
+			// Timestamps out of order are replies or song mentions, not a chapter list
+			return nil
+		}
+		chapters = append(chapters, Chapter{StartTime: start, Title: truncateString(title, maxChapterTitleChars)})
+	}
+
+	if len(chapters) < minInferredChapters || chapters[0].StartTime != 0 {
+		return nil
+	}
+	if duration > 0 && chapters[len(chapters)-1].StartTime >= duration {
+		return nil
+	}
+	for i := range chapters {
+		end := duration
+		if i+1 < len(chapters) {
+			end = chapters[i+1].StartTime
+		}
+		if end > 0 && end-chapters[i].StartTime < minChapterSeconds {
+			return nil
+		}
+		chapters[i].EndTime = end
+	}
+	return chapters
+}
+
+// inferChapters looks for a chapter list in the description, then in the comments,
+// preferring the uploader's comments and then the most liked ones
+func inferChapters(description string, comments []infoComment, duration float64) ([]Chapter, string) {
+	if chapters := parseChapterList(description, duration); chapters != nil {
+		return chapters, ChapterSourceDescription
+	}
+
+	var best []Chapter
+	bestScore := -1
+	for _, comment := range comments {
+		chapters := parseChapterList(comment.Text, duration)
+		if chapters == nil {
+			continue
+		}
+		if comment.AuthorIsUploader {
+			return chapters, ChapterSourceComment
+		}
+		if comment.LikeCount > bestScore {
+			best, bestScore = chapters, comment.LikeCount
+		}
+	}
+	if best != nil {
+		return best, ChapterSourceComment
+	}
+	return nil, ""
+}
+
+// sectionChapters moves the video's chapters into a downloaded section: they are shifted
+// to its start and cut at its end, chapters outside of it are dropped. The section is
+// given in video time, tempo is the playback speed the chapters were scaled to.
+func sectionChapters(chapters []Chapter, section MediaSection, tempo float64) []Chapter {
+	start, end := section.Start/tempo, section.End/tempo
+	var moved []Chapter
+	for _, chapter := range chapters {
+		if section.End > 0 {
+			chapter.EndTime = min(chapter.EndTime, end)
+		}
+		chapter.StartTime = max(chapter.StartTime, start) - start
+		chapter.EndTime -= start
+		if chapter.EndTime-chapter.StartTime >= 1 {
+			moved = append(moved, chapter)
+		}
+	}
+	return moved
+}
+
+// splitByChapters cuts the file at chapter boundaries and removes the original.
+// Parts are named like size/time splits and carry the chapter title as tag.
+func splitByChapters(mediaPath string, chapters []Chapter) ([]string, error) {
+	if len(chapters) < 2 {
+		return nil, fmt.Errorf("need at least two chapters to split")
+	}
+
+	ext := filepath.Ext(mediaPath)
+	base := strings.TrimSuffix(mediaPath, ext)
+
+	var names []string
+	for i, chapter := range chapters {
+		partPath := fmt.Sprintf("%s_part%03d%s", base, i+1, ext)
+		// Input seeking keeps the cut fast; -t is the chapter length from there
+		args := []string{"-v", "error", "-y", "-ss", fmt.Sprintf("%.3f", chapter.StartTime)}
+		if chapter.EndTime > chapter.StartTime {
+			args = append(args, "-t", fmt.Sprintf("%.3f", chapter.EndTime-chapter.StartTime))
+		}
+		args = append(args,
+			"-i", mediaPath,
+			"-map", "0",
+			"-c", "copy",
+			"-map_chapters", "-1",
+			"-metadata", "title="+chapter.Title,
+			"-metadata", fmt.Sprintf("track=%d/%d", i+1, len(chapters)),
+			partPath)
+
+		if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+			for _, name := range names {
+				os.Remove(filepath.Join(filepath.Dir(mediaPath), name))
+			}
+			return nil, fmt.Errorf("ffmpeg chapter split failed: %v: %s", err, truncateString(string(output), 500))
+		}
+		names = append(names, filepath.Base(partPath))
+	}
+
+	if err := os.Remove(mediaPath); err != nil {
+		splitLog.Warn("Could not remove original", "path", mediaPath, "error", err)
+	}
+	splitLog.Info("Split into chapters", "file", filepath.Base(mediaPath), "chapters", len(names))
+	return names, nil
+}
+
+// chapterContainers are the output extensions that can carry a chapter list
+var chapterContainers = map[string]bool{".mp4": true, ".m4a": true, ".mkv": true}
+
+var ffmetadataEscaper = strings.NewReplacer("\\", "\\\\", "=", "\\=", ";", "\\;", "#", "\\#", "\n", "\\\n")
+
+// chapterMetadata renders chapters in ffmpeg's FFMETADATA format
+func chapterMetadata(chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		end := chapter.EndTime
+		if end <= chapter.StartTime {
+			end = chapter.StartTime + minChapterSeconds
+		}
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(chapter.StartTime*1000), int64(end*1000), ffmetadataEscaper.Replace(chapter.Title))
+	}
+	return b.String()
+}
+
+// embedChapters writes the chapter list into the container in place, without re-encoding
+func embedChapters(mediaPath string, chapters []Chapter) error {
+	ext := filepath.Ext(mediaPath)
+	metaPath := strings.TrimSuffix(mediaPath, ext) + ".chapters.txt"
+	if err := os.WriteFile(metaPath, []byte(chapterMetadata(chapters)), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(metaPath)
+
+	tmpPath := strings.TrimSuffix(mediaPath, ext) + ".chapters" + ext
+	output, err := exec.Command("ffmpeg",
+		"-v", "error",
+		"-y",
+		"-i", mediaPath,
+		"-f", "ffmetadata",
+		"-i", metaPath,
+		"-map", "0",
+		"-map_metadata", "0",
+		"-map_chapters", "1",
+		"-c", "copy",
+		tmpPath).CombinedOutput()
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, truncateString(string(output), 500))
+	}
+	if err := syncFile(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, mediaPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Chromecasts are found via mDNS (_googlecast._tcp) and controlled with the CastV2
+// protocol: length-prefixed protobuf CastMessages over TLS. The few messages needed
+// are encoded by hand to avoid a protobuf dependency.
+
+const (
+	mdnsAddress          = "224.0.0.251:5353"
+	googlecastService    = "_googlecast._tcp.local."
+	defaultMediaReceiver = "CC1AD845" // Google's default media receiver app
+	castTimeout          = 15 * time.Second
+
+	castNamespaceConnection = "urn:x-cast:com.google.cast.tp.connection"
+	castNamespaceHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	castNamespaceReceiver   = "urn:x-cast:com.google.cast.receiver"
+	castNamespaceMedia      = "urn:x-cast:com.google.cast.media"
+)
+
+// DNS record types used by mDNS discovery
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+)
+
+// discoverChromecasts sends a one-shot mDNS query. Queries from a port other than
+// 5353 are answered by unicast, so no multicast group membership is needed.
+func discoverChromecasts(timeout time.Duration) ([]CastDevice, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	target, err := net.ResolveUDPAddr("udp4", mdnsAddress)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteTo(mdnsQuery(googlecastService, dnsTypePTR), target); err != nil {
+		return nil, err
+	}
+
+	type instance struct {
+		target, name, id string
+		port             int
+	}
+	instances := make(map[string]*instance)
+	addresses := make(map[string]string)
+	get := func(name string) *instance {
+		if instances[name] == nil {
+			instances[name] = &instance{}
+		}
+		return instances[name]
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break // Deadline reached
+		}
+		records, err := parseDNSRecords(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, rr := range records {
+			switch rr.Type {
+			case dnsTypePTR:
+				if strings.EqualFold(rr.Name, googlecastService) {
+					get(rr.Target)
+				}
+			case dnsTypeSRV:
+				inst := get(rr.Name)
+				inst.target, inst.port = rr.Target, rr.Port
+			case dnsTypeTXT:
+				inst := get(rr.Name)
+				for _, entry := range rr.Text {
+					if key, value, ok := strings.Cut(entry, "="); ok {
+						switch key {
+						case "fn":
+							inst.name = value
+						case "id":
+							inst.id = value
+						}
+					}
+				}
+			case dnsTypeA:
+				addresses[strings.ToLower(rr.Name)] = rr.IP.String()
+			}
+		}
+	}
+
+	var devices []CastDevice
+	for instanceName, inst := range instances {
+		ip := addresses[strings.ToLower(inst.target)]
+		if ip == "" || inst.port == 0 {
+			continue
+		}
+		device := CastDevice{
+			ID:      inst.id,
+			Name:    inst.name,
+			Kind:    CastKindChromecast,
+			Address: net.JoinHostPort(ip, fmt.Sprintf("%d", inst.port)),
+		}
+		if device.ID == "" {
+			device.ID = instanceName
+		}
+		if device.Name == "" {
+			device.Name = strings.TrimSuffix(instanceName, "."+googlecastService)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// mdnsQuery builds a DNS query packet with a single question
+func mdnsQuery(name string, qtype uint16) []byte {
+	packet := make([]byte, 12) // ID 0, no flags
+	binary.BigEndian.PutUint16(packet[4:], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		packet = append(packet, byte(len(label)))
+		packet = append(packet, label...)
+	}
+	packet = append(packet, 0)
+	packet = binary.BigEndian.AppendUint16(packet, qtype)
+	return binary.BigEndian.AppendUint16(packet, 1) // Class IN
+}
+
+// dnsRecord is a parsed resource record; only the fields of the record's type are set
+type dnsRecord struct {
+	Name   string
+	Type   uint16
+	Target string // PTR target or SRV host
+	Port   int    // SRV
+	Text   []string
+	IP     net.IP
+}
+
+var errDNSTruncated = errors.New("truncated DNS packet")
+
+// parseDNSRecords returns all answer, authority and additional records of a packet
+func parseDNSRecords(packet []byte) ([]dnsRecord, error) {
+	if len(packet) < 12 {
+		return nil, errDNSTruncated
+	}
+	questions := int(binary.BigEndian.Uint16(packet[4:]))
+	records := int(binary.BigEndian.Uint16(packet[6:])) +
+		int(binary.BigEndian.Uint16(packet[8:])) +
+		int(binary.BigEndian.Uint16(packet[10:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readDNSName(packet, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+
+	var result []dnsRecord
+	for i := 0; i < records; i++ {
+		name, next, err := readDNSName(packet, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(packet) {
+			return nil, errDNSTruncated
+		}
+		rr := dnsRecord{Name: name, Type: binary.BigEndian.Uint16(packet[next:])}
+		length := int(binary.BigEndian.Uint16(packet[next+8:]))
+		start := next + 10
+		if start+length > len(packet) {
+			return nil, errDNSTruncated
+		}
+		data := packet[start : start+length]
+
+		switch rr.Type {
+		case dnsTypePTR:
+			rr.Target, _, err = readDNSName(packet, start)
+		case dnsTypeSRV:
+			if length < 6 {
+				return nil, errDNSTruncated
+			}
+			rr.Port = int(binary.BigEndian.Uint16(data[4:]))
+			rr.Target, _, err = readDNSName(packet, start+6)
+		case dnsTypeTXT:
+			for j := 0; j < len(data); {
+				size := int(data[j])
+				if j+1+size > len(data) {
+					break
+				}
+				rr.Text = append(rr.Text, string(data[j+1:j+1+size]))
+				j += 1 + size
+			}
+		case dnsTypeA:
+			if length == 4 {
+				rr.IP = net.IP(append([]byte(nil), data...))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rr)
+		offset = start + length
+	}
+	return result, nil
+}
+
+// readDNSName decodes a possibly compressed name and returns the offset after it
+func readDNSName(packet []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; jumps < 32; {
+		if offset >= len(packet) {
+			return "", 0, errDNSTruncated
+		}
+		size := int(packet[offset])
+		switch {
+		case size == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case size&0xC0 == 0xC0:
+			if offset+1 >= len(packet) {
+				return "", 0, errDNSTruncated
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(packet[offset:]) & 0x3FFF)
+			jumps++
+		default:
+			if offset+1+size > len(packet) {
+				return "", 0, errDNSTruncated
+			}
+			labels = append(labels, string(packet[offset+1:offset+1+size]))
+			offset += 1 + size
+		}
+	}
+	return "", 0, errors.New("DNS name compression loop")
+}
+
+// castChannel is a CastV2 connection to a device
+type castChannel struct {
+	conn      net.Conn
+	requestID int
+}
+
+// send writes a CastMessage with a JSON payload
+func (c *castChannel) send(destination, namespace string, payload map[string]interface{}) error {
+	if _, ok := payload["requestId"]; !ok && payload["type"] != "CONNECT" && payload["type"] != "PONG" {
+		c.requestID++
+		payload["requestId"] = c.requestID
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// CastMessage fields: protocol_version, source_id, destination_id, namespace, payload_type, payload_utf8
+	var msg []byte
+	msg = append(msg, 0x08, 0x00)
+	msg = appendProtoString(msg, 2, "sender-0")
+	msg = appendProtoString(msg, 3, destination)
+	msg = appendProtoString(msg, 4, namespace)
+	msg = append(msg, 0x28, 0x00)
+	msg = appendProtoString(msg, 6, string(data))
+
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+	_, err = c.conn.Write(append(frame, msg...))
+	return err
+}
+
+// receive reads the next CastMessage and returns its namespace and JSON payload
+func (c *castChannel) receive() (string, map[string]interface{}, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return "", nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size > 64*1024 {
+		return "", nil, fmt.Errorf("cast message too large (%d bytes)", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(c.conn, msg); err != nil {
+		return "", nil, err
+	}
+
+	var namespace, payload string
+	for i := 0; i < len(msg); {
+		key, n := binary.Uvarint(msg[i:])
+		if n <= 0 {
+			return "", nil, errors.New("invalid cast message")
+		}
+		i += n
+		field, wireType := key>>3, key&7
+		switch wireType {
+		case 0:
+			_, n := binary.Uvarint(msg[i:])
+			if n <= 0 {
+				return "", nil, errors.New("invalid cast message")
+			}
+			i += n
+		case 2:
+			length, n := binary.Uvarint(msg[i:])
+			if n <= 0 || i+n+int(length) > len(msg) {
+				return "", nil, errors.New("invalid cast message")
+			}
+			value := string(msg[i+n : i+n+int(length)])
+			i += n + int(length)
+			switch field {
+			case 4:
+				namespace = value
+			case 6:
+				payload = value
+			}
+		default:
+			return "", nil, fmt.Errorf("unexpected wire type %d", wireType)
+		}
+	}
+
+	var data map[string]interface{}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &data); err != nil {
+			return namespace, nil, nil // Binary payloads are not used here
+		}
+	}
+	return namespace, data, nil
+}
+
+func appendProtoString(msg []byte, field int, value string) []byte {
+	msg = binary.AppendUvarint(msg, uint64(field<<3|2))
+	msg = binary.AppendUvarint(msg, uint64(len(value)))
+	return append(msg, value...)
+}
+
+// castToChromecast launches the default media receiver and loads the media URL
+func castToChromecast(device CastDevice, mediaURL, contentType, title string) error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	// Chromecasts use self-signed device certificates
+	conn, err := tls.DialWithDialer(dialer, "tcp", device.Address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(castTimeout))
+
+	c := &castChannel{conn: conn}
+	if err := c.send("receiver-0", castNamespaceConnection, map[string]interface{}{"type": "CONNECT"}); err != nil {
+		return err
+	}
+	if err := c.send("receiver-0", castNamespaceReceiver, map[string]interface{}{"type": "LAUNCH", "appId": defaultMediaReceiver}); err != nil {
+		return err
+	}
+
+	transportID := ""
+	for transportID == "" {
+		namespace, payload, err := c.receive()
+		if err != nil {
+			return fmt.Errorf("waiting for receiver: %v", err)
+		}
+		if c.answerPing(namespace, payload) {
+			continue
+		}
+		switch payload["type"] {
+		case "LAUNCH_ERROR":
+			return fmt.Errorf("launch failed: %v", payload["reason"])
+		case "RECEIVER_STATUS":
+			transportID = receiverTransportID(payload)
+		}
+	}
+
+	if err := c.send(transportID, castNamespaceConnection, map[string]interface{}{"type": "CONNECT"}); err != nil {
+		return err
+	}
+	err = c.send(transportID, castNamespaceMedia, map[string]interface{}{
+		"type":     "LOAD",
+		"autoplay": true,
+		"media": map[string]interface{}{
+			"contentId":   mediaURL,
+			"contentType": contentType,
+			"streamType":  "BUFFERED",
+			"metadata":    map[string]interface{}{"metadataType": 0, "title": title},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		namespace, payload, err := c.receive()
+		if err != nil {
+			return fmt.Errorf("waiting for media status: %v", err)
+		}
+		if c.answerPing(namespace, payload) || namespace != castNamespaceMedia {
+			continue
+		}
+		switch payload["type"] {
+		case "MEDIA_STATUS":
+			return nil // Playback continues after we disconnect
+		case "LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST":
+			return fmt.Errorf("device rejected media: %v", payload["type"])
+		}
+	}
+}
+
+// answerPing keeps the connection alive while waiting; it reports whether the message was a ping
+func (c *castChannel) answerPing(namespace string, payload map[string]interface{}) bool {
+	if namespace != castNamespaceHeartbeat {
+		return false
+	}
+	if payload["type"] == "PING" {
+		c.send("receiver-0", castNamespaceHeartbeat, map[string]interface{}{"type": "PONG"})
+	}
+	return true
+}
+
+// receiverTransportID finds the running default media receiver in a RECEIVER_STATUS message
+func receiverTransportID(payload map[string]interface{}) string {
+	status, _ := payload["status"].(map[string]interface{})
+	apps, _ := status["applications"].([]interface{})
+	for _, app := range apps {
+		entry, _ := app.(map[string]interface{})
+		if entry["appId"] == defaultMediaReceiver {
+			id, _ := entry["transportId"].(string)
+			return id
+		}
+	}
+	return ""
+}
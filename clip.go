@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ytdownloader/resolver"
+)
+
+// MediaSection is a time range of a video that is downloaded instead of the whole file
+type MediaSection struct {
+	Start float64 `json:"start"` // Seconds
+	End   float64 `json:"end"`   // Seconds, 0 = until the end of the video
+}
+
+// Timestamp is a position in a video for the start and end of a download, given as
+// seconds (90 or "90.5") or as "m:ss" or "h:mm:ss"
+type Timestamp string
+
+// UnmarshalJSON accepts a number as well as a string
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*t = Timestamp(strings.TrimSpace(text))
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("timestamp must be a number or a string")
+	}
+	*t = Timestamp(number.String())
+	return nil
+}
+
+// seconds parses the timestamp
+func (t Timestamp) seconds() (float64, bool) {
+	parts := strings.Split(string(t), ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+	total := 0.0
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+			return 0, false
+		}
+		// Only the seconds may have a fraction; minutes and seconds after a colon stay below 60
+		if i < len(parts)-1 && value != float64(int(value)) {
+			return 0, false
+		}
+		if i > 0 && value >= 60 {
+			return 0, false
+		}
+		total = total*60 + value
+	}
+	return total, true
+}
+
+// requestSection returns the range given by start and end, nil for the whole video
+func requestSection(req DownloadRequest) (*MediaSection, string) {
+	if req.Start == "" && req.End == "" {
+		return nil, ""
+	}
+	if resolver.IsClipURL(req.URL) {
+		return nil, "Start und Ende gibt es nicht für Clip-Links, der Clip legt den Bereich schon fest."
+	}
+	if req.CaptureMinutes > 0 {
+		return nil, "Start und Ende lassen sich nicht mit einer Live-Aufnahme kombinieren."
+	}
+
+	section := &MediaSection{}
+	if req.Start != "" {
+		start, ok := req.Start.seconds()
+		if !ok {
+			return nil, fmt.Sprintf("Ungültige Startzeit: %s", req.Start)
+		}
+		section.Start = start
+	}
+	if req.End != "" {
+		end, ok := req.End.seconds()
+		if !ok {
+			return nil, fmt.Sprintf("Ungültige Endzeit: %s", req.End)
+		}
+		if end <= section.Start {
+			return nil, "Das Ende muss nach dem Start liegen."
+		}
+		section.End = end
+	}
+	return section, ""
+}
+
+// clipInfo describes a youtube.com/clip/... link resolved to its parent video
+type clipInfo struct {
+	WatchURL string
+	Section  MediaSection
+	Title    string
+}
+
+var (
+	ogTitlePattern = regexp.MustCompile(`<meta\s+property="og:title"\s+content="([^"]*)"`)
+	clipPageClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// sectionArgs makes yt-dlp download only the given range, cutting exactly at its bounds
+func sectionArgs(section MediaSection) []string {
+	end := "inf"
+	if section.End > 0 {
+		end = fmt.Sprintf("%.3f", section.End)
+	}
+	return []string{
+		"--download-sections", fmt.Sprintf("*%.3f-%s", section.Start, end),
+		"--force-keyframes-at-cuts",
+	}
+}
+
+// resolveClip asks yt-dlp for the parent video and time range of a clip.
+// yt-dlp reports the clip as the parent video plus section_start/section_end.
+// Note: the clip ID may replace the video ID in "id", so "display_id" is the fallback.
+func resolveClip(clipURL, ytdlp string) (*clipInfo, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(ytdlp,
+		"--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"--no-warnings",
+		"--skip-download",
+		"--dump-single-json",
+		clipURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, classifyYtDlpError(stderr.String()).downloadError()
+	}
+
+	var info struct {
+		WebpageURL   string  `json:"webpage_url"`
+		DisplayID    string  `json:"display_id"`
+		Title        string  `json:"title"`
+		SectionStart float64 `json:"section_start"`
+		SectionEnd   float64 `json:"section_end"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return nil, fmt.Errorf("Clip-Informationen konnten nicht gelesen werden")
+	}
+	if info.SectionEnd <= info.SectionStart {
+		return nil, fmt.Errorf("Clip enthält keinen gültigen Zeitbereich")
+	}
+
+	watchURL, ok := resolver.Canonical(info.WebpageURL)
+	if !ok || resolver.IsClipURL(watchURL) {
+		if info.DisplayID == "" {
+			return nil, fmt.Errorf("Originalvideo des Clips nicht gefunden")
+		}
+		watchURL = "https://www.youtube.com/watch?v=" + url.QueryEscape(info.DisplayID)
+	}
+
+	clip := &clipInfo{
+		WatchURL: watchURL,
+		Section:  MediaSection{Start: info.SectionStart, End: info.SectionEnd},
+		Title:    fetchClipTitle(clipURL),
+	}
+	if clip.Title == "" && info.Title != "" {
+		clip.Title = info.Title + " (Clip)"
+	}
+	return clip, nil
+}
+
+// fetchClipTitle reads the clip's own title from its page; yt-dlp only knows the video title
+func fetchClipTitle(clipURL string) string {
+	req, err := http.NewRequest(http.MethodGet, clipURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("Accept-Language", "en")
+
+	resp, err := clipPageClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	if err != nil {
+		return ""
+	}
+	match := ogTitlePattern.FindSubmatch(page)
+	if match == nil {
+		return ""
+	}
+	title := strings.TrimSpace(html.UnescapeString(string(match[1])))
+	return strings.TrimSpace(strings.TrimPrefix(title, "✂️"))
+}
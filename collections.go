@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Collections are named subdirectories of the downloads ("Workout", "Kids", ...).
+// Their definitions are kept in collectionsFile so they survive restarts.
+var collectionsFile = metadataDir + "/collections.json"
+
+const (
+	maxCollectionNameLen  = 64
+	maxCollections        = 100
+	maxCollectionBodySize = 4 << 10
+)
+
+// Collection is a saved output folder with optional defaults for its downloads
+type Collection struct {
+	Name      string            `json:"name"`
+	Dir       string            `json:"dir"`                // Subdirectory of ./downloads
+	Template  string            `json:"template,omitempty"` // Filename template, e.g. "{uploader} - {title}"
+	Format    string            `json:"format,omitempty"`   // Used when a request has no format
+	Preset    *CollectionPreset `json:"preset,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// CollectionPreset lists post-processing steps always enabled for a collection
+type CollectionPreset struct {
+	Waveform      bool    `json:"waveform,omitempty"`
+	TrimSilence   bool    `json:"trimSilence,omitempty"`
+	Lyrics        bool    `json:"lyrics,omitempty"`
+	MusicBrainz   bool    `json:"musicbrainz,omitempty"`
+	SmartTitle    bool    `json:"smartTitle,omitempty"`
+	Transcribe    bool    `json:"transcribe,omitempty"`
+	Summarize     bool    `json:"summarize,omitempty"`
+	SplitMinutes  int     `json:"splitMinutes,omitempty"`
+	InferChapters bool    `json:"inferChapters,omitempty"`
+	SplitChapters bool    `json:"splitChapters,omitempty"`
+	SampleRate    int     `json:"sampleRate,omitempty"`
+	Channels      int     `json:"channels,omitempty"`
+	Tempo         float64 `json:"tempo,omitempty"`
+	AudioPreset   string  `json:"audioPreset,omitempty"`
+}
+
+// collectionSettings is the body to create or update a collection
+type collectionSettings struct {
+	Name     string            `json:"name"`
+	Template string            `json:"template"`
+	Format   string            `json:"format"`
+	Preset   *CollectionPreset `json:"preset"`
+}
+
+// templateFields are the placeholders available in collection filename templates
+var templateFields = []string{"{title}", "{uploader}", "{channel}", "{artist}", "{track}", "{album}", "{id}", "{date}", "{language}", "{format}"}
+
+var (
+	collections      = loadCollections() // By lowercased name
+	collectionsMutex sync.RWMutex
+	collectionsLog   = componentLogger("collections")
+)
+
+func loadCollections() map[string]*Collection {
+	loaded := make(map[string]*Collection)
+	data, err := os.ReadFile(collectionsFile)
+	if err != nil {
+		return loaded
+	}
+	var list []*Collection
+	if err := json.Unmarshal(data, &list); err != nil {
+		configLog.Warn("Could not read collections", "path", collectionsFile, "error", err)
+		return loaded
+	}
+	for _, collection := range list {
+		loaded[strings.ToLower(collection.Name)] = collection
+	}
+	return loaded
+}
+
+// saveCollections writes the definitions atomically; callers hold collectionsMutex
+func saveCollections() error {
+	data, err := json.MarshalIndent(listCollectionsLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(metadataDir, 0755); err != nil {
+		return err
+	}
+	tmp := collectionsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, collectionsFile)
+}
+
+func listCollectionsLocked() []*Collection {
+	list := make([]*Collection, 0, len(collections))
+	for _, collection := range collections {
+		list = append(list, collection)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// collectionDirName turns a collection name into a safe directory name
+func collectionDirName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("Name der Sammlung fehlt")
+	}
+	if len(name) > maxCollectionNameLen {
+		return "", fmt.Errorf("Name der Sammlung ist zu lang (max. %d Zeichen)", maxCollectionNameLen)
+	}
+	dir := sanitizeFilename(pathSeparators.Replace(name))
+	// Hidden names would clash with .meta, .staging and .trash
+	dir = strings.TrimLeft(dir, ".")
+	if dir == "" {
+		return "", fmt.Errorf("Ungültiger Name der Sammlung")
+	}
+	return dir, nil
+}
+
+// getCollection looks up a collection by name (case-insensitive)
+func getCollection(name string) (Collection, bool) {
+	collectionsMutex.RLock()
+	defer collectionsMutex.RUnlock()
+
+	collection, ok := collections[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Collection{}, false
+	}
+	return *collection, true
+}
+
+// isCollectionDir reports whether dir is a servable collection folder: one visible
+// level below ./downloads. Folders of deleted collections stay servable.
+func isCollectionDir(dir string) bool {
+	if dir == "" || strings.ContainsAny(dir, "/\\") || strings.HasPrefix(dir, ".") {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(downloadsDir, dir))
+	return err == nil && info.IsDir()
+}
+
+// collectionOutputDir validates the collection of a request and makes sure its folder exists.
+// It returns the directory relative to ./downloads ("" without collection).
+func collectionOutputDir(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	collection, ok := getCollection(name)
+	if !ok {
+		return "", fmt.Errorf("Sammlung %q existiert nicht", name)
+	}
+	if err := os.MkdirAll(filepath.Join(downloadsDir, collection.Dir), 0755); err != nil {
+		return "", fmt.Errorf("Ordner der Sammlung konnte nicht erstellt werden: %v", err)
+	}
+	return collection.Dir, nil
+}
+
+// downloadPath resolves a filename from the job store (optionally "<collection>/<file>")
+// inside ./downloads; it can never point outside of it
+func downloadPath(name string) string {
+	return filepath.Join(downloadsDir, filepath.Clean("/"+name))
+}
+
+// handleCollections lists (GET) or creates (POST {"name": "..."}) collections: /collections
+func handleCollections(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		collectionsMutex.RLock()
+		list := listCollectionsLocked()
+		collectionsMutex.RUnlock()
+		writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "collections": list})
+	case http.MethodPost:
+		createCollection(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func createCollection(w http.ResponseWriter, r *http.Request) {
+	var body collectionSettings
+	if reqErr := decodeJSONBody(w, r, &body, maxCollectionBodySize); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+		return
+	}
+	dir, err := collectionDirName(body.Name)
+	if err == nil {
+		err = validateCollectionSettings(body)
+	}
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": err.Error()})
+		return
+	}
+
+	collectionsMutex.Lock()
+	defer collectionsMutex.Unlock()
+
+	key := strings.ToLower(strings.TrimSpace(body.Name))
+	if _, exists := collections[key]; exists {
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": "Sammlung existiert bereits"})
+		return
+	}
+	for _, existing := range collections {
+		if strings.EqualFold(existing.Dir, dir) {
+			writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": "Eine Sammlung mit diesem Ordner existiert bereits"})
+			return
+		}
+	}
+	if len(collections) >= maxCollections {
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": "Zu viele Sammlungen"})
+		return
+	}
+	if err := os.MkdirAll(filepath.Join(downloadsDir, dir), 0755); err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Ordner konnte nicht erstellt werden"})
+		return
+	}
+
+	collection := &Collection{
+		Name:      strings.TrimSpace(body.Name),
+		Dir:       dir,
+		Template:  body.Template,
+		Format:    body.Format,
+		Preset:    body.Preset,
+		CreatedAt: time.Now(),
+	}
+	collections[key] = collection
+	if err := saveCollections(); err != nil {
+		collectionsLog.Error("Could not save collections", "path", collectionsFile, "error", err)
+	}
+	collectionsLog.Info("Created collection", "name", collection.Name, "dir", dir)
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "collection": collection})
+}
+
+// handleCollection updates (PUT) or removes (DELETE) a collection: /collections/{name}
+// Deleting only removes the definition; the folder and its files are kept.
+func handleCollection(w http.ResponseWriter, r *http.Request) {
+	key := strings.ToLower(pathParam(r, "name"))
+	switch r.Method {
+	case http.MethodPut:
+		updateCollection(w, r, key)
+		return
+	case http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	collectionsMutex.Lock()
+	defer collectionsMutex.Unlock()
+
+	if _, ok := collections[key]; !ok {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Sammlung nicht gefunden"})
+		return
+	}
+	delete(collections, key)
+	if err := saveCollections(); err != nil {
+		collectionsLog.Error("Could not save collections", "path", collectionsFile, "error", err)
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// updateCollection replaces template, format and preset; name and folder stay unchanged
+func updateCollection(w http.ResponseWriter, r *http.Request, key string) {
+	var body collectionSettings
+	if reqErr := decodeJSONBody(w, r, &body, maxCollectionBodySize); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+		return
+	}
+	if err := validateCollectionSettings(body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": err.Error()})
+		return
+	}
+
+	collectionsMutex.Lock()
+	defer collectionsMutex.Unlock()
+
+	collection, ok := collections[key]
+	if !ok {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Sammlung nicht gefunden"})
+		return
+	}
+	collection.Template = body.Template
+	collection.Format = body.Format
+	collection.Preset = body.Preset
+	if err := saveCollections(); err != nil {
+		collectionsLog.Error("Could not save collections", "path", collectionsFile, "error", err)
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "collection": collection})
+}
+
+func validateCollectionSettings(settings collectionSettings) error {
+	if settings.Format != "" && !validFormats[settings.Format] {
+		return fmt.Errorf("Ungültiges Standardformat")
+	}
+	if settings.Template != "" {
+		// The template names a file in the collection's folder, never a path
+		if strings.ContainsAny(settings.Template, "/\\") || strings.Contains(settings.Template, "..") {
+			return fmt.Errorf("Der Dateiname darf weder / noch \\ noch .. enthalten")
+		}
+		rendered := settings.Template
+		for _, field := range templateFields {
+			rendered = strings.ReplaceAll(rendered, field, "")
+		}
+		if strings.ContainsAny(rendered, "{}") {
+			return fmt.Errorf("Unbekannter Platzhalter im Dateinamen, erlaubt sind %s", strings.Join(templateFields, ", "))
+		}
+	}
+	return nil
+}
+
+// applyCollectionDefaults fills in the collection's default format and enables its preset
+func applyCollectionDefaults(req DownloadRequest) DownloadRequest {
+	collection, ok := getCollection(req.Collection)
+	if !ok {
+		return req
+	}
+	if req.Format == "" {
+		req.Format = collection.Format
+	}
+	if preset := collection.Preset; preset != nil {
+		req.TrimSilence = req.TrimSilence || preset.TrimSilence
+		req.Lyrics = req.Lyrics || preset.Lyrics
+		req.MusicBrainz = req.MusicBrainz || preset.MusicBrainz
+		req.SmartTitle = req.SmartTitle || preset.SmartTitle
+		// A request listing its steps leaves out the steps of the preset
+		if len(req.Steps) == 0 {
+			req.Waveform = req.Waveform || preset.Waveform
+			req.Transcribe = req.Transcribe || preset.Transcribe
+			req.Summarize = req.Summarize || preset.Summarize
+		}
+		req.InferChapters = req.InferChapters || preset.InferChapters
+		req.SplitChapters = req.SplitChapters || preset.SplitChapters
+		if req.SplitMinutes == 0 {
+			req.SplitMinutes = preset.SplitMinutes
+		}
+		if req.SampleRate == 0 {
+			req.SampleRate = preset.SampleRate
+		}
+		if req.Channels == 0 {
+			req.Channels = preset.Channels
+		}
+		if req.Tempo == 0 {
+			req.Tempo = preset.Tempo
+		}
+		if req.AudioPreset == "" {
+			req.AudioPreset = preset.AudioPreset
+		}
+	}
+	return req
+}
+
+// collectionFilename renders the collection's filename template, "" if there is none
+func collectionFilename(collectionName string, metadata *VideoMetadata, format, ext string) string {
+	collection, ok := getCollection(collectionName)
+	if !ok || collection.Template == "" || metadata == nil {
+		return ""
+	}
+
+	value := func(s string) string {
+		return sanitizeFilename(pathSeparators.Replace(s))
+	}
+	replacer := strings.NewReplacer(
+		"{title}", value(metadata.Title),
+		"{uploader}", value(metadata.Uploader),
+		"{channel}", value(metadata.Channel),
+		"{artist}", value(metadata.Artist),
+		"{track}", value(metadata.Track),
+		"{album}", value(metadata.Album),
+		"{id}", value(metadata.ID),
+		"{date}", value(metadata.UploadDate),
+		"{language}", value(metadata.Language),
+		"{format}", format,
+	)
+	name := sanitizeFilename(pathSeparators.Replace(replacer.Replace(collection.Template)))
+	if name == "" {
+		return ""
+	}
+	return name + ext
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Filename collision strategies, configured globally via FILENAME_COLLISION
+const (
+	CollisionSuffix    = "suffix"    // "Title-1.mp3", "Title-2.mp3", ...
+	CollisionKeepBoth  = "keep-both" // "Title [videoID].mp3"
+	CollisionOverwrite = "overwrite" // Replace the existing file
+	CollisionFail      = "fail"      // Fail the download
+)
+
+// maxCollisionAttempts bounds the suffix search
+const maxCollisionAttempts = 1000
+
+var collisionStrategy = parseCollisionStrategy(getenv("FILENAME_COLLISION"))
+
+var errFileExists = &downloadError{
+	Code:    "file_exists",
+	Message: "Eine Datei mit diesem Namen existiert bereits",
+}
+
+func parseCollisionStrategy(value string) string {
+	switch strategy := strings.ToLower(strings.TrimSpace(value)); strategy {
+	case CollisionSuffix, CollisionKeepBoth, CollisionOverwrite, CollisionFail:
+		return strategy
+	case "":
+		return CollisionSuffix
+	default:
+		configLog.Warn("Unknown FILENAME_COLLISION", "value", value, "using", CollisionSuffix)
+		return CollisionSuffix
+	}
+}
+
+// placeFile moves srcPath to dir/name according to the collision strategy and returns the final name.
+// Targets are claimed with a hard link, so concurrent jobs can never overwrite each other's files.
+func placeFile(srcPath, dir, name, videoID string) (string, error) {
+	target := filepath.Join(dir, name)
+	if filepath.Clean(srcPath) == filepath.Clean(target) {
+		return name, nil
+	}
+	if collisionStrategy == CollisionOverwrite {
+		return name, os.Rename(srcPath, target)
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for attempt := 0; attempt < maxCollisionAttempts; attempt++ {
+		candidate := collisionCandidate(base, ext, videoID, attempt)
+		err := claimPath(srcPath, filepath.Join(dir, candidate))
+		if err == nil {
+			if attempt > 0 {
+				fileLog.Info("File already exists, stored under another name", "file", name, "name", candidate)
+			}
+			return candidate, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+		if collisionStrategy == CollisionFail {
+			return "", errFileExists
+		}
+	}
+	return "", errFileExists
+}
+
+// collisionCandidate returns the name to try for the given attempt; attempt 0 is the plain name
+func collisionCandidate(base, ext, videoID string, attempt int) string {
+	if attempt == 0 {
+		return base + ext
+	}
+	if collisionStrategy == CollisionKeepBoth && videoID != "" {
+		if attempt == 1 {
+			return fmt.Sprintf("%s [%s]%s", base, videoID, ext)
+		}
+		return fmt.Sprintf("%s [%s]-%d%s", base, videoID, attempt-1, ext)
+	}
+	return fmt.Sprintf("%s-%d%s", base, attempt, ext)
+}
+
+// claimPath moves src to dst only if dst does not exist yet
+func claimPath(src, dst string) error {
+	if err := os.Link(src, dst); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		// Filesystems without hard links: best effort check before renaming
+		if _, statErr := os.Stat(dst); statErr == nil {
+			return fs.ErrExist
+		}
+		return os.Rename(src, dst)
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings come from three layers, each overriding the one before: an optional YAML
+// config file (CONFIG_FILE or -config), the environment and command line flags. The
+// file covers the common settings by name and takes any other variable from
+// .env.example under "env":
+//
+//	port: 8080
+//	downloadsDir: /srv/downloads
+//	slackWebhookUrl: https://hooks.slack.com/services/...
+//	jobRetention: 24h
+//	maxConcurrentDownloads: 2
+//	ytdlpBinary: /usr/local/bin/yt-dlp
+//	formats: [mp3, m4a]
+//	env:
+//	  TRASH_RETENTION_DAYS: 7
+//
+// Flags exist for the same settings (see -help), -set KEY=VALUE sets any other. Empty
+// environment variables don't override the file, as docker compose passes unset
+// variables on as empty ones. All settings are read through getenv.
+var settings = loadSettings()
+
+// downloadsDir holds the finished files and, in hidden directories, the job store,
+// staging and trash
+var downloadsDir = getEnvDefault("DOWNLOADS_DIR", "./downloads")
+
+// Config is the schema of the config file
+type Config struct {
+	Port                   string            `yaml:"port"`
+	DownloadsDir           string            `yaml:"downloadsDir"`
+	SlackWebhookURL        string            `yaml:"slackWebhookUrl"`
+	JobRetention           string            `yaml:"jobRetention"`
+	JobHistoryRetention    string            `yaml:"jobHistoryRetention"`
+	TrashRetentionDays     string            `yaml:"trashRetentionDays"`
+	MaxConcurrentDownloads string            `yaml:"maxConcurrentDownloads"`
+	YtDlpBinary            string            `yaml:"ytdlpBinary"`
+	Formats                []string          `yaml:"formats"`
+	Env                    map[string]string `yaml:"env"`
+}
+
+// configSetting is a setting with its own field in the file and its own flag
+type configSetting struct {
+	key   string // Environment variable
+	flag  string
+	usage string
+	field func(*Config) string
+}
+
+var configSettings = []configSetting{
+	{"PORT", "port", "HTTP port", func(c *Config) string { return c.Port }},
+	{"DOWNLOADS_DIR", "downloads-dir", "directory for finished downloads and metadata", func(c *Config) string { return c.DownloadsDir }},
+	{"SLACK_WEBHOOK_URL", "", "", func(c *Config) string { return c.SlackWebhookURL }}, // No flag, arguments show up in ps
+	{"JOB_RETENTION", "job-retention", "how long finished jobs stay in memory", func(c *Config) string { return c.JobRetention }},
+	{"JOB_HISTORY_RETENTION", "job-history-retention", "how long jobs stay in the history", func(c *Config) string { return c.JobHistoryRetention }},
+	{"TRASH_RETENTION_DAYS", "trash-retention-days", "days deleted jobs stay in the trash", func(c *Config) string { return c.TrashRetentionDays }},
+	{"MAX_CONCURRENT_DOWNLOADS", "max-concurrent-downloads", "downloads running at the same time", func(c *Config) string { return c.MaxConcurrentDownloads }},
+	{"YTDLP_BINARY", "ytdlp", "path of the yt-dlp binary", func(c *Config) string { return c.YtDlpBinary }},
+	{"ALLOWED_FORMATS", "formats", "comma-separated formats downloads may request", func(c *Config) string { return strings.Join(c.Formats, ",") }},
+}
+
+// settingLayers are the values from the config file and the flags, keyed by variable
+type settingLayers struct {
+	file     map[string]string
+	flags    map[string]string
+	filePath string
+	flagSet  *flag.FlagSet
+	flagErr  error // Reported by checkCommandLine
+}
+
+// getenv returns a setting from the flags, the environment or the config file
+func getenv(key string) string {
+	if value, ok := settings.flags[key]; ok {
+		return value
+	}
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return settings.file[key]
+}
+
+// loadSettings parses the flags and reads the config file. It runs before the logger
+// exists, so a broken config file goes straight to stderr and ends the process. Flag
+// errors wait for main: the end-to-end tests run the test binary as a yt-dlp stub.
+func loadSettings() settingLayers {
+	layers := settingLayers{file: map[string]string{}, flags: map[string]string{}}
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	layers.flagSet = flags
+	configPath := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	flagKeys := make(map[string]string) // Flag name to variable
+	for _, setting := range configSettings {
+		if setting.flag != "" {
+			flags.String(setting.flag, "", setting.usage+" ("+setting.key+")")
+			flagKeys[setting.flag] = setting.key
+		}
+	}
+	flags.Func("set", "any other setting as KEY=VALUE, repeatable", func(value string) error {
+		key, setting, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("expected KEY=VALUE")
+		}
+		layers.flags[strings.ToUpper(key)] = setting
+		return nil
+	})
+	layers.flagErr = flags.Parse(commandLineArgs())
+	flags.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			layers.flags[key] = f.Value.String()
+		}
+	})
+
+	if *configPath == "" {
+		return layers
+	}
+	file, err := readConfigFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read config file %s: %v\n", *configPath, err)
+		os.Exit(1)
+	}
+	layers.file, layers.filePath = file, *configPath
+	return layers
+}
+
+// commandLineArgs are the program arguments without the flags of go test
+func commandLineArgs() []string {
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if !strings.HasPrefix(arg, "-test.") {
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// readConfigFile reads the file into settings keyed by environment variable
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var config Config
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true) // A typo should not silently fall back to a default
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	file := make(map[string]string, len(config.Env)+len(configSettings))
+	for key, value := range config.Env {
+		file[strings.ToUpper(key)] = value
+	}
+	for _, setting := range configSettings {
+		if value := setting.field(&config); value != "" {
+			file[setting.key] = value
+		}
+	}
+	return file, nil
+}
+
+// checkCommandLine ends the process on invalid flags and prints the usage for -help
+func checkCommandLine() {
+	if settings.flagErr == nil {
+		return
+	}
+	settings.flagSet.SetOutput(os.Stderr)
+	if errors.Is(settings.flagErr, flag.ErrHelp) {
+		settings.flagSet.Usage()
+		os.Exit(0)
+	}
+	fmt.Fprintln(os.Stderr, settings.flagErr)
+	settings.flagSet.Usage()
+	os.Exit(2)
+}
+
+func logConfigSource() {
+	if settings.filePath == "" && len(settings.flags) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(settings.flags))
+	for key := range settings.flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	configLog.Info("Settings loaded", "file", settings.filePath, "fileSettings", len(settings.file), "flags", strings.Join(keys, ","))
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local jobs run files that are already on the server (inbox, uploads) through the
+// same conversion, post-processing and serving steps as YouTube downloads.
+
+var convertLog = componentLogger("convert")
+
+// ChannelLocal marks jobs that were not downloaded with yt-dlp
+const ChannelLocal = "local"
+
+// maxUploadBytes limits files sent to /convert (MAX_UPLOAD_MB, default 2048)
+var maxUploadBytes = parseMaxUploadMB(getenv("MAX_UPLOAD_MB")) << 20
+
+func parseMaxUploadMB(value string) int64 {
+	if value == "" {
+		return 2048
+	}
+	mb, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || mb <= 0 {
+		configLog.Warn("Invalid MAX_UPLOAD_MB, using 2048", "value", value)
+		return 2048
+	}
+	return mb
+}
+
+// localEncoderArgs are the ffmpeg output options per target format, matching the
+// quality yt-dlp uses for downloads
+var localEncoderArgs = map[string][]string{
+	"mp3":  {"-vn", "-c:a", "libmp3lame", "-q:a", "0"},
+	"m4a":  {"-vn", "-c:a", "aac", "-b:a", "256k"},
+	"wav":  {"-vn", "-c:a", "pcm_s16le"},
+	"flac": {"-vn", "-c:a", "flac"},
+	"opus": {"-vn", "-c:a", "libopus", "-b:a", "160k"},
+	"ogg":  {"-vn", "-c:a", "libvorbis", "-q:a", "6"},
+	"mp4":  {"-c:v", "libx264", "-preset", "medium", "-crf", "20", "-c:a", "aac", "-b:a", "192k", "-movflags", "+faststart"},
+	"webm": {"-c:v", "libvpx-vp9", "-crf", "32", "-b:v", "0", "-c:a", "libopus", "-b:a", "160k"},
+	"mkv":  {"-c:v", "libx264", "-preset", "medium", "-crf", "20", "-c:a", "aac", "-b:a", "192k"},
+}
+
+// localRemuxArgs are tried before re-encoding for containers most streams fit into
+var localRemuxArgs = map[string][]string{
+	"mp4": {"-c", "copy", "-movflags", "+faststart"},
+	"mkv": {"-c", "copy"},
+}
+
+// startLocalJob registers a job for a local file and converts it in the background.
+// source is shown as the job URL, e.g. "inbox:talks/lecture.mkv".
+func startLocalJob(srcPath, source string, req DownloadRequest, user string, onDone func(job Job)) string {
+	sessionID := fmt.Sprintf("%d", time.Now().UnixNano())
+	createJob(sessionID, source, req.Format, ChannelLocal, "")
+
+	runJob(sessionID, req, user, onDone, func() (string, error) {
+		return convertLocalFile(sessionID, req, srcPath)
+	})
+	return sessionID
+}
+
+// convertLocalFile converts srcPath into the requested format in the job's staging dir
+// and moves the result into ./downloads. The source file is left untouched.
+func convertLocalFile(sessionID string, req DownloadRequest, srcPath string) (string, error) {
+	stagingDir := jobStagingDir(sessionID)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return "", fmt.Errorf("Fehler beim Erstellen des Download-Verzeichnisses: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	sendProgress(sessionID, 10, "Datei wird analysiert...")
+	duration, err := probeDuration(srcPath)
+	if err != nil {
+		return "", &downloadError{Code: "invalid_media", Message: "Die Datei enthält keine lesbaren Medien"}
+	}
+
+	base := strings.TrimSuffix(filepath.Base(srcPath), filepath.Ext(srcPath))
+	updateJob(sessionID, func(job *Job) {
+		job.Metadata = &VideoMetadata{Title: base, Duration: duration}
+	})
+
+	ext := "." + req.Format
+	outPath := filepath.Join(stagingDir, "output"+ext)
+
+	sendProgress(sessionID, 20, "Wird konvertiert...")
+	// A remux is enough when the streams already fit into the container
+	remuxArgs, remux := localRemuxArgs[req.Format]
+	if remux {
+		err = runLocalFFmpeg(sessionID, srcPath, outPath, duration, remuxArgs)
+		if err != nil {
+			jobLogger(convertLog, sessionID, "convert").Warn("Remux failed, re-encoding", "error", err)
+			sendWarning(sessionID, WarningRemuxFailed)
+		}
+	}
+	if !remux || err != nil {
+		args := append([]string(nil), localEncoderArgs[req.Format]...)
+		if voiceArgs, ok := voiceEncoderArgs["."+req.Format]; ok && req.AudioPreset == AudioPresetVoice {
+			args = append([]string{"-vn"}, voiceArgs...)
+		}
+		if audioArgs := audioOutputArgs(req); audioArgs != "" {
+			args = append(args, strings.Fields(audioArgs)...)
+		}
+		if err := runLocalFFmpeg(sessionID, srcPath, outPath, duration, args); err != nil {
+			jobLogger(convertLog, sessionID, "convert").Error("Conversion failed", "error", err)
+			return "", &downloadError{Code: "conversion_failed", Message: "Konvertierung fehlgeschlagen"}
+		}
+	}
+	if err := syncFile(outPath); err != nil {
+		return "", fmt.Errorf("Fehler beim Speichern der Datei: %v", err)
+	}
+	sendProgress(sessionID, 90, "Konvertierung abgeschlossen, finalisiere...")
+
+	name := sanitizeFilename(base) + ext
+	job, _ := getJob(sessionID)
+	if templated := collectionFilename(req.Collection, job.Metadata, req.Format, ext); templated != "" {
+		name = templated
+	}
+	return publishStagedFile(sessionID, req, outPath, name)
+}
+
+// runLocalFFmpeg runs one ffmpeg conversion and maps its progress to 20-90%
+func runLocalFFmpeg(sessionID, srcPath, outPath string, duration float64, outputArgs []string) error {
+	args := []string{"-v", "error", "-y", "-nostats", "-progress", "pipe:1", "-i", srcPath, "-map_metadata", "0"}
+	args = append(args, outputArgs...)
+	args = append(args, outPath)
+
+	cmd := exec.Command("ffmpeg", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// -progress writes key=value lines; out_time_us is the position in the output
+	lastProgress := 20
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" || duration <= 0 {
+			continue
+		}
+		micros, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		progress := 20 + int(micros/1e6/duration*70)
+		if progress > 90 {
+			progress = 90
+		}
+		if progress > lastProgress {
+			lastProgress = progress
+			sendProgress(sessionID, progress, fmt.Sprintf("Wird konvertiert... %d%%", (progress-20)*100/70))
+		}
+	}
+
+	err = cmd.Wait()
+	recordProcessResources(sessionID, cmd.ProcessState)
+	if err != nil {
+		os.Remove(outPath)
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, truncateString(stderr.String(), 500))
+	}
+	return nil
+}
+
+// handleConvert converts an uploaded file: POST /convert (multipart/form-data).
+// Fields: "file", "format" and optionally "options" with DownloadRequest JSON for
+// post-processing (collection, trimSilence, ...). Progress is reported like downloads,
+// and the route has the same API key, terms and rate limit checks as /download.
+func handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if refuseWhileShuttingDown(w) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, DownloadResponse{Success: false, Message: "Erwarte multipart/form-data mit einer Datei"})
+		return
+	}
+
+	if err := os.MkdirAll(stagingRoot, 0755); err != nil {
+		convertLog.Error("Cannot create the staging directory", "path", stagingRoot, "error", err)
+		writeJSONStatus(w, http.StatusInternalServerError, DownloadResponse{Success: false, Message: "Upload konnte nicht gespeichert werden"})
+		return
+	}
+	uploadDir, err := os.MkdirTemp(stagingRoot, "upload-")
+	if err != nil {
+		convertLog.Error("Cannot create upload directory", "error", err)
+		writeJSONStatus(w, http.StatusInternalServerError, DownloadResponse{Success: false, Message: "Upload konnte nicht gespeichert werden"})
+		return
+	}
+	started := false
+	defer func() {
+		if !started {
+			os.RemoveAll(uploadDir)
+		}
+	}()
+
+	var req DownloadRequest
+	var srcPath, format string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			name := sanitizeFilename(filepath.Base(part.FileName()))
+			if name == "" || name == "." {
+				name = "upload"
+			}
+			srcPath = filepath.Join(uploadDir, name)
+			if err := saveUpload(srcPath, part); err != nil {
+				writeUploadError(w, err)
+				return
+			}
+		case "format":
+			value, _ := io.ReadAll(io.LimitReader(part, 16))
+			format = strings.ToLower(strings.TrimSpace(string(value)))
+		case "options":
+			if err := json.NewDecoder(io.LimitReader(part, maxJSONBodyBytes)).Decode(&req); err != nil {
+				writeJSONStatus(w, http.StatusBadRequest, DownloadResponse{Success: false, Message: "Ungültige Optionen"})
+				return
+			}
+		}
+		part.Close()
+	}
+
+	if srcPath == "" {
+		writeJSONStatus(w, http.StatusBadRequest, DownloadResponse{Success: false, Message: "Datei fehlt (Feld \"file\")"})
+		return
+	}
+	if format != "" {
+		req.Format = format
+	}
+	req = applyCollectionDefaults(req)
+	if msg := validateDownloadOptions(req); msg != "" {
+		writeJSONStatus(w, http.StatusBadRequest, DownloadResponse{Success: false, Message: msg})
+		return
+	}
+
+	user := remoteIP(r)
+	req.Owner = requestOwner(r)
+	sessionID := startLocalJob(srcPath, "upload:"+filepath.Base(srcPath), req, user, func(job Job) {
+		os.RemoveAll(uploadDir)
+	})
+	started = true
+	convertLog.Info("Converting upload", "file", filepath.Base(srcPath), "format", req.Format, "session", sessionID)
+
+	sendJSONResponse(w, DownloadResponse{Success: true, Message: sessionID, Filename: sessionID, Token: sessionToken(sessionID)})
+}
+
+// saveUpload writes an uploaded part to disk
+func saveUpload(path string, src io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, src); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeUploadError answers a failed upload, distinguishing oversized files
+func writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONStatus(w, http.StatusRequestEntityTooLarge, DownloadResponse{
+			Success: false,
+			Message: fmt.Sprintf("Datei zu groß (maximal %d MB)", maxUploadBytes>>20),
+		})
+		return
+	}
+	convertLog.Warn("Upload failed", "error", err)
+	writeJSONStatus(w, http.StatusBadRequest, DownloadResponse{Success: false, Message: "Upload fehlgeschlagen"})
+}
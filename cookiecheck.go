@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookies expire or get logged out by Google, and yt-dlp then quietly continues without
+// a login: members-only videos fail with misleading age-restriction errors. Every
+// COOKIE_CHECK_INTERVAL the stored bundles are tried against a YouTube page that needs
+// a login. When a user's cookies stop working, Slack and Matrix are notified once and
+// GET /me/cookies shows the result. 0 disables the check.
+var (
+	cookieCheckURL      = "https://www.youtube.com/account" // Redirects to the login page without a valid session
+	cookieCheckInterval = parseEnvDurationOrOff("COOKIE_CHECK_INTERVAL", 12*time.Hour)
+	cookieCheckClient   = &http.Client{
+		Timeout: 15 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	cookieChecks      = make(map[string]CookieCheck) // Keyed by user
+	cookieChecksMutex sync.Mutex
+)
+
+const (
+	minCookieCheckInterval = 10 * time.Minute
+	cookieCheckSpacing     = 5 * time.Second // Between two users, to stay inconspicuous
+)
+
+// youtubeAuthCookies mark a logged-in Google session
+var youtubeAuthCookies = map[string]bool{
+	"SID":            true,
+	"SAPISID":        true,
+	"__Secure-1PSID": true,
+	"__Secure-3PSID": true,
+	"LOGIN_INFO":     true,
+}
+
+// errNoYouTubeCookies means the bundle is for other sites and can't be checked
+var errNoYouTubeCookies = errors.New("no YouTube cookies")
+
+// CookieCheck is the result of the last freshness check of a user's cookies
+type CookieCheck struct {
+	Valid     bool      `json:"valid"`
+	Reason    string    `json:"reason,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// runCookieChecks checks all stored bundles every COOKIE_CHECK_INTERVAL
+func runCookieChecks() {
+	if !userCookiesEnabled() || cookieCheckInterval <= 0 {
+		return
+	}
+	if cookieCheckInterval < minCookieCheckInterval {
+		configLog.Warn("COOKIE_CHECK_INTERVAL is too short", "value", cookieCheckInterval.String(), "using", minCookieCheckInterval.String())
+		cookieCheckInterval = minCookieCheckInterval
+	}
+	cookiesLog.Info("Checking stored cookies periodically", "interval", cookieCheckInterval.String())
+
+	for {
+		for _, user := range cookieUsers() {
+			checkUserCookies(user)
+			time.Sleep(cookieCheckSpacing)
+		}
+		time.Sleep(cookieCheckInterval)
+	}
+}
+
+// checkUserCookies validates the cookies of one user and alerts when they stopped working
+func checkUserCookies(user string) {
+	bundle, err := loadCookieBundle(user)
+	if err != nil {
+		if err != errNoCookieBundle {
+			cookiesLog.Error("Cannot read cookies", "user", user, "error", err)
+		}
+		return
+	}
+	check, err := validateCookies(bundle)
+	if err == errNoYouTubeCookies {
+		return
+	}
+	if err != nil {
+		// Network trouble or throttling says nothing about the cookies
+		cookiesLog.Warn("Check inconclusive", "user", user, "error", err)
+		return
+	}
+
+	cookieChecksMutex.Lock()
+	previous, known := cookieChecks[user]
+	cookieChecks[user] = check
+	cookieChecksMutex.Unlock()
+
+	switch {
+	case !check.Valid && (!known || previous.Valid):
+		notifyCookiesExpired(user, check)
+	case check.Valid && known && !previous.Valid:
+		cookiesLog.Info("Cookies work again", "user", user)
+	}
+}
+
+// validateCookies checks the expiry dates of the login cookies and then whether
+// YouTube still accepts them
+func validateCookies(bundle CookieBundle) (CookieCheck, error) {
+	check := CookieCheck{CheckedAt: time.Now()}
+	var youtube []http.Cookie
+	var expired []http.Cookie
+	loggedIn := false
+	for _, cookie := range parseCookieFile(bundle.Cookies) {
+		if cookie.Domain != "youtube.com" && !strings.HasSuffix(cookie.Domain, ".youtube.com") {
+			continue
+		}
+		if !cookie.Expires.IsZero() && cookie.Expires.Before(check.CheckedAt) {
+			if youtubeAuthCookies[cookie.Name] {
+				expired = append(expired, cookie)
+			}
+			continue
+		}
+		youtube = append(youtube, cookie)
+		loggedIn = loggedIn || youtubeAuthCookies[cookie.Name]
+	}
+	if len(youtube) == 0 && len(expired) == 0 {
+		return check, errNoYouTubeCookies
+	}
+	if !loggedIn {
+		check.Reason = "Keine Anmelde-Cookies von YouTube gefunden"
+		if len(expired) > 0 {
+			check.Reason = fmt.Sprintf("Die Anmelde-Cookies sind am %s abgelaufen", expired[0].Expires.Format("02.01.2006"))
+		}
+		return check, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, cookieCheckURL, nil)
+	if err != nil {
+		return check, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	for i := range youtube {
+		req.AddCookie(&http.Cookie{Name: youtube[i].Name, Value: youtube[i].Value})
+	}
+	resp, err := cookieCheckClient.Do(req)
+	if err != nil {
+		return check, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		check.Valid = true
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && strings.Contains(resp.Header.Get("Location"), "accounts.google.com"):
+		check.Reason = "YouTube hat die Anmeldung abgelehnt (abgemeldet oder abgelaufen)"
+	default:
+		return check, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, cookieCheckURL)
+	}
+	return check, nil
+}
+
+// lastCookieCheck returns the result of the last check, nil if there was none
+func lastCookieCheck(user string) *CookieCheck {
+	cookieChecksMutex.Lock()
+	defer cookieChecksMutex.Unlock()
+	check, ok := cookieChecks[user]
+	if !ok {
+		return nil
+	}
+	return &check
+}
+
+// forgetCookieCheck drops the last result, so new cookies alert again when they expire
+func forgetCookieCheck(user string) {
+	cookieChecksMutex.Lock()
+	defer cookieChecksMutex.Unlock()
+	delete(cookieChecks, user)
+}
+
+func notifyCookiesExpired(user string, check CookieCheck) {
+	cookiesLog.Warn("Cookies stopped working", "user", user, "reason", check.Reason)
+	data := newNotificationData(NotifyCookiesExpired)
+	data.User, data.Reason = user, check.Reason
+	notifyMatrix(notificationText(NotifierMatrix, data, fmt.Sprintf("🍪 Die Cookies von %s funktionieren nicht mehr: %s", user, check.Reason)))
+	if slackWebhookURL() == "" {
+		return
+	}
+	message := slackNotification(data, SlackMessage{
+		Text: "🍪 Cookies funktionieren nicht mehr",
+		Attachments: []SlackAttachment{
+			{
+				Color: "warning",
+				Fields: []SlackField{
+					{Title: "Nutzer", Value: user, Short: true},
+					{Title: "Geprüft", Value: check.CheckedAt.Format("2006-01-02 15:04:05 MST"), Short: true},
+					{Title: "Grund", Value: check.Reason, Short: false},
+					{Title: "Abhilfe", Value: "Neue cookies.txt mit PUT /me/cookies hochladen", Short: false},
+				},
+			},
+		},
+	})
+	if err := postSlackMessage(message); err != nil {
+		cookiesLog.Error("Slack notification failed", "error", err)
+	}
+}
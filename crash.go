@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// A crash gets a last "service crashed" notification with the stack trace before the
+// process exits, so the startup message is not the first sign of trouble. Requests and
+// jobs recover their own panics; crashGuard covers main and the long-running
+// goroutines. Fatal runtime errors (e.g. concurrent map writes) cannot be caught.
+const crashNotifyTimeout = 5 * time.Second
+
+var crashLog = componentLogger("crash")
+
+// crashGuard reports an unrecovered panic of the calling goroutine and then lets it
+// crash the process as before. Use as: defer crashGuard("name")
+func crashGuard(name string) {
+	if rec := recover(); rec != nil {
+		notifyCrash(fmt.Sprintf("panic in %s: %v", name, rec), debug.Stack())
+		panic(rec)
+	}
+}
+
+// goGuarded runs fn in a goroutine protected by crashGuard
+func goGuarded(name string, fn func()) {
+	go func() {
+		defer crashGuard(name)
+		fn()
+	}()
+}
+
+// fatal replaces log.Fatal: it sends the crash notification before exiting
+func fatal(v ...interface{}) {
+	reason := fmt.Sprint(v...)
+	notifyCrash(reason, debug.Stack())
+	crashLog.Error("Exiting", "reason", reason)
+	os.Exit(1)
+}
+
+// notifyCrash sends the crash to Slack, Matrix and Sentry in parallel and waits at
+// most crashNotifyTimeout, so a hanging webhook cannot keep a broken process alive
+func notifyCrash(reason string, stack []byte) {
+	crashLog.Error("Crashed, sending crash notifications", "reason", reason)
+
+	data := newNotificationData(NotifyCrash)
+	data.Message = reason
+	var wg sync.WaitGroup
+	if slackWebhookURL() != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := postSlackMessage(slackNotification(data, buildCrashSlackMessage(reason, stack))); err != nil {
+				crashLog.Error("Slack notification failed", "error", err)
+			}
+		}()
+	}
+	if matrixEnabled() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sendMatrixMessage(notificationText(NotifierMatrix, data, "💥 YouTube Downloader abgestürzt: "+reason)); err != nil {
+				crashLog.Error("Matrix notification failed", "error", err)
+			}
+		}()
+	}
+	if sentry != nil {
+		event := newSentryEvent("fatal", map[string]string{"reason": reason})
+		event.Message = reason
+		event.Extra["stack"] = string(stack)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sentry.send(event)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(crashNotifyTimeout):
+		crashLog.Error("Notifications did not finish in time", "timeout", crashNotifyTimeout.String())
+	}
+}
+
+// buildCrashSlackMessage formats the crash with the (truncated) stack trace
+func buildCrashSlackMessage(reason string, stack []byte) SlackMessage {
+	hostname, _ := os.Hostname()
+	return SlackMessage{
+		Text: "💥 YouTube Downloader abgestürzt",
+		Attachments: []SlackAttachment{
+			{
+				Color: "danger",
+				Fields: []SlackField{
+					{Title: "Grund", Value: reason, Short: false},
+					{Title: "Hostname", Value: hostname, Short: true},
+					{Title: "Uptime", Value: formatUptime(time.Since(serverStartedAt)), Short: true},
+					{Title: "Stack Trace", Value: fmt.Sprintf("```%s```", truncateString(string(stack), 2500)), Short: false},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"ytdownloader/resolver"
+)
+
+// With DEMO_MODE=true the UI can be hosted publicly without offering a free
+// downloading service: downloads are simulated with fake progress, yt-dlp and ffmpeg
+// are never run and nothing is written to ./downloads. Only the routes the UI needs
+// for a download are registered; everything else answers 404.
+var (
+	demoMode            = getenv("DEMO_MODE") == "true"
+	demoDownloadLimiter = newRateLimiter(10, time.Minute) // Simulated downloads per IP
+)
+
+// demoSteps are the fake progress updates of a simulated download
+var demoSteps = []struct {
+	progress int
+	status   string
+}{
+	{5, "Video-Informationen werden geladen..."},
+	{15, "Download läuft... 10%"},
+	{35, "Download läuft... 40%"},
+	{55, "Download läuft... 70%"},
+	{75, "Download läuft... 100%"},
+	{85, "Konvertiere..."},
+	{95, "Metadaten werden geschrieben..."},
+}
+
+const demoStepInterval = 1200 * time.Millisecond
+
+// registerDemoRoutes wires the few routes of the demo next to static files and progress
+func registerDemoRoutes(router *Router) {
+	router.HandleFunc("POST /download", handleDemoDownload)
+	router.HandleFunc("POST /cancel", handleCancel)
+	router.HandleFunc("POST /check-formats", handleDemoCheckFormats)
+	router.HandleFunc("POST /resolve", handleResolve)
+	serverLog.Info("Demo mode enabled: downloads are simulated, yt-dlp is never run")
+}
+
+// handleDemoDownload limits simulated downloads per address, so the demo stays cheap
+func handleDemoDownload(w http.ResponseWriter, r *http.Request) {
+	if !demoDownloadLimiter.allow(remoteIP(r)) {
+		writeJSONStatus(w, http.StatusTooManyRequests, DownloadResponse{
+			Success: false,
+			Message: "Zu viele Demo-Downloads. Bitte warte eine Minute.",
+		})
+		return
+	}
+	handleDownload(w, r)
+}
+
+// handleDemoCheckFormats answers the format check with fixed qualities instead of probing
+func handleDemoCheckFormats(w http.ResponseWriter, r *http.Request) {
+	var req DownloadRequest
+	if reqErr := decodeJSONBody(w, r, &req, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, FormatCheckResponse{
+			Success: false,
+			Message: reqErr.message,
+		})
+		return
+	}
+	if !resolver.IsYouTubeURL(req.URL) {
+		writeJSONStatus(w, http.StatusOK, FormatCheckResponse{
+			Success: false,
+			Message: "Nur YouTube URLs sind erlaubt",
+		})
+		return
+	}
+
+	audioLabel := formatQualityLabel("160kbps", false)
+	writeJSONStatus(w, http.StatusOK, FormatCheckResponse{
+		Success:       true,
+		BestVideoInfo: "1920x1080 (Demo)",
+		BestAudioInfo: "160kbps (Demo)",
+		QualityInfo: map[string]string{
+			"mp4":  formatQualityLabel("1080p", true),
+			"webm": formatQualityLabel("1080p", true),
+			"mkv":  formatQualityLabel("1080p", true),
+			"mp3":  audioLabel,
+			"wav":  audioLabel,
+			"m4a":  audioLabel,
+			"flac": audioLabel,
+			"opus": audioLabel,
+			"ogg":  audioLabel,
+		},
+	})
+}
+
+// simulateDownload sends the fake progress of a demo job and returns a file name
+// that is never created
+func simulateDownload(cleanedURL string, req DownloadRequest, sessionID string) (string, error) {
+	for _, step := range demoSteps {
+		if isCancelled(sessionID) {
+			return "", errJobCancelled
+		}
+		sendProgress(sessionID, step.progress, step.status)
+		time.Sleep(demoStepInterval)
+	}
+	return fmt.Sprintf("Demo_%s.%s", resolver.VideoID(cleanedURL), req.Format), nil
+}
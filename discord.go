@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"ytdownloader/resolver"
+)
+
+// Discord bot mode uses the HTTP interactions API: set the application's
+// "Interactions Endpoint URL" to https://<host>/discord/interactions.
+// Users run /ytdown <url> or the "Mit ytdown herunterladen" message command on
+// any message containing a link, pick a format via buttons and get the result link.
+var (
+	discordPublicKey     = getenv("DISCORD_PUBLIC_KEY")
+	discordApplicationID = getenv("DISCORD_APPLICATION_ID")
+	publicBaseURL        = strings.TrimSuffix(getenv("PUBLIC_BASE_URL"), "/")
+	discordClient        = &http.Client{Timeout: 10 * time.Second}
+	discordLog           = componentLogger("discord")
+)
+
+const (
+	discordAPIBase         = "https://discord.com/api/v10"
+	maxDiscordBodyBytes    = 64 << 10
+	discordPendingTTL      = 15 * time.Minute // Interaction tokens expire after 15 minutes
+	discordMessageCommand  = "Mit ytdown herunterladen"
+	discordFormatButtonTag = "ytdown"
+)
+
+// Discord interaction and response types
+const (
+	discordInteractionPing       = 1
+	discordInteractionCommand    = 2
+	discordInteractionComponent  = 3
+	discordResponsePong          = 1
+	discordResponseMessage       = 4
+	discordResponseUpdateMessage = 7
+	discordFlagEphemeral         = 64
+)
+
+var linkPattern = regexp.MustCompile(`https?://[^\s<>]+`)
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type discordInteraction struct {
+	Type          int    `json:"type"`
+	Token         string `json:"token"`
+	ApplicationID string `json:"application_id"`
+	Member        *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+	Data struct {
+		Name     string `json:"name"`
+		CustomID string `json:"custom_id"`
+		TargetID string `json:"target_id"`
+		Options  []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"options"`
+		Resolved struct {
+			Messages map[string]struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		} `json:"resolved"`
+	} `json:"data"`
+}
+
+type discordResponse struct {
+	Type int                  `json:"type"`
+	Data *discordResponseData `json:"data,omitempty"`
+}
+
+type discordResponseData struct {
+	Content    string             `json:"content"`
+	Flags      int                `json:"flags,omitempty"`
+	Components []discordComponent `json:"components"`
+}
+
+type discordComponent struct {
+	Type       int                `json:"type"` // 1 = action row, 2 = button
+	Style      int                `json:"style,omitempty"`
+	Label      string             `json:"label,omitempty"`
+	CustomID   string             `json:"custom_id,omitempty"`
+	Components []discordComponent `json:"components,omitempty"`
+}
+
+// discordPending holds URLs waiting for a format choice; custom IDs are limited to 100 chars
+var (
+	discordPending      = make(map[string]discordPendingLink)
+	discordPendingMutex sync.Mutex
+)
+
+type discordPendingLink struct {
+	URL       string
+	CreatedAt time.Time
+}
+
+func discordEnabled() bool {
+	return discordPublicKey != ""
+}
+
+// handleDiscordInteraction is the Discord interactions endpoint: /discord/interactions
+func handleDiscordInteraction(w http.ResponseWriter, r *http.Request) {
+	if !discordEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDiscordBodyBytes))
+	if err != nil {
+		http.Error(w, "Anfrage zu groß", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !verifyDiscordSignature(r.Header.Get("X-Signature-Ed25519"), r.Header.Get("X-Signature-Timestamp"), body) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		http.Error(w, "Ungültige Anfrage", http.StatusBadRequest)
+		return
+	}
+
+	var response discordResponse
+	switch interaction.Type {
+	case discordInteractionPing:
+		response = discordResponse{Type: discordResponsePong}
+	case discordInteractionCommand:
+		response = discordCommandResponse(interaction)
+	case discordInteractionComponent:
+		response = discordFormatChosen(interaction)
+	default:
+		http.Error(w, "Unbekannter Interaktionstyp", http.StatusBadRequest)
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, response)
+}
+
+func verifyDiscordSignature(signature, timestamp string, body []byte) bool {
+	key, err := hex.DecodeString(discordPublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		configLog.Warn("DISCORD_PUBLIC_KEY is not a valid Ed25519 key")
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || timestamp == "" {
+		return false
+	}
+	return ed25519.Verify(key, append([]byte(timestamp), body...), sig)
+}
+
+// discordCommandResponse answers /ytdown and the message command with format buttons
+func discordCommandResponse(interaction discordInteraction) discordResponse {
+	link := ""
+	for _, option := range interaction.Data.Options {
+		if option.Name == "url" {
+			link = option.Value
+		}
+	}
+	if message, ok := interaction.Data.Resolved.Messages[interaction.Data.TargetID]; ok {
+		link = linkPattern.FindString(message.Content)
+	}
+
+	if link == "" || !resolver.IsYouTubeURL(link) {
+		return discordEphemeral("Kein gültiger YouTube-Link gefunden.")
+	}
+
+	id := storeDiscordLink(link)
+	var buttons []discordComponent
+	for _, format := range []string{"mp4", "mp3", "m4a", "wav"} {
+		buttons = append(buttons, discordComponent{
+			Type:     2,
+			Style:    1,
+			Label:    strings.ToUpper(format),
+			CustomID: fmt.Sprintf("%s:%s:%s", discordFormatButtonTag, id, format),
+		})
+	}
+	return discordResponse{
+		Type: discordResponseMessage,
+		Data: &discordResponseData{
+			Content:    fmt.Sprintf("Format für <%s> wählen:", link),
+			Components: []discordComponent{{Type: 1, Components: buttons}},
+		},
+	}
+}
+
+// discordFormatChosen starts the job for a format button and reports back when it finished
+func discordFormatChosen(interaction discordInteraction) discordResponse {
+	parts := strings.Split(interaction.Data.CustomID, ":")
+	if len(parts) != 3 || parts[0] != discordFormatButtonTag {
+		return discordEphemeral("Unbekannte Aktion.")
+	}
+	link, ok := takeDiscordLink(parts[1])
+	if !ok {
+		return discordEphemeral("Diese Auswahl ist abgelaufen. Bitte den Befehl erneut ausführen.")
+	}
+
+	req := DownloadRequest{URL: link, Format: parts[2]}
+	cleanedURL, msg := validateDownloadRequest(req)
+	if msg != "" {
+		return discordEphemeral(msg)
+	}
+
+	token := interaction.Token
+	user := interaction.username()
+	startJob(cleanedURL, req, "discord:"+user, func(job Job) {
+		text := notificationText(NotifierDiscord, jobNotificationData(job, user), chatJobResult(job))
+		if err := editDiscordResponse(interaction.ApplicationID, token, text); err != nil {
+			discordLog.Error("Could not post result", "session", job.SessionID, "error", err)
+		}
+	})
+
+	return discordResponse{
+		Type: discordResponseUpdateMessage,
+		Data: &discordResponseData{
+			Content:    fmt.Sprintf("⏳ Download von <%s> als %s läuft...", cleanedURL, strings.ToUpper(req.Format)),
+			Components: []discordComponent{},
+		},
+	}
+}
+
+func (i discordInteraction) username() string {
+	if i.Member != nil {
+		return i.Member.User.Username
+	}
+	if i.User != nil {
+		return i.User.Username
+	}
+	return ""
+}
+
+func discordEphemeral(content string) discordResponse {
+	return discordResponse{
+		Type: discordResponseMessage,
+		Data: &discordResponseData{Content: content, Flags: discordFlagEphemeral, Components: []discordComponent{}},
+	}
+}
+
+// chatJobResult formats the final message for a finished job in chat integrations
+func chatJobResult(job Job) string {
+	if job.Status != JobStatusCompleted {
+		return "❌ Download fehlgeschlagen: " + job.Error
+	}
+	title := job.Filename
+	if job.Metadata != nil && job.Metadata.Title != "" {
+		title = job.Metadata.Title
+	}
+	if publicBaseURL == "" {
+		return fmt.Sprintf("✅ %s ist fertig: %s", title, job.Filename)
+	}
+	return fmt.Sprintf("✅ %s ist fertig: %s/download-file/%s", title, publicBaseURL, url.PathEscape(job.Filename))
+}
+
+// editDiscordResponse replaces the original interaction message via its webhook
+func editDiscordResponse(applicationID, token, content string) error {
+	body, _ := json.Marshal(map[string]string{"content": content})
+	endpoint := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", discordAPIBase, applicationID, token)
+
+	req, err := http.NewRequest(http.MethodPatch, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doDiscordRequest(req)
+}
+
+// registerDiscordCommands installs /ytdown and the message command for the application
+func registerDiscordCommands() {
+	if !discordEnabled() || discordBotToken() == "" || discordApplicationID == "" {
+		return
+	}
+
+	commands := []map[string]interface{}{
+		{
+			"name":        "ytdown",
+			"type":        1,
+			"description": "YouTube-Video herunterladen",
+			"options": []map[string]interface{}{
+				{"name": "url", "description": "YouTube-Link", "type": 3, "required": true},
+			},
+		},
+		{"name": discordMessageCommand, "type": 3},
+	}
+	body, _ := json.Marshal(commands)
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/applications/%s/commands", discordAPIBase, discordApplicationID), bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bot "+discordBotToken())
+	if err := doDiscordRequest(req); err != nil {
+		discordLog.Error("Registering commands failed", "error", err)
+		return
+	}
+	discordLog.Info("Commands registered")
+}
+
+func doDiscordRequest(req *http.Request) error {
+	resp, err := discordClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, message)
+	}
+	return nil
+}
+
+func storeDiscordLink(link string) string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+
+	discordPendingMutex.Lock()
+	defer discordPendingMutex.Unlock()
+
+	now := time.Now()
+	for key, pending := range discordPending {
+		if now.Sub(pending.CreatedAt) > discordPendingTTL {
+			delete(discordPending, key)
+		}
+	}
+	discordPending[id] = discordPendingLink{URL: link, CreatedAt: now}
+	return id
+}
+
+func takeDiscordLink(id string) (string, bool) {
+	discordPendingMutex.Lock()
+	defer discordPendingMutex.Unlock()
+
+	pending, ok := discordPending[id]
+	if !ok || time.Since(pending.CreatedAt) > discordPendingTTL {
+		return "", false
+	}
+	delete(discordPending, id)
+	return pending.URL, true
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ssdpAddress     = "239.255.255.250:1900"
+	avTransportType = "urn:schemas-upnp-org:service:AVTransport:1"
+)
+
+// Renderers are only contacted at the address that answered the search, so redirects
+// elsewhere are not followed
+var dlnaClient = &http.Client{
+	Timeout: 5 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// upnpDevice is the part of a UPnP device description needed to find AVTransport
+type upnpDevice struct {
+	UDN          string `xml:"UDN"`
+	FriendlyName string `xml:"friendlyName"`
+	Services     []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+// discoverDLNARenderers sends an SSDP M-SEARCH for AVTransport and reads the device descriptions
+func discoverDLNARenderers(timeout time.Duration) ([]CastDevice, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	target, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return nil, err
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddress + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: " + avTransportType + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), target); err != nil {
+		return nil, err
+	}
+
+	locations := make(map[string]net.IP) // Description URL → address of the responder
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			break // Deadline reached
+		}
+		responder, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		// Any host in the LAN can answer; a LOCATION pointing elsewhere would make the
+		// server fetch arbitrary URLs
+		if location := resp.Header.Get("Location"); location != "" && onResponder(location, responder.IP) {
+			locations[location] = responder.IP
+		}
+	}
+
+	var devices []CastDevice
+	for location, responder := range locations {
+		device, err := describeDLNARenderer(location, responder)
+		if err != nil {
+			continue
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// onResponder reports whether rawURL is an http URL on the given address
+func onResponder(rawURL string, responder net.IP) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "http" {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.Equal(responder)
+}
+
+// describeDLNARenderer fetches the description XML and finds the AVTransport control
+// URL, which must be on the responder as well
+func describeDLNARenderer(location string, responder net.IP) (CastDevice, error) {
+	resp, err := dlnaClient.Get(location)
+	if err != nil {
+		return CastDevice{}, err
+	}
+	defer resp.Body.Close()
+
+	var desc upnpDescription
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&desc); err != nil {
+		return CastDevice{}, err
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return CastDevice{}, err
+	}
+	if desc.URLBase != "" {
+		if parsed, err := url.Parse(desc.URLBase); err == nil {
+			base = parsed
+		}
+	}
+
+	device, controlURL := findAVTransport(desc.Device)
+	if controlURL == "" {
+		return CastDevice{}, fmt.Errorf("no AVTransport service at %s", location)
+	}
+	control, err := base.Parse(controlURL)
+	if err != nil {
+		return CastDevice{}, err
+	}
+	if !onResponder(control.String(), responder) {
+		return CastDevice{}, fmt.Errorf("control URL %s is not on %s", control, responder)
+	}
+
+	return CastDevice{
+		ID:         strings.TrimPrefix(device.UDN, "uuid:"),
+		Name:       device.FriendlyName,
+		Kind:       CastKindDLNA,
+		Address:    control.Host,
+		ControlURL: control.String(),
+	}, nil
+}
+
+// findAVTransport searches the device tree; renderers are often embedded devices
+func findAVTransport(device upnpDevice) (upnpDevice, string) {
+	for _, service := range device.Services {
+		if strings.HasPrefix(service.ServiceType, "urn:schemas-upnp-org:service:AVTransport:") {
+			return device, service.ControlURL
+		}
+	}
+	for _, child := range device.Devices {
+		if found, controlURL := findAVTransport(child); controlURL != "" {
+			return found, controlURL
+		}
+	}
+	return upnpDevice{}, ""
+}
+
+// castToDLNA sets the media URI on the renderer and starts playback
+func castToDLNA(device CastDevice, mediaURL, contentType, title string) error {
+	itemClass := "object.item.videoItem"
+	if strings.HasPrefix(contentType, "audio/") {
+		itemClass = "object.item.audioItem.musicTrack"
+	}
+	didl := fmt.Sprintf(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`+
+		`<item id="0" parentID="-1" restricted="1"><dc:title>%s</dc:title><upnp:class>%s</upnp:class>`+
+		`<res protocolInfo="http-get:*:%s:*">%s</res></item></DIDL-Lite>`,
+		html.EscapeString(title), itemClass, contentType, html.EscapeString(mediaURL))
+
+	err := dlnaAction(device, "SetAVTransportURI",
+		"<InstanceID>0</InstanceID>"+
+			"<CurrentURI>"+html.EscapeString(mediaURL)+"</CurrentURI>"+
+			"<CurrentURIMetaData>"+html.EscapeString(didl)+"</CurrentURIMetaData>")
+	if err != nil {
+		return err
+	}
+	return dlnaAction(device, "Play", "<InstanceID>0</InstanceID><Speed>1</Speed>")
+}
+
+// dlnaAction performs a SOAP call on the AVTransport service
+func dlnaAction(device CastDevice, action, args string) error {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + avTransportType + `">` + args + `</u:` + action + `></s:Body></s:Envelope>`
+
+	req, err := http.NewRequest(http.MethodPost, device.ControlURL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+avTransportType+"#"+action+`"`)
+
+	resp, err := dlnaClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fault, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return fmt.Errorf("%s returned status %d: %s", action, resp.StatusCode, strings.TrimSpace(string(fault)))
+	}
+	return nil
+}
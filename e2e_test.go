@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// End-to-end tests drive the HTTP API against a scripted yt-dlp: the test binary
+// re-executes itself as yt-dlp and replays a transcript from testdata/ytdlp, so
+// download → progress (SSE) → file serving runs without network access.
+// The stub is selected per test with YTDLP_STUB_TRANSCRIPT.
+const stubTranscriptEnv = "YTDLP_STUB_TRANSCRIPT"
+
+func TestMain(m *testing.M) {
+	if transcript := os.Getenv(stubTranscriptEnv); transcript != "" {
+		os.Exit(runYtDlpStub(transcript, os.Args[1:]))
+	}
+
+	// The server works relative to the current directory (./downloads, ./static)
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testdata, _ := filepath.Abs("testdata")
+	workDir, err := os.MkdirTemp("", "ytdown-e2e-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Chdir(workDir)
+	ytdlpBinary = self
+	registerEventSubscribers()
+	testdataDir = testdata
+
+	code := m.Run()
+	os.RemoveAll(workDir)
+	os.Exit(code)
+}
+
+var testdataDir string
+
+// runYtDlpStub imitates yt-dlp: it answers --version and otherwise replays the
+// transcript, writing the info JSON and the output file where the arguments ask for them
+func runYtDlpStub(transcript string, args []string) int {
+	if len(args) == 1 && args[0] == "--version" {
+		fmt.Println("2099.01.01-stub")
+		return 0
+	}
+
+	var outputTemplate, infoTemplate, ext string
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-o":
+			if strings.HasPrefix(args[i+1], "infojson:") {
+				infoTemplate = strings.TrimPrefix(args[i+1], "infojson:")
+			} else {
+				outputTemplate = args[i+1]
+			}
+		case "--audio-format", "--merge-output-format":
+			ext = args[i+1]
+		}
+	}
+
+	data, err := os.ReadFile(transcript)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: stub:", err)
+		return 2
+	}
+	title := "Stub"
+	for _, line := range strings.Split(string(data), "\n") {
+		directive, rest, _ := strings.Cut(line, " ")
+		switch directive {
+		case "stdout":
+			fmt.Fprintln(os.Stdout, rest)
+		case "stderr":
+			fmt.Fprintln(os.Stderr, rest)
+		case "sleep":
+			duration, _ := time.ParseDuration(rest)
+			time.Sleep(duration)
+		case "info":
+			var info struct {
+				Title string `json:"title"`
+			}
+			json.Unmarshal([]byte(rest), &info)
+			if info.Title != "" {
+				title = info.Title
+			}
+			if infoTemplate != "" {
+				os.WriteFile(infoTemplate+".info.json", []byte(rest), 0644)
+			}
+		case "file":
+			// An argument replaces the extension, e.g. ".mp4.part"
+			suffix := "." + ext
+			if rest != "" {
+				suffix = rest
+			}
+			name := strings.ReplaceAll(outputTemplate, "%(title)s", title)
+			name = strings.ReplaceAll(name, ".%(ext)s", suffix)
+			os.WriteFile(name, []byte("stub media: "+title), 0644)
+		case "exit":
+			code, _ := strconv.Atoi(rest)
+			return code
+		}
+	}
+	return 0
+}
+
+// e2eServer serves the full router with yt-dlp replaying the named transcript
+func e2eServer(t *testing.T, transcript string) *httptest.Server {
+	t.Helper()
+	t.Setenv(stubTranscriptEnv, filepath.Join(testdataDir, "ytdlp", transcript+".txt"))
+	server := httptest.NewServer(newRouter())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// startDownload posts a download and returns session ID and token
+func startDownload(t *testing.T, server *httptest.Server, body string) (string, string) {
+	t.Helper()
+	resp, err := http.Post(server.URL+"/download", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result DownloadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.Token == "" {
+		t.Fatalf("download not started: %+v", result)
+	}
+	return result.Message, result.Token
+}
+
+// sseEvent is one event of the progress stream
+type sseEvent struct {
+	Name   string
+	Update ProgressUpdate
+}
+
+// readProgress collects the progress stream until the server closes it
+func readProgress(t *testing.T, server *httptest.Server, sessionID, token string) []sseEvent {
+	t.Helper()
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(server.URL + "/progress?session=" + sessionID + "&token=" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("progress: status %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("progress: content type %q", contentType)
+	}
+
+	var events []sseEvent
+	current := sseEvent{Name: "message"}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.Name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.Update); err != nil {
+				t.Fatalf("progress: invalid event %q: %v", line, err)
+			}
+		case line == "":
+			events = append(events, current)
+			current = sseEvent{Name: "message"}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// finalUpdate returns the last plain message of the stream
+func finalUpdate(t *testing.T, events []sseEvent) ProgressUpdate {
+	t.Helper()
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Name == "message" {
+			return events[i].Update
+		}
+	}
+	t.Fatal("progress stream has no messages")
+	return ProgressUpdate{}
+}
+
+func TestE2EDownloadMP3(t *testing.T) {
+	server := e2eServer(t, "success_mp3")
+	sessionID, token := startDownload(t, server, `{"url":"https://youtu.be/dQw4w9WgXcQ","format":"mp3","force":true}`)
+
+	events := readProgress(t, server, sessionID, token)
+	var warnings []string
+	downloading := false
+	for _, event := range events {
+		if event.Name == "warning" {
+			warnings = append(warnings, event.Update.Warning.Code)
+		}
+		if strings.HasPrefix(event.Update.Status, "Download läuft...") {
+			downloading = true
+		}
+	}
+	if !downloading {
+		t.Error("no download progress parsed from the transcript")
+	}
+	if len(warnings) != 1 || warnings[0] != WarningNsigFailed {
+		t.Errorf("warnings = %v, want [%s]", warnings, WarningNsigFailed)
+	}
+
+	final := finalUpdate(t, events)
+	filename, ok := strings.CutPrefix(final.Status, "Completed: ")
+	if final.Progress != 100 || !ok {
+		t.Fatalf("final update = %+v", final)
+	}
+	// Named after the title; a second run within the same second gets a "-1" suffix
+	if !strings.Contains(filename, "_Rick Astley - Never Gonna Give You Up") || filepath.Ext(filename) != ".mp3" {
+		t.Errorf("filename = %q", filename)
+	}
+	if final.Versions == nil || final.Versions.YtDlp != "2099.01.01-stub" {
+		t.Errorf("versions = %+v", final.Versions)
+	}
+
+	// The job carries the metadata from the info JSON
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/jobs/"+sessionID, nil)
+	req.Header.Set("X-Session-Token", token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Job Job `json:"job"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if job := result.Job; job.Status != JobStatusCompleted || job.Metadata == nil || job.Metadata.ID != "dQw4w9WgXcQ" {
+		t.Errorf("job = %+v", result.Job)
+	}
+
+	resp, err = http.Get(server.URL + "/download-file/" + url.PathEscape(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "stub media: Rick Astley - Never Gonna Give You Up" {
+		t.Errorf("download-file: status %d, body %q", resp.StatusCode, body)
+	}
+}
+
+func TestE2EPrivateVideo(t *testing.T) {
+	server := e2eServer(t, "private_video")
+	sessionID, token := startDownload(t, server, `{"url":"https://www.youtube.com/watch?v=AAAAAAAAAAA","format":"mp4","force":true}`)
+
+	final := finalUpdate(t, readProgress(t, server, sessionID, token))
+	if !final.Error || final.Progress != -1 {
+		t.Fatalf("final update = %+v, want an error", final)
+	}
+	if final.Status != "Video ist privat und kann nicht heruntergeladen werden" {
+		t.Errorf("error message = %q", final.Status)
+	}
+	if job, _ := getJob(sessionID); job.ErrorCode != "private_video" {
+		t.Errorf("error code = %q", job.ErrorCode)
+	}
+}
+
+func TestE2EMissingFile(t *testing.T) {
+	server := e2eServer(t, "no_file")
+	sessionID, token := startDownload(t, server, `{"url":"https://www.youtube.com/watch?v=BBBBBBBBBBB","format":"mp4","force":true}`)
+
+	final := finalUpdate(t, readProgress(t, server, sessionID, token))
+	if !final.Error || final.Status != "Download abgeschlossen, aber Datei wurde nicht gefunden" {
+		t.Errorf("final update = %+v", final)
+	}
+}
+
+func TestE2EProgressRequiresToken(t *testing.T) {
+	server := e2eServer(t, "success_mp3")
+	sessionID, _ := startDownload(t, server, `{"url":"https://www.youtube.com/watch?v=CCCCCCCCCCC","format":"mp3","force":true}`)
+
+	resp, err := http.Get(server.URL + "/progress?session=" + sessionID + "&token=wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Job lifecycle events are published on an in-process bus. SSE delivery, stats,
+// Home Assistant and the audit log subscribe to it instead of being called directly
+// from the download code.
+
+// Lifecycle event types
+const (
+	EventJobCreated  = "job.created"
+	EventJobStarted  = "job.started"
+	EventJobProgress = "job.progress"
+	EventJobWarning  = "job.warning"
+	EventJobRetried  = "job.retried"
+	EventJobFinished = "job.finished" // Completed or failed, see Job.Status
+	EventJobServed   = "job.served"   // File sent to a client via /download-file
+	EventJobPurged   = "job.purged"   // Removed from the job store
+)
+
+// LifecycleEvent is a state change of a job
+type LifecycleEvent struct {
+	Type      string
+	SessionID string
+	Job       Job             // Snapshot taken when the event was published
+	Update    *ProgressUpdate // SSE payload for progress, warning, retry and finish events
+	Detail    string          // Free text for the audit log, e.g. the requester
+	At        time.Time
+}
+
+type eventSubscriber struct {
+	name    string
+	types   map[string]bool
+	handler func(LifecycleEvent)
+}
+
+var (
+	eventSubscribers      []eventSubscriber
+	eventSubscribersMutex sync.RWMutex
+	eventsLog             = componentLogger("events")
+)
+
+// subscribe registers a handler for the given event types. Handlers run synchronously
+// in the publishing goroutine and in subscription order, which keeps SSE updates in
+// order; anything slow must be moved into its own goroutine by the handler.
+func subscribe(name string, handler func(LifecycleEvent), types ...string) {
+	subscriber := eventSubscriber{name: name, types: make(map[string]bool), handler: handler}
+	for _, eventType := range types {
+		subscriber.types[eventType] = true
+	}
+
+	eventSubscribersMutex.Lock()
+	defer eventSubscribersMutex.Unlock()
+	eventSubscribers = append(eventSubscribers, subscriber)
+}
+
+// publishEvent delivers an event to all interested subscribers. A panicking
+// subscriber is logged and does not affect the others.
+func publishEvent(event LifecycleEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	eventSubscribersMutex.RLock()
+	subscribers := eventSubscribers
+	eventSubscribersMutex.RUnlock()
+
+	for _, subscriber := range subscribers {
+		if !subscriber.types[event.Type] {
+			continue
+		}
+		func() {
+			defer func() {
+				if rec := recover(); rec != nil {
+					eventsLog.Error("Subscriber panicked", "subscriber", subscriber.name, "event", event.Type, "session", event.SessionID, "panic", rec)
+				}
+			}()
+			subscriber.handler(event)
+		}()
+	}
+}
+
+// emitJobEvent publishes an event with a snapshot of the job
+func emitJobEvent(eventType, sessionID string, update *ProgressUpdate, detail string) {
+	job, _ := getJob(sessionID)
+	publishEvent(LifecycleEvent{Type: eventType, SessionID: sessionID, Job: job, Update: update, Detail: detail})
+}
+
+// registerEventSubscribers wires all consumers of lifecycle events
+func registerEventSubscribers() {
+	subscribe("sse", deliverToSSE, EventJobProgress, EventJobWarning, EventJobRetried, EventJobFinished)
+	subscribe("stats", recordStatsEvent, EventJobCreated, EventJobFinished)
+	subscribe("resources", recordResourcesEvent, EventJobFinished)
+	subscribe("metrics", recordMetricsEvent, EventJobStarted, EventJobFinished)
+	subscribe("flags", recordFlagEvent, EventJobFinished)
+	subscribe("homeassistant", notifyHomeAssistantEvent, EventJobStarted, EventJobFinished)
+	subscribe("progress-webhook", notifyProgressWebhook, EventJobProgress, EventJobFinished)
+	subscribe("jobstore", recordJobStoreEvent,
+		EventJobCreated, EventJobStarted, EventJobWarning, EventJobRetried,
+		EventJobFinished, EventJobServed, EventJobPurged)
+	subscribe("sessions", forgetSessionToken, EventJobPurged)
+	subscribe("shares", revokeJobShares, EventJobPurged)
+	subscribe("torrent", removeSeededFiles, EventJobPurged)
+	subscribe("audit", recordAuditEvent,
+		EventJobCreated, EventJobStarted, EventJobWarning, EventJobRetried,
+		EventJobFinished, EventJobServed, EventJobPurged)
+}
+
+// deliverToSSE forwards progress and final updates to the session's SSE clients
+func deliverToSSE(event LifecycleEvent) {
+	if event.Update == nil {
+		return
+	}
+	if event.Update.Error {
+		publishError(event.SessionID, *event.Update)
+		return
+	}
+	publishProgress(event.SessionID, *event.Update)
+}
+
+// recordStatsEvent counts yt-dlp jobs per release channel; local conversions are not counted
+func recordStatsEvent(event LifecycleEvent) {
+	if event.Job.Binary == "" {
+		return
+	}
+	switch event.Type {
+	case EventJobCreated:
+		recordJobStart(event.Job.Channel, event.Job.Binary)
+	case EventJobFinished:
+		recordJobResult(event.Job.Channel, event.Job.Binary, event.Job.ErrorCode)
+	}
+}
+
+// notifyHomeAssistantEvent maps lifecycle events to the Home Assistant webhook events
+func notifyHomeAssistantEvent(event LifecycleEvent) {
+	switch {
+	case event.Type == EventJobStarted:
+		notifyHomeAssistant(event.SessionID, JobEventStarted)
+	case event.Job.Status == JobStatusCompleted:
+		notifyHomeAssistant(event.SessionID, JobEventFinished)
+	default:
+		notifyHomeAssistant(event.SessionID, JobEventFailed)
+	}
+}
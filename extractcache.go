@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"ytdownloader/resolver"
+)
+
+// Extracting a video takes yt-dlp several seconds. The info JSON of every probe
+// (/check-formats, /preflight, /recommend) is kept so that a download started shortly
+// afterwards skips the extraction and passes it to yt-dlp with --load-info-json.
+// The media URLs in the info JSON expire, so an entry is only used well before that.
+var extractionDir = metadataDir + "/extractions"
+
+// extractionExpiryMargin keeps a running download clear of the media URL expiry
+const extractionExpiryMargin = 15 * time.Minute
+
+var (
+	extractionTTL     = parseEnvDuration("EXTRACTION_CACHE_TTL", 5*time.Minute)
+	extractions       = make(map[string]*cachedExtraction) // Keyed like the format cache
+	extractionsMutex  sync.Mutex
+	extractionEnabled = getenv("EXTRACTION_CACHE") != "false"
+)
+
+type cachedExtraction struct {
+	path      string
+	cachedAt  time.Time
+	expiresAt time.Time // Earliest expiry of the media URLs, zero if unknown
+}
+
+func (c *cachedExtraction) fresh(now time.Time) bool {
+	if now.Sub(c.cachedAt) > extractionTTL {
+		return false
+	}
+	return c.expiresAt.IsZero() || now.Before(c.expiresAt.Add(-extractionExpiryMargin))
+}
+
+// storeExtraction keeps the raw yt-dlp -J output of a video
+func storeExtraction(videoID string, infoJSON []byte) {
+	if !extractionEnabled || videoID == "" || filepath.Base(videoID) != videoID {
+		return
+	}
+	if err := os.MkdirAll(extractionDir, 0755); err != nil {
+		ytdlpLog.Error("Failed to create the extraction cache", "path", extractionDir, "error", err)
+		return
+	}
+
+	// Each version gets its own file so a running download never reads a half-written one
+	path := filepath.Join(extractionDir, videoID+"."+strconv.FormatInt(time.Now().UnixNano(), 36)+".info.json")
+	if err := os.WriteFile(path, infoJSON, 0644); err != nil {
+		ytdlpLog.Error("Failed to cache extraction", "video", videoID, "error", err)
+		return
+	}
+
+	extractionsMutex.Lock()
+	previous := extractions[formatCacheKey(videoID)]
+	extractions[formatCacheKey(videoID)] = &cachedExtraction{
+		path:      path,
+		cachedAt:  time.Now(),
+		expiresAt: mediaURLExpiry(infoJSON),
+	}
+	extractionsMutex.Unlock()
+
+	if previous != nil {
+		os.Remove(previous.path)
+	}
+}
+
+// cachedExtractionPath returns the info JSON file for the video if it can still be downloaded from
+func cachedExtractionPath(watchURL string) (string, bool) {
+	videoID := resolver.VideoID(watchURL)
+	if !extractionEnabled || videoID == "" {
+		return "", false
+	}
+
+	extractionsMutex.Lock()
+	defer extractionsMutex.Unlock()
+
+	cached, ok := extractions[formatCacheKey(videoID)]
+	if !ok || !cached.fresh(time.Now()) {
+		return "", false
+	}
+	return cached.path, true
+}
+
+// forgetExtraction drops the cached info JSON, e.g. after a download with it failed
+func forgetExtraction(watchURL string) {
+	key := formatCacheKey(resolver.VideoID(watchURL))
+
+	extractionsMutex.Lock()
+	cached, ok := extractions[key]
+	delete(extractions, key)
+	extractionsMutex.Unlock()
+
+	if ok {
+		os.Remove(cached.path)
+	}
+}
+
+// mediaURLExpiry returns the earliest "expire" timestamp of the format URLs
+func mediaURLExpiry(infoJSON []byte) time.Time {
+	var info struct {
+		Formats []struct {
+			URL string `json:"url"`
+		} `json:"formats"`
+	}
+	if err := json.Unmarshal(infoJSON, &info); err != nil {
+		return time.Time{}
+	}
+
+	var earliest time.Time
+	for _, format := range info.Formats {
+		parsed, err := url.Parse(format.URL)
+		if err != nil {
+			continue
+		}
+		expire, err := strconv.ParseInt(parsed.Query().Get("expire"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if at := time.Unix(expire, 0); earliest.IsZero() || at.Before(earliest) {
+			earliest = at
+		}
+	}
+	return earliest
+}
+
+// cleanupExtractions removes stale entries and their files
+func cleanupExtractions() {
+	extractionsMutex.Lock()
+	defer extractionsMutex.Unlock()
+
+	now := time.Now()
+	for key, cached := range extractions {
+		if !cached.fresh(now) {
+			os.Remove(cached.path)
+			delete(extractions, key)
+		}
+	}
+}
+
+// cleanupExtractionDir removes info JSON files left behind by a previous run
+func cleanupExtractionDir() {
+	if err := os.RemoveAll(extractionDir); err != nil {
+		ytdlpLog.Warn("Could not clean up the extraction cache", "path", extractionDir, "error", err)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/subtle"
+	"math/rand"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Feature flags let operators try yt-dlp workarounds on a share of jobs and compare
+// the outcome with the jobs that ran without them. FEATURE_FLAGS sets the initial
+// percentages ("android_client=10,aria2c=50"). GET /admin/flags lists the flags with
+// success rates of both groups; PUT /admin/flags/{name} with {"percent": 25} changes
+// a flag at runtime and needs "Authorization: Bearer <ADMIN_TOKEN>". Without
+// ADMIN_TOKEN the flags are read-only. Runtime changes are not persisted.
+
+// featureFlag is a yt-dlp behavior that can be rolled out to a share of jobs
+type featureFlag struct {
+	name        string
+	description string
+	youtubeArgs func() []string // Merged into a single --extractor-args youtube:...
+	args        []string        // Additional yt-dlp arguments
+	available   func() bool     // nil means always available
+}
+
+var (
+	featureFlags = []featureFlag{
+		{
+			name:        "android_client",
+			description: "YouTube über den Android-Client abfragen",
+			youtubeArgs: func() []string { return []string{"player_client=android"} },
+		},
+		{
+			name:        "aria2c",
+			description: "Download mit aria2c über mehrere Verbindungen",
+			args:        []string{"--downloader", "aria2c", "--downloader-args", "aria2c:-x 4 -k 1M"},
+			available:   func() bool { _, err := exec.LookPath("aria2c"); return err == nil },
+		},
+		{
+			name:        "po_token",
+			description: "PO-Token aus YTDLP_PO_TOKEN mitsenden",
+			youtubeArgs: func() []string { return []string{"po_token=" + poToken()} }, // Read per job, the token can be rotated
+			available:   func() bool { return poToken() != "" },
+		},
+	}
+
+	flagPercents = parseFeatureFlags(getenv("FEATURE_FLAGS"))
+	flagOutcomes = make(map[string]*FlagStats)
+	flagsMutex   sync.Mutex
+	adminLog     = componentLogger("admin")
+)
+
+// FlagSet maps the flags in rollout when a job started to whether the job uses them
+type FlagSet map[string]bool
+
+// FlagOutcome counts finished jobs of one group
+type FlagOutcome struct {
+	Succeeded   int     `json:"succeeded"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"successRate"` // Succeeded / finished jobs, 0-1
+}
+
+// FlagStats is a flag with its rollout and the outcomes of jobs with and without it
+type FlagStats struct {
+	Description string      `json:"description"`
+	Available   bool        `json:"available"`
+	Percent     int         `json:"percent"`
+	Enabled     FlagOutcome `json:"enabled"` // Jobs that ran with the flag
+	Control     FlagOutcome `json:"control"` // Jobs that ran without it during the rollout
+}
+
+func findFeatureFlag(name string) (featureFlag, bool) {
+	for _, flag := range featureFlags {
+		if flag.name == name {
+			return flag, true
+		}
+	}
+	return featureFlag{}, false
+}
+
+func (f featureFlag) isAvailable() bool {
+	return f.available == nil || f.available()
+}
+
+// parseFeatureFlags reads "name=percent" pairs; unknown flags are ignored
+func parseFeatureFlags(value string) map[string]int {
+	percents := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rawPercent, _ := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		percent, err := strconv.Atoi(strings.TrimSpace(rawPercent))
+		if _, ok := findFeatureFlag(name); !ok || err != nil || percent < 0 || percent > 100 {
+			configLog.Warn("Invalid FEATURE_FLAGS entry", "entry", entry)
+			continue
+		}
+		percents[name] = percent
+	}
+	return percents
+}
+
+// pickFeatureFlags rolls the dice for every flag in rollout. Flags the job does not
+// use are kept too, so finished jobs can be counted per group.
+func pickFeatureFlags() FlagSet {
+	flagsMutex.Lock()
+	defer flagsMutex.Unlock()
+
+	var picked FlagSet
+	for _, flag := range featureFlags {
+		percent := flagPercents[flag.name]
+		if percent == 0 || !flag.isAvailable() {
+			continue
+		}
+		if picked == nil {
+			picked = make(FlagSet)
+		}
+		picked[flag.name] = rand.Intn(100) < percent
+	}
+	return picked
+}
+
+// featureFlagArgs returns the yt-dlp arguments of the flags a job uses. youtubeArgs
+// from elsewhere are merged in, as yt-dlp only takes one set per extractor.
+func featureFlagArgs(flags FlagSet, youtubeArgs ...string) []string {
+	var args []string
+	for _, flag := range featureFlags {
+		if flags[flag.name] {
+			if flag.youtubeArgs != nil {
+				youtubeArgs = append(youtubeArgs, flag.youtubeArgs()...)
+			}
+			args = append(args, flag.args...)
+		}
+	}
+	if len(youtubeArgs) > 0 {
+		args = append(args, "--extractor-args", "youtube:"+strings.Join(youtubeArgs, ";"))
+	}
+	return args
+}
+
+// recordFlagEvent counts a finished job for every flag that was in rollout when it started
+func recordFlagEvent(event LifecycleEvent) {
+	if len(event.Job.Flags) == 0 || event.Job.Status == JobStatusCancelled {
+		return
+	}
+	flagsMutex.Lock()
+	defer flagsMutex.Unlock()
+
+	for name, used := range event.Job.Flags {
+		stats, ok := flagOutcomes[name]
+		if !ok {
+			stats = &FlagStats{}
+			flagOutcomes[name] = stats
+		}
+		outcome := &stats.Control
+		if used {
+			outcome = &stats.Enabled
+		}
+		if event.Job.ErrorCode == "" {
+			outcome.Succeeded++
+		} else {
+			outcome.Failed++
+		}
+	}
+}
+
+// snapshotFlags returns all flags with their rollout and success rates
+func snapshotFlags() map[string]FlagStats {
+	flagsMutex.Lock()
+	defer flagsMutex.Unlock()
+
+	snapshot := make(map[string]FlagStats, len(featureFlags))
+	for _, flag := range featureFlags {
+		var stats FlagStats
+		if counted, ok := flagOutcomes[flag.name]; ok {
+			stats = *counted
+		}
+		stats.Description = flag.description
+		stats.Available = flag.isAvailable()
+		stats.Percent = flagPercents[flag.name]
+		for _, outcome := range []*FlagOutcome{&stats.Enabled, &stats.Control} {
+			if finished := outcome.Succeeded + outcome.Failed; finished > 0 {
+				outcome.SuccessRate = float64(outcome.Succeeded) / float64(finished)
+			}
+		}
+		snapshot[flag.name] = stats
+	}
+	return snapshot
+}
+
+// logFeatureFlags prints the flags in rollout at startup
+func logFeatureFlags() {
+	var active []string
+	for name, percent := range flagPercents {
+		if percent > 0 {
+			active = append(active, name+"="+strconv.Itoa(percent)+"%")
+		}
+	}
+	if len(active) > 0 {
+		sort.Strings(active)
+		serverLog.Info("Feature flags rolled out", "flags", strings.Join(active, ", "))
+	}
+}
+
+// isAdminRequest reports whether the request carries the ADMIN_TOKEN bearer token
+func isAdminRequest(r *http.Request) bool {
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return adminToken() != "" && subtle.ConstantTimeCompare([]byte(given), []byte(adminToken())) == 1
+}
+
+// requireAdmin checks the ADMIN_TOKEN bearer token and writes the error response
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if adminToken() == "" {
+		writeJSONStatus(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "Änderungen sind deaktiviert, da ADMIN_TOKEN nicht gesetzt ist",
+		})
+		return false
+	}
+	if !isAdminRequest(r) {
+		adminLog.Warn("Rejected request: missing or wrong token", "method", r.Method, "path", r.URL.Path, "ip", remoteIP(r))
+		writeJSONStatus(w, http.StatusUnauthorized, map[string]interface{}{
+			"success": false,
+			"message": "Nicht autorisiert",
+		})
+		return false
+	}
+	return true
+}
+
+// handleListFlags returns all feature flags: GET /admin/flags
+func handleListFlags(w http.ResponseWriter, r *http.Request) {
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"flags":   snapshotFlags(),
+	})
+}
+
+type setFlagRequest struct {
+	Percent *int `json:"percent"`
+}
+
+// handleSetFlag changes the rollout of a flag: PUT /admin/flags/{name}
+func handleSetFlag(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	name := pathParam(r, "name")
+	flag, ok := findFeatureFlag(name)
+	if !ok {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Unbekanntes Feature-Flag"})
+		return
+	}
+
+	var body setFlagRequest
+	if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+		return
+	}
+	if body.Percent == nil || *body.Percent < 0 || *body.Percent > 100 {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "percent muss zwischen 0 und 100 liegen"})
+		return
+	}
+	if *body.Percent > 0 && !flag.isAvailable() {
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": "Das Feature-Flag ist auf diesem Server nicht verfügbar"})
+		return
+	}
+
+	flagsMutex.Lock()
+	flagPercents[name] = *body.Percent
+	flagsMutex.Unlock()
+	adminLog.Info("Feature flag changed", "flag", name, "percent", *body.Percent, "ip", remoteIP(r))
+
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"flag":    snapshotFlags()[name],
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// FormatInfo holds the parsed yt-dlp -F output for a video, independent of the selected format
+type FormatInfo struct {
+	HasSABR       bool
+	BestVideoInfo string
+	BestAudioInfo string
+	Warnings      []string
+	QualityInfo   map[string]string
+}
+
+type cachedFormatInfo struct {
+	info     FormatInfo
+	cachedAt time.Time
+}
+
+var (
+	formatCache      = make(map[string]*cachedFormatInfo) // Keyed by yt-dlp version + video ID
+	formatCacheMutex sync.RWMutex
+	formatCacheTTL   = 5 * time.Minute
+)
+
+// formatCacheKey partitions the cache by extractor version so a yt-dlp update never serves
+// stale results. The version lookup may run yt-dlp, so callers build the key before locking.
+func formatCacheKey(videoID string) string {
+	return getYtDlpVersion() + "|" + videoID
+}
+
+// getCachedFormatInfo returns cached format data if it is still fresh
+func getCachedFormatInfo(videoID string) (FormatInfo, bool) {
+	if videoID == "" {
+		return FormatInfo{}, false
+	}
+
+	key := formatCacheKey(videoID)
+	formatCacheMutex.RLock()
+	defer formatCacheMutex.RUnlock()
+
+	cached, ok := formatCache[key]
+	if !ok || time.Since(cached.cachedAt) > formatCacheTTL {
+		return FormatInfo{}, false
+	}
+	return cached.info, true
+}
+
+// storeFormatInfo caches successfully parsed format data
+func storeFormatInfo(videoID string, info FormatInfo) {
+	if videoID == "" {
+		return
+	}
+
+	key := formatCacheKey(videoID)
+	formatCacheMutex.Lock()
+	defer formatCacheMutex.Unlock()
+
+	formatCache[key] = &cachedFormatInfo{
+		info:     info,
+		cachedAt: time.Now(),
+	}
+}
+
+// cleanupFormatCache removes expired entries
+func cleanupFormatCache() {
+	formatCacheMutex.Lock()
+	defer formatCacheMutex.Unlock()
+
+	now := time.Now()
+	for key, cached := range formatCache {
+		if now.Sub(cached.cachedAt) > formatCacheTTL {
+			delete(formatCache, key)
+		}
+	}
+}
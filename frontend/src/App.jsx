@@ -7,6 +7,8 @@ import StarBorder from '@/components/StarBorder'
 import ShinyText from '@/components/ShinyText'
 import './App.css'
 
+const DEMO_COMPLETED_TEXT = 'Demo abgeschlossen! Im Demo-Modus wird keine Datei erzeugt.'
+
 function App() {
   const [url, setUrl] = useState('')
   const [format, setFormat] = useState('mp3')
@@ -19,6 +21,7 @@ function App() {
   const [isCheckingUrl, setIsCheckingUrl] = useState(false)
   const [urlResolved, setUrlResolved] = useState(false)
   const [qualityInfo, setQualityInfo] = useState({}) // Quality info for each format
+  const [terms, setTerms] = useState(null) // Terms of use still to accept ({ version, url })
 
   const eventSourceRef = useRef(null)
   const containerRef = useRef(null)
@@ -77,7 +80,7 @@ function App() {
 
       console.error('[ErrorReport] Sending error report:', errorReport)
 
-      await fetch('/report-error', {
+      await fetch('report-error', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(errorReport)
@@ -120,6 +123,42 @@ function App() {
     }
   }, [reportError])
 
+  // Ask for the terms of use up front when the server requires them
+  useEffect(() => {
+    fetch('terms')
+      .then((response) => response.json())
+      .then((data) => {
+        if (data.required && !data.accepted) {
+          setTerms({ version: data.version, url: data.url })
+        }
+      })
+      .catch(() => {})
+  }, [])
+
+  const acceptTerms = async () => {
+    trackAction(`Terms accepted: version=${terms.version}`)
+    try {
+      // The server answers with the terms_token cookie, sent with every later request
+      const response = await fetch('accept-terms', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ version: terms.version }),
+      })
+      const data = await response.json()
+      if (!data.success) {
+        setMessage({ type: 'error', text: `Fehler: ${data.message}` })
+        return
+      }
+      setTerms(null)
+      setMessage(null)
+      addToast('success', 'Nutzungsbedingungen akzeptiert')
+    } catch (error) {
+      setMessage({ type: 'error', text: `Fehler: ${error.message}` })
+    }
+  }
+
   // Validate if URL is from YouTube
   const isValidYouTubeURL = (url) => {
     if (!url) return false
@@ -147,7 +186,7 @@ function App() {
     const activeDownload = sessionStorage.getItem('active_download')
     if (activeDownload) {
       try {
-        const { sessionID, url: savedUrl, format: savedFormat, timestamp } = JSON.parse(activeDownload)
+        const { sessionID, token, url: savedUrl, format: savedFormat, timestamp } = JSON.parse(activeDownload)
 
         // Only restore if less than 10 minutes old
         const age = Date.now() - timestamp
@@ -161,13 +200,18 @@ function App() {
           setProgressText('Verbindung wird wiederhergestellt...')
 
           // Reconnect to SSE
-          eventSourceRef.current = new EventSource(`/progress?session=${sessionID}`)
+          eventSourceRef.current = new EventSource(`progress?session=${sessionID}&token=${token}`)
 
           eventSourceRef.current.onopen = () => {
             console.log('[Restore] SSE reconnected successfully')
             trackAction('SSE reconnected after page reload')
           }
 
+          eventSourceRef.current.addEventListener('warning', (event) => {
+            const update = JSON.parse(event.data)
+            addToast('warning', update.warning.message)
+          })
+
           eventSourceRef.current.onmessage = (event) => {
             const update = JSON.parse(event.data)
 
@@ -189,11 +233,13 @@ function App() {
               eventSourceRef.current.close()
               sessionStorage.removeItem('active_download')
 
-              const filename = update.status.replace('Completed: ', '')
-              triggerDownload(filename)
+              // Demo servers simulate downloads and have no file to fetch
+              if (!update.demo) {
+                triggerDownload(update.status.replace('Completed: ', ''))
+              }
 
               setIsDownloading(false)
-              setMessage({ type: 'success', text: 'Download abgeschlossen!' })
+              setMessage({ type: 'success', text: update.demo ? DEMO_COMPLETED_TEXT : 'Download abgeschlossen!' })
               setTimeout(() => {
                 setProgress(0)
                 setProgressText('')
@@ -308,7 +354,7 @@ function App() {
     if (url && (url.includes('youtube.com') || url.includes('youtu.be'))) {
       resolveTimerRef.current = setTimeout(async () => {
         try {
-          const response = await fetch('/resolve', {
+          const response = await fetch('resolve', {
             method: 'POST',
             headers: {
               'Content-Type': 'application/json',
@@ -358,7 +404,7 @@ function App() {
 
       debounceTimerRef.current = setTimeout(async () => {
         try {
-          const response = await fetch('/check-formats', {
+          const response = await fetch('check-formats', {
             method: 'POST',
             headers: {
               'Content-Type': 'application/json',
@@ -418,7 +464,7 @@ function App() {
 
   // Handle file download with iOS Safari compatibility
   const triggerDownload = (filename) => {
-    const downloadUrl = `/download-file/${encodeURIComponent(filename)}`
+    const downloadUrl = `download-file/${encodeURIComponent(filename)}`
 
     if (isIOSSafari()) {
       // iOS Safari: Open in new tab with instructions
@@ -437,7 +483,7 @@ function App() {
     }
   }
 
-  const handleSubmit = async (e) => {
+  const handleSubmit = async (e, force = false) => {
     e.preventDefault()
     trackAction(`Download initiated: format=${format}, url=${url.substring(0, 50)}...`)
 
@@ -461,14 +507,26 @@ function App() {
     setMessage(null)
 
     try {
-      const response = await fetch('/download', {
+      const response = await fetch('download', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify({ url, format }),
+        body: JSON.stringify({ url, format, force }),
       })
 
+      // The terms of use have to be accepted first
+      if (response.status === 403) {
+        const data = await response.clone().json().catch(() => ({}))
+        if (data.code === 'terms_required') {
+          setTerms({ version: data.termsVersion, url: data.termsUrl })
+          setIsDownloading(false)
+          setMessage({ type: 'error', text: data.message })
+          trackAction('Download failed: Terms not accepted')
+          return
+        }
+      }
+
       // Check if response is OK
       if (!response.ok) {
         const errorText = await response.text()
@@ -479,24 +537,35 @@ function App() {
 
       if (data.success) {
         const sessionID = data.message
+        // Only the token from this response grants access to the progress stream
+        const token = data.token
         trackAction(`SSE connection started: session=${sessionID}`)
 
         // Save active download to sessionStorage
         sessionStorage.setItem('active_download', JSON.stringify({
           sessionID,
+          token,
           url,
           format,
           timestamp: Date.now()
         }))
 
         console.log('[SSE] Opening EventSource for session:', sessionID)
-        eventSourceRef.current = new EventSource(`/progress?session=${sessionID}`)
+        eventSourceRef.current = new EventSource(`progress?session=${sessionID}&token=${token}`)
 
         eventSourceRef.current.onopen = () => {
           console.log('[SSE] Connection opened successfully')
           trackAction('SSE connection opened')
         }
 
+        // Non-fatal problems (retries, missing formats) arrive as separate events
+        eventSourceRef.current.addEventListener('warning', (event) => {
+          const update = JSON.parse(event.data)
+          console.log('[SSE] Warning received:', update.warning.code)
+          trackAction(`Download warning: ${update.warning.code}`)
+          addToast('warning', update.warning.message)
+        })
+
         eventSourceRef.current.onmessage = (event) => {
           console.log('[SSE] Message received:', event.data)
           const update = JSON.parse(event.data)
@@ -533,15 +602,18 @@ function App() {
 
             const filename = update.status.replace('Completed: ', '')
             console.log('[Download] Attempting download for:', filename)
-            console.log('[Download] Encoded URL:', `/download-file/${encodeURIComponent(filename)}`)
+            console.log('[Download] Encoded URL:', `download-file/${encodeURIComponent(filename)}`)
 
-            triggerDownload(filename)
+            // Demo servers simulate downloads and have no file to fetch
+            if (!update.demo) {
+              triggerDownload(filename)
+            }
 
             // Clean up session storage
             sessionStorage.removeItem('active_download')
 
             setIsDownloading(false)
-            setMessage({ type: 'success', text: 'Download abgeschlossen!' })
+            setMessage({ type: 'success', text: update.demo ? DEMO_COMPLETED_TEXT : 'Download abgeschlossen!' })
 
             setTimeout(() => {
               setProgress(0)
@@ -567,6 +639,17 @@ function App() {
           setIsDownloading(false)
           setMessage({ type: 'error', text: 'Verbindungsfehler beim Fortschritt' })
         }
+      } else if (data.redownload) {
+        // Same video was downloaded before: ask before fetching it again
+        sessionStorage.removeItem('active_download')
+        setIsDownloading(false)
+        trackAction(`Duplicate download: ${data.message}`)
+
+        if (window.confirm(`${data.message}. Erneut herunterladen?`)) {
+          handleSubmit({ preventDefault() {} }, true)
+        } else {
+          setMessage({ type: 'info', text: data.message })
+        }
       } else {
         // Clean up session storage
         sessionStorage.removeItem('active_download')
@@ -772,6 +855,32 @@ function App() {
             </StarBorder>
           </form>
 
+          {/* Terms of use */}
+          <AnimatePresence>
+            {terms && (
+              <motion.div
+                className="info"
+                initial={{ opacity: 0, height: 0, y: -10 }}
+                animate={{ opacity: 1, height: 'auto', y: 0 }}
+                exit={{ opacity: 0, height: 0, y: -10 }}
+                transition={{ duration: 0.3 }}
+                style={{ marginTop: '24px' }}
+              >
+                <Info size={16} />
+                <span style={{ flex: 1 }}>
+                  Vor dem ersten Download musst du die{' '}
+                  <a href={terms.url} target="_blank" rel="noopener noreferrer" style={{ color: 'inherit' }}>
+                    Nutzungsbedingungen
+                  </a>{' '}
+                  akzeptieren.
+                </span>
+                <button type="button" onClick={acceptTerms} style={{ cursor: 'pointer' }}>
+                  Akzeptieren
+                </button>
+              </motion.div>
+            )}
+          </AnimatePresence>
+
           {/* Progress Bar */}
           <AnimatePresence>
             {isDownloading && (
@@ -822,15 +931,15 @@ function App() {
             animate={{ opacity: 1 }}
             transition={{ delay: 0.5 }}
           >
-            <a href="/legal.html#impressum" className="footer-link" style={{ textDecoration: 'none' }}>
+            <a href="legal.html#impressum" className="footer-link" style={{ textDecoration: 'none' }}>
               Impressum
             </a>
             <span className="footer-separator">•</span>
-            <a href="/legal.html#datenschutz" className="footer-link" style={{ textDecoration: 'none' }}>
+            <a href="legal.html#datenschutz" className="footer-link" style={{ textDecoration: 'none' }}>
               Datenschutz
             </a>
             <span className="footer-separator">•</span>
-            <a href="/legal.html#haftungsausschluss" className="footer-link" style={{ textDecoration: 'none' }}>
+            <a href="legal.html#haftungsausschluss" className="footer-link" style={{ textDecoration: 'none' }}>
               Haftungsausschluss
             </a>
           </motion.div>
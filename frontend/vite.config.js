@@ -4,6 +4,8 @@ import tailwindcss from '@tailwindcss/vite'
 import path from 'path'
 
 export default defineConfig({
+  // Relative asset URLs, so the app also works below a BASE_PATH like /ytdown/
+  base: './',
   plugins: [
     react(),
     tailwindcss(),
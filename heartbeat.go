@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Besides the startup message, Slack can receive a periodic "still alive" message with
+// session metrics. SLACK_HEARTBEAT_INTERVAL enables it (e.g. "6h"); incoming webhooks
+// are bound to a channel, so SLACK_HEARTBEAT_WEBHOOK_URL posts heartbeats to another
+// channel than startup and error messages.
+var (
+	serverStartedAt     = time.Now()
+	heartbeatInterval   = parseEnvDuration("SLACK_HEARTBEAT_INTERVAL", 0)
+	heartbeatWebhookURL = getenv("SLACK_HEARTBEAT_WEBHOOK_URL")
+)
+
+// heartbeatWebhook returns the heartbeat channel's webhook, by default the main one
+func heartbeatWebhook() string {
+	if heartbeatWebhookURL != "" {
+		return heartbeatWebhookURL
+	}
+	return slackWebhookURL()
+}
+
+// minHeartbeatInterval keeps a typo like "1s" from flooding the channel
+const minHeartbeatInterval = time.Minute
+
+// sendStartupNotification sends a notification to Slack when the service starts
+func sendStartupNotification() {
+	if slackWebhookURL() == "" {
+		slackLog.Info("SLACK_WEBHOOK_URL not configured, skipping startup notification")
+		return
+	}
+
+	data := startupNotificationData()
+	message := slackNotification(data, SlackMessage{
+		Text: "✅ YouTube Downloader gestartet",
+		Attachments: []SlackAttachment{
+			{
+				Color: "good",
+				Fields: []SlackField{
+					{Title: "Status", Value: "🚀 Service läuft wieder", Short: true},
+					{Title: "Hostname", Value: data.Hostname, Short: true},
+					{Title: "Timestamp", Value: data.Time.Format("2006-01-02 15:04:05 MST"), Short: true},
+					{Title: "yt-dlp Version", Value: data.YtDlpVersion, Short: true},
+					{Title: "Downloads", Value: data.Downloads, Short: true},
+				},
+			},
+		},
+	})
+
+	if err := postSlackMessage(message); err != nil {
+		slackLog.Error("Startup notification failed", "error", err)
+		return
+	}
+	slackLog.Info("Startup notification sent")
+}
+
+// runHeartbeat posts the heartbeat every SLACK_HEARTBEAT_INTERVAL
+func runHeartbeat() {
+	if heartbeatInterval <= 0 || heartbeatWebhook() == "" {
+		return
+	}
+	if heartbeatInterval < minHeartbeatInterval {
+		configLog.Warn("SLACK_HEARTBEAT_INTERVAL is too short", "value", heartbeatInterval.String(), "using", minHeartbeatInterval.String())
+		heartbeatInterval = minHeartbeatInterval
+	}
+	slackLog.Info("Sending heartbeats", "interval", heartbeatInterval.String())
+
+	for range time.Tick(heartbeatInterval) {
+		if err := postSlackMessageTo(heartbeatWebhook(), buildHeartbeatMessage()); err != nil {
+			slackLog.Error("Heartbeat failed", "error", err)
+		}
+	}
+}
+
+// buildHeartbeatMessage reports uptime, job counts and disk usage since the start
+func buildHeartbeatMessage() SlackMessage {
+	hostname, _ := os.Hostname()
+	started, succeeded, failed, cancelled := jobTotals()
+	// Jobs cancelled while queued were never started
+	running := max(started-succeeded-failed-cancelled, 0)
+
+	color := "good"
+	if failed > 0 && failed*2 >= succeeded+failed {
+		color = "warning" // At least half of the finished jobs failed
+	}
+
+	return SlackMessage{
+		Text: "💓 YouTube Downloader läuft",
+		Attachments: []SlackAttachment{
+			{
+				Color: color,
+				Fields: []SlackField{
+					{Title: "Hostname", Value: hostname, Short: true},
+					{Title: "Uptime", Value: formatUptime(time.Since(serverStartedAt)), Short: true},
+					{Title: "Jobs seit Start", Value: fmt.Sprintf("%d (%d laufen)", started, running), Short: true},
+					{Title: "Fehlgeschlagen", Value: fmt.Sprintf("%d", failed), Short: true},
+					{Title: "Downloads", Value: downloadsUsage(), Short: true},
+					{Title: "yt-dlp Version", Value: getYtDlpVersion(), Short: true},
+				},
+			},
+		},
+	}
+}
+
+// formatUptime renders a duration as "3d 4h 12m"
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, d/time.Minute)
+	}
+	return fmt.Sprintf("%dh %dm", hours, d/time.Minute)
+}
+
+// downloadsUsage returns the size and file count of ./downloads, including the trash
+func downloadsUsage() string {
+	var size int64
+	var files int
+	filepath.WalkDir(downloadsDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return fmt.Sprintf("%s in %d Dateien", formatByteSize(size), files)
+}
+
+// formatByteSize renders a size with binary units, e.g. "1.5 GiB"
+func formatByteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
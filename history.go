@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyCSVHeader lists the exported columns; nested fields are flattened
+var historyCSVHeader = []string{
+	"sessionId", "createdAt", "finishedAt", "status", "url", "format", "filename",
+	"error", "errorCode", "channel", "ytdlpVersion", "ffmpegVersion",
+	"videoId", "title", "uploader", "duration", "artist", "trackTitle", "album",
+	"parts", "waveform", "lyrics", "hook", "libraryImport", "libraryScan", "tags", "collection",
+	"language",
+}
+
+// parseHistoryTime accepts RFC 3339 timestamps or plain dates (YYYY-MM-DD)
+func parseHistoryTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return day, nil
+}
+
+// parseOptionalHistoryTime returns the zero time for an empty value
+func parseOptionalHistoryTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return parseHistoryTime(value, endOfDay)
+}
+
+// handleHistoryExport streams the caller's jobs as CSV or JSONL, all jobs for the
+// admin: /history/export?format=csv|jsonl&from=&to=
+func handleHistoryExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "csv" && format != "jsonl" {
+		http.Error(w, "Ungültiges Format, erlaubt sind csv und jsonl", http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseOptionalHistoryTime(query.Get("from"), false)
+	if err != nil {
+		http.Error(w, "Ungültiges Datum für from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseOptionalHistoryTime(query.Get("to"), true)
+	if err != nil {
+		http.Error(w, "Ungültiges Datum für to", http.StatusBadRequest)
+		return
+	}
+
+	// Oldest first, like a log
+	list := historyJobs()
+	filename := fmt.Sprintf("history-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		for i := len(list) - 1; i >= 0; i-- {
+			if !jobVisibleTo(r, list[i]) || !inHistoryRange(list[i], from, to) {
+				continue
+			}
+			// historyJobs omits logs; the export includes every field
+			if job, ok := getJob(list[i].SessionID); ok {
+				encoder.Encode(job)
+			} else if job, ok := storedJobByID(list[i].SessionID); ok {
+				encoder.Encode(job)
+			}
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(w)
+	writer.Write(historyCSVHeader)
+	for i := len(list) - 1; i >= 0; i-- {
+		if jobVisibleTo(r, list[i]) && inHistoryRange(list[i], from, to) {
+			writer.Write(historyCSVRow(list[i]))
+		}
+	}
+	writer.Flush()
+}
+
+func inHistoryRange(job Job, from, to time.Time) bool {
+	if !from.IsZero() && job.CreatedAt.Before(from) {
+		return false
+	}
+	if !to.IsZero() && job.CreatedAt.After(to) {
+		return false
+	}
+	return true
+}
+
+func historyCSVRow(job Job) []string {
+	finishedAt := ""
+	if !job.FinishedAt.IsZero() {
+		finishedAt = job.FinishedAt.Format(time.RFC3339)
+	}
+
+	row := []string{
+		job.SessionID, job.CreatedAt.Format(time.RFC3339), finishedAt, job.Status, job.URL, job.Format, job.Filename,
+		job.Error, job.ErrorCode, job.Channel, job.Versions.YtDlp, job.Versions.FFmpeg,
+	}
+
+	var videoID, title, uploader, duration string
+	if job.Metadata != nil {
+		videoID, title, uploader = job.Metadata.ID, job.Metadata.Title, job.Metadata.Uploader
+		duration = strconv.FormatFloat(job.Metadata.Duration, 'f', -1, 64)
+	}
+	var artist, trackTitle, album string
+	if job.AudioTags != nil {
+		artist, trackTitle, album = job.AudioTags.Artist, job.AudioTags.Title, job.AudioTags.Album
+	}
+	row = append(row, videoID, title, uploader, duration, artist, trackTitle, album)
+
+	row = append(row,
+		strings.Join(job.Parts, ";"),
+		strconv.FormatBool(job.Waveform),
+		strconv.FormatBool(job.Lyrics),
+		job.Hook, job.LibraryImport, job.LibraryScan,
+		strings.Join(job.Tags, ";"),
+		job.Collection,
+		job.Language,
+	)
+	for i, cell := range row {
+		row[i] = csvCell(cell)
+	}
+	return row
+}
+
+// csvCell keeps spreadsheets from running a cell as a formula, e.g. a video title
+// starting with "="
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// HOME_ASSISTANT_WEBHOOK_URL receives job events, e.g. http://homeassistant:8123/api/webhook/ytdown.
+// Automations use a webhook trigger and read trigger.json.event.
+var (
+	homeAssistantClient = &http.Client{Timeout: 10 * time.Second}
+	homeAssistantLog    = componentLogger("homeassistant")
+)
+
+// Job events sent to Home Assistant
+const (
+	JobEventStarted  = "started"
+	JobEventFinished = "finished"
+	JobEventFailed   = "failed"
+)
+
+// HomeAssistantEvent is the webhook payload for a job state change
+type HomeAssistantEvent struct {
+	Event     string    `json:"event"`
+	SessionID string    `json:"sessionId"`
+	URL       string    `json:"url"`
+	Format    string    `json:"format"`
+	Title     string    `json:"title,omitempty"`
+	Uploader  string    `json:"uploader,omitempty"`
+	Filename  string    `json:"filename,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode string    `json:"errorCode,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// notifyHomeAssistant posts a job event in the background; delivery failures are only logged
+func notifyHomeAssistant(sessionID, event string) {
+	if homeAssistantWebhookURL() == "" {
+		return
+	}
+	job, ok := getJob(sessionID)
+	if !ok {
+		return
+	}
+
+	payload := HomeAssistantEvent{
+		Event:     event,
+		SessionID: sessionID,
+		URL:       job.URL,
+		Format:    job.Format,
+		Filename:  job.Filename,
+		Error:     job.Error,
+		ErrorCode: job.ErrorCode,
+		Timestamp: time.Now(),
+	}
+	if job.Metadata != nil {
+		payload.Title = job.Metadata.Title
+		payload.Uploader = job.Metadata.Uploader
+	}
+
+	go func() {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return
+		}
+		resp, err := homeAssistantClient.Post(homeAssistantWebhookURL(), "application/json", bytes.NewReader(body))
+		if err != nil {
+			homeAssistantLog.Error("Failed to send event", "event", event, "session", sessionID, "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			homeAssistantLog.Error("Webhook rejected event", "event", event, "status", resp.StatusCode)
+		}
+	}()
+}
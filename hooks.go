@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hook results stored on the job
+const (
+	HookStatusOK      = "ok"
+	HookStatusFailed  = "failed"
+	HookStatusTimeout = "timeout"
+)
+
+// POST_DOWNLOAD_HOOK is run through "sh -c" after every successful job, e.g. to
+// trigger a library scan. It gets FILE, URL, TITLE, FORMAT, USER and JOB_ID as env vars.
+var (
+	postDownloadHook        = getenv("POST_DOWNLOAD_HOOK")
+	postDownloadHookTimeout = parseEnvDuration("POST_DOWNLOAD_HOOK_TIMEOUT", 60*time.Second)
+	hookLog                 = componentLogger("hook")
+)
+
+// parseEnvDuration reads a positive duration like "90s" from the environment
+func parseEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := getenv(key)
+	if value == "" {
+		return fallback
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		configLog.Warn("Invalid duration", "key", key, "value", value, "using", fallback.String())
+		return fallback
+	}
+	return timeout
+}
+
+// parseEnvInt reads a positive number from the environment
+func parseEnvInt(key string, fallback int) int {
+	value := getenv(key)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		configLog.Warn("Invalid number", "key", key, "value", value, "using", fallback)
+		return fallback
+	}
+	return number
+}
+
+// parseEnvDurationOrOff is parseEnvDuration for settings where "0" turns the feature off
+func parseEnvDurationOrOff(key string, fallback time.Duration) time.Duration {
+	if value := getenv(key); value == "0" || strings.EqualFold(value, "off") {
+		return 0
+	}
+	return parseEnvDuration(key, fallback)
+}
+
+// runPostDownloadHook executes the configured hook for a finished file.
+// The hook's output goes to the job log; failures only fail the hook step.
+func runPostDownloadHook(sessionID, filename, user string) error {
+	if postDownloadHook == "" {
+		return nil
+	}
+
+	job, _ := getJob(sessionID)
+	absPath, err := filepath.Abs(filepath.Join(downloadsDir, filename))
+	if err != nil {
+		absPath = filepath.Join(downloadsDir, filename)
+	}
+	title := ""
+	if job.Metadata != nil {
+		title = job.Metadata.Title
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postDownloadHookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", postDownloadHook)
+	cmd.Env = append(os.Environ(),
+		"FILE="+absPath,
+		"URL="+job.URL,
+		"TITLE="+title,
+		"FORMAT="+job.Format,
+		"USER="+user,
+		"JOB_ID="+sessionID,
+	)
+	cmd.WaitDelay = 5 * time.Second // Don't hang on pipes held open by children
+
+	started := time.Now()
+	output, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			appendJobLog(sessionID, "[hook] "+line)
+		}
+	}
+
+	status := HookStatusOK
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		status = HookStatusTimeout
+		appendJobLog(sessionID, fmt.Sprintf("[hook] timed out after %s", postDownloadHookTimeout))
+	case err != nil:
+		status = HookStatusFailed
+		appendJobLog(sessionID, fmt.Sprintf("[hook] %v", err))
+	}
+	updateJob(sessionID, func(job *Job) { job.Hook = status })
+
+	jobLogger(hookLog, sessionID, StepHook).Info("Hook finished", "status", status, "duration", time.Since(started).Round(time.Millisecond).String())
+	if status != HookStatusOK {
+		return fmt.Errorf("hook %s", status)
+	}
+	return nil
+}
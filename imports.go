@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ytdownloader/resolver"
+)
+
+// Imports turn Google Takeout watch history/watch later exports or plain URL lists
+// into a reviewable batch. Nothing is downloaded until items are explicitly queued.
+const (
+	maxImportBytes     = 32 << 20 // Takeout histories get large
+	maxImportItems     = 10000
+	importPrefetch     = 3 // Upcoming items extracted while the current one downloads
+	importBatchTTL     = 24 * time.Hour
+	ImportItemPending  = "pending"
+	ImportItemDup      = "duplicate" // Already downloaded or listed twice
+	ImportItemQueued   = "queued"
+	ImportItemStarted  = "started"
+	ImportItemRejected = "rejected" // Invalid URL or options
+)
+
+// ImportBatch is an uploaded list waiting for review
+type ImportBatch struct {
+	ID        string       `json:"id"`
+	Source    string       `json:"source"` // takeout, list
+	CreatedAt time.Time    `json:"createdAt"`
+	Items     []ImportItem `json:"items"`
+	Owner     string       `json:"-"` // Owner of the jobs started from the batch
+}
+
+// ImportItem is a single video of an import batch
+type ImportItem struct {
+	URL       string `json:"url"`
+	VideoID   string `json:"videoId"`
+	Title     string `json:"title,omitempty"`
+	Status    string `json:"status"`
+	SessionID string `json:"sessionId,omitempty"` // Job once started
+	Token     string `json:"token,omitempty"`     // Session token of the job, see sessions.go
+	Message   string `json:"message,omitempty"`
+}
+
+// takeoutEntry is an entry of Takeout's watch-history.json
+type takeoutEntry struct {
+	Title    string `json:"title"`
+	TitleURL string `json:"titleUrl"`
+}
+
+var (
+	importBatches      = make(map[string]*ImportBatch)
+	importBatchesMutex sync.Mutex
+	importLog          = componentLogger("import")
+)
+
+// handleImport creates a batch from an uploaded file (raw body or multipart field "file"): POST /imports
+func handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, formErr := r.FormFile("file")
+		if formErr != nil {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "Datei fehlt (Feld \"file\")"})
+			return
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+	} else {
+		data, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		writeJSONStatus(w, http.StatusRequestEntityTooLarge, map[string]interface{}{"success": false, "message": "Datei zu groß"})
+		return
+	}
+
+	source, items := parseImport(data)
+	if len(items) == 0 {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "Keine YouTube-Links gefunden"})
+		return
+	}
+
+	batch := &ImportBatch{
+		ID:        newImportID(),
+		Source:    source,
+		CreatedAt: time.Now(),
+		Items:     dedupeImportItems(items),
+		Owner:     requestOwner(r),
+	}
+
+	importBatchesMutex.Lock()
+	importBatches[batch.ID] = batch
+	importBatchesMutex.Unlock()
+
+	importLog.Info("Batch created", "batch", batch.ID, "items", len(batch.Items), "source", source)
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "batch": batch})
+}
+
+// parseImport detects Takeout JSON, otherwise treats the file as a list with one URL or video ID per line
+// (Takeout's watch later CSV has the video ID in the first column)
+func parseImport(data []byte) (string, []ImportItem) {
+	var entries []takeoutEntry
+	if json.Unmarshal(bytes.TrimSpace(data), &entries) == nil && len(entries) > 0 {
+		var items []ImportItem
+		for _, entry := range entries {
+			if entry.TitleURL == "" {
+				continue // Removed videos, ads, search entries
+			}
+			title := strings.TrimPrefix(entry.Title, "Watched ")
+			title = strings.TrimSuffix(title, " angesehen")
+			items = appendImportItem(items, entry.TitleURL, title)
+		}
+		return "takeout", items
+	}
+
+	var items []ImportItem
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		field, _, _ := strings.Cut(line, ",")
+		field = strings.TrimSpace(field)
+		if !strings.Contains(field, "://") && len(field) == 11 {
+			field = "https://www.youtube.com/watch?v=" + field
+		}
+		items = appendImportItem(items, field, "")
+	}
+	return "list", items
+}
+
+func appendImportItem(items []ImportItem, rawURL, title string) []ImportItem {
+	if len(items) >= maxImportItems || !resolver.IsYouTubeURL(rawURL) {
+		return items
+	}
+	cleaned, err := cleanURL(rawURL)
+	if err != nil {
+		return items
+	}
+	videoID := resolver.VideoID(cleaned)
+	if videoID == "" {
+		return items
+	}
+	return append(items, ImportItem{URL: cleaned, VideoID: videoID, Title: title, Status: ImportItemPending})
+}
+
+// dedupeImportItems marks videos that were already downloaded or appear more than once
+func dedupeImportItems(items []ImportItem) []ImportItem {
+	downloaded := completedVideoIDs()
+	seen := make(map[string]bool, len(items))
+	for i := range items {
+		switch {
+		case downloaded[items[i].VideoID]:
+			items[i].Status = ImportItemDup
+			items[i].Message = "Bereits heruntergeladen"
+		case seen[items[i].VideoID]:
+			items[i].Status = ImportItemDup
+			items[i].Message = "Doppelt in der Liste"
+		}
+		seen[items[i].VideoID] = true
+	}
+	return items
+}
+
+// handleImportBatch shows a batch (GET /imports/{id}) or queues selected items (POST /imports/{id}/queue)
+func handleImportBatch(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	action := ""
+	if strings.HasSuffix(r.URL.Path, "/queue") {
+		action = "queue"
+	}
+
+	importBatchesMutex.Lock()
+	batch, ok := importBatches[id]
+	importBatchesMutex.Unlock()
+	// Other owners' batches look missing, like jobVisibleTo
+	if !ok || !(isAdminRequest(r) || batch.Owner == requestOwner(r)) {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Import nicht gefunden"})
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		importBatchesMutex.Lock()
+		snapshot := *batch
+		snapshot.Items = append([]ImportItem(nil), batch.Items...)
+		importBatchesMutex.Unlock()
+		writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "batch": snapshot})
+	case action == "queue" && r.Method == http.MethodPost:
+		queueImportBatch(w, r, batch)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// importQueueRequest selects items by index; without indices all pending items are queued
+type importQueueRequest struct {
+	Format  string `json:"format"`
+	Indices []int  `json:"indices,omitempty"`
+}
+
+// queueImportBatch runs the selected items one after another so large imports don't start thousands of jobs
+func queueImportBatch(w http.ResponseWriter, r *http.Request, batch *ImportBatch) {
+	var body importQueueRequest
+	if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+		return
+	}
+	// Reject bad options once instead of for every item
+	if _, msg := validateDownloadRequest(DownloadRequest{URL: batch.Items[0].URL, Format: body.Format}); msg != "" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": msg})
+		return
+	}
+
+	importBatchesMutex.Lock()
+	selected := body.Indices
+	if selected == nil {
+		for i, item := range batch.Items {
+			if item.Status == ImportItemPending {
+				selected = append(selected, i)
+			}
+		}
+	}
+	var queue []int
+	for _, i := range selected {
+		if i >= 0 && i < len(batch.Items) && (batch.Items[i].Status == ImportItemPending || batch.Items[i].Status == ImportItemDup) {
+			batch.Items[i].Status = ImportItemQueued
+			queue = append(queue, i)
+		}
+	}
+	importBatchesMutex.Unlock()
+
+	goGuarded("import queue", func() { runImportQueue(batch, queue, body.Format) })
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "queued": len(queue)})
+}
+
+// runImportQueue starts the next item once the previous job finished. Meanwhile the
+// following items are extracted in the background, so their jobs can skip that step.
+func runImportQueue(batch *ImportBatch, queue []int, format string) {
+	slots := make(chan struct{}, importPrefetch)
+	prefetched := 1 // The first item extracts itself
+	for pos, i := range queue {
+		for ; extractionEnabled && prefetched < len(queue) && prefetched <= pos+importPrefetch; prefetched++ {
+			index := queue[prefetched]
+			goGuarded("import prefetch", func() { prefetchImportItem(batch, index, slots) })
+		}
+
+		importBatchesMutex.Lock()
+		req := DownloadRequest{URL: batch.Items[i].URL, Format: format, Owner: batch.Owner}
+		importBatchesMutex.Unlock()
+
+		cleanedURL, msg := validateDownloadRequest(req)
+		if msg != "" {
+			setImportItem(batch, i, ImportItemRejected, "", msg)
+			continue
+		}
+
+		done := make(chan struct{})
+		sessionID := startJob(cleanedURL, req, "import:"+batch.ID, func(Job) { close(done) })
+		setImportItem(batch, i, ImportItemStarted, sessionID, "")
+		<-done
+	}
+	importLog.Info("Batch processed", "batch", batch.ID, "items", len(queue))
+}
+
+// prefetchImportItem caches the extraction of a queued item, see extractcache.go
+func prefetchImportItem(batch *ImportBatch, index int, slots chan struct{}) {
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	importBatchesMutex.Lock()
+	item := batch.Items[index]
+	importBatchesMutex.Unlock()
+
+	// The job may have started while waiting for a slot
+	if item.Status != ImportItemQueued {
+		return
+	}
+	if _, ok := cachedExtractionPath(item.URL); ok {
+		return
+	}
+	if _, _, err := probeInfo(item.URL); err != nil {
+		importLog.Warn("Prefetching failed", "batch", batch.ID, "video", item.VideoID, "error", err)
+	}
+}
+
+func setImportItem(batch *ImportBatch, index int, status, sessionID, message string) {
+	importBatchesMutex.Lock()
+	defer importBatchesMutex.Unlock()
+	batch.Items[index].Status = status
+	batch.Items[index].SessionID = sessionID
+	batch.Items[index].Token = ""
+	if sessionID != "" {
+		batch.Items[index].Token = sessionToken(sessionID)
+	}
+	batch.Items[index].Message = message
+}
+
+// cleanupImportBatches removes batches older than importBatchTTL
+func cleanupImportBatches() {
+	importBatchesMutex.Lock()
+	defer importBatchesMutex.Unlock()
+	for id, batch := range importBatches {
+		if time.Since(batch.CreatedAt) > importBatchTTL {
+			delete(importBatches, id)
+		}
+	}
+}
+
+func newImportID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
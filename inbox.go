@@ -0,0 +1,232 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The inbox is a folder for media that already exists (recordings, old downloads).
+// Files dropped there are converted with INBOX_FORMAT once they stopped growing;
+// single files can also be submitted with other options via POST /inbox.
+// Processed files are moved to .done/ or .failed/ inside the inbox.
+var (
+	inboxDir          = getenv("INBOX_DIR")
+	inboxFormat       = getEnvDefault("INBOX_FORMAT", "mp3")
+	inboxWatch        = getEnvDefault("INBOX_WATCH", "true") == "true"
+	inboxPollInterval = parseEnvDuration("INBOX_POLL_INTERVAL", 30*time.Second)
+	inboxLog          = componentLogger("inbox")
+)
+
+// Subfolders for processed files
+const (
+	inboxDoneDir   = ".done"
+	inboxFailedDir = ".failed"
+)
+
+// inboxBusy holds the inbox files with a running job
+var (
+	inboxBusy      = make(map[string]bool)
+	inboxBusyMutex sync.Mutex
+)
+
+// claimInboxFile marks a file as being processed; false if it already is
+func claimInboxFile(srcPath string) bool {
+	inboxBusyMutex.Lock()
+	defer inboxBusyMutex.Unlock()
+	if inboxBusy[srcPath] {
+		return false
+	}
+	inboxBusy[srcPath] = true
+	return true
+}
+
+// inboxRequest submits one inbox file: POST /inbox
+type inboxRequest struct {
+	DownloadRequest        // Format and processing options; URL is ignored
+	Path            string `json:"path"` // Relative to INBOX_DIR
+}
+
+// inboxFile is a file waiting in the inbox
+type inboxFile struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// listInbox returns all unprocessed files, skipping hidden files and folders
+func listInbox() ([]inboxFile, error) {
+	var files []inboxFile
+	err := filepath.WalkDir(inboxDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != inboxDir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(inboxDir, path)
+		if err != nil {
+			return nil
+		}
+		files = append(files, inboxFile{Path: filepath.ToSlash(rel), Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, err
+}
+
+// inboxPath resolves a client supplied path and makes sure it stays inside the inbox
+func inboxPath(rel string) (string, bool) {
+	cleaned := filepath.Clean("/" + rel)
+	for _, part := range strings.Split(cleaned, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+	path := filepath.Join(inboxDir, cleaned)
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return path, true
+}
+
+// finishInboxFile moves a processed file out of the way so it is not picked up again
+func finishInboxFile(srcPath string, job Job) {
+	folder := inboxDoneDir
+	if job.Status != JobStatusCompleted {
+		folder = inboxFailedDir
+	}
+	rel, err := filepath.Rel(inboxDir, srcPath)
+	if err != nil {
+		return
+	}
+	dst := filepath.Join(inboxDir, folder, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+		err = os.Rename(srcPath, dst)
+	}
+	if err != nil {
+		inboxLog.Error("Could not move file", "file", rel, "folder", folder, "error", err)
+	}
+
+	inboxBusyMutex.Lock()
+	delete(inboxBusy, srcPath)
+	inboxBusyMutex.Unlock()
+}
+
+// runInboxWatcher polls the inbox and converts files one at a time. A file is only
+// picked up when its size and modification time did not change since the last poll.
+func runInboxWatcher() {
+	if inboxDir == "" || !inboxWatch || demoMode {
+		return
+	}
+	if err := os.MkdirAll(inboxDir, 0755); err != nil {
+		inboxLog.Error("Cannot create the inbox", "path", inboxDir, "error", err)
+		return
+	}
+	inboxLog.Info("Watching inbox", "path", inboxDir, "interval", inboxPollInterval.String(), "format", inboxFormat)
+
+	seen := make(map[string]inboxFile)
+	for range time.Tick(inboxPollInterval) {
+		files, err := listInbox()
+		if err != nil {
+			inboxLog.Error("Listing the inbox failed", "path", inboxDir, "error", err)
+			continue
+		}
+
+		current := make(map[string]inboxFile, len(files))
+		for _, file := range files {
+			current[file.Path] = file
+			previous, ok := seen[file.Path]
+			if !ok || previous.Size != file.Size || !previous.Modified.Equal(file.Modified) {
+				continue // New or still being written
+			}
+
+			srcPath := filepath.Join(inboxDir, filepath.FromSlash(file.Path))
+			if !claimInboxFile(srcPath) {
+				continue // Submitted via POST /inbox
+			}
+			done := make(chan struct{})
+			req := DownloadRequest{Format: inboxFormat}
+			sessionID := startLocalJob(srcPath, "inbox:"+file.Path, req, "inbox", func(job Job) {
+				finishInboxFile(srcPath, job)
+				close(done)
+			})
+			inboxLog.Info("Converting file", "file", file.Path, "session", sessionID)
+			<-done
+			delete(current, file.Path)
+		}
+		seen = current
+	}
+}
+
+// handleInbox lists waiting files (GET) or converts one with custom options (POST)
+func handleInbox(w http.ResponseWriter, r *http.Request) {
+	if inboxDir == "" {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Kein Eingangsordner konfiguriert"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		files, err := listInbox()
+		if err != nil {
+			inboxLog.Error("Listing the inbox failed", "path", inboxDir, "error", err)
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Eingangsordner konnte nicht gelesen werden"})
+			return
+		}
+		writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "files": files})
+
+	case http.MethodPost:
+		var body inboxRequest
+		if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+			writeJSONStatus(w, reqErr.status, DownloadResponse{Success: false, Message: reqErr.message})
+			return
+		}
+		srcPath, ok := inboxPath(body.Path)
+		if !ok {
+			writeJSONStatus(w, http.StatusNotFound, DownloadResponse{Success: false, Message: "Datei nicht im Eingangsordner gefunden"})
+			return
+		}
+
+		req := applyCollectionDefaults(body.DownloadRequest)
+		if req.Format == "" {
+			req.Format = inboxFormat
+		}
+		if msg := validateDownloadOptions(req); msg != "" {
+			writeJSONStatus(w, http.StatusBadRequest, DownloadResponse{Success: false, Message: msg})
+			return
+		}
+
+		if !claimInboxFile(srcPath) {
+			writeJSONStatus(w, http.StatusConflict, DownloadResponse{Success: false, Message: "Datei wird bereits verarbeitet"})
+			return
+		}
+
+		rel, _ := filepath.Rel(inboxDir, srcPath)
+		user := remoteIP(r)
+		req.Owner = requestOwner(r)
+		sessionID := startLocalJob(srcPath, "inbox:"+filepath.ToSlash(rel), req, user, func(job Job) {
+			finishInboxFile(srcPath, job)
+		})
+		sendJSONResponse(w, DownloadResponse{Success: true, Message: sessionID, Filename: sessionID, Token: sessionToken(sessionID)})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
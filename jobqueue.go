@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Jobs run on a fixed pool of workers, so a burst of requests can't start dozens of
+// yt-dlp and ffmpeg processes at once. MAX_CONCURRENT_DOWNLOADS sets the pool size;
+// further jobs wait in FIFO order and see their position in the progress stream.
+const defaultConcurrentDownloads = 3
+
+var maxConcurrentDownloads = parseConcurrentDownloads(getenv("MAX_CONCURRENT_DOWNLOADS"))
+
+// queuedJob is a job waiting for a worker
+type queuedJob struct {
+	sessionID string
+	run       func()
+}
+
+var (
+	jobQueue        []queuedJob
+	jobQueueRunning int  // Jobs currently on a worker
+	jobQueueStopped bool // Set by the shutdown; queued jobs are left for recovery
+	jobQueueMutex   sync.Mutex
+	jobQueueReady   = sync.NewCond(&jobQueueMutex)
+	startWorkers    sync.Once
+)
+
+// parseConcurrentDownloads reads the worker pool size, at least 1
+func parseConcurrentDownloads(value string) int {
+	if value == "" {
+		return defaultConcurrentDownloads
+	}
+	workers, err := strconv.Atoi(value)
+	if err != nil || workers < 1 {
+		configLog.Warn("Invalid MAX_CONCURRENT_DOWNLOADS", "value", value, "using", defaultConcurrentDownloads)
+		return defaultConcurrentDownloads
+	}
+	return workers
+}
+
+// enqueueJob marks the job as queued and runs it on the next free worker
+func enqueueJob(sessionID string, run func()) {
+	startWorkers.Do(func() {
+		jobLog.Info("Starting download workers", "workers", maxConcurrentDownloads)
+		for i := 0; i < maxConcurrentDownloads; i++ {
+			goGuarded("download worker", runDownloadWorker)
+		}
+	})
+
+	updateJob(sessionID, func(job *Job) { job.Status = JobStatusQueued })
+
+	jobQueueMutex.Lock()
+	jobQueue = append(jobQueue, queuedJob{sessionID: sessionID, run: run})
+	jobQueueMutex.Unlock()
+	jobQueueReady.Signal()
+
+	announceQueuePositions()
+}
+
+// runDownloadWorker runs queued jobs one after another
+func runDownloadWorker() {
+	for {
+		jobQueueMutex.Lock()
+		for len(jobQueue) == 0 || jobQueueStopped {
+			jobQueueReady.Wait()
+		}
+		next := jobQueue[0]
+		jobQueue = jobQueue[1:]
+		jobQueueRunning++
+		jobQueueMutex.Unlock()
+
+		updateJob(next.sessionID, func(job *Job) {
+			job.Status = JobStatusRunning
+			job.QueuePosition = 0
+		})
+		announceQueuePositions()
+
+		next.run()
+
+		jobQueueMutex.Lock()
+		jobQueueRunning--
+		jobQueueMutex.Unlock()
+	}
+}
+
+// announceQueuePositions tells every job that has to wait for a worker its position.
+// Jobs an idle worker is about to pick up are skipped.
+func announceQueuePositions() {
+	jobQueueMutex.Lock()
+	idle := maxConcurrentDownloads - jobQueueRunning
+	var waiting []string
+	for i, queued := range jobQueue {
+		if i >= idle {
+			waiting = append(waiting, queued.sessionID)
+		}
+	}
+	jobQueueMutex.Unlock()
+
+	for i, sessionID := range waiting {
+		position := i + 1
+		if job, ok := getJob(sessionID); !ok || job.QueuePosition == position {
+			continue
+		}
+		updateJob(sessionID, func(job *Job) { job.QueuePosition = position })
+		sendProgress(sessionID, 0, fmt.Sprintf("In der Warteschlange, Position %d", position))
+	}
+}
+
+// removeQueuedJob takes a job out of the queue and returns its run function
+func removeQueuedJob(sessionID string) (func(), bool) {
+	jobQueueMutex.Lock()
+	var run func()
+	for i, queued := range jobQueue {
+		if queued.sessionID == sessionID {
+			run = queued.run
+			jobQueue = append(jobQueue[:i:i], jobQueue[i+1:]...)
+			break
+		}
+	}
+	jobQueueMutex.Unlock()
+
+	if run == nil {
+		return nil, false
+	}
+	announceQueuePositions()
+	return run, true
+}
+
+// stopJobQueue keeps the workers from starting further jobs and returns the queued ones
+func stopJobQueue() []string {
+	jobQueueMutex.Lock()
+	defer jobQueueMutex.Unlock()
+	jobQueueStopped = true
+	queued := make([]string, 0, len(jobQueue))
+	for _, job := range jobQueue {
+		queued = append(queued, job.sessionID)
+	}
+	return queued
+}
+
+// queueLength returns the number of jobs waiting for a worker and the number running
+func queueLength() (waiting, running int) {
+	jobQueueMutex.Lock()
+	defer jobQueueMutex.Unlock()
+	return len(jobQueue), jobQueueRunning
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"ytdownloader/resolver"
+)
+
+// Job status values
+const (
+	JobStatusQueued    = "queued" // Waiting for a download worker, see jobqueue.go
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// maxJobLogLines is the number of yt-dlp output lines kept per job
+const maxJobLogLines = 50
+
+// Job tracks a single download from request to completion
+type Job struct {
+	SessionID      string           `json:"sessionId"`
+	URL            string           `json:"url"`
+	Format         string           `json:"format"`
+	Status         string           `json:"status"`
+	Progress       int              `json:"progress"`                // Last reported progress in percent
+	QueuePosition  int              `json:"queuePosition,omitempty"` // 1 is next while queued
+	Paused         bool             `json:"paused,omitempty"`        // Download stopped until resumed
+	Filename       string           `json:"filename,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	ErrorCode      string           `json:"errorCode,omitempty"`
+	ErrorHint      string           `json:"errorHint,omitempty"`
+	Channel        string           `json:"channel"`         // yt-dlp release channel (stable/canary)
+	Binary         string           `json:"-"`               // yt-dlp binary used for this job
+	Flags          FlagSet          `json:"flags,omitempty"` // Feature flags in rollout at the start, true if used
+	Versions       ToolVersions     `json:"versions"`
+	Waveform       bool             `json:"waveform"`        // Peaks available at /jobs/{id}/waveform.json
+	Parts          []string         `json:"parts,omitempty"` // Split parts, archive at /jobs/{id}/parts.zip
+	Lyrics         bool             `json:"lyrics"`          // Lyrics available at /jobs/{id}/lyrics.lrc
+	LyricsFile     string           `json:"-"`
+	Transcript     bool             `json:"transcript"`         // Transcript available at /jobs/{id}/transcript
+	TranscriptFile string           `json:"-"`                  // Relative path without .srt/.txt extension
+	Summary        string           `json:"summary,omitempty"`  // Transcript summary from the summarizer
+	Language       string           `json:"language,omitempty"` // ISO 639-1 code of the spoken language, if known
+	Section        *MediaSection    `json:"section,omitempty"`  // Downloaded range if not the whole video
+	Warnings       []JobWarning     `json:"warnings,omitempty"` // Non-fatal problems during the job
+	Metadata       *VideoMetadata   `json:"metadata,omitempty"`
+	AudioTags      *AudioTags       `json:"audioTags,omitempty"`     // Corrected tags written to the file
+	Hook           string           `json:"hook,omitempty"`          // Post-download hook result (ok/failed/timeout)
+	LibraryImport  string           `json:"libraryImport,omitempty"` // Music library import result (imported/queued/failed)
+	LibraryScan    string           `json:"libraryScan,omitempty"`   // Jellyfin/Plex scan result (triggered/failed)
+	TransferURLs   []string         `json:"transferUrls,omitempty"`  // External copies from TRANSFER_SERVICE
+	DeletedAt      *time.Time       `json:"deletedAt,omitempty"`     // In the trash since
+	Tags           []string         `json:"tags,omitempty"`          // Free-form user tags
+	Collection     string           `json:"collection,omitempty"`    // Collection the file was saved into
+	Torrent        bool             `json:"torrent"`                 // Torrent available at /jobs/{id}/torrent, web seed at /seed/{SeedKey}/
+	TorrentFile    string           `json:"-"`
+	SeedKey        string           `json:"-"`
+	CreatedAt      time.Time        `json:"createdAt"`
+	FinishedAt     time.Time        `json:"finishedAt"`
+	LogLines       []string         `json:"logLines,omitempty"`
+	Steps          []JobStep        `json:"steps,omitempty"`     // Download, post-processing and the steps after it
+	Resources      *JobResources    `json:"resources,omitempty"` // CPU, memory and traffic used so far
+	Requester      string           `json:"-"`                   // User who started the job, for retried steps
+	Request        *DownloadRequest `json:"-"`                   // Options of the job, for retried steps
+	Chapters       []Chapter        `json:"-"`                   // Chapters of the file, for the split step
+	Owner          string           `json:"-"`                   // Who may list the job, see requestOwner
+}
+
+var (
+	jobs         = make(map[string]*Job) // Jobs by session ID
+	jobsMutex    sync.RWMutex
+	jobRetention = parseJobRetention(getenv("JOB_RETENTION")) // Keep finished jobs for 1 hour by default
+)
+
+// createJob registers a new running job for the given session and yt-dlp channel
+func createJob(sessionID, url, format, channel, binary string) {
+	versions := toolVersionsFor(binary)
+	issueSessionToken(sessionID) // Before the job is visible, so it is never unprotected
+
+	jobsMutex.Lock()
+	jobs[sessionID] = &Job{
+		SessionID: sessionID,
+		URL:       url,
+		Format:    format,
+		Status:    JobStatusRunning,
+		Channel:   channel,
+		Binary:    binary,
+		Versions:  versions,
+		CreatedAt: time.Now(),
+	}
+	jobsMutex.Unlock()
+
+	emitJobEvent(EventJobCreated, sessionID, nil, "")
+}
+
+// isActive reports whether the job is queued or running
+func (job Job) isActive() bool {
+	return job.Status == JobStatusQueued || job.Status == JobStatusRunning
+}
+
+// getJob returns a copy of the job so callers can read it without holding the lock
+func getJob(sessionID string) (Job, bool) {
+	jobsMutex.RLock()
+	defer jobsMutex.RUnlock()
+
+	job, ok := jobs[sessionID]
+	if !ok {
+		return Job{}, false
+	}
+	snapshot := *job
+	snapshot.LogLines = append([]string(nil), job.LogLines...)
+	snapshot.Parts = append([]string(nil), job.Parts...)
+	snapshot.Tags = append([]string(nil), job.Tags...)
+	snapshot.Steps = append([]JobStep(nil), job.Steps...)
+	return snapshot, true
+}
+
+// appendJobLog stores a yt-dlp output line, keeping only the last maxJobLogLines
+func appendJobLog(sessionID, line string) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	job, ok := jobs[sessionID]
+	if !ok {
+		return
+	}
+	job.LogLines = append(job.LogLines, line)
+	if len(job.LogLines) > maxJobLogLines {
+		job.LogLines = job.LogLines[len(job.LogLines)-maxJobLogLines:]
+	}
+}
+
+// finishJob marks a job as completed or failed
+func finishJob(sessionID, filename string, jobErr error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	job, ok := jobs[sessionID]
+	if !ok {
+		return
+	}
+	job.FinishedAt = time.Now()
+	if jobErr == errJobCancelled {
+		job.Status = JobStatusCancelled
+		job.ErrorCode = errJobCancelled.Code
+		return
+	}
+	if jobErr != nil {
+		job.Status = JobStatusFailed
+		job.Error = jobErr.Error()
+		job.ErrorCode = downloadErrorCode(jobErr)
+		job.ErrorHint = errorHint(jobErr)
+		return
+	}
+	job.Status = JobStatusCompleted
+	job.Progress = 100
+	job.Filename = filename
+}
+
+// updateJob applies fn to the job under the lock; unknown sessions are ignored
+func updateJob(sessionID string, fn func(job *Job)) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	if job, ok := jobs[sessionID]; ok {
+		fn(job)
+	}
+}
+
+// cleanupJobs removes finished jobs older than jobRetention
+func cleanupJobs() {
+	jobsMutex.Lock()
+	var removed []Job
+	now := time.Now()
+	for sessionID, job := range jobs {
+		// Trashed jobs are kept until cleanupTrash purges them
+		if !job.isActive() && job.DeletedAt == nil && now.Sub(job.FinishedAt) > jobRetention {
+			removed = append(removed, *job)
+			delete(jobs, sessionID)
+		}
+	}
+	jobsMutex.Unlock()
+
+	for _, job := range removed {
+		publishEvent(LifecycleEvent{Type: EventJobPurged, SessionID: job.SessionID, Job: job, Detail: jobRetentionExpired})
+	}
+}
+
+// deleteJob removes a finished job from the store; queued and running jobs are kept
+func deleteJob(sessionID string) bool {
+	jobsMutex.Lock()
+	job, ok := jobs[sessionID]
+	if !ok || job.isActive() {
+		jobsMutex.Unlock()
+		return false
+	}
+	delete(jobs, sessionID)
+	jobsMutex.Unlock()
+
+	publishEvent(LifecycleEvent{Type: EventJobPurged, SessionID: sessionID, Job: *job})
+	return true
+}
+
+// findJobByFilename returns the job that produced a file, given relative to ./downloads
+func findJobByFilename(filename string) (Job, bool) {
+	jobsMutex.RLock()
+	defer jobsMutex.RUnlock()
+
+	for _, job := range jobs {
+		if job.Filename == filename {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+// completedVideoIDs returns the video IDs of all successful jobs
+func completedVideoIDs() map[string]bool {
+	jobsMutex.RLock()
+	defer jobsMutex.RUnlock()
+
+	ids := make(map[string]bool)
+	for _, job := range jobs {
+		if job.Status == JobStatusCompleted && job.DeletedAt == nil {
+			ids[resolver.VideoID(job.URL)] = true
+		}
+	}
+	return ids
+}
+
+// findCompletedJob returns the most recent successful job for a video ID in the given
+// format; another format of the same video is not a duplicate
+func findCompletedJob(videoID, format string) (Job, bool) {
+	if videoID == "" {
+		return Job{}, false
+	}
+
+	jobsMutex.RLock()
+	defer jobsMutex.RUnlock()
+
+	var found *Job
+	for _, job := range jobs {
+		if job.Status != JobStatusCompleted || job.DeletedAt != nil || job.Format != format || resolver.VideoID(job.URL) != videoID {
+			continue
+		}
+		if found == nil || job.FinishedAt.After(found.FinishedAt) {
+			found = job
+		}
+	}
+	if found == nil {
+		return Job{}, false
+	}
+	snapshot := *found
+	snapshot.LogLines = nil
+	return snapshot, true
+}
+
+// listJobs returns copies of all known jobs, newest first
+func listJobs() []Job {
+	jobsMutex.RLock()
+	list := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		snapshot := *job
+		snapshot.LogLines = nil // Logs are only included for single job lookups
+		snapshot.Steps = append([]JobStep(nil), job.Steps...)
+		list = append(list, snapshot)
+	}
+	jobsMutex.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// handleListJobs returns the caller's jobs including the tool versions they ran with;
+// the admin gets all jobs
+func handleListJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Trashed jobs are only listed with ?trash=true
+	trash := r.URL.Query().Get("trash") == "true"
+	list := []Job{}
+	for _, job := range listJobs() {
+		if (job.DeletedAt != nil) == trash && jobVisibleTo(r, job) {
+			list = append(list, job)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"jobs":    list,
+	})
+}
+
+// withJobID adapts a handler taking the session ID to a /jobs/{id}/... route
+// and checks the session token
+func withJobID(handler func(w http.ResponseWriter, r *http.Request, sessionID string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := pathParam(r, "id")
+		if !requireSessionOwner(w, r, sessionID) {
+			return
+		}
+		handler(w, r, sessionID)
+	}
+}
+
+// handleGetJob returns a single job by session ID: GET /jobs/{id}.
+// Artifacts and actions below /jobs/{id} are routed in newRouter.
+func handleGetJob(w http.ResponseWriter, r *http.Request) {
+	sessionID := pathParam(r, "id")
+	if !requireSessionOwner(w, r, sessionID) {
+		return
+	}
+
+	job, ok := getJob(sessionID)
+	if !ok {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"message": "Job nicht gefunden",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"job":     job,
+	})
+}
+
+func deleteJobHandler(w http.ResponseWriter, sessionID string, purge bool) {
+	if purge {
+		respondJobAction(w, purgeJob(sessionID))
+		return
+	}
+	respondJobAction(w, trashJob(sessionID))
+}
+
+// respondJobAction writes the JSON result of a job action
+func respondJobAction(w http.ResponseWriter, err error) {
+	if err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, errJobNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSONStatus(w, status, map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func parseJobRetention(value string) time.Duration {
+	if value == "" {
+		return 1 * time.Hour
+	}
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention <= 0 {
+		configLog.Warn("Invalid JOB_RETENTION, using 1h", "value", value)
+		return 1 * time.Hour
+	}
+	return retention
+}
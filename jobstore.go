@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Jobs are written to an embedded BoltDB file, so history survives restarts. On
+// startup jobs finished within JOB_RETENTION (and trashed jobs) are loaded back
+// together with their session tokens; older jobs stay in the file as history and
+// are served by /history until JOB_HISTORY_RETENTION. Jobs that were queued or
+// running when the server stopped are queued again or marked as failed, see
+// recovery.go. JOB_STORE=off keeps everything in memory as before.
+const (
+	jobStoreBucket        = "jobs"
+	jobRetentionExpired   = "retention expired" // Detail of the purge event when a job leaves memory
+	jobInterruptedCode    = "interrupted"
+	jobInterruptedMessage = "Der Download wurde durch einen Neustart des Servers unterbrochen"
+)
+
+var (
+	jobStore            *bolt.DB
+	jobStorePath        = getEnvDefault("JOB_STORE", metadataDir+"/jobs.db")
+	jobHistoryRetention = parseEnvDurationOrOff("JOB_HISTORY_RETENTION", 90*24*time.Hour)
+	jobStoreLog         = componentLogger("jobstore")
+)
+
+// storedJob is the persisted form of a job, including the fields hidden from the API
+type storedJob struct {
+	Job
+	Binary         string           `json:"binary,omitempty"`
+	LyricsFile     string           `json:"lyricsFile,omitempty"`
+	TranscriptFile string           `json:"transcriptFile,omitempty"`
+	TorrentFile    string           `json:"torrentFile,omitempty"`
+	SeedKey        string           `json:"seedKey,omitempty"`
+	Requester      string           `json:"requester,omitempty"`
+	Owner          string           `json:"owner,omitempty"`
+	Request        *DownloadRequest `json:"request,omitempty"`
+	Chapters       []Chapter        `json:"chapters,omitempty"`
+	Token          string           `json:"token,omitempty"` // Owner token while the job is in memory
+}
+
+func newStoredJob(job Job, token string) storedJob {
+	return storedJob{
+		Job:            job,
+		Binary:         job.Binary,
+		LyricsFile:     job.LyricsFile,
+		TranscriptFile: job.TranscriptFile,
+		TorrentFile:    job.TorrentFile,
+		SeedKey:        job.SeedKey,
+		Requester:      job.Requester,
+		Owner:          job.Owner,
+		Request:        job.Request,
+		Chapters:       job.Chapters,
+		Token:          token,
+	}
+}
+
+func (stored storedJob) job() Job {
+	job := stored.Job
+	job.Binary = stored.Binary
+	job.LyricsFile = stored.LyricsFile
+	job.TranscriptFile = stored.TranscriptFile
+	job.TorrentFile = stored.TorrentFile
+	job.SeedKey = stored.SeedKey
+	job.Requester = stored.Requester
+	job.Owner = stored.Owner
+	job.Request = stored.Request
+	job.Chapters = stored.Chapters
+	return job
+}
+
+// openJobStore opens the database and loads the jobs of the previous run
+func openJobStore() {
+	if demoMode || strings.EqualFold(jobStorePath, "off") {
+		return
+	}
+	if err := os.MkdirAll(metadataDir, 0755); err != nil {
+		configLog.Warn("Job store disabled", "error", err)
+		return
+	}
+	db, err := bolt.Open(jobStorePath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		configLog.Warn("Job store disabled, cannot open it", "path", jobStorePath, "error", err)
+		return
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{jobStoreBucket, jobRequestBucket, searchTermsBucket, searchDocsBucket, errorReportBucket, errorReportGroupBucket, blocklistBucket, termsBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		configLog.Warn("Job store disabled, cannot initialize it", "path", jobStorePath, "error", err)
+		return
+	}
+	jobStore = db
+	restoreJobs()
+	indexMissingJobs()
+	loadErrorReportGroups()
+	loadStoredBlocklist()
+	loadTermsAcceptances()
+}
+
+// restoreJobs puts recent jobs back into memory and queues or fails the jobs
+// interrupted by the restart
+func restoreJobs() {
+	var restored int
+	var recovered []recoveredJob
+	var failed []string
+	now := time.Now()
+	err := jobStore.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(jobStoreBucket))
+		return bucket.ForEach(func(key, value []byte) error {
+			var stored storedJob
+			if err := json.Unmarshal(value, &stored); err != nil {
+				jobStoreLog.Warn("Skipping unreadable job", "session", string(key), "error", err)
+				return nil
+			}
+			requeue := false
+			if stored.isActive() {
+				request, ok := takeRecoverableRequest(tx, stored.SessionID)
+				if ok && stored.Token != "" {
+					requeue = true
+					recovered = append(recovered, recoveredJob{sessionID: stored.SessionID, stored: request})
+				} else {
+					stored.Status = JobStatusFailed
+					stored.QueuePosition = 0
+					stored.Error = jobInterruptedMessage
+					stored.ErrorCode = jobInterruptedCode
+					stored.FinishedAt = now
+					data, err := json.Marshal(stored)
+					if err != nil {
+						return err
+					}
+					if err := bucket.Put(key, data); err != nil {
+						return err
+					}
+					failed = append(failed, stored.SessionID)
+				}
+			}
+			// Without a token the job would be open to everyone, so it stays history only
+			live := requeue || stored.DeletedAt != nil || now.Sub(stored.FinishedAt) <= jobRetention
+			if !live || stored.Token == "" {
+				return nil
+			}
+
+			job := stored.job()
+			jobsMutex.Lock()
+			jobs[job.SessionID] = &job
+			jobsMutex.Unlock()
+			restoreSessionToken(job.SessionID, stored.Token)
+			restored++
+			return nil
+		})
+	})
+	if err != nil {
+		jobStoreLog.Error("Restoring jobs failed", "path", jobStorePath, "error", err)
+	}
+	jobStoreLog.Info("Restored jobs", "path", jobStorePath, "jobs", restored, "requeued", len(recovered), "failed", len(failed))
+
+	for _, sessionID := range failed {
+		forgetJobRequest(sessionID)
+		notifyInterruptedJob(sessionID)
+	}
+	for _, job := range recovered {
+		requeueRecoveredJob(job)
+	}
+}
+
+// saveStoredJobs writes the jobs in one transaction. With inMemoryOnly, jobs removed
+// from memory meanwhile are skipped, so a periodic sync can't bring back a deleted job.
+func saveStoredJobs(list []storedJob, inMemoryOnly bool) {
+	if jobStore == nil || len(list) == 0 {
+		return
+	}
+	err := jobStore.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(jobStoreBucket))
+		for _, stored := range list {
+			if _, ok := getJob(stored.SessionID); inMemoryOnly && !ok {
+				continue
+			}
+			data, err := json.Marshal(stored)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(stored.SessionID), data); err != nil {
+				return err
+			}
+			if err := indexStoredJob(tx, stored.job()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		jobStoreLog.Error("Failed to save jobs", "jobs", len(list), "error", err)
+	}
+}
+
+func deleteStoredJob(sessionID string) {
+	if jobStore == nil {
+		return
+	}
+	err := jobStore.Update(func(tx *bolt.Tx) error {
+		if err := unindexStoredJob(tx, sessionID); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(jobStoreBucket)).Delete([]byte(sessionID))
+	})
+	if err != nil {
+		jobStoreLog.Error("Failed to delete job", "session", sessionID, "error", err)
+	}
+}
+
+// recordJobStoreEvent persists the job on lifecycle events. A job leaving memory after
+// JOB_RETENTION stays as history without its token; deleted jobs are removed.
+func recordJobStoreEvent(event LifecycleEvent) {
+	if jobStore == nil {
+		return
+	}
+	if event.Type == EventJobFinished {
+		forgetJobRequest(event.SessionID)
+	}
+	switch {
+	case event.Type != EventJobPurged:
+		saveStoredJobs([]storedJob{newStoredJob(event.Job, sessionToken(event.SessionID))}, false)
+	case event.Detail == jobRetentionExpired:
+		saveStoredJobs([]storedJob{newStoredJob(event.Job, "")}, false)
+	default:
+		deleteStoredJob(event.SessionID)
+	}
+}
+
+// saveJob persists a job changed without a lifecycle event
+func saveJob(sessionID string) {
+	if job, ok := getJob(sessionID); ok {
+		saveStoredJobs([]storedJob{newStoredJob(job, sessionToken(sessionID))}, false)
+	}
+}
+
+// syncJobStore saves all jobs in memory, which picks up changes without a lifecycle
+// event (tags, trash, library results), and drops history older than JOB_HISTORY_RETENTION
+func syncJobStore() {
+	if jobStore == nil {
+		return
+	}
+	var list []storedJob
+	for _, job := range listJobs() {
+		if full, ok := getJob(job.SessionID); ok {
+			list = append(list, newStoredJob(full, sessionToken(job.SessionID)))
+		}
+	}
+	saveStoredJobs(list, true)
+
+	if jobHistoryRetention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-jobHistoryRetention)
+	var expired [][]byte
+	jobStore.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(jobStoreBucket)).ForEach(func(key, value []byte) error {
+			var stored storedJob
+			if json.Unmarshal(value, &stored) == nil && stored.Token == "" && stored.CreatedAt.Before(cutoff) {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			return nil
+		})
+	})
+	if len(expired) == 0 {
+		return
+	}
+	err := jobStore.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(jobStoreBucket))
+		for _, key := range expired {
+			if err := unindexStoredJob(tx, string(key)); err != nil {
+				return err
+			}
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		jobStoreLog.Error("Failed to prune history", "error", err)
+		return
+	}
+	jobStoreLog.Info("Pruned history", "jobs", len(expired), "retention", jobHistoryRetention.String())
+}
+
+// storedJobByID returns a job from the history, including its log
+func storedJobByID(sessionID string) (Job, bool) {
+	if jobStore == nil {
+		return Job{}, false
+	}
+	var stored storedJob
+	found := false
+	jobStore.View(func(tx *bolt.Tx) error {
+		if value := tx.Bucket([]byte(jobStoreBucket)).Get([]byte(sessionID)); value != nil {
+			found = json.Unmarshal(value, &stored) == nil
+		}
+		return nil
+	})
+	return stored.job(), found
+}
+
+// historyJobs returns the jobs in memory plus the stored history, newest first
+func historyJobs() []Job {
+	list := listJobs()
+	if jobStore == nil {
+		return list
+	}
+	inMemory := make(map[string]bool, len(list))
+	for _, job := range list {
+		inMemory[job.SessionID] = true
+	}
+	jobStore.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(jobStoreBucket)).ForEach(func(key, value []byte) error {
+			if inMemory[string(key)] {
+				return nil
+			}
+			var stored storedJob
+			if err := json.Unmarshal(value, &stored); err == nil {
+				job := stored.job()
+				job.LogLines = nil // Like listJobs
+				list = append(list, job)
+			}
+			return nil
+		})
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Language detection is deliberately lightweight: yt-dlp's "language" field is used
+// when the uploader set one, otherwise common stopwords in title and description
+// decide. A whisper transcription replaces the guess with the spoken language.
+
+// minStopwordHits avoids guessing from a handful of words
+const minStopwordHits = 3
+
+// languageStopwords are frequent short words that rarely appear in other languages
+var languageStopwords = map[string][]string{
+	"de": {"und", "der", "die", "das", "nicht", "ist", "ich", "mit", "ein", "eine", "auf", "für", "den", "dem", "wie", "auch", "wir", "sich", "noch", "oder"},
+	"en": {"the", "and", "is", "of", "to", "with", "this", "that", "for", "you", "are", "how", "what", "from", "your", "we", "my", "it's", "on", "be"},
+	"fr": {"le", "la", "les", "et", "est", "une", "des", "pour", "avec", "dans", "pas", "que", "qui", "sur", "vous", "nous", "du", "au", "ce", "je"},
+	"es": {"el", "los", "las", "y", "es", "una", "por", "para", "con", "que", "del", "como", "pero", "más", "muy", "su", "lo", "se", "al", "yo"},
+	"it": {"il", "gli", "e", "è", "di", "che", "per", "con", "una", "della", "sono", "non", "come", "anche", "nel", "questo", "ma", "lo", "si", "mi"},
+	"nl": {"het", "een", "en", "van", "niet", "ik", "met", "voor", "op", "zijn", "maar", "ook", "dat", "wat", "hoe", "je", "wij", "naar", "deze", "om"},
+	"pt": {"os", "as", "e", "não", "uma", "com", "para", "do", "da", "que", "em", "por", "como", "mais", "muito", "seu", "sua", "você", "é", "ao"},
+}
+
+// iso639Bibliographic maps detected codes to the three letter codes used in audio tags
+var iso639Bibliographic = map[string]string{
+	"de": "ger", "en": "eng", "fr": "fre", "es": "spa", "it": "ita", "nl": "dut", "pt": "por",
+	"ja": "jpn", "ko": "kor", "zh": "chi", "ru": "rus", "pl": "pol", "tr": "tur", "sv": "swe",
+}
+
+var (
+	stopwordSets      = buildStopwordSets()
+	languageCodeRe    = regexp.MustCompile(`^[a-z]{2,3}$`)
+	whisperLanguageRe = regexp.MustCompile(`auto-detected language: ([a-z]{2,3})`)
+)
+
+func buildStopwordSets() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(languageStopwords))
+	for lang, words := range languageStopwords {
+		sets[lang] = make(map[string]bool, len(words))
+		for _, word := range words {
+			sets[lang][word] = true
+		}
+	}
+	return sets
+}
+
+// normalizeLanguageCode reduces "de-DE" or "en_US" to "de"; unknown shapes return ""
+func normalizeLanguageCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i > 0 {
+		code = code[:i]
+	}
+	if !languageCodeRe.MatchString(code) {
+		return ""
+	}
+	return code
+}
+
+// guessTextLanguage returns the language whose stopwords occur most often, or "" if unsure
+func guessTextLanguage(text string) string {
+	hits := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		for lang, set := range stopwordSets {
+			if set[word] {
+				hits[lang]++
+			}
+		}
+	}
+
+	best, bestHits, secondHits := "", 0, 0
+	for lang, count := range hits {
+		if count > bestHits {
+			best, bestHits, secondHits = lang, count, bestHits
+		} else if count > secondHits {
+			secondHits = count
+		}
+	}
+	// Short words are shared between languages; require a clear winner
+	if bestHits < minStopwordHits || bestHits < 2*secondHits {
+		return ""
+	}
+	return best
+}
+
+// detectMetadataLanguage prefers the uploader's language over guessing from the text
+func detectMetadataLanguage(metadata *VideoMetadata, description string) string {
+	if lang := normalizeLanguageCode(metadata.Language); lang != "" {
+		return lang
+	}
+	return guessTextLanguage(metadata.Title + "\n" + description)
+}
+
+// whisperDetectedLanguage extracts the spoken language from whisper.cpp output
+func whisperDetectedLanguage(output string) string {
+	if match := whisperLanguageRe.FindStringSubmatch(output); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// languageTag returns the three letter code written into audio tags
+func languageTag(lang string) string {
+	if tag, ok := iso639Bibliographic[lang]; ok {
+		return tag
+	}
+	return lang
+}
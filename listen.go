@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// For path-based reverse proxies the whole app can live below BASE_PATH (e.g.
+// "/ytdown"): the prefix is stripped before routing, and the UI only uses relative
+// URLs. PUBLIC_BASE_URL must then include the prefix. LISTEN_SOCKET serves HTTP on a
+// unix domain socket instead of serverPort, e.g. for nginx on the same host.
+var (
+	basePath     = normalizeBasePath(getenv("BASE_PATH"))
+	listenSocket = getenv("LISTEN_SOCKET")
+	socketMode   = parseSocketMode(getenv("LISTEN_SOCKET_MODE")) // e.g. "0660"
+)
+
+// normalizeBasePath turns "ytdown/" into "/ytdown"; "/" and "" mean no prefix
+func normalizeBasePath(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), "/")
+	if value == "" {
+		return ""
+	}
+	return "/" + value
+}
+
+func parseSocketMode(value string) os.FileMode {
+	if value == "" {
+		return 0660
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		configLog.Warn("Invalid LISTEN_SOCKET_MODE, using 0660", "value", value)
+		return 0660
+	}
+	return os.FileMode(mode)
+}
+
+// withBasePath serves handler below prefix and answers everything else with 404.
+// The bare prefix redirects to "prefix/" so relative URLs in the UI resolve correctly.
+func withBasePath(prefix string, handler http.Handler) http.Handler {
+	if prefix == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix {
+			target := prefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		stripped := *r.URL
+		stripped.Path = strings.TrimPrefix(r.URL.Path, prefix)
+		stripped.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+		r2 := r.WithContext(r.Context())
+		r2.URL = &stripped
+		handler.ServeHTTP(w, r2)
+	})
+}
+
+// The peer of a socket request is the proxy on this host, which counts as 127.0.0.1
+// in TRUSTED_PROXIES. Requests without proxy headers come from unknownPeerAddr: it is
+// no loopback address, so access control does not wave them through.
+const (
+	socketProxyIP   = "127.0.0.1"
+	unknownPeerAddr = "0.0.0.0:0"
+)
+
+// unixPeerMiddleware sets the client address of requests from the unix socket from
+// the proxy headers, so access control, rate limits and owners see the real client
+func unixPeerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := net.SplitHostPort(r.RemoteAddr); err != nil {
+			r.RemoteAddr = unknownPeerAddr
+			if client := forwardedClientIP(r); client != "" {
+				r.RemoteAddr = net.JoinHostPort(client, "0")
+			} else {
+				httpLog.Warn("No usable X-Forwarded-For/X-Real-IP on the socket", "path", r.URL.Path)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listenAndServe serves the app on LISTEN_SOCKET or on serverPort until SIGTERM or
+// SIGINT, then shuts down gracefully
+func listenAndServe(handler http.Handler) error {
+	listener, handler, err := listen(withBasePath(basePath, handler))
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler}
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	select {
+	case err := <-served:
+		return err
+	case <-signals.Done():
+	}
+	// From here on a second signal ends the process right away
+	stopSignals()
+	shutdown(server)
+	return nil
+}
+
+// listen opens LISTEN_SOCKET or serverPort and returns the handler to serve on it
+func listen(handler http.Handler) (net.Listener, http.Handler, error) {
+	if listenSocket == "" {
+		listener, err := net.Listen("tcp", ":"+serverPort)
+		if err != nil {
+			return nil, nil, err
+		}
+		serverLog.Info("Server starting", "url", "http://localhost:"+serverPort+basePath+"/")
+		return listener, handler, nil
+	}
+
+	// Without a trusted proxy every client of the socket would share one address
+	if !isTrustedProxy(socketProxyIP) {
+		return nil, nil, errors.New("LISTEN_SOCKET requires TRUSTED_PROXIES to include " + socketProxyIP)
+	}
+
+	// A socket left over from an unclean shutdown blocks Listen
+	if info, err := os.Stat(listenSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(listenSocket)
+	}
+	listener, err := net.Listen("unix", listenSocket)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.Chmod(listenSocket, socketMode); err != nil {
+		serverLog.Warn("Could not chmod the socket", "path", listenSocket, "error", err)
+	}
+	serverLog.Info("Server starting", "socket", listenSocket, "basePath", basePath+"/")
+	return listener, unixPeerMiddleware(handler), nil
+}
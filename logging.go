@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Logs are written with log/slog. LOG_LEVEL (debug, info, warn or error) filters them,
+// LOG_FORMAT=json writes one JSON object per line for log aggregation instead of
+// key=value text. Every entry names its component; entries about a job also carry its
+// session, URL, format and phase. The standard log package, used by net/http and some
+// libraries, writes into the same handler.
+var logger = newLogger()
+
+// configLog reports invalid settings, mostly while the package variables are initialized
+var configLog = componentLogger("config")
+
+func newLogger() *slog.Logger {
+	level, levelErr := parseLogLevel(getenv("LOG_LEVEL"))
+	options := &slog.HandlerOptions{Level: level}
+
+	format := strings.ToLower(strings.TrimSpace(getenv("LOG_FORMAT")))
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	}
+	l := slog.New(handler)
+	slog.SetDefault(l)
+
+	if levelErr {
+		l.Warn("Invalid LOG_LEVEL, using info", "value", getenv("LOG_LEVEL"))
+	}
+	if format != "" && format != "json" && format != "text" {
+		l.Warn("Invalid LOG_FORMAT, using text", "value", getenv("LOG_FORMAT"))
+	}
+	return l
+}
+
+// parseLogLevel reads debug, info, warn or error; it reports true for unknown values
+func parseLogLevel(value string) (slog.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug, false
+	case "", "info":
+		return slog.LevelInfo, false
+	case "warn", "warning":
+		return slog.LevelWarn, false
+	case "error":
+		return slog.LevelError, false
+	}
+	return slog.LevelInfo, true
+}
+
+// componentLogger returns the logger of one part of the server
+func componentLogger(component string) *slog.Logger {
+	return logger.With("component", component)
+}
+
+// jobLogger adds the session, URL and format of a job and the phase it is in. It
+// reads the job, so it must not be called with jobsMutex held.
+func jobLogger(component *slog.Logger, sessionID, phase string) *slog.Logger {
+	attrs := []any{"session", sessionID}
+	if job, ok := getJob(sessionID); ok {
+		attrs = append(attrs, "url", job.URL, "format", job.Format)
+	}
+	if phase != "" {
+		attrs = append(attrs, "phase", phase)
+	}
+	return component.With(attrs...)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var lyricsProviderURL = getEnvDefault("LYRICS_PROVIDER_URL", "https://lrclib.net") // LRCLIB compatible API
+
+// lrclibResult is a lyrics record from the LRCLIB API
+type lrclibResult struct {
+	TrackName    string  `json:"trackName"`
+	ArtistName   string  `json:"artistName"`
+	Duration     float64 `json:"duration"`
+	PlainLyrics  string  `json:"plainLyrics"`
+	SyncedLyrics string  `json:"syncedLyrics"`
+}
+
+var lyricsClient = &http.Client{Timeout: 10 * time.Second}
+
+// fetchLyrics looks up lyrics by artist/title, preferring an exact match with duration
+func fetchLyrics(artist, title string, duration float64) (*lrclibResult, error) {
+	params := url.Values{}
+	params.Set("artist_name", artist)
+	params.Set("track_name", title)
+	if duration > 0 {
+		params.Set("duration", fmt.Sprintf("%.0f", duration))
+	}
+
+	var exact lrclibResult
+	found, err := lyricsRequest("/api/get?"+params.Encode(), &exact)
+	if err != nil {
+		return nil, err
+	}
+	if found && (exact.SyncedLyrics != "" || exact.PlainLyrics != "") {
+		return &exact, nil
+	}
+
+	// Fall back to a fuzzy search, titles on YouTube rarely match exactly
+	search := url.Values{}
+	search.Set("q", artist+" "+title)
+	var results []lrclibResult
+	if _, err := lyricsRequest("/api/search?"+search.Encode(), &results); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if results[i].SyncedLyrics != "" || results[i].PlainLyrics != "" {
+			return &results[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// lyricsRequest performs a GET against the lyrics provider; 404 is reported as not found
+func lyricsRequest(path string, dst interface{}) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(lyricsProviderURL, "/")+path, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "ytdownloader/1.0 (+https://github.com/TimHasenkamp/go-ytdown)")
+
+	resp, err := lyricsClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("lyrics provider returned status %d", resp.StatusCode)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// lyricsPath returns the .lrc sidecar path for a media file
+func lyricsPath(mediaPath string) string {
+	return strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath)) + ".lrc"
+}
+
+// addLyrics fetches lyrics for the job, writes an .lrc file and embeds them into mp3/m4a tags
+func addLyrics(mediaPath string, job Job) (bool, error) {
+	artist, title := jobArtistTitle(job)
+	if artist == "" || title == "" {
+		return false, fmt.Errorf("no artist/title available")
+	}
+
+	duration := 0.0
+	if job.Metadata != nil {
+		duration = job.Metadata.Duration
+	}
+	result, err := fetchLyrics(artist, title, duration)
+	if err != nil {
+		return false, err
+	}
+	if result == nil {
+		return false, nil
+	}
+
+	// Synced lyrics are already in LRC format; plain lyrics are written as-is
+	lrc := result.SyncedLyrics
+	if lrc == "" {
+		lrc = result.PlainLyrics
+	}
+	if err := os.WriteFile(lyricsPath(mediaPath), []byte(lrc), 0644); err != nil {
+		return false, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(mediaPath))
+	if ext != ".mp3" && ext != ".m4a" {
+		return true, nil
+	}
+
+	plain := result.PlainLyrics
+	if plain == "" {
+		plain = lrc
+	}
+	if err := rewriteMetadata(mediaPath, map[string]string{"lyrics": plain}); err != nil {
+		return true, fmt.Errorf("embedding lyrics failed: %v", err)
+	}
+	return true, nil
+}
+
+// serveLyrics serves the .lrc file of a job: /jobs/{id}/lyrics.lrc
+func serveLyrics(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, ok := getJob(jobID)
+	if !ok {
+		http.Error(w, "Job nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if !job.Lyrics {
+		http.Error(w, "Keine Lyrics für diesen Job vorhanden", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeFile(w, r, downloadPath(job.LyricsFile))
+}
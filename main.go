@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -14,32 +13,75 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"ytdownloader/resolver"
 )
 
 type DownloadRequest struct {
-	URL    string `json:"url"`
-	Format string `json:"format"`
+	URL            string        `json:"url"`
+	Format         string        `json:"format"`
+	Waveform       bool          `json:"waveform,omitempty"`       // Generate waveform peaks for audio formats
+	TrimSilence    bool          `json:"trimSilence,omitempty"`    // Trim leading/trailing silence from audio
+	SplitMinutes   int           `json:"splitMinutes,omitempty"`   // Split output into parts of N minutes
+	SplitMB        int           `json:"splitMB,omitempty"`        // Split output into parts of at most N MB
+	SampleRate     int           `json:"sampleRate,omitempty"`     // Output sample rate in Hz (lossless formats only)
+	Channels       int           `json:"channels,omitempty"`       // 1 = mono, 2 = stereo (lossless formats only)
+	Lyrics         bool          `json:"lyrics,omitempty"`         // Fetch lyrics, write .lrc and embed into tags
+	MusicBrainz    bool          `json:"musicbrainz,omitempty"`    // Correct tags via AcoustID fingerprint lookup
+	SmartTitle     bool          `json:"smartTitle,omitempty"`     // Split "Artist - Title (Official Video)" into tags and filename
+	Transcribe     bool          `json:"transcribe,omitempty"`     // Transcribe speech with whisper.cpp into .srt/.txt
+	Summarize      bool          `json:"summarize,omitempty"`      // Summarize the transcript via SUMMARIZER_URL (implies transcribe)
+	Force          bool          `json:"force,omitempty"`          // Download even if the video was downloaded before
+	Collection     string        `json:"collection,omitempty"`     // Save into the folder of this collection
+	CaptureMinutes int           `json:"captureMinutes,omitempty"` // Record N minutes of a live stream (audio formats only)
+	InferChapters  bool          `json:"inferChapters,omitempty"`  // Read chapters from the top comments if the video has none
+	SplitChapters  bool          `json:"splitChapters,omitempty"`  // Split output into one part per chapter
+	Tempo          float64       `json:"tempo,omitempty"`          // Playback speed for audio, e.g. 1.5 (pitch is preserved)
+	AudioPreset    string        `json:"audioPreset,omitempty"`    // "voice": mono, speech bitrate and highpass (mp3/m4a/opus)
+	Quality        string        `json:"quality,omitempty"`        // Maximum resolution for mp4 ("2160p" to "360p") or "audio-best"
+	Start          Timestamp     `json:"start,omitempty"`          // Only download from here, seconds or "h:mm:ss"
+	End            Timestamp     `json:"end,omitempty"`            // Only download up to here, seconds or "h:mm:ss"
+	Transfer       bool          `json:"transfer,omitempty"`       // Also upload the result to TRANSFER_SERVICE
+	Torrent        bool          `json:"torrent,omitempty"`        // Create a .torrent with this server as web seed
+	Steps          []StepSpec    `json:"steps,omitempty"`          // Steps after the post-processing and their order, see steps.go
+	Section        *MediaSection `json:"-"`                        // Only download this range, e.g. of a clip
+	Account        string        `json:"-"`                        // Authenticated user whose personal cookies are used
+	Owner          string        `json:"-"`                        // Who may list the job, see requestOwner
 }
 
 type DownloadResponse struct {
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
-	Filename string `json:"filename,omitempty"`
+	Success    bool             `json:"success"`
+	Message    string           `json:"message"`
+	Filename   string           `json:"filename,omitempty"`
+	Token      string           `json:"token,omitempty"`      // Session token for /progress and /jobs/{id}, only sent here
+	Existing   *Job             `json:"existing,omitempty"`   // Previous download of the same video
+	Redownload *DownloadRequest `json:"redownload,omitempty"` // Request body to download it again anyway
 }
 
 type ProgressUpdate struct {
-	Progress int    `json:"progress"`
-	Status   string `json:"status"`
-	Error    bool   `json:"error,omitempty"` // Indicates if this is an error message
+	Progress     int           `json:"progress"`
+	Status       string        `json:"status"`
+	Error        bool          `json:"error,omitempty"`        // Indicates if this is an error message
+	Versions     *ToolVersions `json:"versions,omitempty"`     // Tool versions, only on the final update
+	Parts        []string      `json:"parts,omitempty"`        // Part files if the output was split
+	Warning      *JobWarning   `json:"warning,omitempty"`      // Sent as a "warning" event instead of a message
+	TransferURLs []string      `json:"transferUrls,omitempty"` // External copies, only on the final update
+	Demo         bool          `json:"demo,omitempty"`         // Simulated download without a file (DEMO_MODE)
+	Cancelled    bool          `json:"cancelled,omitempty"`    // Final update of a cancelled job
+	Hint         string        `json:"hint,omitempty"`         // What the user can do about an error
+	Paused       bool          `json:"paused,omitempty"`       // The download is paused until resumed
+	Phase        string        `json:"phase,omitempty"`        // Running job step, see steps.go
 }
 
 type FormatCheckResponse struct {
 	Success        bool              `json:"success"`
 	Message        string            `json:"message,omitempty"`
+	Hint           string            `json:"hint,omitempty"`
 	HasSABR        bool              `json:"hasSABR"`
 	BestVideoInfo  string            `json:"bestVideoInfo,omitempty"`
 	BestAudioInfo  string            `json:"bestAudioInfo,omitempty"`
@@ -70,18 +112,21 @@ type ErrorReport struct {
 	SessionID    string            `json:"sessionId"`
 	LastActions  []string          `json:"lastActions"`
 	BrowserInfo  map[string]string `json:"browserInfo"`
+	// Set from the received report, see reportschema.go
+	SchemaVersion int               `json:"schemaVersion,omitempty"`
+	Extra         map[string]string `json:"extra,omitempty"` // Fields the schema doesn't know
 }
 
 type SlackMessage struct {
-	Text        string              `json:"text,omitempty"`
-	Blocks      []SlackBlock        `json:"blocks,omitempty"`
-	Attachments []SlackAttachment   `json:"attachments,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	Blocks      []SlackBlock      `json:"blocks,omitempty"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
 }
 
 type SlackBlock struct {
-	Type string                 `json:"type"`
-	Text *SlackText             `json:"text,omitempty"`
-	Fields []SlackText          `json:"fields,omitempty"`
+	Type   string      `json:"type"`
+	Text   *SlackText  `json:"text,omitempty"`
+	Fields []SlackText `json:"fields,omitempty"`
 }
 
 type SlackText struct {
@@ -100,52 +145,178 @@ type SlackField struct {
 	Short bool   `json:"short"`
 }
 
-type CompletedDownload struct {
-	FinalUpdate ProgressUpdate
-	CompletedAt time.Time
-}
+var (
+	completedCacheTTL = 5 * time.Minute // Keep completed downloads for 5 minutes
+)
 
 var (
-	progressClients      = make(map[string][]chan ProgressUpdate) // Multiple clients per session
-	completedDownloads   = make(map[string]*CompletedDownload)    // Cache completed downloads for reconnect
-	progressMutex        sync.RWMutex
-	slackWebhookURL      = os.Getenv("SLACK_WEBHOOK_URL") // Set via environment variable
-	completedCacheTTL    = 5 * time.Minute                 // Keep completed downloads for 5 minutes
+	serverLog      = componentLogger("server")
+	jobLog         = componentLogger("job")
+	ytdlpLog       = componentLogger("ytdlp")
+	fileLog        = componentLogger("download-file")
+	errorReportLog = componentLogger("error-report")
+	slackLog       = componentLogger("slack")
 )
 
-func main() {
-	// Serve static files
-	http.Handle("/", http.FileServer(http.Dir("./static")))
+var serverPort = getEnvDefault("PORT", "8080")
 
-	// Download endpoint
-	http.HandleFunc("/download", handleDownload)
-	http.HandleFunc("/progress", handleProgress)
-	http.HandleFunc("/download-file/", handleDownloadFile)
-	http.HandleFunc("/check-formats", handleCheckFormats)
-	http.HandleFunc("/resolve", handleResolve)
-	http.HandleFunc("/report-error", handleErrorReport)
-	http.HandleFunc("/test-slack", handleTestSlack) // Test endpoint for Slack notifications
+func main() {
+	defer crashGuard("main")
+	checkCommandLine()
+	registerEventSubscribers()
 
 	// Check if yt-dlp is installed
 	if err := checkYtDlp(); err != nil {
-		log.Printf("Warning: yt-dlp not found. Please install it: %v", err)
+		serverLog.Warn("yt-dlp not found, please install it", "error", err)
 	}
 
-	// Send startup notification to Slack
+	logConfigSource()
+	logCanaryConfig()
+	logFeatureFlags()
+	logThrottleConfig()
+	logPacingConfig()
+
+	// Enable Sentry/GlitchTip reporting if configured
+	if err := initSentry(); err != nil {
+		serverLog.Warn("Sentry disabled", "error", err)
+	}
+
+	// Send startup notification and heartbeats to Slack
 	go sendStartupNotification()
+	goGuarded("heartbeat", runHeartbeat)
+	goGuarded("progress webhooks", runProgressWebhookBatches)
+
+	go registerDiscordCommands()
+
+	if matrixEnabled() {
+		notifyMatrix(notificationText(NotifierMatrix, startupNotificationData(), "✅ YouTube Downloader gestartet"))
+	}
+	goGuarded("matrix bot", runMatrixBot)
+	goGuarded("inbox watcher", runInboxWatcher)
+	goGuarded("cookie check", runCookieChecks)
+
+	// Interrupted downloads are queued again first, so their staging directories are
+	// kept; unfinished files of other jobs are never completed
+	openJobStore()
+	cleanupStaging()
+	cleanupExtractionDir()
 
 	// Start cleanup goroutine for old completed downloads
-	go cleanupCompletedDownloads()
+	goGuarded("cleanup", cleanupCompletedDownloads)
 
-	port := "8080"
-	log.Printf("Server starting on http://localhost:%s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
+	if err := listenAndServe(newRouter()); err != nil {
+		fatal(err)
 	}
 }
 
+// newRouter wires all routes and the middleware chain
+func newRouter() *Router {
+	router := NewRouter()
+	router.Use(authUserMiddleware, realIPMiddleware, accessLogMiddleware, recoverMiddleware, ipAccessMiddleware, securityHeadersMiddleware, corsMiddleware)
+
+	// Serve static files
+	router.Handle("GET /*", http.FileServer(http.Dir("./static")))
+	router.HandleFunc("GET /progress", handleProgress)
+	router.HandleFunc("GET /ws/progress", handleWSProgress)
+	if demoMode {
+		registerDemoRoutes(router)
+		return router
+	}
+
+	// Everything that starts a job or runs yt-dlp needs an API key if API_KEYS is set;
+	// starting jobs is also subject to the terms of use and the download rate limit
+	protected := router.Group("", requireAPIKey)
+	startsJobs := protected.Group("", requireTerms, rateLimit(downloadRateLimiter))
+	extracts := protected.Group("", rateLimit(checkFormatsRateLimiter))
+	startsJobs.HandleFunc("POST /download", handleDownload)
+	protected.HandleFunc("GET /download-file/*", handleDownloadFile)
+	router.HandleFunc("GET /preview/*", handlePreview)
+	router.HandleFunc("POST /cancel", handleCancel)
+	router.HandleFunc("GET /terms", handleTerms)
+	router.HandleFunc("POST /accept-terms", handleAcceptTerms)
+	router.HandleFunc("GET /me/cookies", handleUserCookies)
+	router.HandleFunc("PUT /me/cookies", handleUserCookies)
+	router.HandleFunc("DELETE /me/cookies", handleUserCookies)
+	extracts.HandleFunc("POST /check-formats", handleCheckFormats)
+	protected.HandleFunc("POST /resolve", handleResolve)
+	extracts.HandleFunc("POST /preflight", handlePreflight)
+	extracts.HandleFunc("POST /recommend", handleRecommend)
+	extracts.HandleFunc("POST /stream-url", handleStreamURL)
+	extracts.HandleFunc("GET /screenshot", handleScreenshot)
+
+	// Jobs and their artifacts
+	router.HandleFunc("GET /jobs", handleListJobs)
+	router.HandleFunc("GET /jobs/{id}", handleGetJob)
+	router.HandleFunc("POST /jobs/{id}/cancel", withJobID(func(w http.ResponseWriter, r *http.Request, id string) {
+		respondJobAction(w, cancelJob(id))
+	}))
+	router.HandleFunc("POST /jobs/{id}/pause", withJobID(func(w http.ResponseWriter, r *http.Request, id string) {
+		respondJobAction(w, pauseJob(id, true))
+	}))
+	router.HandleFunc("POST /jobs/{id}/resume", withJobID(func(w http.ResponseWriter, r *http.Request, id string) {
+		respondJobAction(w, pauseJob(id, false))
+	}))
+	router.HandleFunc("DELETE /jobs/{id}", withJobID(func(w http.ResponseWriter, r *http.Request, id string) {
+		deleteJobHandler(w, id, r.URL.Query().Get("purge") == "true")
+	}))
+	router.HandleFunc("POST /jobs/{id}/steps/{step}/retry", withJobID(handleRetryStep))
+	router.HandleFunc("POST /jobs/{id}/restore", withJobID(func(w http.ResponseWriter, r *http.Request, id string) {
+		respondJobAction(w, restoreJob(id))
+	}))
+	router.HandleFunc("PUT /jobs/{id}/tags", withJobID(handleSetTags))
+	router.HandleFunc("POST /jobs/{id}/cast", withJobID(handleCast))
+	router.HandleFunc("GET /jobs/{id}/waveform.json", withJobID(serveWaveform))
+	router.HandleFunc("GET /jobs/{id}/parts.zip", withJobID(serveParts))
+	router.HandleFunc("GET /jobs/{id}/lyrics.lrc", withJobID(serveLyrics))
+	router.HandleFunc("GET /jobs/{id}/transcript", withJobID(serveTranscript))
+	router.HandleFunc("GET /jobs/{id}/shares", withJobID(handleJobShares))
+	router.HandleFunc("POST /jobs/{id}/shares", withJobID(handleJobShares))
+	router.HandleFunc("DELETE /jobs/{id}/shares/{share}", withJobID(handleDeleteJobShare))
+	router.HandleFunc("GET /jobs/{id}/torrent", withJobID(serveTorrent))
+	router.HandleFunc("GET /seed/{key}/*", handleSeed)
+	router.HandleFunc("GET /s/{share}", handleShare)
+	router.HandleFunc("POST /s/{share}", handleShare)
+
+	router.HandleFunc("GET /history", handleHistory)
+	router.HandleFunc("GET /history/export", handleHistoryExport)
+	router.HandleFunc("/collections", handleCollections)
+	router.HandleFunc("PUT /collections/{name}", handleCollection)
+	router.HandleFunc("DELETE /collections/{name}", handleCollection)
+	router.HandleFunc("GET /cast/devices", handleCastDevices)
+	protected.HandleFunc("POST /imports", handleImport)
+	protected.HandleFunc("GET /imports/{id}", handleImportBatch)
+	startsJobs.HandleFunc("POST /imports/{id}/queue", handleImportBatch)
+	protected.HandleFunc("GET /inbox", handleInbox)
+	startsJobs.HandleFunc("POST /inbox", handleInbox)
+	startsJobs.HandleFunc("POST /convert", handleConvert)
+	router.HandleFunc("GET /stats", handleStats)
+	router.HandleFunc("GET /metrics", handleMetrics)
+	router.HandleFunc("GET /admin/flags", handleListFlags)
+	router.HandleFunc("PUT /admin/flags/{name}", handleSetFlag)
+	router.HandleFunc("GET /admin/blocklist", handleListBlocklist)
+	router.HandleFunc("POST /admin/blocklist", handleAddBlock)
+	router.HandleFunc("DELETE /admin/blocklist/{id}", handleDeleteBlock)
+	router.HandleFunc("GET /admin/secrets", handleListSecrets)
+	router.HandleFunc("POST /admin/secrets/reload", handleReloadSecrets)
+	router.HandleFunc("PUT /admin/secrets/{name}", handleSecret)
+	router.HandleFunc("DELETE /admin/secrets/{name}", handleSecret)
+	router.HandleFunc("GET /audit", handleAudit)
+	router.HandleFunc("POST /report-error", handleErrorReport)
+	router.HandleFunc("GET /error-reports", handleListErrorReports)
+	router.HandleFunc("GET /admin/error-reports", handleAdminErrorReports)
+	router.HandleFunc("GET /admin/error-reports/groups", handleAdminErrorReportGroups)
+	router.HandleFunc("DELETE /admin/error-reports/groups/{hash}", handleDeleteErrorReportGroup)
+	router.HandleFunc("GET /admin/error-reports/{id}", handleAdminErrorReport)
+	router.HandleFunc("POST /discord/interactions", handleDiscordInteraction)
+	protected.Group("", requireTerms).HandleFunc("/jsonrpc", handleAria2RPC) // aria2-compatible RPC for aria2 frontends
+	router.HandleFunc("/test-slack", handleTestSlack)                        // Test endpoint for Slack notifications
+	registerMeTubeRoutes(protected, startsJobs)
+
+	return router
+}
+
 func checkYtDlp() error {
-	cmd := exec.Command("yt-dlp", "--version")
+	cmd := exec.Command(ytdlpBinary, "--version")
 	return cmd.Run()
 }
 
@@ -178,208 +349,6 @@ func sanitizeFilename(filename string) string {
 	return filename
 }
 
-// isValidYouTubeURL validates that the URL is from YouTube (including all variants and mobile)
-func isValidYouTubeURL(rawURL string) bool {
-	parsed, err := url.Parse(rawURL)
-	if err != nil {
-		return false
-	}
-
-	host := strings.ToLower(parsed.Host)
-
-	// Remove www. prefix for comparison
-	host = strings.TrimPrefix(host, "www.")
-
-	// List of valid YouTube domains
-	validHosts := []string{
-		"youtube.com",
-		"m.youtube.com",
-		"youtu.be",
-		"youtube-nocookie.com",
-	}
-
-	// Check if host matches or is a subdomain of YouTube
-	for _, validHost := range validHosts {
-		if host == validHost || strings.HasSuffix(host, "."+validHost) {
-			return true
-		}
-	}
-
-	return false
-}
-
-// resolveHTTP follows HTTP redirects manually (HEAD first, then GET fallback)
-// and returns the final URL after up to maxHops hops.
-func resolveHTTP(start string, maxHops int) (string, error) {
-	u := start
-	client := &http.Client{
-		Timeout: 15 * time.Second,
-		// do NOT auto-follow; we want to read Location ourselves
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-
-	for i := 0; i < maxHops; i++ {
-		req, err := http.NewRequest(http.MethodHead, u, nil)
-		if err != nil {
-			return "", err
-		}
-		req.Header.Set("User-Agent", "yt-url-resolver/1.0 (+https://example.local)")
-
-		resp, err := client.Do(req)
-		if err != nil {
-			// Some servers don't like HEAD; try GET
-			req.Method = http.MethodGet
-			resp, err = client.Do(req)
-			if err != nil {
-				return "", err
-			}
-		}
-		resp.Body.Close()
-
-		// 3xx → follow Location
-		if resp.StatusCode/100 == 3 {
-			loc := resp.Header.Get("Location")
-			if loc == "" {
-				return "", errors.New("redirect without Location header")
-			}
-			// Resolve relative locations
-			next, err := url.Parse(loc)
-			if err != nil {
-				return "", err
-			}
-			base, _ := url.Parse(u)
-			u = base.ResolveReference(next).String()
-			continue
-		}
-
-		// Non-redirect → done
-		return u, nil
-	}
-	return "", fmt.Errorf("too many redirects (>%d)", maxHops)
-}
-
-// canonicalYouTube normalizes many YouTube URL shapes into https://www.youtube.com/watch?v=ID
-// Keeps only v and optionally t (timestamp) query params.
-func canonicalYouTube(raw string) (string, bool) {
-	parsed, err := url.Parse(raw)
-	if err != nil {
-		return "", false
-	}
-
-	host := strings.ToLower(parsed.Host)
-	// unify host
-	if host == "youtu.be" {
-		// Path is /VIDEO_ID
-		id := strings.TrimPrefix(parsed.Path, "/")
-		if id == "" {
-			return "", false
-		}
-		// keep optional t=… from short URL
-		t := parsed.Query().Get("t")
-		q := url.Values{}
-		q.Set("v", id)
-		if t != "" {
-			q.Set("t", t)
-		}
-		return (&url.URL{
-			Scheme:   "https",
-			Host:     "www.youtube.com",
-			Path:     "/watch",
-			RawQuery: q.Encode(),
-		}).String(), true
-	}
-
-	if strings.HasSuffix(host, "youtube.com") || strings.HasSuffix(host, "youtube-nocookie.com") || strings.HasSuffix(host, "m.youtube.com") {
-		// shorts/live → watch
-		parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
-		if len(parts) >= 2 && (parts[0] == "shorts" || parts[0] == "live") {
-			id := parts[1]
-			if id != "" {
-				q := url.Values{}
-				q.Set("v", id)
-				t := parsed.Query().Get("t")
-				if t != "" {
-					q.Set("t", t)
-				}
-				return (&url.URL{
-					Scheme:   "https",
-					Host:     "www.youtube.com",
-					Path:     "/watch",
-					RawQuery: q.Encode(),
-				}).String(), true
-			}
-		}
-
-		// already a watch URL?
-		if strings.HasPrefix(parsed.Path, "/watch") {
-			q := parsed.Query()
-			id := q.Get("v")
-			if id == "" {
-				return "", false
-			}
-			// rebuild with only v and optional t
-			only := url.Values{}
-			only.Set("v", id)
-			if t := q.Get("t"); t != "" {
-				only.Set("t", t)
-			}
-			return (&url.URL{
-				Scheme:   "https",
-				Host:     "www.youtube.com",
-				Path:     "/watch",
-				RawQuery: only.Encode(),
-			}).String(), true
-		}
-
-		// youtu.be embed-like: /embed/ID
-		if strings.HasPrefix(parsed.Path, "/embed/") {
-			id := path.Base(parsed.Path)
-			if id != "" {
-				q := url.Values{}
-				q.Set("v", id)
-				if t := parsed.Query().Get("start"); t != "" {
-					// embed uses start=seconds; map to t
-					q.Set("t", t+"s")
-				}
-				return (&url.URL{
-					Scheme:   "https",
-					Host:     "www.youtube.com",
-					Path:     "/watch",
-					RawQuery: q.Encode(),
-				}).String(), true
-			}
-		}
-	}
-
-	return "", false
-}
-
-// resolveYouTubeURL combines canonicalization and HTTP redirect resolution
-func resolveYouTubeURL(input string) (string, bool, bool, error) {
-	// First: try canonicalize without network (works for youtu.be, shorts, etc.)
-	if canon, ok := canonicalYouTube(input); ok {
-		return canon, false, true, nil
-	}
-
-	// Otherwise: resolve HTTP redirects, then try canonicalize again.
-	final, err := resolveHTTP(input, 10)
-	if err != nil {
-		// if redirect resolving failed, still return what we have
-		return input, false, false, err
-	}
-
-	wasRedirect := final != input
-
-	if canon, ok := canonicalYouTube(final); ok {
-		return canon, wasRedirect, true, nil
-	}
-
-	// Fallback: return the final resolved URL
-	return final, wasRedirect, false, nil
-}
-
 func handleResolve(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -387,11 +356,10 @@ func handleResolve(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req ResolveRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(ResolveResponse{
+	if reqErr := decodeJSONBody(w, r, &req, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, ResolveResponse{
 			Success: false,
-			Message: "Ungültige Anfrage",
+			Message: reqErr.message,
 		})
 		return
 	}
@@ -406,7 +374,7 @@ func handleResolve(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate that URL is from YouTube
-	if !isValidYouTubeURL(req.URL) {
+	if !resolver.IsYouTubeURL(req.URL) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(ResolveResponse{
 			Success: false,
@@ -415,7 +383,7 @@ func handleResolve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resolvedURL, wasRedirect, wasCanonical, err := resolveYouTubeURL(req.URL)
+	resolvedURL, wasRedirect, wasCanonical, err := resolver.Resolve(req.URL)
 
 	response := ResolveResponse{
 		Success:      true,
@@ -437,7 +405,7 @@ func handleResolve(w http.ResponseWriter, r *http.Request) {
 // Now uses the advanced resolver functionality
 func cleanURL(rawURL string) (string, error) {
 	// Use the resolver to canonicalize and clean the URL
-	resolvedURL, _, _, err := resolveYouTubeURL(rawURL)
+	resolvedURL, _, _, err := resolver.Resolve(rawURL)
 	if err != nil {
 		// If resolution fails, fall back to basic parsing
 		parsedURL, parseErr := url.Parse(rawURL)
@@ -450,272 +418,393 @@ func cleanURL(rawURL string) (string, error) {
 	return resolvedURL, nil
 }
 
-func handleProgress(w http.ResponseWriter, r *http.Request) {
-	sessionID := r.URL.Query().Get("session")
-	if sessionID == "" {
-		log.Printf("[SSE] ERROR: No session ID provided")
-		http.Error(w, "Session ID required", http.StatusBadRequest)
+func handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	log.Printf("[SSE] Client connected for session: %s", sessionID)
-
-	// Server-Sent Events Headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
-
-	// Check if this download was already completed
-	progressMutex.RLock()
-	completed, wasCompleted := completedDownloads[sessionID]
-	progressMutex.RUnlock()
-
-	if wasCompleted {
-		// Send the final update immediately and close
-		log.Printf("[SSE] Reconnect to completed session %s, sending final update", sessionID)
-		data, _ := json.Marshal(completed.FinalUpdate)
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		if f, ok := w.(http.Flusher); ok {
-			f.Flush()
-		}
+	if refuseWhileShuttingDown(w) {
 		return
 	}
 
-	// Create a new channel for this client
-	progressChan := make(chan ProgressUpdate, 10)
+	var req DownloadRequest
+	if reqErr := decodeJSONBody(w, r, &req, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, DownloadResponse{
+			Success: false,
+			Message: reqErr.message,
+		})
+		return
+	}
 
-	progressMutex.Lock()
-	progressClients[sessionID] = append(progressClients[sessionID], progressChan)
-	clientCount := len(progressClients[sessionID])
-	progressMutex.Unlock()
+	// Collections can provide a default format and post-processing
+	req = applyCollectionDefaults(req)
 
-	log.Printf("[SSE] Client connected for session %s (total clients: %d)", sessionID, clientCount)
+	cleanedURL, msg := validateDownloadRequest(req)
+	if msg != "" {
+		sendJSONResponse(w, DownloadResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+	if entry, blocked := blockedURL(req.URL, cleanedURL); blocked {
+		writeBlocked(w, r, cleanedURL, entry)
+		return
+	}
 
-	// Clean up on disconnect - remove this channel from the list
-	defer func() {
-		progressMutex.Lock()
-		clients := progressClients[sessionID]
-		for i, ch := range clients {
-			if ch == progressChan {
-				// Remove this channel from the slice
-				progressClients[sessionID] = append(clients[:i], clients[i+1:]...)
-				close(ch)
-				log.Printf("[SSE] Client disconnected from session %s (remaining: %d)", sessionID, len(progressClients[sessionID]))
-
-				// If no more clients, remove session entirely
-				if len(progressClients[sessionID]) == 0 {
-					delete(progressClients, sessionID)
-					log.Printf("[SSE] All clients disconnected, removed session: %s", sessionID)
-				}
-				break
-			}
+	// Offer the previous download instead of fetching the same video in the same format again.
+	// Live captures record new audio every time and segments are only part of the
+	// video, so neither are duplicates.
+	if !req.Force && req.CaptureMinutes == 0 && req.Start == "" && req.End == "" && !demoMode {
+		if existing, ok := findCompletedJob(resolver.VideoID(cleanedURL), req.Format); ok {
+			redownload := req
+			redownload.Force = true
+			sendJSONResponse(w, DownloadResponse{
+				Success:    false,
+				Message:    fmt.Sprintf("Bereits heruntergeladen am %s (%s)", existing.FinishedAt.Format("02.01.2006 um 15:04"), strings.ToUpper(existing.Format)),
+				Existing:   &existing,
+				Redownload: &redownload,
+			})
+			return
 		}
-		progressMutex.Unlock()
-	}()
+	}
 
-	// Send updates to client
-	updateCount := 0
-	for update := range progressChan {
-		updateCount++
-		data, _ := json.Marshal(update)
-		log.Printf("[SSE] Sending update #%d to session %s: %d%% - %s", updateCount, sessionID, update.Progress, update.Status)
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		if f, ok := w.(http.Flusher); ok {
-			f.Flush()
-		}
+	// Accounts only exist behind an auth proxy; the hook identifies the requester by address
+	user := remoteIP(r)
+	req.Account = authenticatedUser(r)
+	req.Owner = requestOwner(r)
+	sessionID := startJob(cleanedURL, req, user, nil)
+	if label := apiKeyLabel(r); label != "" {
+		jobLogger(jobLog, sessionID, "").Info("Requested with API key", "label", label)
 	}
-	log.Printf("[SSE] Finished sending %d updates for session: %s", updateCount, sessionID)
+
+	sendJSONResponse(w, DownloadResponse{
+		Success:  true,
+		Message:  sessionID,
+		Filename: sessionID,
+		Token:    sessionToken(sessionID),
+	})
 }
 
-func handleDownload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// supportedFormats are the output formats the server can produce
+var supportedFormats = map[string]bool{
+	"mp4":  true,
+	"webm": true,
+	"mkv":  true,
+	"mp3":  true,
+	"wav":  true,
+	"m4a":  true,
+	"flac": true,
+	"opus": true,
+	"ogg":  true,
+}
 
-	var req DownloadRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendJSONResponse(w, DownloadResponse{
-			Success: false,
-			Message: "Ungültige Anfrage. Bitte versuche es erneut.",
-		})
-		return
+// validFormats are the output formats a download can request, limited by
+// ALLOWED_FORMATS (e.g. "mp3,m4a")
+var validFormats = allowedFormats(getenv("ALLOWED_FORMATS"))
+
+func allowedFormats(value string) map[string]bool {
+	if strings.TrimSpace(value) == "" {
+		return supportedFormats
+	}
+	allowed := make(map[string]bool)
+	for _, format := range strings.Split(value, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		switch {
+		case format == "":
+		case supportedFormats[format]:
+			allowed[format] = true
+		default:
+			configLog.Warn("Ignoring unknown format in ALLOWED_FORMATS", "format", format)
+		}
+	}
+	if len(allowed) == 0 {
+		configLog.Warn("ALLOWED_FORMATS allows no known format, allowing all", "value", value)
+		return supportedFormats
 	}
+	return allowed
+}
 
+// validateDownloadRequest checks a download request and returns the cleaned URL,
+// or a user-facing message if the request is invalid
+func validateDownloadRequest(req DownloadRequest) (string, string) {
 	// Validate URL
 	if req.URL == "" {
-		sendJSONResponse(w, DownloadResponse{
-			Success: false,
-			Message: "Bitte gib eine YouTube-URL ein.",
-		})
-		return
+		return "", "Bitte gib eine YouTube-URL ein."
 	}
 
 	// Validate that URL is from YouTube
-	if !isValidYouTubeURL(req.URL) {
-		sendJSONResponse(w, DownloadResponse{
-			Success: false,
-			Message: "Nur YouTube URLs sind erlaubt. Bitte verwende einen gültigen YouTube-Link.",
-		})
-		return
+	if !resolver.IsYouTubeURL(req.URL) {
+		return "", "Nur YouTube URLs sind erlaubt. Bitte verwende einen gültigen YouTube-Link."
 	}
 
 	// Clean URL (remove playlist parameters)
 	cleanedURL, err := cleanURL(req.URL)
 	if err != nil {
-		sendJSONResponse(w, DownloadResponse{
-			Success: false,
-			Message: "Ungültige URL. Bitte überprüfe den YouTube-Link.",
-		})
-		return
+		return "", "Ungültige URL. Bitte überprüfe den YouTube-Link."
 	}
 
 	// Validate that it's a YouTube URL
 	if !strings.Contains(cleanedURL, "youtube.com") && !strings.Contains(cleanedURL, "youtu.be") {
-		sendJSONResponse(w, DownloadResponse{
-			Success: false,
-			Message: "Nur YouTube-URLs werden unterstützt.",
-		})
-		return
+		return "", "Nur YouTube-URLs werden unterstützt."
+	}
+
+	if msg := validateDownloadOptions(req); msg != "" {
+		return "", msg
+	}
+	if msg := validateCapture(req); msg != "" {
+		return "", msg
+	}
+	if _, msg := requestSection(req); msg != "" {
+		return "", msg
+	}
+
+	return cleanedURL, ""
+}
+
+// validateDownloadOptions checks format and processing options, which local
+// conversions share with downloads
+func validateDownloadOptions(req DownloadRequest) string {
+	if msg := validateAudioOptions(req); msg != "" {
+		return msg
+	}
+	if msg := validateQuality(req); msg != "" {
+		return msg
+	}
+	if msg := validateJobSteps(req); msg != "" {
+		return msg
+	}
+
+	if req.SplitMinutes < 0 || req.SplitMB < 0 {
+		return "Ungültige Aufteilung angegeben."
 	}
 
 	// Validate format
-	validFormats := map[string]bool{
-		"mp4": true,
-		"mp3": true,
-		"wav": true,
-		"m4a": true,
+	if supportedFormats[req.Format] && !validFormats[req.Format] {
+		return fmt.Sprintf("Das Format %s ist auf diesem Server nicht freigegeben.", req.Format)
 	}
 	if !validFormats[req.Format] {
-		sendJSONResponse(w, DownloadResponse{
-			Success: false,
-			Message: "Ungültiges Format ausgewählt.",
-		})
-		return
+		return "Ungültiges Format ausgewählt."
+	}
+
+	if req.Collection != "" {
+		if _, ok := getCollection(req.Collection); !ok {
+			return fmt.Sprintf("Die Sammlung \"%s\" existiert nicht.", req.Collection)
+		}
 	}
 
+	if req.Torrent && publicBaseURL == "" {
+		return "Für Torrents muss PUBLIC_BASE_URL gesetzt sein."
+	}
+	if req.Transfer && !transferEnabled() {
+		return "Externer Upload ist auf diesem Server nicht eingerichtet."
+	}
+	return ""
+}
+
+// startJob registers a job and runs download and post-processing in the background.
+// It is shared by the web UI and the chat integrations; onDone (optional) receives the finished job.
+func startJob(cleanedURL string, req DownloadRequest, user string, onDone func(job Job)) string {
 	// Generate session ID
 	sessionID := fmt.Sprintf("%d", time.Now().UnixNano())
 
-	// Download the video in goroutine
-	go func() {
-		filename, err := downloadVideo(cleanedURL, req.Format, sessionID)
-		if err != nil {
-			log.Printf("Download error: %v", err)
-			sendError(sessionID, fmt.Sprintf("%v", err))
-		} else {
-			sendProgress(sessionID, 100, fmt.Sprintf("Completed: %s", filename))
-		}
-	}()
+	// Route a share of jobs to the canary yt-dlp if configured
+	channel, binary := pickYtDlpChannel()
+	createJob(sessionID, cleanedURL, req.Format, channel, binary)
+	if flags := pickFeatureFlags(); flags != nil {
+		updateJob(sessionID, func(job *Job) { job.Flags = flags })
+	}
+	// Kept until the job finished, so it can be queued again after a restart
+	rememberJobRequest(sessionID, req, user)
 
-	sendJSONResponse(w, DownloadResponse{
-		Success:  true,
-		Message:  sessionID,
-		Filename: sessionID,
+	runJob(sessionID, req, user, onDone, func() (string, error) {
+		if demoMode {
+			return simulateDownload(cleanedURL, req, sessionID)
+		}
+		return downloadVideo(cleanedURL, req, sessionID, binary)
 	})
+	return sessionID
 }
 
-func sendProgress(sessionID string, progress int, status string) {
-	log.Printf("Progress [%s]: %d%% - %s", sessionID, progress, status)
-
-	update := ProgressUpdate{Progress: progress, Status: status, Error: false}
+// runJob queues a created job; a worker fetches the file and runs the shared
+// post-processing and hook steps. fetch returns the filename relative to ./downloads.
+// Start and result are published as lifecycle events.
+func runJob(sessionID string, req DownloadRequest, user string, onDone func(job Job), fetch func() (string, error)) {
+	if collection, ok := getCollection(req.Collection); ok {
+		updateJob(sessionID, func(job *Job) { job.Collection = collection.Name })
+	}
+	request := req
+	updateJob(sessionID, func(job *Job) {
+		job.Steps = planJobSteps(req)
+		job.Requester = user
+		job.Request = &request
+		job.Owner = req.Owner
+	})
+	job, _ := getJob(sessionID)
+
+	// Download the video once a worker is free
+	allowCancel(sessionID)
+	enqueueJob(sessionID, func() {
+		interrupted := false
+		defer func() {
+			if onDone != nil && !interrupted {
+				if job, ok := getJob(sessionID); ok {
+					onDone(job)
+				}
+			}
+		}()
+		defer func() {
+			if rec := recover(); rec != nil {
+				finishCancellable(sessionID)
+				reportPanic(rec, debug.Stack(), map[string]string{
+					"format":  req.Format,
+					"session": sessionID,
+					"url":     job.URL,
+				})
+				finishJob(sessionID, "", fmt.Errorf("panic: %v", rec))
+				updateJob(sessionID, func(job *Job) { job.ErrorCode = "panic" })
+				update := errorUpdate(sessionID, "Interner Fehler beim Download. Bitte versuche es erneut.")
+				emitJobEvent(EventJobFinished, sessionID, &update, "")
+			}
+		}()
+
+		var filename string
+		var err error
+		if !isCancelled(sessionID) {
+			emitJobEvent(EventJobStarted, sessionID, nil, "requested by "+user)
+			startJobStep(sessionID, StepDownload)
+			filename, err = fetch()
+		}
+		if err == errShutdownInterrupted {
+			// Left running in the job store, so the next start queues it again
+			finishCancellable(sessionID)
+			jobLogger(jobLog, sessionID, "finish").Info("Download interrupted by the shutdown")
+			interrupted = true
+			return
+		}
+		if finishCancellable(sessionID) {
+			// Partial files went with the staging directory; a file fetched anyway is dropped
+			if err == nil && filename != "" {
+				os.Remove(downloadPath(filename))
+			}
+			filename, err = "", errJobCancelled
+		}
 
-	progressMutex.RLock()
-	clients := progressClients[sessionID]
-	progressMutex.RUnlock()
+		finishJobStep(sessionID, StepDownload, err)
 
-	// Send to all connected clients for this session
-	for _, ch := range clients {
-		select {
-		case ch <- update:
-		default:
-			// Channel full or closed, skip
+		// Before completion: the file is deleted once the client fetched it.
+		// A demo job has no steps after the download.
+		if err == nil {
+			filename = runJobSteps(sessionID, req, user, filename)
 		}
-	}
 
-	// If 100%, close all channels and cache the final update
-	if progress == 100 {
-		progressMutex.Lock()
-		for _, ch := range progressClients[sessionID] {
-			// Use defer + recover to prevent panic if channel already closed
-			func(c chan ProgressUpdate) {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("[SSE] Channel already closed for session %s", sessionID)
-					}
-				}()
-				close(c)
-			}(ch)
+		finishJob(sessionID, filename, err)
+		var update ProgressUpdate
+		if err != nil {
+			jobLogger(jobLog, sessionID, "finish").Warn("Download failed", "error", err)
+			update = errorUpdate(sessionID, fmt.Sprintf("%v", err))
+			update.Cancelled = err == errJobCancelled
+			update.Hint = errorHint(err)
+		} else {
+			update = completionUpdate(sessionID, filename)
 		}
-		delete(progressClients, sessionID)
+		emitJobEvent(EventJobFinished, sessionID, &update, "")
+	})
+}
 
-		// Cache the final update for reconnects
-		completedDownloads[sessionID] = &CompletedDownload{
-			FinalUpdate: update,
-			CompletedAt: time.Now(),
-		}
+func sendProgress(sessionID string, progress int, status string) {
+	jobLog.Debug("Progress", "session", sessionID, "progress", progress, "status", status)
+
+	var phase string
+	updateJob(sessionID, func(job *Job) {
+		job.Progress = progress
+		phase = job.currentStep()
+	})
+	// Progress is too frequent to snapshot the job for every update
+	publishEvent(LifecycleEvent{Type: EventJobProgress, SessionID: sessionID, Update: &ProgressUpdate{Progress: progress, Status: status, Phase: phase}})
+}
 
-		progressMutex.Unlock()
-		log.Printf("[SSE] Closed all channels for completed session: %s", sessionID)
+// completionUpdate builds the final 100% update including the tool versions used for the job
+func completionUpdate(sessionID string, filename string) ProgressUpdate {
+	status := fmt.Sprintf("Completed: %s", filename)
+	jobLog.Info("Job completed", "session", sessionID, "file", filename)
+
+	update := ProgressUpdate{Progress: 100, Status: status}
+	if job, ok := getJob(sessionID); ok {
+		update.Versions = &job.Versions
+		update.Parts = job.Parts
+		update.TransferURLs = job.TransferURLs
 	}
+	update.Demo = demoMode
+	return update
 }
 
-func sendError(sessionID string, errorMsg string) {
-	log.Printf("Error [%s]: %s", sessionID, errorMsg)
+// errorUpdate builds the final update of a failed job
+func errorUpdate(sessionID string, errorMsg string) ProgressUpdate {
+	jobLog.Info("Job failed", "session", sessionID, "message", errorMsg)
 
 	update := ProgressUpdate{Progress: -1, Status: errorMsg, Error: true}
+	if job, ok := getJob(sessionID); ok {
+		update.Versions = &job.Versions
+	}
+	return update
+}
 
-	progressMutex.Lock()
-	clients := progressClients[sessionID]
+func downloadVideo(url string, req DownloadRequest, sessionID, ytdlp string) (string, error) {
+	format := req.Format
+	jlog := jobLogger(ytdlpLog, sessionID, "download")
 
-	// Send error to all connected clients
-	for _, ch := range clients {
-		select {
-		case ch <- update:
-		default:
-			// Channel full or closed, skip
+	// Clips download the exact range of their parent video
+	var clipTitle string
+	if resolver.IsClipURL(url) {
+		sendProgress(sessionID, 5, "Clip wird aufgelöst...")
+		clip, err := resolveClip(url, ytdlp)
+		if err != nil {
+			return "", err
 		}
+		ytdlpLog.Info("Clip resolved", "session", sessionID, "clip", url, "url", clip.WatchURL, "start", clip.Section.Start, "end", clip.Section.End)
+		url, clipTitle = clip.WatchURL, clip.Title
+		req.Section = &clip.Section
 	}
-
-	// Close all channels and cache the error for reconnects
-	for _, ch := range clients {
-		// Use defer + recover to prevent panic if channel already closed
-		func(c chan ProgressUpdate) {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("[SSE] Channel already closed for session %s", sessionID)
-				}
-			}()
-			close(c)
-		}(ch)
+	if req.Section == nil {
+		req.Section, _ = requestSection(req) // Validated when the job was started
 	}
-	delete(progressClients, sessionID)
-
-	// Cache the error update for reconnects
-	completedDownloads[sessionID] = &CompletedDownload{
-		FinalUpdate: update,
-		CompletedAt: time.Now(),
+	// Jobs from the other entry points and blocks added while the job was queued
+	if entry, blocked := blockedURL(req.URL, url); blocked {
+		jlog.Warn("Refused blocked video", "entry", entry.ID, "type", entry.Type)
+		return "", errBlockedByPolicy
+	}
+	if req.Section != nil {
+		section := *req.Section
+		updateJob(sessionID, func(job *Job) { job.Section = &section })
 	}
 
-	progressMutex.Unlock()
-
-	log.Printf("[SSE] Closed all channels for errored session: %s", sessionID)
-}
-
-func downloadVideo(url, format, sessionID string) (string, error) {
 	// Create downloads directory if it doesn't exist
-	downloadsDir := "./downloads"
-	if err := os.MkdirAll(downloadsDir, 0755); err != nil {
+	if err := os.MkdirAll(metadataDir, 0755); err != nil {
 		return "", fmt.Errorf("Fehler beim Erstellen des Download-Verzeichnisses: %v", err)
 	}
 
+	// yt-dlp writes into a per-job staging dir; only the finished file is moved to ./downloads
+	stagingDir := jobStagingDir(sessionID)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return "", fmt.Errorf("Fehler beim Erstellen des Download-Verzeichnisses: %v", err)
+	}
+	defer func() {
+		// Recovery continues the .part files of a download killed by the shutdown
+		if !interruptedByShutdown(sessionID) {
+			os.RemoveAll(stagingDir)
+		}
+	}()
+
 	sendProgress(sessionID, 10, "Download wird gestartet...")
 
-	// Generate timestamp for unique filename
+	// Generate timestamp for unique filename; the job's creation time, so a job queued
+	// again after a restart continues its .part files
 	timestamp := time.Now().Format("20060102_150405")
-	outputTemplate := filepath.Join(downloadsDir, fmt.Sprintf("%s_%%(title)s.%%(ext)s", timestamp))
+	if job, ok := getJob(sessionID); ok {
+		timestamp = job.CreatedAt.Format("20060102_150405")
+	}
+	outputTemplate := filepath.Join(stagingDir, fmt.Sprintf("%s_%%(title)s.%%(ext)s", timestamp))
 
 	var args []string
 
@@ -723,13 +812,49 @@ func downloadVideo(url, format, sessionID string) (string, error) {
 	commonArgs := []string{
 		"--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
 		"--no-playlist",
+		// Metadata for post-processing (lyrics, tagging) is written outside the download glob
+		"--write-info-json",
+		"-o", "infojson:" + infoJSONTemplate(sessionID),
 	}
 
+	if req.CaptureMinutes > 0 {
+		commonArgs = append(commonArgs, captureArgs(req)...)
+	}
+	if req.InferChapters {
+		commonArgs = append(commonArgs, commentArgs()...)
+	}
+	if req.Section != nil {
+		commonArgs = append(commonArgs, sectionArgs(*req.Section)...)
+	}
+	// While YouTube throttles the server, jobs may sleep, switch client or use a proxy
+	plan := planThrottleMitigation()
+	if plan.mitigated() {
+		appendJobLog(sessionID, plan.describe())
+	}
+	var flags FlagSet
+	if job, ok := getJob(sessionID); ok {
+		flags = job.Flags
+	}
+	commonArgs = append(commonArgs, featureFlagArgs(flags, plan.youtubeArgs...)...)
+	commonArgs = append(commonArgs, plan.args...)
+	if pacing := globalPacing.merge(plan.pacing); !pacing.isZero() {
+		commonArgs = append(commonArgs, pacing.args()...)
+		appendJobLog(sessionID, pacing.describe())
+	}
+	cookieArgs := userCookieArgs(req.Account, stagingDir)
+	commonArgs = append(commonArgs, cookieArgs...)
+
+	// Resampling, downmixing and filters are applied by the ExtractAudio post-processor
+	if audioArgs := audioOutputArgs(req); audioArgs != "" {
+		commonArgs = append(commonArgs, "--postprocessor-args", "ExtractAudio+ffmpeg_o:"+audioArgs)
+	}
+	commonArgs = append(commonArgs, audioFormatArgs(req.Quality)...)
+
 	switch format {
-	case "mp4":
+	case "mp4", "webm", "mkv":
 		args = append(commonArgs,
-			"-f", "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best",
-			"--merge-output-format", "mp4",
+			"-f", videoFormatSelector(format, req.Quality),
+			"--merge-output-format", format,
 			"-o", outputTemplate,
 			url,
 		)
@@ -737,7 +862,7 @@ func downloadVideo(url, format, sessionID string) (string, error) {
 		args = append(commonArgs,
 			"-x",
 			"--audio-format", "mp3",
-			"--audio-quality", "0",
+			"--audio-quality", audioQuality(req),
 			"-o", outputTemplate,
 			url,
 		)
@@ -752,7 +877,31 @@ func downloadVideo(url, format, sessionID string) (string, error) {
 		args = append(commonArgs,
 			"-x",
 			"--audio-format", "m4a",
-			"--audio-quality", "0",
+			"--audio-quality", audioQuality(req),
+			"-o", outputTemplate,
+			url,
+		)
+	case "flac":
+		args = append(commonArgs,
+			"-x",
+			"--audio-format", "flac",
+			"-o", outputTemplate,
+			url,
+		)
+	case "opus":
+		args = append(commonArgs,
+			"-x",
+			"--audio-format", "opus",
+			"--audio-quality", audioQuality(req),
+			"-o", outputTemplate,
+			url,
+		)
+	case "ogg":
+		// yt-dlp calls Ogg Vorbis "vorbis" and writes it as .ogg
+		args = append(commonArgs,
+			"-x",
+			"--audio-format", "vorbis",
+			"--audio-quality", audioQuality(req),
 			"-o", outputTemplate,
 			url,
 		)
@@ -760,9 +909,23 @@ func downloadVideo(url, format, sessionID string) (string, error) {
 		return "", fmt.Errorf("unsupported format: %s", format)
 	}
 
-	sendProgress(sessionID, 20, "Video-Informationen werden abgerufen...")
+	// Reuse the extraction of a recent format check instead of asking YouTube again.
+	// Canary and flagged jobs extract themselves, as do live captures and jobs with
+	// personal cookies (the cached extraction was made without them).
+	cachedInfo, useCachedInfo := "", false
+	if job, ok := getJob(sessionID); ok && ytdlp == ytdlpBinary && len(featureFlagArgs(job.Flags)) == 0 && req.CaptureMinutes == 0 && len(cookieArgs) == 0 {
+		cachedInfo, useCachedInfo = cachedExtractionPath(url)
+	}
+	if useCachedInfo {
+		jlog.Info("Using cached info JSON")
+		args = append(args[:len(args)-1], "--load-info-json", cachedInfo)
+		sendProgress(sessionID, 20, "Video-Informationen aus dem Cache geladen...")
+	} else {
+		sendProgress(sessionID, 20, "Video-Informationen werden abgerufen...")
+	}
 
-	cmd := exec.Command("yt-dlp", args...)
+	cmd := exec.Command(ytdlp, args...)
+	setProcessGroup(cmd) // Cancelling kills ffmpeg too
 
 	// Capture stdout and stderr
 	stdout, err := cmd.StdoutPipe()
@@ -778,19 +941,35 @@ func downloadVideo(url, format, sessionID string) (string, error) {
 	if err := cmd.Start(); err != nil {
 		return "", fmt.Errorf("Download konnte nicht gestartet werden")
 	}
+	started := time.Now()
+	untrack := trackJobProcess(sessionID, cmd)
+	defer untrack()
+	if req.CaptureMinutes > 0 {
+		stopWatchdog := startCaptureWatchdog(sessionID, req, cmd)
+		defer stopWatchdog()
+	}
 
 	// Collect stderr output for better error messages
-	var stderrOutput strings.Builder
+	stderrOutput := newOutputBuffer(stderrHeadBytes, stderrTailBytes)
+
+	// Wait must not close the pipes before both readers are done, or the final
+	// ERROR line can be missing from stderrOutput
+	var readers sync.WaitGroup
+	readers.Add(2)
 
 	// Monitor stdout for progress (yt-dlp writes download progress to stdout!)
 	go func() {
+		defer readers.Done()
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
 			line := scanner.Text()
 			// Log stdout for debugging
 			if line != "" {
-				log.Printf("yt-dlp stdout: %s", line)
+				jlog.Debug("yt-dlp output", "stream", "stdout", "line", line)
+				appendJobLog(sessionID, line)
 			}
+			recordThroughputLine(plan.egress, line)
+			recordDownloadedLine(sessionID, line)
 
 			// Parse download progress from stdout
 			// Format: "[download]  45.3% of 10.00MiB at  500.00KiB/s ETA 00:20"
@@ -824,11 +1003,30 @@ func downloadVideo(url, format, sessionID string) (string, error) {
 
 	// Monitor stderr for errors AND progress (yt-dlp writes progress to stderr!)
 	go func() {
+		defer readers.Done()
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
 			line := scanner.Text()
 			stderrOutput.WriteString(line + "\n")
-			log.Printf("yt-dlp: %s", line)
+			jlog.Debug("yt-dlp output", "stream", "stderr", "line", line)
+			appendJobLog(sessionID, line)
+
+			if code, args, ok := detectWarning(line); ok {
+				sendWarning(sessionID, code, args...)
+				if code == WarningRateLimited {
+					recordRateLimit(plan.egress)
+				}
+			}
+			recordThroughputLine(plan.egress, line)
+			recordDownloadedLine(sessionID, line)
+
+			// Live captures report ffmpeg's recorded time instead of a percentage
+			if req.CaptureMinutes > 0 {
+				if progress, elapsed, ok := captureProgress(line, req.CaptureMinutes); ok {
+					sendProgress(sessionID, progress, fmt.Sprintf("Aufnahme läuft... %d:%02d von %d:00", int(elapsed)/60, int(elapsed)%60, req.CaptureMinutes))
+					continue
+				}
+			}
 
 			// Parse download progress from stderr
 			// Format: "[download]  45.3% of 10.00MiB at  500.00KiB/s ETA 00:20"
@@ -860,94 +1058,125 @@ func downloadVideo(url, format, sessionID string) (string, error) {
 		}
 	}()
 
-	if err := cmd.Wait(); err != nil {
-		errorMsg := stderrOutput.String()
-
-		// Log full stderr for debugging
-		log.Printf("[yt-dlp] Full stderr output for session %s:\n%s", sessionID, errorMsg)
+	readers.Wait()
+	waitErr := cmd.Wait()
+	observeYtDlpRun(sessionID, started, waitErr)
+	recordProcessResources(sessionID, cmd.ProcessState)
 
-		// Report to Slack for critical errors
-		reportBackendError(fmt.Sprintf("yt-dlp failed: %v", err), map[string]string{
-			"url":     url,
-			"format":  format,
-			"session": sessionID,
-			"stderr":  truncateString(errorMsg, 1000), // Increased from 500 to 1000
+	// Keep the video metadata with the job; the info JSON is removed either way
+	if metadata, err := readInfoJSON(sessionID); err == nil {
+		updateJob(sessionID, func(job *Job) {
+			job.Metadata = metadata
+			job.Language = metadata.Language
 		})
-
-		// Check for specific error conditions
-		if strings.Contains(errorMsg, "Requested format is not available") {
-			return "", fmt.Errorf("Das gewählte Format ist für dieses Video nicht verfügbar. Versuche ein anderes Format.")
-		}
-		if strings.Contains(errorMsg, "Only images are available") {
-			return "", fmt.Errorf("Dieses Video enthält nur Bilder und kann nicht heruntergeladen werden")
-		}
-		if strings.Contains(errorMsg, "Video unavailable") {
-			return "", fmt.Errorf("Video ist nicht verfügbar oder wurde gelöscht")
-		}
-		if strings.Contains(errorMsg, "Private video") {
-			return "", fmt.Errorf("Video ist privat und kann nicht heruntergeladen werden")
-		}
-		if strings.Contains(errorMsg, "This video is not available in your country") || strings.Contains(errorMsg, "geo") {
-			return "", fmt.Errorf("Video ist in deinem Land nicht verfügbar (Geo-Blocking)")
-		}
-		if strings.Contains(errorMsg, "copyright") {
-			return "", fmt.Errorf("Video ist urheberrechtlich geschützt und kann nicht heruntergeladen werden")
+		// Channels are only known now; the staged file is removed with the staging dir
+		if entry, blocked := blockedMetadata(metadata); blocked {
+			jlog.Warn("Refused blocked video", "entry", entry.ID, "type", entry.Type, "channel", metadata.ChannelID)
+			return "", errBlockedByPolicy
 		}
-		if strings.Contains(errorMsg, "Sign in") || strings.Contains(errorMsg, "age") {
-			return "", fmt.Errorf("Video erfordert Altersbeschränkung oder Anmeldung")
+	}
+
+	if err := waitErr; err != nil {
+		if interruptedByShutdown(sessionID) {
+			return "", errShutdownInterrupted
 		}
-		if strings.Contains(errorMsg, "network") || strings.Contains(errorMsg, "connection") {
-			return "", fmt.Errorf("Netzwerkfehler. Bitte überprüfe deine Internetverbindung")
+		if isCancelled(sessionID) {
+			return "", errJobCancelled
 		}
-		if strings.Contains(errorMsg, "429") || strings.Contains(errorMsg, "Too Many Requests") {
-			return "", fmt.Errorf("Zu viele Anfragen. Bitte versuche es in einigen Minuten erneut")
+		errorMsg := stderrOutput.String()
+
+		// Log captured stderr for debugging
+		jlog.Error("yt-dlp failed", "error", err, "stderr", errorMsg)
+
+		rule := classifyYtDlpError(errorMsg)
+		if useCachedInfo {
+			// The media URLs may have been revoked early; the next attempt extracts again
+			forgetExtraction(url)
 		}
 
-		// Generic error if no specific match
-		return "", fmt.Errorf("Download fehlgeschlagen. Bitte überprüfe die URL und versuche es erneut")
+		// Report to Slack/Sentry for critical errors
+		reportBackendError(fmt.Sprintf("yt-dlp failed: %v", err), map[string]string{
+			"url":           url,
+			"format":        format,
+			"session":       sessionID,
+			"code":          rule.Code,
+			"transient":     strconv.FormatBool(rule.Transient),
+			"remediation":   rule.Remediation,
+			"ytdlp_version": getToolVersion(ytdlp, "--version"),
+			"stderr":        stderrOutput.Excerpt(200, 800), // The ERROR lines are at the end
+		})
+
+		return "", rule.downloadError()
 	}
 
 	sendProgress(sessionID, 90, "Download abgeschlossen, finalisiere...")
 
-	// Try to find the downloaded file
-	files, err := filepath.Glob(filepath.Join(downloadsDir, timestamp+"_*"))
+	// Find the downloaded file, ignoring leftover .part files
+	stagedPath, err := findStagedFile(stagingDir, format)
 	if err != nil {
-		return "", fmt.Errorf("Fehler beim Suchen der heruntergeladenen Datei")
+		jlog.Error("No finished file", "error", err)
+		return "", fmt.Errorf("Download abgeschlossen, aber Datei wurde nicht gefunden")
 	}
 
-	if len(files) == 0 {
-		return "", fmt.Errorf("Download abgeschlossen, aber Datei wurde nicht gefunden")
+	if err := syncFile(stagedPath); err != nil {
+		return "", fmt.Errorf("Fehler beim Speichern der Datei: %v", err)
 	}
 
-	originalPath := files[0]
-	originalFilename := filepath.Base(originalPath)
+	originalFilename := filepath.Base(stagedPath)
 
 	// Sanitize filename to remove emojis and problematic characters
 	sanitizedFilename := sanitizeFilename(originalFilename)
+	if clipTitle != "" {
+		sanitizedFilename = sanitizeFilename(pathSeparators.Replace(clipTitle)) + filepath.Ext(originalFilename)
+	}
+	job, _ := getJob(sessionID)
+	if name := collectionFilename(req.Collection, job.Metadata, format, filepath.Ext(originalFilename)); name != "" {
+		sanitizedFilename = name
+	}
 
-	// If filename changed, rename the file
-	if sanitizedFilename != originalFilename {
-		newPath := filepath.Join(downloadsDir, sanitizedFilename)
-		if err := os.Rename(originalPath, newPath); err != nil {
-			log.Printf("Warning: Could not rename file from %s to %s: %v", originalFilename, sanitizedFilename, err)
-			// Continue with original filename if rename fails
-			return originalFilename, nil
-		}
-		log.Printf("File renamed from %s to %s (emojis removed)", originalFilename, sanitizedFilename)
-		return sanitizedFilename, nil
+	// Move into ./downloads (or the collection folder) without clobbering an existing file
+	finalPath, err := publishStagedFile(sessionID, req, stagedPath, sanitizedFilename)
+	if err != nil {
+		return "", err
+	}
+
+	if path.Base(finalPath) != originalFilename {
+		jlog.Info("File renamed", "from", originalFilename, "to", path.Base(finalPath))
 	}
+	return finalPath, nil
+}
 
-	// Return just the filename (not the full path)
-	return originalFilename, nil
+// downloadError is a failed download with a classification code for reporting and stats
+type downloadError struct {
+	Code      string
+	Message   string // User-facing message
+	Hint      string // User-facing next step, optional
+	Transient bool   // Trying again later may succeed
+}
+
+func (e *downloadError) Error() string {
+	return e.Message
+}
+
+// downloadErrorCode returns the classification code of err, "" for nil and "internal" for unclassified errors
+func downloadErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var dlErr *downloadError
+	if errors.As(err, &dlErr) {
+		return dlErr.Code
+	}
+	return "internal"
 }
 
 func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 	// Extract filename from URL path
 	filename := strings.TrimPrefix(r.URL.Path, "/download-file/")
-	log.Printf("[Download] Request received for file: %s (raw path: %s)", filename, r.URL.Path)
+	fileLog.Debug("Request received", "file", filename, "path", r.URL.Path)
 
 	if filename == "" {
-		log.Printf("[Download] ERROR: No filename provided")
+		fileLog.Warn("No filename provided")
 		http.Error(w, "Dateiname fehlt", http.StatusBadRequest)
 		return
 	}
@@ -955,56 +1184,65 @@ func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 	// URL decode the filename
 	decodedFilename, err := url.QueryUnescape(filename)
 	if err != nil {
-		log.Printf("[Download] ERROR: Failed to decode filename: %v", err)
+		fileLog.Warn("Failed to decode filename", "file", filename, "error", err)
 		http.Error(w, "Ungültiger Dateiname", http.StatusBadRequest)
 		return
 	}
 	filename = decodedFilename
-	log.Printf("[Download] Decoded filename: %s", filename)
-
-	// Security: Prevent directory traversal
+	fileLog.Debug("Decoded filename", "file", filename)
+
+	// Security: Prevent directory traversal; collection files are one level down
+	collectionDir := ""
+	if dir := filepath.Dir(filename); dir != "." {
+		if !isCollectionDir(dir) {
+			fileLog.Warn("Rejected unknown directory", "dir", dir, "ip", remoteIP(r))
+			http.Error(w, "Ungültiger Dateiname", http.StatusBadRequest)
+			return
+		}
+		collectionDir = dir
+	}
 	filename = filepath.Base(filename)
-	log.Printf("[Download] After Base(): %s", filename)
+	fileLog.Debug("After Base()", "file", filename)
 
 	// Additional security: reject suspicious filenames
 	if strings.Contains(filename, "..") || strings.ContainsAny(filename, "/\\") {
-		log.Printf("[Download] SECURITY: Rejected suspicious filename: %s", filename)
+		fileLog.Warn("Rejected suspicious filename", "file", filename, "ip", remoteIP(r))
 		http.Error(w, "Ungültiger Dateiname", http.StatusBadRequest)
 		return
 	}
 
 	// Build full path
-	filePath := filepath.Join("./downloads", filename)
-	log.Printf("[Download] Full path: %s", filePath)
+	filePath := filepath.Join(downloadsDir, collectionDir, filename)
+	fileLog.Debug("Full path", "path", filePath)
 
 	// Security: Verify the resolved path is still within downloads directory
-	absDownloads, _ := filepath.Abs("./downloads")
+	absDownloads, _ := filepath.Abs(downloadsDir)
 	absFilePath, _ := filepath.Abs(filePath)
 	if !strings.HasPrefix(absFilePath, absDownloads) {
-		log.Printf("[Download] SECURITY: Path traversal attempt detected: %s", filename)
+		fileLog.Warn("Path traversal attempt", "file", filename, "ip", remoteIP(r))
 		http.Error(w, "Zugriff verweigert", http.StatusForbidden)
 		return
 	}
 
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		log.Printf("[Download] ERROR: File not found: %s", filePath)
 		// List available files for debugging
-		files, _ := filepath.Glob("./downloads/*")
-		log.Printf("[Download] Available files in downloads:")
+		var available []string
+		files, _ := filepath.Glob(filepath.Join(downloadsDir, "*"))
 		for _, f := range files {
-			log.Printf("[Download]   - %s", filepath.Base(f))
+			available = append(available, filepath.Base(f))
 		}
+		fileLog.Warn("File not found", "path", filePath, "available", available)
 		http.Error(w, "Datei nicht gefunden. Möglicherweise wurde sie bereits heruntergeladen.", http.StatusNotFound)
 		return
 	}
 
-	log.Printf("[Download] File found, preparing to send: %s", filename)
+	fileLog.Debug("File found, preparing to send", "file", filename)
 
 	// Open file
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Printf("Download file error: Cannot open file %s: %v", filename, err)
+		fileLog.Error("Cannot open file", "file", filename, "error", err)
 		http.Error(w, "Fehler beim Öffnen der Datei", http.StatusInternalServerError)
 		return
 	}
@@ -1013,31 +1251,53 @@ func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 	// Get file info for size
 	fileInfo, err := file.Stat()
 	if err != nil {
-		log.Printf("Download file error: Cannot get file info %s: %v", filename, err)
+		fileLog.Error("Cannot get file info", "file", filename, "error", err)
 		http.Error(w, "Fehler beim Lesen der Dateiinformationen", http.StatusInternalServerError)
 		return
 	}
 
-	// Set headers for download
+	// Set headers for download; ServeContent adds length, ranges and Last-Modified
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
 
-	// Stream file to browser
-	if _, err := io.Copy(w, file); err != nil {
-		log.Printf("Error streaming file: %v", err)
+	// HEAD tells download managers the size without counting as a download
+	if r.Method == http.MethodHead {
+		http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
+		return
+	}
+
+	// Stream file to browser; partial and aborted transfers keep the file for a resume
+	delivered, written := serveDownload(w, r, filePath, file, fileInfo)
+	recordServedFile(filePath, written)
+	if !delivered {
+		fileLog.Info("Transfer not complete yet, file kept", "file", filename)
 		return
 	}
 
 	// Close file before deleting
 	file.Close()
 
+	relPath := filepath.ToSlash(filepath.Join(collectionDir, filename))
+	if job, ok := findJobByFilename(relPath); ok {
+		publishEvent(LifecycleEvent{Type: EventJobServed, SessionID: job.SessionID, Job: job, Detail: "sent to " + remoteIP(r)})
+	}
+
+	// Shared and seeded files stay until the last share ends or the job is purged
+	if shareKeepsFile(relPath) || torrentKeepsFile(relPath) {
+		fileLog.Info("File kept for active shares or torrent seeding", "file", filename)
+		return
+	}
+
 	// Delete file after successful download
 	if err := os.Remove(filePath); err != nil {
-		log.Printf("Error deleting file after download: %v", err)
+		fileLog.Error("Cannot delete file after download", "file", filename, "error", err)
 	} else {
-		log.Printf("File deleted after download: %s", filename)
+		fileLog.Info("File deleted after download", "file", filename)
 	}
+
+	// Remove generated sidecar files (waveform peaks, lyrics) along with the media
+	os.Remove(waveformPath(filePath))
+	os.Remove(lyricsPath(filePath))
 }
 
 func handleCheckFormats(w http.ResponseWriter, r *http.Request) {
@@ -1047,17 +1307,16 @@ func handleCheckFormats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req DownloadRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(FormatCheckResponse{
+	if reqErr := decodeJSONBody(w, r, &req, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, FormatCheckResponse{
 			Success: false,
-			Message: "Ungültige Anfrage",
+			Message: reqErr.message,
 		})
 		return
 	}
 
 	// Validate that URL is from YouTube
-	if !isValidYouTubeURL(req.URL) {
+	if !resolver.IsYouTubeURL(req.URL) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(FormatCheckResponse{
 			Success: false,
@@ -1077,107 +1336,67 @@ func handleCheckFormats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Run yt-dlp with format listing and JSON output for detailed info
-	cmd := exec.Command("yt-dlp",
-		"--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"-F",
-		"--no-warnings",
-		cleanedURL)
-	output, err := cmd.CombinedOutput()
-
-	response := FormatCheckResponse{
-		Success:     true,
-		HasSABR:     false,
-		Warnings:    []string{},
-		QualityInfo: make(map[string]string),
-	}
-
-	outputStr := string(output)
-
-	// Check for SABR warnings in output
-	if strings.Contains(outputStr, "SABR") || strings.Contains(outputStr, "missing a url") {
-		response.HasSABR = true
-		response.Warnings = append(response.Warnings, "SABR-Streaming erkannt - einige Formate möglicherweise nicht verfügbar")
-	}
-
-	// Check for other warnings
-	if strings.Contains(outputStr, "nsig extraction failed") {
-		response.Warnings = append(response.Warnings, "Signatur-Extraktion fehlgeschlagen - einige Formate fehlen möglicherweise")
-	}
-
-	if err != nil {
-		response.Success = false
-		response.Message = "Fehler beim Abrufen der Formatinformationen"
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	// Parse format output to get best quality info
-	lines := strings.Split(outputStr, "\n")
-	bestVideoResolution := ""
-	bestAudioBitrate := ""
-
-	// Regex patterns for extracting quality information
-	videoResPattern := regexp.MustCompile(`(\d{3,4})p`)
-	audioBitratePattern := regexp.MustCompile(`(\d+)k`)
-
-	for _, line := range lines {
-		// Look for best video format lines (usually contains resolution like 1080p, 720p)
-		if strings.Contains(line, "mp4") && (strings.Contains(line, "1080p") || strings.Contains(line, "720p") || strings.Contains(line, "2160p") || strings.Contains(line, "4320p")) {
-			if response.BestVideoInfo == "" {
-				response.BestVideoInfo = strings.TrimSpace(line)
-			}
-
-			// Extract resolution
-			if matches := videoResPattern.FindStringSubmatch(line); len(matches) > 1 {
-				res := matches[1]
-				if bestVideoResolution == "" || parseResolution(res) > parseResolution(bestVideoResolution) {
-					bestVideoResolution = res + "p"
-				}
-			}
-		}
-		// Look for best audio format
-		if strings.Contains(line, "audio only") && (strings.Contains(line, "m4a") || strings.Contains(line, "webm") || strings.Contains(line, "opus")) {
-			if response.BestAudioInfo == "" {
-				response.BestAudioInfo = strings.TrimSpace(line)
-			}
-
-			// Extract bitrate
-			if matches := audioBitratePattern.FindStringSubmatch(line); len(matches) > 1 {
-				bitrate := matches[1]
-				if bestAudioBitrate == "" || parseInt(bitrate) > parseInt(bestAudioBitrate) {
-					bestAudioBitrate = bitrate + "kbps"
-				}
-			}
+	// Serve repeated checks for the same video from cache
+	videoID := resolver.VideoID(cleanedURL)
+	info, cached := getCachedFormatInfo(videoID)
+	if cached {
+		ytdlpLog.Debug("Format check served from cache", "video", videoID)
+	} else {
+		// The probe also caches the extraction for a download right after the check
+		_, info, err = probeInfo(cleanedURL)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(FormatCheckResponse{
+				Success:  false,
+				Message:  "Fehler beim Abrufen der Formatinformationen",
+				Hint:     errorHint(err),
+				HasSABR:  info.HasSABR,
+				Warnings: info.Warnings,
+			})
+			return
 		}
+		storeFormatInfo(videoID, info)
 	}
 
-	// Set quality info for each format with user-friendly labels
-	if bestVideoResolution != "" {
-		response.QualityInfo["mp4"] = formatQualityLabel(bestVideoResolution, true)
-	}
-	if bestAudioBitrate != "" {
-		audioLabel := formatQualityLabel(bestAudioBitrate, false)
-		response.QualityInfo["mp3"] = audioLabel
-		response.QualityInfo["wav"] = audioLabel
-		response.QualityInfo["m4a"] = audioLabel
+	response := FormatCheckResponse{
+		Success:       true,
+		HasSABR:       info.HasSABR,
+		BestVideoInfo: info.BestVideoInfo,
+		BestAudioInfo: info.BestAudioInfo,
+		Warnings:      info.Warnings,
+		QualityInfo:   info.QualityInfo,
 	}
 
 	// Determine what will actually be downloaded based on format
-	switch req.Format {
+	response.SelectedFormat = describeSelectedFormat(req.Format)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// describeSelectedFormat explains what will actually be downloaded for a format
+func describeSelectedFormat(format string) string {
+	switch format {
 	case "mp4":
-		response.SelectedFormat = "Bestes Video (MP4) + Audio zusammengeführt"
+		return "Bestes Video (MP4) + Audio zusammengeführt"
 	case "mp3":
-		response.SelectedFormat = "Beste Audio-Qualität → MP3 konvertiert"
+		return "Beste Audio-Qualität → MP3 konvertiert"
 	case "wav":
-		response.SelectedFormat = "Beste Audio-Qualität → WAV konvertiert"
+		return "Beste Audio-Qualität → WAV konvertiert"
 	case "m4a":
-		response.SelectedFormat = "Beste Audio-Qualität → M4A konvertiert"
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+		return "Beste Audio-Qualität → M4A konvertiert"
+	case "webm":
+		return "Bestes Video (WebM) + Audio zusammengeführt"
+	case "mkv":
+		return "Bestes Video + Audio in MKV zusammengeführt"
+	case "flac":
+		return "Beste Audio-Qualität → FLAC (verlustfrei) konvertiert"
+	case "opus":
+		return "Beste Audio-Qualität → Opus konvertiert"
+	case "ogg":
+		return "Beste Audio-Qualität → OGG Vorbis konvertiert"
+	}
+	return ""
 }
 
 func sendJSONResponse(w http.ResponseWriter, response DownloadResponse) {
@@ -1185,9 +1404,14 @@ func sendJSONResponse(w http.ResponseWriter, response DownloadResponse) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// reportBackendError sends backend errors to Slack automatically
+// reportBackendError sends backend errors to Slack and Sentry automatically
 func reportBackendError(errorMsg string, context map[string]string) {
-	if slackWebhookURL == "" {
+	captureSentryMessage(errorMsg, context)
+	data := newNotificationData(NotifyError)
+	data.Message, data.Session, data.Fields = errorMsg, context["session"], context
+	notifyMatrix(notificationText(NotifierMatrix, data, fmt.Sprintf("⚠️ Backend-Fehler: %s (Session %s, Code %s)", errorMsg, context["session"], context["code"])))
+
+	if slackWebhookURL() == "" {
 		return // Silently skip if not configured
 	}
 
@@ -1204,18 +1428,30 @@ func reportBackendError(errorMsg string, context map[string]string) {
 		}
 
 		if err := sendSlackNotification(report); err != nil {
-			log.Printf("[BackendError] Failed to send Slack notification: %v", err)
+			slackLog.Error("Failed to send backend error", "error", err)
 		}
 	}()
 }
 
 // sendSlackNotification sends a formatted error report to Slack
 func sendSlackNotification(report ErrorReport) error {
-	if slackWebhookURL == "" {
-		log.Printf("[Slack] Warning: SLACK_WEBHOOK_URL not configured, skipping notification")
+	if slackWebhookURL() == "" {
+		slackLog.Warn("SLACK_WEBHOOK_URL not configured, skipping notification")
 		return nil
 	}
 
+	data := newNotificationData(NotifyError)
+	data.Message, data.Session, data.Fields = report.ErrorMessage, report.SessionID, report.BrowserInfo
+	if err := postSlackMessage(slackNotification(data, buildErrorSlackMessage(report))); err != nil {
+		return err
+	}
+
+	slackLog.Info("Error report sent", "session", report.SessionID)
+	return nil
+}
+
+// buildErrorSlackMessage formats an error report as a Slack message
+func buildErrorSlackMessage(report ErrorReport) SlackMessage {
 	// Build Slack message with rich formatting
 	message := SlackMessage{
 		Text: "🚨 YouTube Downloader Error Report",
@@ -1283,13 +1519,22 @@ func sendSlackNotification(report ErrorReport) error {
 		})
 	}
 
-	// Send to Slack
+	return message
+}
+
+// postSlackMessage sends a message to the configured Slack webhook
+func postSlackMessage(message SlackMessage) error {
+	return postSlackMessageTo(slackWebhookURL(), message)
+}
+
+// postSlackMessageTo posts a message to a specific incoming webhook (and thus channel)
+func postSlackMessageTo(webhookURL string, message SlackMessage) error {
 	payload, err := json.Marshal(message)
 	if err != nil {
 		return fmt.Errorf("failed to marshal Slack message: %v", err)
 	}
 
-	resp, err := http.Post(slackWebhookURL, "application/json", strings.NewReader(string(payload)))
+	resp, err := http.Post(webhookURL, "application/json", strings.NewReader(string(payload)))
 	if err != nil {
 		return fmt.Errorf("failed to send Slack notification: %v", err)
 	}
@@ -1300,10 +1545,17 @@ func sendSlackNotification(report ErrorReport) error {
 		return fmt.Errorf("slack returned status %d: %s", resp.StatusCode, string(body))
 	}
 
-	log.Printf("[Slack] Error report sent successfully for session %s", report.SessionID)
 	return nil
 }
 
+// getEnvDefault returns the environment variable or a default if unset
+func getEnvDefault(key, fallback string) string {
+	if value := getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
 // truncateString truncates a string to maxLen characters
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -1319,10 +1571,22 @@ func handleErrorReport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var report ErrorReport
-	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
-		log.Printf("[ErrorReport] Failed to decode error report: %v", err)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	var raw map[string]json.RawMessage
+	if reqErr := decodeJSONBody(w, r, &raw, maxErrorReportBodyBytes); reqErr != nil {
+		errorReportLog.Warn("Failed to decode error report", "error", reqErr)
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{
+			"success": false,
+			"message": reqErr.message,
+		})
+		return
+	}
+	report, err := parseErrorReport(raw)
+	if err != nil {
+		errorReportLog.Warn("Failed to decode error report", "error", err)
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
 		return
 	}
 
@@ -1331,104 +1595,37 @@ func handleErrorReport(w http.ResponseWriter, r *http.Request) {
 		report.Timestamp = time.Now().Format(time.RFC3339)
 	}
 
+	// Attach backend job context if the session matches a known job
+	record := correlateErrorReport(report)
+
 	// Log error locally
-	log.Printf("[ErrorReport] Error received from frontend:")
-	log.Printf("[ErrorReport]   Message: %s", report.ErrorMessage)
-	log.Printf("[ErrorReport]   URL: %s", report.URL)
-	log.Printf("[ErrorReport]   User-Agent: %s", report.UserAgent)
-	log.Printf("[ErrorReport]   Session: %s", report.SessionID)
+	attrs := []any{"message", report.ErrorMessage, "url", report.URL, "userAgent", report.UserAgent, "session", report.SessionID}
 	if len(report.LastActions) > 0 {
-		log.Printf("[ErrorReport]   Last Actions: %v", report.LastActions)
+		attrs = append(attrs, "lastActions", report.LastActions)
 	}
 	if report.ErrorStack != "" {
-		log.Printf("[ErrorReport]   Stack: %s", report.ErrorStack)
+		attrs = append(attrs, "stack", report.ErrorStack)
+	}
+	if record.Job != nil {
+		attrs = append(attrs, "jobUrl", record.Job.URL, "jobStatus", record.Job.Status)
 	}
+	errorReportLog.Warn("Error received from frontend", attrs...)
 
 	// Send to Slack
 	go func() {
-		if err := sendSlackNotification(report); err != nil {
-			log.Printf("[ErrorReport] Failed to send Slack notification: %v", err)
+		if err := sendCorrelatedSlackNotification(record); err != nil {
+			errorReportLog.Error("Failed to send Slack notification", "error", err)
 		}
 	}()
 
 	// Respond to frontend
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
-}
-
-// sendStartupNotification sends a notification to Slack when the service starts
-func sendStartupNotification() {
-	if slackWebhookURL == "" {
-		log.Printf("[Startup] SLACK_WEBHOOK_URL not configured, skipping startup notification")
-		return
-	}
-
-	// Get hostname
-	hostname, _ := os.Hostname()
-
-	// Get yt-dlp version
-	ytdlpVersion := "unknown"
-	cmd := exec.Command("yt-dlp", "--version")
-	if output, err := cmd.Output(); err == nil {
-		ytdlpVersion = strings.TrimSpace(string(output))
-	}
-
-	message := SlackMessage{
-		Text: "✅ YouTube Downloader gestartet",
-		Attachments: []SlackAttachment{
-			{
-				Color: "good",
-				Fields: []SlackField{
-					{
-						Title: "Status",
-						Value: "🚀 Service läuft wieder",
-						Short: true,
-					},
-					{
-						Title: "Hostname",
-						Value: hostname,
-						Short: true,
-					},
-					{
-						Title: "Timestamp",
-						Value: time.Now().Format("2006-01-02 15:04:05 MST"),
-						Short: true,
-					},
-					{
-						Title: "yt-dlp Version",
-						Value: ytdlpVersion,
-						Short: true,
-					},
-				},
-			},
-		},
-	}
-
-	payload, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("[Startup] Failed to marshal Slack message: %v", err)
-		return
-	}
-
-	resp, err := http.Post(slackWebhookURL, "application/json", strings.NewReader(string(payload)))
-	if err != nil {
-		log.Printf("[Startup] Failed to send Slack notification: %v", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("[Startup] Slack returned status %d: %s", resp.StatusCode, string(body))
-		return
-	}
-
-	log.Printf("[Startup] Startup notification sent to Slack")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "schemaVersion": errorReportSchemaVersion})
 }
 
 // handleTestSlack is a test endpoint to verify Slack notifications work
 func handleTestSlack(w http.ResponseWriter, r *http.Request) {
-	if slackWebhookURL == "" {
+	if slackWebhookURL() == "" {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -1457,11 +1654,11 @@ func handleTestSlack(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	log.Printf("[TestSlack] Sending test notification to Slack...")
+	slackLog.Info("Sending test notification")
 
 	// Send to Slack
 	if err := sendSlackNotification(testReport); err != nil {
-		log.Printf("[TestSlack] Failed: %v", err)
+		slackLog.Error("Test notification failed", "error", err)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -1470,7 +1667,7 @@ func handleTestSlack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[TestSlack] Test notification sent successfully!")
+	slackLog.Info("Test notification sent")
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1479,24 +1676,6 @@ func handleTestSlack(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// parseResolution converts resolution string to int for comparison
-func parseResolution(res string) int {
-	resInt, err := strconv.Atoi(res)
-	if err != nil {
-		return 0
-	}
-	return resInt
-}
-
-// parseInt converts string to int for comparison
-func parseInt(s string) int {
-	val, err := strconv.Atoi(s)
-	if err != nil {
-		return 0
-	}
-	return val
-}
-
 // formatQualityLabel converts technical values to user-friendly labels
 func formatQualityLabel(value string, isVideo bool) string {
 	if isVideo {
@@ -1528,14 +1707,14 @@ func cleanupCompletedDownloads() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		progressMutex.Lock()
-		now := time.Now()
-		for sessionID, completed := range completedDownloads {
-			if now.Sub(completed.CompletedAt) > completedCacheTTL {
-				delete(completedDownloads, sessionID)
-				log.Printf("[Cleanup] Removed old completed download: %s", sessionID)
-			}
-		}
-		progressMutex.Unlock()
+		cleanupProgress()
+		cleanupJobs()
+		syncJobStore()
+		cleanupFormatCache()
+		cleanupExtractions()
+		cleanupImportBatches()
+		cleanupTrash()
+		cleanupShares()
+		cleanupRateLimiters()
 	}
 }
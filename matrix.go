@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Matrix integration: error/startup notifications go to MATRIX_ROOM_ID and
+// "!ytdown <url> [format]" messages in that room start downloads.
+var (
+	matrixHomeserver = strings.TrimSuffix(getenv("MATRIX_HOMESERVER"), "/")
+	matrixRoomID     = getenv("MATRIX_ROOM_ID")
+	matrixClient     = &http.Client{Timeout: 60 * time.Second} // Longer than the /sync long-poll
+	matrixTxnCounter atomic.Int64
+	matrixLog        = componentLogger("matrix")
+)
+
+const (
+	matrixCommandPrefix = "!ytdown"
+	matrixSyncTimeout   = 30 * time.Second
+	matrixMaxBackoff    = 5 * time.Minute
+)
+
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+type matrixEvent struct {
+	Type    string `json:"type"`
+	Sender  string `json:"sender"`
+	Content struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	} `json:"content"`
+}
+
+func matrixEnabled() bool {
+	return matrixHomeserver != "" && matrixAccessToken() != "" && matrixRoomID != ""
+}
+
+// notifyMatrix posts a notice to the configured room in the background
+func notifyMatrix(message string) {
+	if !matrixEnabled() {
+		return
+	}
+	go func() {
+		if err := sendMatrixMessage(message); err != nil {
+			matrixLog.Error("Failed to send notification", "error", err)
+		}
+	}()
+}
+
+// sendMatrixMessage posts a notice (not highlighted like regular messages) to the room
+func sendMatrixMessage(message string) error {
+	body, _ := json.Marshal(map[string]string{"msgtype": "m.notice", "body": message})
+	txnID := fmt.Sprintf("ytdown-%d-%d", time.Now().UnixNano(), matrixTxnCounter.Add(1))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		matrixHomeserver, url.PathEscape(matrixRoomID), txnID)
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return matrixRequest(req, nil)
+}
+
+func matrixRequest(req *http.Request, dst interface{}) error {
+	req.Header.Set("Authorization", "Bearer "+matrixAccessToken())
+	resp, err := matrixClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, message)
+	}
+	if dst == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// runMatrixBot long-polls /sync and handles commands in the configured room
+func runMatrixBot() {
+	if !matrixEnabled() {
+		return
+	}
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	req, _ := http.NewRequest(http.MethodGet, matrixHomeserver+"/_matrix/client/v3/account/whoami", nil)
+	if err := matrixRequest(req, &whoami); err != nil {
+		matrixLog.Error("Login check failed, bridge disabled", "error", err)
+		return
+	}
+	matrixLog.Info("Listening for commands", "prefix", matrixCommandPrefix, "room", matrixRoomID, "user", whoami.UserID)
+
+	filter, _ := json.Marshal(map[string]interface{}{
+		"room": map[string]interface{}{
+			"rooms":    []string{matrixRoomID},
+			"timeline": map[string]interface{}{"types": []string{"m.room.message"}},
+		},
+		"presence":     map[string]interface{}{"types": []string{}},
+		"account_data": map[string]interface{}{"types": []string{}},
+	})
+
+	since := ""
+	backoff := time.Second
+	for {
+		params := url.Values{}
+		params.Set("filter", string(filter))
+		if since != "" {
+			params.Set("since", since)
+			params.Set("timeout", fmt.Sprintf("%d", matrixSyncTimeout.Milliseconds()))
+		}
+
+		var sync matrixSyncResponse
+		req, _ := http.NewRequest(http.MethodGet, matrixHomeserver+"/_matrix/client/v3/sync?"+params.Encode(), nil)
+		if err := matrixRequest(req, &sync); err != nil {
+			matrixLog.Warn("Sync failed, retrying", "backoff", backoff.String(), "error", err)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, matrixMaxBackoff)
+			continue
+		}
+		backoff = time.Second
+
+		// The first sync only establishes the position; old commands are not replayed
+		if since != "" {
+			for _, event := range sync.Rooms.Join[matrixRoomID].Timeline.Events {
+				if event.Type == "m.room.message" && event.Sender != whoami.UserID {
+					handleMatrixCommand(event)
+				}
+			}
+		}
+		since = sync.NextBatch
+	}
+}
+
+// handleMatrixCommand runs "!ytdown <url> [format]"; the format defaults to mp3
+func handleMatrixCommand(event matrixEvent) {
+	fields := strings.Fields(event.Content.Body)
+	if len(fields) == 0 || fields[0] != matrixCommandPrefix {
+		return
+	}
+	if len(fields) < 2 {
+		notifyMatrix("Verwendung: !ytdown <url> [mp4|mp3|m4a|wav]")
+		return
+	}
+
+	req := DownloadRequest{URL: fields[1], Format: "mp3"}
+	if len(fields) > 2 {
+		req.Format = strings.ToLower(fields[2])
+	}
+	cleanedURL, msg := validateDownloadRequest(req)
+	if msg != "" {
+		notifyMatrix("❌ " + msg)
+		return
+	}
+
+	startJob(cleanedURL, req, "matrix:"+event.Sender, func(job Job) {
+		builtin := fmt.Sprintf("%s (%s)", chatJobResult(job), event.Sender)
+		notifyMatrix(notificationText(NotifierMatrix, jobNotificationData(job, event.Sender), builtin))
+	})
+	notifyMatrix(fmt.Sprintf("⏳ Download von %s als %s läuft...", cleanedURL, strings.ToUpper(req.Format)))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Video downloads can be copied into a media library and announced to Jellyfin
+// and/or Plex, so the new item shows up without waiting for a scheduled scan.
+var (
+	mediaLibraryDir       = getenv("MEDIA_LIBRARY_DIR")
+	mediaServerLibraryDir = getEnvDefault("MEDIA_SERVER_LIBRARY_DIR", mediaLibraryDir) // Same folder as seen by the media server
+	jellyfinURL           = getenv("JELLYFIN_URL")
+	plexURL               = getenv("PLEX_URL")
+	plexSectionID         = getenv("PLEX_SECTION_ID")
+	mediaServerClient     = &http.Client{Timeout: 15 * time.Second}
+	mediaServerLog        = componentLogger("mediaserver")
+)
+
+// Library scan results stored on the job
+const (
+	LibraryScanTriggered = "triggered"
+	LibraryScanFailed    = "failed"
+)
+
+func mediaLibraryEnabled() bool {
+	return mediaLibraryDir != ""
+}
+
+// exportToMediaLibrary copies a finished video into the media library and triggers a scan of it
+func exportToMediaLibrary(sessionID, mediaPath string) {
+	dst := filepath.Join(mediaLibraryDir, filepath.Base(mediaPath))
+	if err := os.MkdirAll(mediaLibraryDir, 0755); err != nil {
+		mediaServerLog.Error("Could not create the library directory", "path", mediaLibraryDir, "error", err)
+		return
+	}
+	if err := copyFileAtomic(mediaPath, dst); err != nil {
+		mediaServerLog.Error("Copy to library failed", "session", sessionID, "error", err)
+		appendJobLog(sessionID, fmt.Sprintf("[library] copy failed: %v", err))
+		return
+	}
+
+	// Translate to the path the media server knows, e.g. inside its container
+	serverPath := path.Join(filepath.ToSlash(mediaServerLibraryDir), filepath.Base(mediaPath))
+
+	status := ""
+	if jellyfinURL != "" {
+		status = scanResult(status, sessionID, "Jellyfin", notifyJellyfin(serverPath))
+	}
+	if plexURL != "" {
+		status = scanResult(status, sessionID, "Plex", refreshPlex(path.Dir(serverPath)))
+	}
+	if status != "" {
+		updateJob(sessionID, func(job *Job) { job.LibraryScan = status })
+	}
+}
+
+// scanResult logs a scan attempt and combines it with earlier results; any failure wins
+func scanResult(status, sessionID, server string, err error) string {
+	if err != nil {
+		mediaServerLog.Warn("Scan failed", "server", server, "session", sessionID, "error", err)
+		appendJobLog(sessionID, fmt.Sprintf("[library] %s scan failed: %v", server, err))
+		return LibraryScanFailed
+	}
+	mediaServerLog.Info("Scan triggered", "server", server, "session", sessionID)
+	if status == "" {
+		return LibraryScanTriggered
+	}
+	return status
+}
+
+// notifyJellyfin reports a new file so Jellyfin scans only that path
+func notifyJellyfin(serverPath string) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"Updates": []map[string]string{{"Path": serverPath, "UpdateType": "Created"}},
+	})
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(jellyfinURL, "/")+"/Library/Media/Updated", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Emby-Token", jellyfinToken())
+	return doMediaServerRequest(req)
+}
+
+// refreshPlex runs a partial scan of one folder in the configured library section
+func refreshPlex(serverDir string) error {
+	if plexSectionID == "" {
+		return fmt.Errorf("PLEX_SECTION_ID not configured")
+	}
+
+	params := url.Values{}
+	params.Set("path", serverDir)
+	params.Set("X-Plex-Token", plexToken())
+	endpoint := fmt.Sprintf("%s/library/sections/%s/refresh?%s", strings.TrimSuffix(plexURL, "/"), url.PathEscape(plexSectionID), params.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	return doMediaServerRequest(req)
+}
+
+func doMediaServerRequest(req *http.Request) error {
+	resp, err := mediaServerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
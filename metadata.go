@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// metadataDir holds the temporary yt-dlp .info.json files, outside the download glob
+var metadataDir = filepath.Join(downloadsDir, ".meta")
+
+// VideoMetadata is the subset of the yt-dlp info JSON kept with a job
+type VideoMetadata struct {
+	ID            string    `json:"id"`
+	Title         string    `json:"title"`
+	Uploader      string    `json:"uploader,omitempty"`
+	Channel       string    `json:"channel,omitempty"`
+	ChannelID     string    `json:"channel_id,omitempty"`  // UC...
+	UploaderID    string    `json:"uploader_id,omitempty"` // @handle
+	Artist        string    `json:"artist,omitempty"`      // Set for YouTube Music tracks
+	Track         string    `json:"track,omitempty"`
+	Album         string    `json:"album,omitempty"`
+	Duration      float64   `json:"duration,omitempty"` // Seconds
+	UploadDate    string    `json:"upload_date,omitempty"`
+	Language      string    `json:"language,omitempty"` // Set by the uploader or guessed, see language.go
+	Chapters      []Chapter `json:"chapters,omitempty"`
+	ChapterSource string    `json:"chapterSource,omitempty"` // youtube, or where inferred chapters came from
+}
+
+// infoJSONTemplate returns the yt-dlp output template for the job's info JSON
+// (yt-dlp appends .info.json itself)
+func infoJSONTemplate(sessionID string) string {
+	return filepath.Join(metadataDir, sessionID)
+}
+
+// readInfoJSON loads and removes the info JSON written by yt-dlp for the job
+func readInfoJSON(sessionID string) (*VideoMetadata, error) {
+	path := infoJSONTemplate(sessionID) + ".info.json"
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata VideoMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+
+	// Description and comments are only needed for detection and are not kept
+	var extra struct {
+		Description string        `json:"description"`
+		Comments    []infoComment `json:"comments"`
+	}
+	json.Unmarshal(data, &extra)
+	metadata.Language = detectMetadataLanguage(&metadata, extra.Description)
+	if len(metadata.Chapters) > 0 {
+		metadata.ChapterSource = ChapterSourceYouTube
+	} else {
+		metadata.Chapters, metadata.ChapterSource = inferChapters(extra.Description, extra.Comments, metadata.Duration)
+	}
+	return &metadata, nil
+}
+
+// jobVideoID returns the video ID of a job once its metadata is known
+func jobVideoID(sessionID string) string {
+	job, ok := getJob(sessionID)
+	if !ok || job.Metadata == nil {
+		return ""
+	}
+	return job.Metadata.ID
+}
+
+// jobArtistTitle prefers cleaned up tags over the raw video metadata
+func jobArtistTitle(job Job) (string, string) {
+	if job.AudioTags != nil {
+		return job.AudioTags.Artist, job.AudioTags.Title
+	}
+	return metadataArtistTitle(job.Metadata)
+}
+
+// metadataArtistTitle returns the best known artist and title for tagging and lookups
+func metadataArtistTitle(metadata *VideoMetadata) (string, string) {
+	if metadata == nil {
+		return "", ""
+	}
+	if metadata.Artist != "" && metadata.Track != "" {
+		return metadata.Artist, metadata.Track
+	}
+
+	artist := metadata.Channel
+	if artist == "" {
+		artist = metadata.Uploader
+	}
+	// Auto-generated music channels are named "Artist - Topic"
+	artist = strings.TrimSuffix(artist, " - Topic")
+	return artist, metadata.Title
+}
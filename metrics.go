@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// GET /metrics exposes counters for Prometheus, so Grafana can alert on failure rates
+// and a growing queue instead of relying on the Slack messages alone. Downloads are
+// counted from the lifecycle events per format; local conversions are not counted,
+// like in /stats. With METRICS_TOKEN set, scrapers must send it as bearer token.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+	metricsHandler  = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+	downloadsStarted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ytdl_downloads_started_total",
+		Help: "Downloads that started running, by format.",
+	}, []string{"format"})
+	downloadsSucceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ytdl_downloads_succeeded_total",
+		Help: "Downloads that completed, by format.",
+	}, []string{"format"})
+	downloadsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ytdl_downloads_failed_total",
+		Help: "Downloads that failed, by format and error code. Cancelled downloads are not counted.",
+	}, []string{"format", "code"})
+	downloadsCancelled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ytdl_downloads_cancelled_total",
+		Help: "Downloads cancelled by the user, by format.",
+	}, []string{"format"})
+	ytdlpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ytdl_ytdlp_run_duration_seconds",
+		Help:    "Run time of the yt-dlp process, by result (success, error, cancelled).",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"result"})
+	servedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ytdl_served_bytes_total",
+		Help: "Bytes of finished downloads sent via /download-file, including partial transfers.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		downloadsStarted, downloadsSucceeded, downloadsFailed, downloadsCancelled,
+		ytdlpDuration, servedBytes,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ytdl_sse_clients",
+			Help: "Connected progress clients, EventSource and WebSocket subscriptions.",
+		}, func() float64 { return float64(progressClientCount()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ytdl_queue_depth",
+			Help: "Jobs waiting for a free download slot.",
+		}, func() float64 {
+			waiting, _ := queueLength()
+			return float64(waiting)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ytdl_jobs_running",
+			Help: "Jobs currently downloading.",
+		}, func() float64 {
+			_, running := queueLength()
+			return float64(running)
+		}),
+	)
+}
+
+func metricsToken() string { return secret("METRICS_TOKEN") }
+
+// recordMetricsEvent counts started and finished yt-dlp jobs per format
+func recordMetricsEvent(event LifecycleEvent) {
+	if event.Job.Binary == "" {
+		return
+	}
+	format := event.Job.Format
+	switch {
+	case event.Type == EventJobStarted:
+		downloadsStarted.WithLabelValues(format).Inc()
+	case event.Job.Status == JobStatusCompleted:
+		downloadsSucceeded.WithLabelValues(format).Inc()
+	case event.Job.ErrorCode == errJobCancelled.Code:
+		downloadsCancelled.WithLabelValues(format).Inc()
+	default:
+		code := event.Job.ErrorCode
+		if code == "" {
+			code = "unknown"
+		}
+		downloadsFailed.WithLabelValues(format, code).Inc()
+	}
+}
+
+// observeYtDlpRun records how long a yt-dlp process ran
+func observeYtDlpRun(sessionID string, started time.Time, err error) {
+	result := "success"
+	switch {
+	case err != nil && isCancelled(sessionID):
+		result = "cancelled"
+	case err != nil:
+		result = "error"
+	}
+	ytdlpDuration.WithLabelValues(result).Observe(time.Since(started).Seconds())
+}
+
+// handleMetrics serves the metrics in the Prometheus text format: GET /metrics
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := metricsToken(); token != "" {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			adminLog.Warn("Rejected metrics scrape: missing or wrong token", "ip", remoteIP(r))
+			http.Error(w, "Nicht autorisiert", http.StatusUnauthorized)
+			return
+		}
+	}
+	metricsHandler.ServeHTTP(w, r)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// MeTube compatibility mode (METUBE_COMPAT=true) implements MeTube's REST shape
+// (POST /add, POST /delete, GET /history, GET /download/<file>) so existing
+// automations and iOS shortcuts keep working. MeTube's socket.io events are not
+// provided; clients poll /history instead, which answers in MeTube's shape when
+// called without search parameters. MeTube clients have no session tokens, so they
+// only see and delete the jobs started via /add.
+var metubeCompat = strings.EqualFold(getenv("METUBE_COMPAT"), "true")
+
+// metubeRequester marks the jobs started via /add
+const metubeRequester = "metube"
+
+// metubeAddRequest is MeTube's /add body; unknown fields from newer clients are ignored
+type metubeAddRequest struct {
+	URL              string `json:"url"`
+	Quality          string `json:"quality"`
+	Format           string `json:"format"`
+	Folder           string `json:"folder"`
+	CustomNamePrefix string `json:"custom_name_prefix"`
+}
+
+type metubeDeleteRequest struct {
+	IDs   []string `json:"ids"`
+	Where string   `json:"where"` // "queue" or "done"
+}
+
+// metubeDownload mirrors MeTube's DownloadInfo
+type metubeDownload struct {
+	ID               string  `json:"id"`
+	Title            string  `json:"title"`
+	URL              string  `json:"url"`
+	Quality          string  `json:"quality"`
+	Format           string  `json:"format"`
+	Folder           string  `json:"folder"`
+	CustomNamePrefix string  `json:"custom_name_prefix"`
+	Status           string  `json:"status"` // pending, downloading, finished, error
+	Msg              string  `json:"msg,omitempty"`
+	Percent          float64 `json:"percent"`
+	Speed            *int64  `json:"speed"`
+	ETA              *int64  `json:"eta"`
+	Filename         string  `json:"filename,omitempty"`
+	Error            string  `json:"error,omitempty"`
+	Timestamp        int64   `json:"timestamp"` // Nanoseconds
+}
+
+// registerMeTubeRoutes installs the MeTube compatible endpoints if enabled; /add goes
+// through the same checks as /download
+func registerMeTubeRoutes(protected, startsJobs *Router) {
+	if !metubeCompat {
+		return
+	}
+	startsJobs.HandleFunc("POST /add", handleMeTubeAdd)
+	protected.HandleFunc("POST /delete", handleMeTubeDelete)
+	protected.HandleFunc("GET /download/*", handleMeTubeFile)
+}
+
+// metubeFormat maps MeTube's format/quality selection to a supported output format
+func metubeFormat(format, quality string) string {
+	switch strings.ToLower(format) {
+	case "mp3", "m4a", "wav", "flac", "opus", "ogg", "webm", "mkv":
+		return strings.ToLower(format)
+	}
+	if quality == "audio" {
+		return "mp3"
+	}
+	return "mp4"
+}
+
+// metubeQuality maps MeTube's resolutions ("1080", "720", ...) to a quality for mp4
+func metubeQuality(format, quality string) string {
+	if format != "mp4" {
+		return ""
+	}
+	if _, ok := videoQualityHeights[quality+"p"]; ok {
+		return quality + "p"
+	}
+	return ""
+}
+
+func handleMeTubeAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body metubeAddRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"status": "error", "msg": "Ungültige Anfrage"})
+		return
+	}
+
+	req := DownloadRequest{URL: body.URL, Format: metubeFormat(body.Format, body.Quality)}
+	req.Quality = metubeQuality(req.Format, body.Quality)
+	cleanedURL, msg := validateDownloadRequest(req)
+	if msg != "" {
+		writeJSONStatus(w, http.StatusOK, map[string]string{"status": "error", "msg": msg})
+		return
+	}
+
+	startJob(cleanedURL, req, metubeRequester, nil)
+	writeJSONStatus(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleMeTubeDelete removes finished jobs started via /add by session ID or URL
+func handleMeTubeDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body metubeDeleteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"status": "error", "msg": "Ungültige Anfrage"})
+		return
+	}
+
+	ids := make(map[string]bool, len(body.IDs))
+	for _, id := range body.IDs {
+		ids[id] = true
+	}
+	for _, job := range listJobs() {
+		if job.Requester == metubeRequester && (ids[job.SessionID] || ids[job.URL]) {
+			if job.isActive() {
+				cancelJob(job.SessionID)
+			} else {
+				deleteJob(job.SessionID)
+			}
+		}
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func handleMeTubeHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history := map[string][]metubeDownload{
+		"done":    {},
+		"queue":   {},
+		"pending": {},
+	}
+	for _, job := range listJobs() {
+		if job.Requester != metubeRequester {
+			continue
+		}
+		if job.isActive() {
+			history["queue"] = append(history["queue"], toMeTubeDownload(job))
+		} else {
+			history["done"] = append(history["done"], toMeTubeDownload(job))
+		}
+	}
+	writeJSONStatus(w, http.StatusOK, history)
+}
+
+// handleMeTubeFile serves finished files like MeTube's /download/<file>
+func handleMeTubeFile(w http.ResponseWriter, r *http.Request) {
+	r.URL.Path = "/download-file/" + strings.TrimPrefix(r.URL.Path, "/download/")
+	handleDownloadFile(w, r)
+}
+
+func toMeTubeDownload(job Job) metubeDownload {
+	download := metubeDownload{
+		ID:        job.SessionID,
+		Title:     job.URL,
+		URL:       job.URL,
+		Quality:   "best",
+		Format:    job.Format,
+		Status:    "downloading",
+		Percent:   float64(job.Progress),
+		Timestamp: job.CreatedAt.UnixNano(),
+	}
+	if job.Metadata != nil && job.Metadata.Title != "" {
+		download.Title = job.Metadata.Title
+	}
+	if job.Progress == 0 {
+		download.Status = "pending"
+	}
+
+	switch job.Status {
+	case JobStatusCompleted:
+		download.Status = "finished"
+		download.Filename = job.Filename
+	case JobStatusFailed:
+		download.Status = "error"
+		download.Msg = job.Error
+		download.Error = job.Error
+	}
+	return download
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// defaultCSP allows only same-origin resources; inline styles are needed by the React UI
+// and googlevideo media is needed for direct stream playback
+const defaultCSP = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: https:; media-src 'self' blob: https://*.googlevideo.com; connect-src 'self'; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'"
+
+var (
+	contentSecurityPolicy = getenv("CONTENT_SECURITY_POLICY") // Replaces defaultCSP entirely if set
+	frameAncestors        = getenv("FRAME_ANCESTORS")         // e.g. "'self' https://intranet.example.com"
+	accessLog             = getenv("ACCESS_LOG") == "true"
+	corsOrigins           = parseCORSOrigins(getenv("CORS_ORIGINS")) // Comma-separated, or "*"
+	httpLog               = componentLogger("http")
+)
+
+// ErrorResponse is the JSON body returned for unexpected server errors
+type ErrorResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+// responseRecorder remembers whether the handler already started writing a response
+type responseRecorder struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush keeps SSE streaming working through the wrapper
+func (rw *responseRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through the wrapper
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.wroteHeader = true
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// ReadFrom keeps sendfile working for file downloads through the wrapper
+func (rw *responseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rw.wroteHeader = true
+	return io.Copy(rw.ResponseWriter, src)
+}
+
+// recoverMiddleware turns handler panics into a logged, reported JSON 500 response
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseRecorder{ResponseWriter: w}
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// http.ErrAbortHandler is used deliberately to abort a response
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			reportPanic(rec, debug.Stack(), map[string]string{
+				"handler": r.URL.Path,
+				"method":  r.Method,
+			})
+
+			// Too late for a JSON body if the handler already sent headers
+			if rw.wroteHeader {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Success: false,
+				Message: "Interner Serverfehler. Bitte versuche es erneut.",
+				Error:   "internal_error",
+			})
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// reportPanic logs a recovered panic with its stack and reports it to Slack and Sentry
+func reportPanic(rec interface{}, stack []byte, context map[string]string) {
+	crashLog.Error("Recovered panic", "panic", rec, "context", context, "stack", string(stack))
+
+	captureSentryPanic(rec, context)
+
+	if slackWebhookURL() == "" {
+		return
+	}
+
+	go func() {
+		report := ErrorReport{
+			ErrorMessage: fmt.Sprintf("panic: %v", rec),
+			ErrorStack:   string(stack),
+			URL:          "Backend Panic",
+			UserAgent:    "Go Backend",
+			Timestamp:    time.Now().Format(time.RFC3339),
+			SessionID:    "backend-" + time.Now().Format("20060102-150405"),
+			LastActions:  []string{},
+			BrowserInfo:  context,
+		}
+
+		if err := sendSlackNotification(report); err != nil {
+			crashLog.Error("Slack notification failed", "error", err)
+		}
+	}()
+}
+
+// buildCSP returns the Content-Security-Policy header value from the configuration
+func buildCSP() string {
+	if contentSecurityPolicy != "" {
+		return contentSecurityPolicy
+	}
+
+	ancestors := frameAncestors
+	if ancestors == "" {
+		ancestors = "'self'"
+	}
+	return defaultCSP + "; frame-ancestors " + ancestors
+}
+
+// securityHeadersMiddleware sets security headers for the static UI and all API responses
+func securityHeadersMiddleware(next http.Handler) http.Handler {
+	csp := buildCSP()
+	allowFraming := contentSecurityPolicy != "" || frameAncestors != ""
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", csp)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		// Legacy header for old browsers; only set when the operator didn't allow embedding
+		if !allowFraming {
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder remembers the response status for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *statusRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *statusRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush keeps SSE streaming working through the wrapper
+func (rw *statusRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through the wrapper
+func (rw *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// ReadFrom keeps sendfile working for file downloads through the wrapper
+func (rw *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return io.Copy(rw.ResponseWriter, src)
+}
+
+// accessLogMiddleware logs method, path, status and duration of every request if ACCESS_LOG=true
+func accessLogMiddleware(next http.Handler) http.Handler {
+	if !accessLog {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		httpLog.Info("Request", "method", r.Method, "path", r.URL.Path, "status", rw.status,
+			"duration", time.Since(start).Round(time.Millisecond).String(), "ip", remoteIP(r))
+	})
+}
+
+func parseCORSOrigins(value string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			origins[origin] = true
+		}
+	}
+	return origins
+}
+
+// corsMiddleware allows the API to be called from the origins in CORS_ORIGINS and
+// answers their preflight requests. Without CORS_ORIGINS only same-origin calls work.
+func corsMiddleware(next http.Handler) http.Handler {
+	if len(corsOrigins) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!corsOrigins["*"] && !corsOrigins[origin]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Session-Token, X-API-Key, X-Terms-Token")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
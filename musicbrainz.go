@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// AcoustID fingerprint lookups resolve to MusicBrainz recordings.
+// An API key is free at https://acoustid.org/new-application
+var (
+	acoustIDMinScore = 0.8 // Ignore matches below this confidence
+	acoustIDClient   = &http.Client{Timeout: 15 * time.Second}
+)
+
+// AudioTags are the cleaned up artist/title/album tags written to an audio file
+type AudioTags struct {
+	Artist        string `json:"artist"`
+	Title         string `json:"title"`
+	Album         string `json:"album,omitempty"`
+	MusicBrainzID string `json:"musicbrainzId,omitempty"` // Recording MBID
+	Source        string `json:"source"`                  // Where the tags came from, e.g. "musicbrainz"
+}
+
+type fpcalcResult struct {
+	Duration    float64 `json:"duration"`
+	Fingerprint string  `json:"fingerprint"`
+}
+
+type acoustIDResponse struct {
+	Status  string `json:"status"`
+	Results []struct {
+		Score      float64 `json:"score"`
+		Recordings []struct {
+			ID      string `json:"id"`
+			Title   string `json:"title"`
+			Artists []struct {
+				Name       string `json:"name"`
+				JoinPhrase string `json:"joinphrase"`
+			} `json:"artists"`
+			ReleaseGroups []struct {
+				Title string `json:"title"`
+				Type  string `json:"type"`
+			} `json:"releasegroups"`
+		} `json:"recordings"`
+	} `json:"results"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// fingerprintAudio runs fpcalc (Chromaprint) on the file
+func fingerprintAudio(mediaPath string) (*fpcalcResult, error) {
+	output, err := exec.Command("fpcalc", "-json", mediaPath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("fpcalc failed: %v", err)
+	}
+
+	var result fpcalcResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse fpcalc output: %v", err)
+	}
+	return &result, nil
+}
+
+// lookupMusicBrainzTags identifies the recording via AcoustID and returns its MusicBrainz tags.
+// It returns nil without error when no confident match exists.
+func lookupMusicBrainzTags(mediaPath string) (*AudioTags, error) {
+	if acoustIDAPIKey() == "" {
+		return nil, fmt.Errorf("ACOUSTID_API_KEY not configured")
+	}
+
+	fp, err := fingerprintAudio(mediaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("client", acoustIDAPIKey())
+	params.Set("meta", "recordings releasegroups")
+	params.Set("duration", fmt.Sprintf("%.0f", fp.Duration))
+	params.Set("fingerprint", fp.Fingerprint)
+
+	// POST keeps the long fingerprint out of the URL
+	resp, err := acoustIDClient.PostForm("https://api.acoustid.org/v2/lookup", params)
+	if err != nil {
+		return nil, fmt.Errorf("AcoustID request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var lookup acoustIDResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lookup); err != nil {
+		return nil, fmt.Errorf("failed to parse AcoustID response: %v", err)
+	}
+	if lookup.Status != "ok" {
+		if lookup.Error != nil {
+			return nil, fmt.Errorf("AcoustID error: %s", lookup.Error.Message)
+		}
+		return nil, fmt.Errorf("AcoustID returned status %q", lookup.Status)
+	}
+
+	for _, result := range lookup.Results {
+		if result.Score < acoustIDMinScore {
+			continue
+		}
+		for _, recording := range result.Recordings {
+			if recording.Title == "" || len(recording.Artists) == 0 {
+				continue
+			}
+
+			var artist strings.Builder
+			for _, a := range recording.Artists {
+				artist.WriteString(a.Name + a.JoinPhrase)
+			}
+
+			tags := &AudioTags{
+				Artist:        artist.String(),
+				Title:         recording.Title,
+				MusicBrainzID: recording.ID,
+				Source:        "musicbrainz",
+			}
+			// Prefer the album over singles/compilations
+			for _, group := range recording.ReleaseGroups {
+				if tags.Album == "" || group.Type == "Album" {
+					tags.Album = group.Title
+				}
+			}
+			return tags, nil
+		}
+	}
+	return nil, nil
+}
+
+// writeAudioTags rewrites artist/title/album tags of an audio file in place
+func writeAudioTags(mediaPath string, tags *AudioTags) error {
+	metadata := map[string]string{
+		"artist": tags.Artist,
+		"title":  tags.Title,
+	}
+	if tags.Album != "" {
+		metadata["album"] = tags.Album
+	}
+	if tags.MusicBrainzID != "" {
+		metadata["MusicBrainz Track Id"] = tags.MusicBrainzID
+	}
+	return rewriteMetadata(mediaPath, metadata)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// NOTIFY_WEBHOOK_URL receives one notification per job once its file and the steps
+// before the notify step are done, e.g. with the transfer links. Unlike the job events
+// it is the notify step of the job, so a failed delivery shows up there and can be
+// retried.
+var (
+	notifyClient = &http.Client{Timeout: 10 * time.Second}
+	notifyLog    = componentLogger("notify")
+)
+
+func notifyWebhookURL() string { return secret("NOTIFY_WEBHOOK_URL") }
+
+// JobNotification is the payload of the notify step
+type JobNotification struct {
+	SessionID    string    `json:"sessionId"`
+	URL          string    `json:"url"`
+	Format       string    `json:"format"`
+	Title        string    `json:"title,omitempty"`
+	Filename     string    `json:"filename"`
+	Parts        []string  `json:"parts,omitempty"`
+	TransferURLs []string  `json:"transferUrls,omitempty"`
+	Transcript   bool      `json:"transcript"`
+	Summary      string    `json:"summary,omitempty"`
+	Steps        []JobStep `json:"steps"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// notifyJob is the notify step: it posts the job to NOTIFY_WEBHOOK_URL
+func notifyJob(sessionID, filename string) error {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+	payload := JobNotification{
+		SessionID:    sessionID,
+		URL:          job.URL,
+		Format:       job.Format,
+		Filename:     filename,
+		Parts:        job.Parts,
+		TransferURLs: job.TransferURLs,
+		Transcript:   job.Transcript,
+		Summary:      job.Summary,
+		Steps:        job.Steps,
+		Timestamp:    time.Now(),
+	}
+	if job.Metadata != nil {
+		payload.Title = job.Metadata.Title
+	}
+
+	sendProgress(sessionID, 99, "Benachrichtigung wird gesendet...")
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(notifyWebhookURL(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		notifyLog.Error("Failed to send notification", "session", sessionID, "error", err)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		notifyLog.Error("Webhook rejected notification", "session", sessionID, "status", resp.StatusCode)
+		return fmt.Errorf("notify webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NOTIFICATION_TEMPLATES names a YAML file with Go templates (text/template) that
+// replace the built-in notification texts, per notifier and event:
+//
+//	slack:
+//	  startup: "🟢 {{.Hostname}} läuft wieder, yt-dlp {{.YtDlpVersion}}"
+//	  error: "Fehler in {{.Session}}: {{.Message}}"
+//	matrix:
+//	  job.finished: "{{with .Job.Metadata}}{{.Title}}{{end}} für {{.User}}: {{.Link}}"
+//
+// A Slack template replaces the whole formatted message with its text. Events without
+// a template, and templates that fail to render, keep the built-in text.
+const (
+	NotifierSlack   = "slack"
+	NotifierMatrix  = "matrix"
+	NotifierDiscord = "discord"
+)
+
+// Notification events
+const (
+	NotifyStartup        = "startup"
+	NotifyError          = "error"
+	NotifyCrash          = "crash"
+	NotifyCookiesExpired = "cookies.expired"
+	NotifyJobFinished    = "job.finished"
+)
+
+// notificationEvents are the events each notifier sends
+var notificationEvents = map[string][]string{
+	NotifierSlack:   {NotifyStartup, NotifyError, NotifyCrash, NotifyCookiesExpired},
+	NotifierMatrix:  {NotifyStartup, NotifyError, NotifyCrash, NotifyCookiesExpired, NotifyJobFinished},
+	NotifierDiscord: {NotifyJobFinished},
+}
+
+var notificationTemplates = loadNotificationTemplates(getenv("NOTIFICATION_TEMPLATES"))
+
+// NotificationData is what the templates see; which fields are set depends on the event
+type NotificationData struct {
+	Event        string
+	Time         time.Time
+	Hostname     string
+	YtDlpVersion string            // startup
+	Downloads    string            // startup: size and number of the downloads
+	Message      string            // error and crash: what went wrong
+	Session      string            // error and job.finished
+	Fields       map[string]string // error: context such as code, format and url
+	User         string            // cookies.expired, job.finished: the requester
+	Reason       string            // cookies.expired
+	Job          *Job              // job.finished
+	Link         string            // job.finished: download link, empty without PUBLIC_BASE_URL
+}
+
+var notificationFuncs = template.FuncMap{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"truncate": func(maxLen int, s string) string { return truncateString(s, maxLen) },
+	"join":     strings.Join,
+}
+
+func newNotificationData(event string) NotificationData {
+	hostname, _ := os.Hostname()
+	return NotificationData{Event: event, Time: time.Now(), Hostname: hostname}
+}
+
+// startupNotificationData describes the started server
+func startupNotificationData() NotificationData {
+	data := newNotificationData(NotifyStartup)
+	data.YtDlpVersion = getYtDlpVersion()
+	data.Downloads = downloadsUsage()
+	return data
+}
+
+// jobNotificationData describes a finished job for the chat notifiers
+func jobNotificationData(job Job, user string) NotificationData {
+	data := newNotificationData(NotifyJobFinished)
+	data.Job = &job
+	data.Session = job.SessionID
+	data.User = user
+	if publicBaseURL != "" && job.Filename != "" {
+		data.Link = publicBaseURL + "/download-file/" + url.PathEscape(job.Filename)
+	}
+	return data
+}
+
+// loadNotificationTemplates parses the templates, keyed by notifier and event
+func loadNotificationTemplates(path string) map[string]map[string]*template.Template {
+	templates := make(map[string]map[string]*template.Template)
+	if path == "" {
+		return templates
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		configLog.Error("Cannot read NOTIFICATION_TEMPLATES, using the built-in texts", "path", path, "error", err)
+		return templates
+	}
+	var sources map[string]map[string]string
+	if err := yaml.Unmarshal(data, &sources); err != nil {
+		configLog.Error("Invalid NOTIFICATION_TEMPLATES, using the built-in texts", "path", path, "error", err)
+		return templates
+	}
+
+	loaded := 0
+	for notifier, events := range sources {
+		for event, source := range events {
+			if !notifierSendsEvent(notifier, event) {
+				configLog.Warn("Ignoring notification template: unknown notifier or event", "notifier", notifier, "event", event)
+				continue
+			}
+			tmpl, err := template.New(notifier + "." + event).Funcs(notificationFuncs).Parse(source)
+			if err != nil {
+				configLog.Error("Ignoring notification template", "notifier", notifier, "event", event, "error", err)
+				continue
+			}
+			if templates[notifier] == nil {
+				templates[notifier] = make(map[string]*template.Template)
+			}
+			templates[notifier][event] = tmpl
+			loaded++
+		}
+	}
+	configLog.Info("Notification templates loaded", "path", path, "templates", loaded)
+	return templates
+}
+
+func notifierSendsEvent(notifier, event string) bool {
+	for _, known := range notificationEvents[notifier] {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+// renderNotification returns the text of the operator's template, if there is one
+// and it renders
+func renderNotification(notifier string, data NotificationData) (string, bool) {
+	tmpl, ok := notificationTemplates[notifier][data.Event]
+	if !ok {
+		return "", false
+	}
+	var text strings.Builder
+	if err := tmpl.Execute(&text, data); err != nil {
+		configLog.Warn("Notification template failed, using the built-in text", "notifier", notifier, "event", data.Event, "error", err)
+		return "", false
+	}
+	return strings.TrimSpace(text.String()), true
+}
+
+// notificationText returns the templated text for a notifier or the built-in one
+func notificationText(notifier string, data NotificationData, builtin string) string {
+	if text, ok := renderNotification(notifier, data); ok {
+		return text
+	}
+	return builtin
+}
+
+// slackNotification returns the templated Slack message or the built-in one
+func slackNotification(data NotificationData, builtin SlackMessage) SlackMessage {
+	if text, ok := renderNotification(NotifierSlack, data); ok {
+		return SlackMessage{Text: text}
+	}
+	return builtin
+}
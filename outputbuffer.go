@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Limits for captured yt-dlp stderr: the start has the extractor context, the
+// end the ERROR lines that classification and reports look at
+const (
+	stderrHeadBytes = 4 << 10
+	stderrTailBytes = 16 << 10
+)
+
+// outputBuffer keeps the first and the last bytes written to it, so a chatty
+// command can't grow it without bound. Everything in between is only counted.
+type outputBuffer struct {
+	head      []byte
+	tail      []byte // Ring buffer once it reached tailLimit
+	tailPos   int    // Oldest byte of the ring
+	tailFull  bool
+	total     int
+	headLimit int
+	tailLimit int
+}
+
+func newOutputBuffer(headLimit, tailLimit int) *outputBuffer {
+	return &outputBuffer{headLimit: headLimit, tailLimit: tailLimit}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	b.total += n
+
+	if room := b.headLimit - len(b.head); room > 0 {
+		room = min(room, len(p))
+		b.head = append(b.head, p[:room]...)
+		p = p[room:]
+	}
+	if b.tailLimit <= 0 {
+		return n, nil
+	}
+	for len(p) > 0 {
+		if !b.tailFull {
+			room := min(b.tailLimit-len(b.tail), len(p))
+			b.tail = append(b.tail, p[:room]...)
+			p = p[room:]
+			b.tailFull = len(b.tail) == b.tailLimit
+			continue
+		}
+		written := copy(b.tail[b.tailPos:], p)
+		b.tailPos = (b.tailPos + written) % b.tailLimit
+		p = p[written:]
+	}
+	return n, nil
+}
+
+// WriteString appends a line of output, see Write
+func (b *outputBuffer) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+// String returns the kept output with a marker where bytes were dropped
+func (b *outputBuffer) String() string {
+	return b.Excerpt(b.headLimit, b.tailLimit)
+}
+
+// Excerpt returns at most headBytes from the start and tailBytes from the end of
+// the output. The tail starts at a line boundary when bytes were dropped before it.
+func (b *outputBuffer) Excerpt(headBytes, tailBytes int) string {
+	tail := b.tail
+	if b.tailFull {
+		tail = append(append([]byte(nil), b.tail[b.tailPos:]...), b.tail[:b.tailPos]...)
+	}
+
+	var start, end []byte
+	if len(b.head)+len(tail) == b.total {
+		// Nothing dropped yet, head and tail are contiguous
+		full := append(append([]byte(nil), b.head...), tail...)
+		if len(full) <= headBytes+tailBytes {
+			return string(full)
+		}
+		start, end = full[:headBytes], full[len(full)-tailBytes:]
+	} else {
+		start = b.head[:min(headBytes, len(b.head))]
+		end = tail[len(tail)-min(tailBytes, len(tail)):]
+	}
+
+	omitted := b.total - len(start) - len(end)
+	if i := bytes.IndexByte(end, '\n'); i >= 0 && i < len(end)-1 {
+		omitted += i + 1
+		end = end[i+1:]
+	}
+	marker := fmt.Sprintf("[... %d bytes omitted ...]\n", omitted)
+	if len(start) > 0 && start[len(start)-1] != '\n' {
+		marker = "\n" + marker
+	}
+	return string(start) + marker + string(end)
+}
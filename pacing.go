@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Archives that fetch hundreds of videos a day stand out less when yt-dlp paces its
+// requests. YTDLP_SLEEP_REQUESTS pauses between the requests of an extraction,
+// YTDLP_SLEEP_INTERVAL before each download, and with YTDLP_MAX_SLEEP_INTERVAL the
+// pause is picked at random up to that. All values are seconds, 0 means no pause.
+// The pacing applies to every download; while YouTube throttles the server, the
+// longer pauses of the mitigation win. Each job logs the pacing it ran with.
+var globalPacing = loadRequestPacing()
+
+// throttlePacing slows a throttled server down to a few requests per minute
+var throttlePacing = requestPacing{requests: 1, interval: 5, maxInterval: 15}
+
+// requestPacing are yt-dlp's sleep options, in seconds
+type requestPacing struct {
+	requests    float64 // --sleep-requests
+	interval    float64 // --sleep-interval
+	maxInterval float64 // --max-sleep-interval, 0 = always interval
+}
+
+func loadRequestPacing() requestPacing {
+	pacing := requestPacing{
+		requests:    parsePacingSeconds("YTDLP_SLEEP_REQUESTS"),
+		interval:    parsePacingSeconds("YTDLP_SLEEP_INTERVAL"),
+		maxInterval: parsePacingSeconds("YTDLP_MAX_SLEEP_INTERVAL"),
+	}
+	if pacing.maxInterval > 0 && pacing.maxInterval < pacing.interval {
+		configLog.Warn("YTDLP_MAX_SLEEP_INTERVAL is below YTDLP_SLEEP_INTERVAL, ignoring it")
+		pacing.maxInterval = 0
+	}
+	if pacing.maxInterval > 0 && pacing.interval == 0 {
+		// yt-dlp only accepts a maximum together with a minimum
+		configLog.Warn("YTDLP_MAX_SLEEP_INTERVAL needs YTDLP_SLEEP_INTERVAL, ignoring it")
+		pacing.maxInterval = 0
+	}
+	return pacing
+}
+
+func parsePacingSeconds(key string) float64 {
+	value := strings.TrimSpace(getenv(key))
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		configLog.Warn("Invalid pause, using none", "key", key, "value", value)
+		return 0
+	}
+	return seconds
+}
+
+func (p requestPacing) isZero() bool {
+	return p == requestPacing{}
+}
+
+// merge returns the longer pause of both for each option
+func (p requestPacing) merge(other requestPacing) requestPacing {
+	merged := requestPacing{
+		requests:    math.Max(p.requests, other.requests),
+		interval:    math.Max(p.interval, other.interval),
+		maxInterval: math.Max(p.maxInterval, other.maxInterval),
+	}
+	if merged.maxInterval > 0 && merged.maxInterval < merged.interval {
+		merged.maxInterval = 0
+	}
+	return merged
+}
+
+// args are the yt-dlp arguments for the pacing
+func (p requestPacing) args() []string {
+	var args []string
+	if p.requests > 0 {
+		args = append(args, "--sleep-requests", formatSeconds(p.requests))
+	}
+	if p.interval > 0 {
+		args = append(args, "--sleep-interval", formatSeconds(p.interval))
+		if p.maxInterval > p.interval {
+			args = append(args, "--max-sleep-interval", formatSeconds(p.maxInterval))
+		}
+	}
+	return args
+}
+
+// describe explains the pacing for the job log
+func (p requestPacing) describe() string {
+	var parts []string
+	if p.requests > 0 {
+		parts = append(parts, formatSeconds(p.requests)+" s zwischen den Anfragen")
+	}
+	switch {
+	case p.maxInterval > p.interval:
+		parts = append(parts, fmt.Sprintf("%s–%s s vor dem Download", formatSeconds(p.interval), formatSeconds(p.maxInterval)))
+	case p.interval > 0:
+		parts = append(parts, formatSeconds(p.interval)+" s vor dem Download")
+	}
+	return "Pausen: " + strings.Join(parts, ", ")
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+func logPacingConfig() {
+	if globalPacing.isZero() {
+		return
+	}
+	serverLog.Info("yt-dlp downloads are paced", "args", strings.Join(globalPacing.args(), " "))
+}
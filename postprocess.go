@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Silence detection settings for trimSilence
+const (
+	silenceThreshold   = "-50dB"
+	silenceMinDuration = 1.0 // Seconds of silence before it is trimmed
+)
+
+var (
+	silenceStartPattern = regexp.MustCompile(`silence_start: (-?[\d.]+)`)
+	silenceEndPattern   = regexp.MustCompile(`silence_end: ([\d.]+)`)
+	durationPattern     = regexp.MustCompile(`Duration: (\d+):(\d+):([\d.]+)`)
+)
+
+var postProcessLog = componentLogger("postprocess")
+
+// audioEncoderArgs re-encodes audio in the original output format after filtering
+var audioEncoderArgs = map[string][]string{
+	".mp3":  {"-c:a", "libmp3lame", "-q:a", "0"},
+	".m4a":  {"-c:a", "aac", "-b:a", "256k"},
+	".wav":  {"-c:a", "pcm_s16le"},
+	".flac": {"-c:a", "flac"},
+	".opus": {"-c:a", "libopus", "-b:a", "160k"},
+	".ogg":  {"-c:a", "libvorbis", "-q:a", "6"},
+}
+
+// postProcess runs the optional processing of a finished download up to the library
+// exports; transcription, splitting and the waveform are steps of their own.
+// Failures are logged but never fail the download itself.
+func postProcess(sessionID string, req DownloadRequest, filename string) string {
+	mediaPath := filepath.Join(downloadsDir, filename)
+	dir := filepath.Dir(filename) // Collection folder or "."
+	plog := jobLogger(postProcessLog, sessionID, "postprocess")
+
+	if req.SmartTitle {
+		job, _ := getJob(sessionID)
+		if tags, ok := smartTitleTags(job.Metadata); ok {
+			if err := writeAudioTags(mediaPath, tags); err != nil {
+				plog.Warn("Writing parsed tags failed", "error", err)
+			}
+			updateJob(sessionID, func(job *Job) { job.AudioTags = tags })
+
+			newName := cleanFilename(tags, filepath.Ext(filename))
+			placed, err := placeFile(mediaPath, filepath.Dir(mediaPath), newName, jobVideoID(sessionID))
+			if err != nil {
+				plog.Warn("Could not rename, keeping the name", "file", filename, "name", newName, "error", err)
+			} else {
+				plog.Info("Renamed", "file", filename, "name", placed)
+				filename = filepath.ToSlash(filepath.Join(dir, placed))
+				mediaPath = filepath.Join(downloadsDir, filename)
+			}
+		}
+	}
+
+	trimmed := false
+	if req.TrimSilence && isAudioFormat(req.Format) {
+		sendProgress(sessionID, 93, "Stille wird entfernt...")
+		if err := trimSilence(mediaPath, req.AudioPreset); err != nil {
+			plog.Warn("Silence trimming failed", "error", err)
+		} else {
+			trimmed = true
+		}
+	}
+
+	if req.MusicBrainz && isAudioFormat(req.Format) {
+		sendProgress(sessionID, 94, "Titel wird erkannt...")
+		tags, err := lookupMusicBrainzTags(mediaPath)
+		if err != nil {
+			plog.Warn("MusicBrainz lookup failed", "error", err)
+		} else if tags == nil {
+			plog.Info("No confident MusicBrainz match")
+		} else if err := writeAudioTags(mediaPath, tags); err != nil {
+			plog.Warn("Writing tags failed", "error", err)
+		} else {
+			plog.Info("Tagged", "artist", tags.Artist, "title", tags.Title)
+			updateJob(sessionID, func(job *Job) { job.AudioTags = tags })
+		}
+	}
+
+	if req.Lyrics && isAudioFormat(req.Format) {
+		sendProgress(sessionID, 95, "Lyrics werden gesucht...")
+		job, _ := getJob(sessionID)
+		found, err := addLyrics(mediaPath, job)
+		if err != nil {
+			plog.Warn("Lyrics failed", "error", err)
+		}
+		if found {
+			lrcFile := filepath.ToSlash(filepath.Join(dir, filepath.Base(lyricsPath(mediaPath))))
+			updateJob(sessionID, func(job *Job) {
+				job.Lyrics = true
+				job.LyricsFile = lrcFile
+			})
+		}
+	}
+
+	// After fingerprinting and lyrics lookup, which need the original speed
+	tempo := 1.0
+	if req.Tempo != 0 && req.Tempo != 1 && isAudioFormat(req.Format) {
+		sendProgress(sessionID, 95, "Tempo wird angepasst...")
+		if err := changeTempo(mediaPath, req.Tempo, req.AudioPreset); err != nil {
+			plog.Warn("Changing tempo failed", "error", err)
+		} else {
+			tempo = req.Tempo
+			updateJob(sessionID, func(job *Job) {
+				if job.Metadata != nil {
+					metadata := *job.Metadata
+					metadata.Duration /= req.Tempo
+					metadata.Chapters = scaleChapters(metadata.Chapters, req.Tempo)
+					job.Metadata = &metadata
+				}
+			})
+		}
+	}
+
+	// Chapters are those of the whole video. They are moved into a downloaded section;
+	// after silence trimming nobody knows where they are, so they are left out.
+	var chapters []Chapter
+	if job, _ := getJob(sessionID); job.Metadata != nil && !trimmed {
+		chapters = job.Metadata.Chapters
+		if job.Section != nil {
+			chapters = sectionChapters(chapters, *job.Section, tempo)
+		}
+	}
+
+	// Players show embedded chapters as a list; chapter splits don't need them
+	if len(chapters) > 1 && !req.SplitChapters && chapterContainers[strings.ToLower(filepath.Ext(mediaPath))] {
+		sendProgress(sessionID, 95, "Kapitel werden eingebettet...")
+		if err := embedChapters(mediaPath, chapters); err != nil {
+			plog.Warn("Embedding chapters failed", "error", err)
+		}
+	}
+
+	// Import the complete file before it is split into parts
+	if libraryImportEnabled() && isAudioFormat(req.Format) {
+		sendProgress(sessionID, 96, "Wird in die Musikbibliothek importiert...")
+		importToLibrary(sessionID, mediaPath)
+	}
+	if mediaLibraryEnabled() && !isAudioFormat(req.Format) {
+		sendProgress(sessionID, 96, "Wird in die Mediathek kopiert...")
+		exportToMediaLibrary(sessionID, mediaPath)
+	}
+
+	// The split step cuts the file at these chapters
+	updateJob(sessionID, func(job *Job) { job.Chapters = chapters })
+
+	return filename
+}
+
+// rewriteMetadata sets container metadata tags without re-encoding the media
+func rewriteMetadata(mediaPath string, metadata map[string]string) error {
+	ext := filepath.Ext(mediaPath)
+	tmpPath := strings.TrimSuffix(mediaPath, ext) + ".tags" + ext
+
+	args := []string{"-v", "error", "-y", "-i", mediaPath, "-map", "0", "-c", "copy"}
+	for key, value := range metadata {
+		args = append(args, "-metadata", key+"="+value)
+	}
+	args = append(args, tmpPath)
+
+	if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, truncateString(string(output), 500))
+	}
+	if err := syncFile(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, mediaPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// detectSilence runs ffmpeg silencedetect and returns the audio range without
+// leading/trailing silence plus the total duration
+func detectSilence(mediaPath string) (float64, float64, float64, error) {
+	cmd := exec.Command("ffmpeg",
+		"-hide_banner",
+		"-i", mediaPath,
+		"-af", fmt.Sprintf("silencedetect=noise=%s:d=%.1f", silenceThreshold, silenceMinDuration),
+		"-f", "null",
+		"-")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("silencedetect failed: %v", err)
+	}
+	out := string(output)
+
+	match := durationPattern.FindStringSubmatch(out)
+	if match == nil {
+		return 0, 0, 0, fmt.Errorf("could not determine duration")
+	}
+	hours, _ := strconv.ParseFloat(match[1], 64)
+	minutes, _ := strconv.ParseFloat(match[2], 64)
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	duration := hours*3600 + minutes*60 + seconds
+
+	starts := silenceStartPattern.FindAllStringSubmatch(out, -1)
+	ends := silenceEndPattern.FindAllStringSubmatch(out, -1)
+
+	start, end := 0.0, duration
+
+	// Leading silence: the first silence starts at the very beginning
+	if len(starts) > 0 && len(ends) > 0 {
+		if first, _ := strconv.ParseFloat(starts[0][1], 64); first <= 0.05 {
+			start, _ = strconv.ParseFloat(ends[0][1], 64)
+		}
+	}
+
+	// Trailing silence: the last silence never ends, or ends at the end of the file
+	if len(starts) > 0 {
+		last, _ := strconv.ParseFloat(starts[len(starts)-1][1], 64)
+		if len(ends) < len(starts) {
+			end = last
+		} else if lastEnd, _ := strconv.ParseFloat(ends[len(ends)-1][1], 64); duration-lastEnd < 0.1 {
+			end = last
+		}
+	}
+
+	if end <= start {
+		// Everything is silence; keep the file untouched
+		return 0, duration, duration, nil
+	}
+	return start, end, duration, nil
+}
+
+// trimSilence cuts leading and trailing silence from an audio file in place
+func trimSilence(mediaPath, preset string) error {
+	start, end, duration, err := detectSilence(mediaPath)
+	if err != nil {
+		return err
+	}
+	if start == 0 && end >= duration {
+		return nil // Nothing to trim
+	}
+
+	ext := strings.ToLower(filepath.Ext(mediaPath))
+	encoderArgs, ok := audioEncoder(ext, preset)
+	if !ok {
+		return fmt.Errorf("unsupported audio format %s", ext)
+	}
+
+	tmpPath := strings.TrimSuffix(mediaPath, ext) + ".trim" + ext
+	args := []string{"-v", "error", "-y", "-i", mediaPath, "-ss", fmt.Sprintf("%.3f", start), "-to", fmt.Sprintf("%.3f", end)}
+	args = append(args, encoderArgs...)
+	args = append(args, "-map_metadata", "0", tmpPath)
+
+	if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg trim failed: %v: %s", err, truncateString(string(output), 500))
+	}
+
+	if err := syncFile(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, mediaPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	postProcessLog.Info("Trimmed silence", "file", filepath.Base(mediaPath), "start", start, "end", end)
+	return nil
+}
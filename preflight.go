@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"ytdownloader/resolver"
+)
+
+// PreflightResponse contains everything the UI needs to render the download card
+type PreflightResponse struct {
+	Success        bool              `json:"success"`
+	Message        string            `json:"message,omitempty"`
+	Hint           string            `json:"hint,omitempty"`
+	OriginalURL    string            `json:"originalUrl"`
+	ResolvedURL    string            `json:"resolvedUrl"`
+	WasRedirect    bool              `json:"wasRedirect"`
+	WasCanonical   bool              `json:"wasCanonical"`
+	Video          *VideoInfo        `json:"video,omitempty"`
+	HasSABR        bool              `json:"hasSABR"`
+	BestVideoInfo  string            `json:"bestVideoInfo,omitempty"`
+	BestAudioInfo  string            `json:"bestAudioInfo,omitempty"`
+	Warnings       []string          `json:"warnings,omitempty"`
+	SelectedFormat string            `json:"selectedFormat,omitempty"`
+	QualityInfo    map[string]string `json:"qualityInfo,omitempty"`
+}
+
+// VideoInfo is the video metadata shown on the download card
+type VideoInfo struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Channel     string  `json:"channel,omitempty"`
+	Duration    float64 `json:"duration,omitempty"` // Seconds
+	Thumbnail   string  `json:"thumbnail,omitempty"`
+	ViewCount   int64   `json:"viewCount,omitempty"`
+	UploadDate  string  `json:"uploadDate,omitempty"` // YYYYMMDD
+	IsLive      bool    `json:"isLive,omitempty"`
+	Description string  `json:"description,omitempty"`
+}
+
+// ytdlpInfo is the subset of yt-dlp -J output we use
+type ytdlpInfo struct {
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	Channel     string        `json:"channel"`
+	Uploader    string        `json:"uploader"`
+	Duration    float64       `json:"duration"`
+	Thumbnail   string        `json:"thumbnail"`
+	ViewCount   int64         `json:"view_count"`
+	UploadDate  string        `json:"upload_date"`
+	IsLive      bool          `json:"is_live"`
+	Description string        `json:"description"`
+	Categories  []string      `json:"categories"`
+	Formats     []ytdlpFormat `json:"formats"`
+}
+
+type ytdlpFormat struct {
+	FormatID   string  `json:"format_id"`
+	Ext        string  `json:"ext"`
+	URL        string  `json:"url"`
+	VCodec     string  `json:"vcodec"`
+	ACodec     string  `json:"acodec"`
+	Height     int     `json:"height"`
+	ABR        float64 `json:"abr"`
+	Resolution string  `json:"resolution"`
+	FormatNote string  `json:"format_note"`
+}
+
+// probeInfo runs a single yt-dlp -J call and returns the metadata and parsed format info.
+// The info JSON is cached for a download that follows, see extractcache.go.
+func probeInfo(cleanedURL string) (*ytdlpInfo, FormatInfo, error) {
+	cmd := exec.Command(ytdlpBinary,
+		"--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"-J",
+		"--no-playlist",
+		cleanedURL)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	formatInfo := FormatInfo{
+		Warnings:    []string{},
+		QualityInfo: make(map[string]string),
+	}
+
+	// Warnings are written to stderr, the JSON document to stdout
+	stderrStr := stderr.String()
+	if strings.Contains(stderrStr, "SABR") || strings.Contains(stderrStr, "missing a url") {
+		formatInfo.HasSABR = true
+		formatInfo.Warnings = append(formatInfo.Warnings, "SABR-Streaming erkannt - einige Formate möglicherweise nicht verfügbar")
+	}
+	if strings.Contains(stderrStr, "nsig extraction failed") {
+		formatInfo.Warnings = append(formatInfo.Warnings, "Signatur-Extraktion fehlgeschlagen - einige Formate fehlen möglicherweise")
+	}
+
+	if err != nil {
+		ytdlpLog.Warn("yt-dlp -J failed", "error", err, "stderr", truncateString(stderrStr, 1000))
+		return nil, formatInfo, classifyYtDlpError(stderrStr).downloadError()
+	}
+
+	var info ytdlpInfo
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return nil, formatInfo, fmt.Errorf("failed to parse yt-dlp JSON: %v", err)
+	}
+	storeExtraction(info.ID, stdout.Bytes())
+
+	bestHeight, bestAnyHeight := 0, 0
+	bestABR := 0.0
+	for _, f := range info.Formats {
+		isVideo := f.VCodec != "" && f.VCodec != "none"
+		isAudioOnly := !isVideo && f.ACodec != "" && f.ACodec != "none"
+
+		if isVideo && f.Ext == "mp4" && f.Height > bestHeight {
+			bestHeight = f.Height
+			formatInfo.BestVideoInfo = describeFormat(f)
+		}
+		if isVideo && f.Height > bestAnyHeight {
+			bestAnyHeight = f.Height
+		}
+		if isAudioOnly && f.ABR > bestABR {
+			bestABR = f.ABR
+			formatInfo.BestAudioInfo = describeFormat(f)
+		}
+	}
+
+	if bestHeight > 0 {
+		formatInfo.QualityInfo["mp4"] = formatQualityLabel(fmt.Sprintf("%dp", bestHeight), true)
+	}
+	// WebM and MKV take any codec, so their best is the best video overall
+	if bestAnyHeight > 0 {
+		videoLabel := formatQualityLabel(fmt.Sprintf("%dp", bestAnyHeight), true)
+		formatInfo.QualityInfo["webm"] = videoLabel
+		formatInfo.QualityInfo["mkv"] = videoLabel
+	}
+	if bestABR > 0 {
+		audioLabel := formatQualityLabel(fmt.Sprintf("%dkbps", int(bestABR)), false)
+		formatInfo.QualityInfo["mp3"] = audioLabel
+		formatInfo.QualityInfo["wav"] = audioLabel
+		formatInfo.QualityInfo["m4a"] = audioLabel
+		formatInfo.QualityInfo["flac"] = audioLabel
+		formatInfo.QualityInfo["opus"] = audioLabel
+		formatInfo.QualityInfo["ogg"] = audioLabel
+	}
+
+	return &info, formatInfo, nil
+}
+
+// describeFormat builds a short human readable description similar to a yt-dlp -F line
+func describeFormat(f ytdlpFormat) string {
+	parts := []string{f.FormatID, f.Ext, f.Resolution}
+	if f.FormatNote != "" {
+		parts = append(parts, f.FormatNote)
+	}
+	return strings.Join(parts, " ")
+}
+
+// handlePreflight canonicalizes the URL and probes metadata and formats in one round trip
+func handlePreflight(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DownloadRequest
+	if reqErr := decodeJSONBody(w, r, &req, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, PreflightResponse{
+			Success: false,
+			Message: reqErr.message,
+		})
+		return
+	}
+
+	if req.URL == "" {
+		writeJSONStatus(w, http.StatusOK, PreflightResponse{
+			Success: false,
+			Message: "URL fehlt",
+		})
+		return
+	}
+
+	if !resolver.IsYouTubeURL(req.URL) {
+		writeJSONStatus(w, http.StatusOK, PreflightResponse{
+			Success:     false,
+			Message:     "Nur YouTube URLs sind erlaubt",
+			OriginalURL: req.URL,
+		})
+		return
+	}
+
+	resolvedURL, wasRedirect, wasCanonical, resolveErr := resolver.Resolve(req.URL)
+
+	response := PreflightResponse{
+		Success:        true,
+		OriginalURL:    req.URL,
+		ResolvedURL:    resolvedURL,
+		WasRedirect:    wasRedirect,
+		WasCanonical:   wasCanonical,
+		SelectedFormat: describeSelectedFormat(req.Format),
+	}
+	if resolveErr != nil {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("Warnung: %v", resolveErr))
+	}
+
+	info, formatInfo, err := probeInfo(resolvedURL)
+	response.HasSABR = formatInfo.HasSABR
+	response.Warnings = append(response.Warnings, formatInfo.Warnings...)
+
+	if err != nil {
+		response.Success = false
+		response.Message = "Fehler beim Abrufen der Videoinformationen"
+		response.Hint = errorHint(err)
+		writeJSONStatus(w, http.StatusOK, response)
+		return
+	}
+
+	// Share the probe result with /check-formats
+	storeFormatInfo(info.ID, formatInfo)
+
+	channel := info.Channel
+	if channel == "" {
+		channel = info.Uploader
+	}
+	response.Video = &VideoInfo{
+		ID:          info.ID,
+		Title:       info.Title,
+		Channel:     channel,
+		Duration:    info.Duration,
+		Thumbnail:   info.Thumbnail,
+		ViewCount:   info.ViewCount,
+		UploadDate:  info.UploadDate,
+		IsLive:      info.IsLive,
+		Description: truncateString(info.Description, 500),
+	}
+	response.BestVideoInfo = formatInfo.BestVideoInfo
+	response.BestAudioInfo = formatInfo.BestAudioInfo
+	response.QualityInfo = formatInfo.QualityInfo
+
+	writeJSONStatus(w, http.StatusOK, response)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cast devices fetch /preview/{id} themselves and can't send the session token, so
+// castMediaURL signs the URL instead (?expires=&sig=). The key only lives in memory:
+// after a restart the device has to be cast to again.
+const previewURLTTL = 12 * time.Hour
+
+var previewSigningKey = newPreviewSigningKey()
+
+func newPreviewSigningKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+func previewSignature(jobID string, expires int64) string {
+	mac := hmac.New(sha256.New, previewSigningKey)
+	mac.Write([]byte(jobID + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signPreviewQuery returns the query that grants access to a job's preview until it expires
+func signPreviewQuery(jobID string) string {
+	expires := time.Now().Add(previewURLTTL).Unix()
+	return url.Values{
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {previewSignature(jobID, expires)},
+	}.Encode()
+}
+
+// previewSignatureValid reports whether the request carries a valid, unexpired signature
+func previewSignatureValid(r *http.Request, jobID string) bool {
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(query.Get("sig")), []byte(previewSignature(jobID, expires)))
+}
+
+// previewContentTypes maps output extensions to types browsers can play inline
+var previewContentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".wav":  "audio/wav",
+	".webm": "video/webm",
+	".flac": "audio/flac",
+	".opus": "audio/ogg",
+	".ogg":  "audio/ogg",
+}
+
+// handlePreview serves a completed job's file inline with Range support: /preview/{jobId}
+// with the session token or a signed cast URL. Unlike /download-file/ the file is not
+// deleted afterwards.
+func handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := strings.TrimPrefix(r.URL.Path, "/preview/")
+	if !previewSignatureValid(r, jobID) && !requireSessionOwner(w, r, jobID) {
+		return
+	}
+	job, ok := getJob(jobID)
+	if !ok {
+		http.Error(w, "Job nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if job.Status != JobStatusCompleted || job.Filename == "" {
+		http.Error(w, "Download ist noch nicht abgeschlossen", http.StatusConflict)
+		return
+	}
+
+	// Filename comes from our own job store, but stay inside downloads anyway
+	filePath := downloadPath(job.Filename)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		fileLog.Warn("Preview file not available", "session", jobID, "error", err)
+		http.Error(w, "Datei nicht gefunden. Möglicherweise wurde sie bereits heruntergeladen.", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Fehler beim Lesen der Dateiinformationen", http.StatusInternalServerError)
+		return
+	}
+
+	contentType, ok := previewContentTypes[strings.ToLower(filepath.Ext(filePath))]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "inline")
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	// ServeContent handles Range, If-Range and HEAD requests for seeking in the player
+	counter := &countingWriter{ResponseWriter: w}
+	http.ServeContent(counter, r, fileInfo.Name(), fileInfo.ModTime(), file)
+	addJobResources(jobID, JobResources{ServedBytes: counter.written})
+}
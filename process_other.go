@@ -0,0 +1,35 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op without Unix process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills a started process; its children keep running
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// stopProcessGroup is not supported without Unix signals
+func stopProcessGroup(cmd *exec.Cmd) error {
+	return errors.ErrUnsupported
+}
+
+// continueProcessGroup is not supported without Unix signals
+func continueProcessGroup(cmd *exec.Cmd) error {
+	return errors.ErrUnsupported
+}
+
+// peakRSS is not available without getrusage
+func peakRSS(state *os.ProcessState) int64 {
+	return 0
+}
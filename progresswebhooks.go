@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROGRESS_WEBHOOK_URL receives the progress of every job for external dashboards:
+// an event when the download passes one of PROGRESS_WEBHOOK_MILESTONES (percent,
+// default 25,50,75), with PROGRESS_WEBHOOK_INTERVAL additionally at most that often
+// while it runs, and one when the job completes or fails. Each event is posted as
+// its own JSON object; with PROGRESS_WEBHOOK_BATCH the events are collected and
+// posted as {"events": [...]} once per batch window instead.
+const (
+	ProgressEventProgress  = "progress"
+	ProgressEventCompleted = "completed"
+	ProgressEventFailed    = "failed"
+
+	maxProgressWebhookBatch = 500 // Events kept per batch window, the oldest are dropped
+)
+
+var (
+	progressWebhookMilestones = parseMilestones(getEnvDefault("PROGRESS_WEBHOOK_MILESTONES", "25,50,75"))
+	progressWebhookInterval   = parseEnvDurationOrOff("PROGRESS_WEBHOOK_INTERVAL", 0)
+	progressWebhookBatch      = parseEnvDurationOrOff("PROGRESS_WEBHOOK_BATCH", 0)
+
+	progressWebhookClient = &http.Client{Timeout: 10 * time.Second}
+	progressWebhookLog    = componentLogger("progress-webhook")
+
+	progressWebhookStates  = make(map[string]*progressWebhookState) // Keyed by session ID
+	progressWebhookPending []ProgressWebhookEvent                   // Waiting for the next batch
+	progressWebhookMutex   sync.Mutex
+)
+
+// ProgressWebhookEvent is the payload of one progress or final event
+type ProgressWebhookEvent struct {
+	Event     string    `json:"event"`
+	SessionID string    `json:"sessionId"`
+	URL       string    `json:"url"`
+	Format    string    `json:"format"`
+	Title     string    `json:"title,omitempty"`
+	Progress  int       `json:"progress"`
+	Milestone int       `json:"milestone,omitempty"` // Highest milestone passed by this update
+	Status    string    `json:"status,omitempty"`
+	Phase     string    `json:"phase,omitempty"`
+	Filename  string    `json:"filename,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode string    `json:"errorCode,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// progressWebhookState is what was sent for a running job
+type progressWebhookState struct {
+	milestone int
+	lastSent  time.Time
+}
+
+func progressWebhookURL() string { return secret("PROGRESS_WEBHOOK_URL") }
+
+// parseMilestones reads "25,50,75" into sorted percentages between 1 and 99
+func parseMilestones(value string) []int {
+	var milestones []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		percent, err := strconv.Atoi(field)
+		if err != nil || percent <= 0 || percent >= 100 {
+			configLog.Warn("Ignoring invalid progress milestone", "value", field)
+			continue
+		}
+		milestones = append(milestones, percent)
+	}
+	sort.Ints(milestones)
+	return milestones
+}
+
+// notifyProgressWebhook turns progress and finish events into webhook events
+func notifyProgressWebhook(event LifecycleEvent) {
+	if progressWebhookURL() == "" || event.Update == nil {
+		return
+	}
+	if event.Type == EventJobFinished {
+		progressWebhookMutex.Lock()
+		delete(progressWebhookStates, event.SessionID)
+		progressWebhookMutex.Unlock()
+
+		payload := newProgressWebhookEvent(event.Job, ProgressEventCompleted, *event.Update)
+		if event.Job.Status != JobStatusCompleted {
+			payload.Event = ProgressEventFailed
+		}
+		sendProgressWebhook(payload)
+		return
+	}
+
+	update := *event.Update
+	milestone, due := progressWebhookDue(event.SessionID, update.Progress, event.At)
+	if !due {
+		return
+	}
+	job, ok := getJob(event.SessionID)
+	if !ok {
+		return
+	}
+	payload := newProgressWebhookEvent(job, ProgressEventProgress, update)
+	payload.Milestone = milestone
+	sendProgressWebhook(payload)
+}
+
+// progressWebhookDue reports whether an update passes a new milestone or the
+// interval is over, and the highest milestone it passes
+func progressWebhookDue(sessionID string, progress int, now time.Time) (int, bool) {
+	progressWebhookMutex.Lock()
+	defer progressWebhookMutex.Unlock()
+
+	state, ok := progressWebhookStates[sessionID]
+	if !ok {
+		state = &progressWebhookState{lastSent: now}
+		progressWebhookStates[sessionID] = state
+	}
+	milestone := 0
+	for _, m := range progressWebhookMilestones {
+		if progress >= m && m > state.milestone {
+			milestone = m
+		}
+	}
+	intervalOver := progressWebhookInterval > 0 && now.Sub(state.lastSent) >= progressWebhookInterval
+	if milestone == 0 && !intervalOver {
+		return 0, false
+	}
+	if milestone > 0 {
+		state.milestone = milestone
+	}
+	state.lastSent = now
+	return milestone, true
+}
+
+func newProgressWebhookEvent(job Job, event string, update ProgressUpdate) ProgressWebhookEvent {
+	payload := ProgressWebhookEvent{
+		Event:     event,
+		SessionID: job.SessionID,
+		URL:       job.URL,
+		Format:    job.Format,
+		Progress:  update.Progress,
+		Status:    update.Status,
+		Phase:     update.Phase,
+		Timestamp: time.Now(),
+	}
+	if event != ProgressEventProgress {
+		payload.Filename = job.Filename
+		payload.Error = job.Error
+		payload.ErrorCode = job.ErrorCode
+	}
+	if job.Metadata != nil {
+		payload.Title = job.Metadata.Title
+	}
+	return payload
+}
+
+// sendProgressWebhook posts the event in the background or queues it for the batch
+func sendProgressWebhook(payload ProgressWebhookEvent) {
+	if progressWebhookBatch > 0 {
+		progressWebhookMutex.Lock()
+		progressWebhookPending = append(progressWebhookPending, payload)
+		if len(progressWebhookPending) > maxProgressWebhookBatch {
+			progressWebhookPending = progressWebhookPending[len(progressWebhookPending)-maxProgressWebhookBatch:]
+		}
+		progressWebhookMutex.Unlock()
+		return
+	}
+	go postProgressWebhook(payload, payload.Event)
+}
+
+// runProgressWebhookBatches posts the collected events once per batch window
+func runProgressWebhookBatches() {
+	if progressWebhookBatch <= 0 {
+		return
+	}
+	for range time.Tick(progressWebhookBatch) {
+		progressWebhookMutex.Lock()
+		events := progressWebhookPending
+		progressWebhookPending = nil
+		progressWebhookMutex.Unlock()
+		if len(events) > 0 && progressWebhookURL() != "" {
+			postProgressWebhook(map[string]interface{}{"events": events}, "batch")
+		}
+	}
+}
+
+func postProgressWebhook(payload interface{}, event string) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	resp, err := progressWebhookClient.Post(progressWebhookURL(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		progressWebhookLog.Error("Failed to send event", "event", event, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		progressWebhookLog.Error("Webhook rejected event", "event", event, "status", resp.StatusCode)
+	}
+}
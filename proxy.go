@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Behind nginx or Traefik every request comes from the proxy. TRUSTED_PROXIES lists
+// the proxies (CIDRs or addresses, "lan" for private ranges) whose X-Forwarded-For
+// and X-Real-IP headers are believed. realIPMiddleware then replaces r.RemoteAddr
+// with the client address, so rate limits, access control and the audit log see the
+// real client. Headers from untrusted peers are ignored, as they can be forged.
+var trustedProxies = parsePrefixList("TRUSTED_PROXIES")
+
+// remoteIP returns the client address without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrustedProxy(value string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(value))
+	return err == nil && matchesPrefix(trustedProxies, addr.Unmap().WithZone(""))
+}
+
+// forwardedClientIP returns the client address from the proxy headers, or "" if
+// there is none. X-Forwarded-For is read from the right: the first address that is
+// not a trusted proxy is the client, anything left of it was sent by the client.
+func forwardedClientIP(r *http.Request) string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			return "" // Garbage, don't guess
+		}
+		if !isTrustedProxy(hop) || i == 0 {
+			return hop
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return ""
+}
+
+// realIPMiddleware sets r.RemoteAddr to the client address for requests that come
+// through a trusted proxy
+func realIPMiddleware(next http.Handler) http.Handler {
+	if len(trustedProxies) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isTrustedProxy(remoteIP(r)) {
+			if client := forwardedClientIP(r); client != "" {
+				_, port, _ := net.SplitHostPort(r.RemoteAddr)
+				r.RemoteAddr = net.JoinHostPort(client, port)
+			} else {
+				httpLog.Warn("No usable X-Forwarded-For/X-Real-IP from proxy", "proxy", r.RemoteAddr, "path", r.URL.Path)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
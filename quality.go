@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A download can ask for a quality instead of the best available: a maximum video
+// height for the video formats ("2160p" to "360p"), or "audio-best" for the audio
+// formats, which picks the best audio stream explicitly. Above 1080p YouTube mostly
+// offers VP9 and AV1 only, so those are merged into an mp4 as well. Without a quality
+// mp4 takes the best mp4 video and m4a audio as before.
+const QualityAudioBest = "audio-best"
+
+// videoQualityHeights are the accepted video qualities
+var videoQualityHeights = map[string]int{
+	"2160p": 2160,
+	"1440p": 1440,
+	"1080p": 1080,
+	"720p":  720,
+	"480p":  480,
+	"360p":  360,
+}
+
+const defaultVideoSelector = "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best"
+
+// videoContainerStreams are the video and audio streams that fit a container without
+// re-encoding; mkv takes any
+var videoContainerStreams = map[string][2]string{
+	"mp4":  {"[ext=mp4]", "[ext=m4a]"},
+	"webm": {"[ext=webm]", "[ext=webm]"},
+	"mkv":  {"", ""},
+}
+
+// validateQuality checks that the quality exists and fits the format
+func validateQuality(req DownloadRequest) string {
+	switch {
+	case req.Quality == "":
+		return ""
+	case req.Quality == QualityAudioBest:
+		if !isAudioFormat(req.Format) {
+			return "Die Qualität audio-best gibt es nur für Audioformate."
+		}
+		if req.AudioPreset != "" {
+			return "Die Qualität audio-best lässt sich nicht mit einem Audio-Profil kombinieren."
+		}
+		return ""
+	case videoQualityHeights[req.Quality] > 0:
+		if _, ok := videoContainerStreams[req.Format]; !ok {
+			return fmt.Sprintf("Die Auflösung %s gibt es nur für Videoformate.", req.Quality)
+		}
+		return ""
+	}
+	return fmt.Sprintf("Unbekannte Qualität: %s", req.Quality)
+}
+
+// videoFormatSelector returns yt-dlp's -f for a video download. Streams that fit the
+// container are preferred, others are merged into it. A video is never upscaled: if
+// it is smaller than the quality, its best version is taken.
+func videoFormatSelector(format, quality string) string {
+	height, ok := videoQualityHeights[quality]
+	if !ok && format == "mp4" {
+		return defaultVideoSelector
+	}
+	limit := ""
+	if ok {
+		limit = "[height<=" + strconv.Itoa(height) + "]"
+	}
+	streams := videoContainerStreams[format]
+	selectors := []string{"bestvideo" + limit + streams[0] + "+bestaudio" + streams[1]}
+	if streams[0] != "" {
+		selectors = append(selectors, "bestvideo"+limit+"+bestaudio")
+	}
+	selectors = append(selectors, "best"+limit)
+	if limit != "" {
+		selectors = append(selectors, "best")
+	}
+	return strings.Join(selectors, "/")
+}
+
+// audioFormatArgs selects the audio stream for the audio formats
+func audioFormatArgs(quality string) []string {
+	if quality == QualityAudioBest {
+		return []string{"-f", "bestaudio/best"}
+	}
+	return nil
+}
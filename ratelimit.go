@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter counts requests per key (usually the client IP) in fixed windows
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu   sync.Mutex
+	hits map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, hits: make(map[string]*rateWindow)}
+}
+
+// allow counts a request and reports whether it is within the limit
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	hit, ok := l.hits[key]
+	if !ok || now.Sub(hit.start) >= l.window {
+		hit = &rateWindow{start: now}
+		l.hits[key] = hit
+	}
+	hit.count++
+	return hit.count <= l.limit
+}
+
+// blocked reports whether key already used up its limit, without counting
+func (l *rateLimiter) blocked(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hit, ok := l.hits[key]
+	return ok && time.Since(hit.start) < l.window && hit.count >= l.limit
+}
+
+// cleanup forgets windows that have ended
+func (l *rateLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, hit := range l.hits {
+		if now.Sub(hit.start) >= l.window {
+			delete(l.hits, key)
+		}
+	}
+}
+
+// Per-IP rate limits for the endpoints that call yt-dlp, so one client can neither
+// flood the server nor get its address banned by YouTube. DOWNLOAD_RATE_LIMIT and
+// CHECK_FORMATS_RATE_LIMIT are written as "<requests>/<s|m|h>", e.g. "10/m"; the
+// matching *_RATE_BURST allows that many requests at once (default: the rate's
+// count). The client address honours X-Forwarded-For from TRUSTED_PROXIES. Requests
+// over the limit get 429 with Retry-After.
+var (
+	downloadRateLimiter     = newTokenBucketFromEnv("DOWNLOAD_RATE_LIMIT", "DOWNLOAD_RATE_BURST")
+	checkFormatsRateLimiter = newTokenBucketFromEnv("CHECK_FORMATS_RATE_LIMIT", "CHECK_FORMATS_RATE_BURST")
+	rateLimitLog            = componentLogger("ratelimit")
+)
+
+// tokenBucketLimiter refills every key's bucket at rate tokens per second up to burst
+type tokenBucketLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newTokenBucketLimiter(rate float64, burst int) *tokenBucketLimiter {
+	return &tokenBucketLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// newTokenBucketFromEnv returns nil if the limit is not set or invalid
+func newTokenBucketFromEnv(limitKey, burstKey string) *tokenBucketLimiter {
+	value := getenv(limitKey)
+	if value == "" {
+		return nil
+	}
+	count, per, err := parseRequestRate(value)
+	if err != nil {
+		configLog.Warn("Invalid rate limit, not limiting", "key", limitKey, "value", value, "error", err)
+		return nil
+	}
+	return newTokenBucketLimiter(float64(count)/per.Seconds(), parseEnvInt(burstKey, count))
+}
+
+// parseRequestRate reads "10/m" as 10 requests per minute
+func parseRequestRate(value string) (int, time.Duration, error) {
+	countText, unit, ok := strings.Cut(strings.TrimSpace(value), "/")
+	count, err := strconv.Atoi(strings.TrimSpace(countText))
+	if !ok || err != nil || count <= 0 {
+		return 0, 0, fmt.Errorf("expected <requests>/<s|m|h>")
+	}
+	switch strings.TrimSpace(unit) {
+	case "s":
+		return count, time.Second, nil
+	case "m":
+		return count, time.Minute, nil
+	case "h":
+		return count, time.Hour, nil
+	}
+	return 0, 0, fmt.Errorf("unknown unit %q, expected s, m or h", unit)
+}
+
+// take uses one token of key; without one it returns how long until the next is there
+func (l *tokenBucketLimiter) take(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// cleanup forgets buckets that are full again
+func (l *tokenBucketLimiter) cleanup() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func cleanupRateLimiters() {
+	downloadRateLimiter.cleanup()
+	checkFormatsRateLimiter.cleanup()
+}
+
+// rateLimit returns middleware that limits the requests per client address
+func rateLimit(limiter *tokenBucketLimiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := limiter.take(remoteIP(r))
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			rateLimitLog.Warn("Rate limit exceeded", "path", r.URL.Path, "ip", remoteIP(r), "retryAfter", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeJSONStatus(w, http.StatusTooManyRequests, map[string]interface{}{
+				"success":    false,
+				"message":    fmt.Sprintf("Zu viele Anfragen, bitte in %d Sekunden erneut versuchen", retryAfter),
+				"retryAfter": retryAfter,
+			})
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ytdownloader/resolver"
+)
+
+// Recommendations pick a format for a video from what it is (music, talk or other
+// video) and what the user wants to do with it, and explain the choice in one sentence.
+
+// What the user wants to do with the download
+const (
+	IntentListen  = "listen"
+	IntentWatch   = "watch"
+	IntentArchive = "archive"
+)
+
+// Kind of video, detected from category and duration
+const (
+	NatureMusic = "music"
+	NatureTalk  = "talk"
+	NatureVideo = "video"
+)
+
+// talkCategories are YouTube categories that are mostly speech
+var talkCategories = map[string]bool{
+	"Education":             true,
+	"News & Politics":       true,
+	"People & Blogs":        true,
+	"Science & Technology":  true,
+	"Howto & Style":         true,
+	"Nonprofits & Activism": true,
+}
+
+// longTalkSeconds is the duration from which an uncategorized video counts as talk
+const longTalkSeconds = 20 * 60
+
+type recommendRequest struct {
+	URL    string `json:"url"`
+	Intent string `json:"intent,omitempty"` // listen, watch, archive; guessed from the video if empty
+}
+
+// RecommendResponse is the suggested format with the reasoning behind it
+type RecommendResponse struct {
+	Success     bool             `json:"success"`
+	Message     string           `json:"message,omitempty"`
+	Hint        string           `json:"hint,omitempty"`
+	Nature      string           `json:"nature,omitempty"`
+	Intent      string           `json:"intent,omitempty"`
+	Format      string           `json:"format,omitempty"`
+	Quality     string           `json:"quality,omitempty"`
+	Explanation string           `json:"explanation,omitempty"`
+	Request     *DownloadRequest `json:"request,omitempty"` // Ready to send to /download
+}
+
+// detectNature classifies a video by category, falling back to its duration
+func detectNature(info *ytdlpInfo) string {
+	for _, category := range info.Categories {
+		if category == "Music" {
+			return NatureMusic
+		}
+	}
+	for _, category := range info.Categories {
+		if talkCategories[category] {
+			return NatureTalk
+		}
+	}
+	if info.Duration >= longTalkSeconds {
+		return NatureTalk
+	}
+	return NatureVideo
+}
+
+// recommendFormat chooses format and options for a video and intent
+func recommendFormat(info *ytdlpInfo, formatInfo FormatInfo, intent string) RecommendResponse {
+	nature := detectNature(info)
+	if intent == "" {
+		intent = IntentWatch
+		if nature != NatureVideo {
+			intent = IntentListen
+		}
+	}
+
+	rec := RecommendResponse{Success: true, Nature: nature, Intent: intent}
+	req := DownloadRequest{URL: "https://www.youtube.com/watch?v=" + info.ID}
+	videoQuality, hasVideo := formatInfo.QualityInfo["mp4"]
+
+	switch {
+	case intent == IntentListen && nature == NatureMusic:
+		req.Format = "m4a"
+		req.SmartTitle = true
+		rec.Explanation = "Musik: M4A übernimmt die AAC-Spur von YouTube meist ohne erneute Kodierung, Interpret und Titel werden als Tags gesetzt."
+	case intent == IntentListen && nature == NatureTalk:
+		req.Format = "mp3"
+		req.AudioPreset = AudioPresetVoice
+		rec.Explanation = fmt.Sprintf("Vortrag/Podcast: Das Sprachprofil (Mono, %s) reicht für Sprache und macht %s deutlich kleiner als die Standardqualität.",
+			describeBitrate(voiceBitrates["mp3"]), describeDuration(info.Duration))
+	case intent == IntentListen:
+		req.Format = "mp3"
+		rec.Explanation = "Nur Ton: MP3 läuft auf jedem Gerät und Auto-Radio."
+	case !hasVideo:
+		req.Format = "m4a"
+		rec.Explanation = "Für dieses Video ist kein MP4-Videoformat verfügbar, deshalb wird nur der Ton in bester Qualität geladen."
+	case intent == IntentArchive:
+		req.Format = "mp4"
+		rec.Explanation = fmt.Sprintf("Archiv: MP4 mit der besten verfügbaren Auflösung (%s) und Originalton, vorhandene Kapitel werden eingebettet.", videoQuality)
+	default:
+		req.Format = "mp4"
+		rec.Explanation = fmt.Sprintf("Ansehen: MP4 in %s spielt auf Fernseher, Handy und Browser ohne zusätzliche Software.", videoQuality)
+	}
+
+	rec.Format = req.Format
+	if req.Format == "mp4" {
+		rec.Quality = videoQuality
+	} else if req.AudioPreset == AudioPresetVoice {
+		rec.Quality = describeBitrate(voiceBitrates[req.Format]) + " Mono"
+	} else {
+		rec.Quality = formatInfo.QualityInfo[req.Format]
+	}
+	rec.Request = &req
+	return rec
+}
+
+// describeBitrate turns an ffmpeg bitrate like "64k" into "64 kbps"
+func describeBitrate(bitrate string) string {
+	return strings.TrimSuffix(bitrate, "k") + " kbps"
+}
+
+// describeDuration renders a duration for explanations, e.g. "die 95 Minuten"
+func describeDuration(seconds float64) string {
+	if seconds <= 0 {
+		return "die Datei"
+	}
+	return fmt.Sprintf("die %d Minuten", int(seconds/60+0.5))
+}
+
+// handleRecommend suggests a format: POST /recommend {"url": ..., "intent": "listen"}
+func handleRecommend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body recommendRequest
+	if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, RecommendResponse{Success: false, Message: reqErr.message})
+		return
+	}
+
+	switch body.Intent {
+	case "", IntentListen, IntentWatch, IntentArchive:
+	default:
+		writeJSONStatus(w, http.StatusBadRequest, RecommendResponse{Success: false, Message: "Ungültiger Zweck (listen, watch oder archive)"})
+		return
+	}
+	if !resolver.IsYouTubeURL(body.URL) {
+		writeJSONStatus(w, http.StatusBadRequest, RecommendResponse{Success: false, Message: "Nur YouTube URLs sind erlaubt"})
+		return
+	}
+	cleanedURL, err := cleanURL(body.URL)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, RecommendResponse{Success: false, Message: "Ungültige URL"})
+		return
+	}
+
+	info, formatInfo, err := probeInfo(cleanedURL)
+	if err != nil {
+		writeJSONStatus(w, http.StatusOK, RecommendResponse{Success: false, Message: "Fehler beim Abrufen der Videoinformationen", Hint: errorHint(err)})
+		return
+	}
+	storeFormatInfo(info.ID, formatInfo)
+
+	writeJSONStatus(w, http.StatusOK, recommendFormat(info, formatInfo, body.Intent))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Downloads that were queued or running when the server stopped are picked up again
+// on the next start. They keep their session ID and token, so clients reconnect to
+// /progress as before, and their staging directory, so yt-dlp continues the .part
+// files instead of starting over. JOB_RECOVERY=fail marks them as failed instead.
+// Jobs without a stored request (local conversions) and jobs that were already
+// recovered maxJobRecoveries times fail as well, so a download that takes the server
+// down can't loop; their clients get the error from the progress cache.
+const (
+	jobRequestBucket = "requests"
+	maxJobRecoveries = 2
+)
+
+var (
+	jobRecovery = strings.ToLower(getEnvDefault("JOB_RECOVERY", "requeue"))
+	recoveryLog = componentLogger("recovery")
+)
+
+// storedRequest is what is needed to start a download again. Section, Account and
+// Owner are hidden from the API, so they are kept next to the request.
+type storedRequest struct {
+	Request    DownloadRequest `json:"request"`
+	Section    *MediaSection   `json:"section,omitempty"`
+	Account    string          `json:"account,omitempty"`
+	Owner      string          `json:"owner,omitempty"`
+	User       string          `json:"user"`
+	Recoveries int             `json:"recoveries,omitempty"`
+}
+
+// recoveredJob is an interrupted job that is queued again once the store is loaded
+type recoveredJob struct {
+	sessionID string
+	stored    storedRequest
+}
+
+// rememberJobRequest stores the request of a download until the job finished
+func rememberJobRequest(sessionID string, req DownloadRequest, user string) {
+	if jobStore == nil {
+		return
+	}
+	data, err := json.Marshal(storedRequest{Request: req, Section: req.Section, Account: req.Account, Owner: req.Owner, User: user})
+	if err != nil {
+		jobStoreLog.Error("Failed to save request", "session", sessionID, "error", err)
+		return
+	}
+	err = jobStore.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(jobRequestBucket)).Put([]byte(sessionID), data)
+	})
+	if err != nil {
+		jobStoreLog.Error("Failed to save request", "session", sessionID, "error", err)
+	}
+}
+
+func forgetJobRequest(sessionID string) {
+	err := jobStore.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(jobRequestBucket)).Delete([]byte(sessionID))
+	})
+	if err != nil {
+		jobStoreLog.Error("Failed to delete request", "session", sessionID, "error", err)
+	}
+}
+
+// takeRecoverableRequest decides within the restore transaction whether an interrupted
+// job is queued again, and counts the attempt
+func takeRecoverableRequest(tx *bolt.Tx, sessionID string) (storedRequest, bool) {
+	var stored storedRequest
+	bucket := tx.Bucket([]byte(jobRequestBucket))
+	value := bucket.Get([]byte(sessionID))
+	if value == nil || jobRecovery != "requeue" {
+		return stored, false
+	}
+	if err := json.Unmarshal(value, &stored); err != nil {
+		recoveryLog.Warn("Unreadable request", "session", sessionID, "error", err)
+		return stored, false
+	}
+	if stored.Recoveries >= maxJobRecoveries {
+		recoveryLog.Warn("Job interrupted too often, giving up", "session", sessionID, "interruptions", stored.Recoveries+1)
+		return stored, false
+	}
+	stored.Recoveries++
+	data, err := json.Marshal(stored)
+	if err != nil || bucket.Put([]byte(sessionID), data) != nil {
+		return stored, false
+	}
+	return stored, true
+}
+
+// requeueRecoveredJob runs an interrupted download again under its old session ID
+func requeueRecoveredJob(recovered recoveredJob) {
+	sessionID := recovered.sessionID
+	job, ok := getJob(sessionID)
+	if !ok {
+		return
+	}
+	req := recovered.stored.Request
+	req.Section = recovered.stored.Section
+	req.Account = recovered.stored.Account
+	req.Owner = recovered.stored.Owner
+
+	jobLogger(recoveryLog, sessionID, "queue").Info("Re-queueing interrupted job", "attempt", recovered.stored.Recoveries+1)
+	sendWarning(sessionID, WarningRecovered)
+	runJob(sessionID, req, recovered.stored.User, nil, func() (string, error) {
+		return downloadVideo(job.URL, req, sessionID, job.Binary)
+	})
+}
+
+// notifyInterruptedJob leaves the final error in the progress cache, so a client
+// reconnecting after the restart learns what happened to its download
+func notifyInterruptedJob(sessionID string) {
+	if _, ok := getJob(sessionID); !ok {
+		return
+	}
+	publishError(sessionID, errorUpdate(sessionID, jobInterruptedMessage))
+}
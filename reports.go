@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CorrelatedErrorReport combines a frontend error report with the backend job it belongs to
+type CorrelatedErrorReport struct {
+	ID         string      `json:"id"`
+	Group      string      `json:"group"` // Hash of the message, see reportstore.go
+	ReceivedAt time.Time   `json:"receivedAt"`
+	Report     ErrorReport `json:"report"`
+	Job        *Job        `json:"job,omitempty"`
+}
+
+var (
+	errorReports          []CorrelatedErrorReport // Most recent reports, oldest first
+	errorReportsMutex     sync.RWMutex
+	maxStoredErrorReports = 200
+)
+
+// maxSlackLogChars keeps the job log field below Slack's attachment field limit
+const maxSlackLogChars = 2500
+
+// correlateErrorReport attaches the matching job (if any) and stores the combined record
+func correlateErrorReport(report ErrorReport) CorrelatedErrorReport {
+	record := CorrelatedErrorReport{
+		ID:         fmt.Sprintf("%d", time.Now().UnixNano()),
+		Group:      errorReportGroupHash(report.ErrorMessage),
+		ReceivedAt: time.Now(),
+		Report:     report,
+	}
+
+	if report.SessionID != "" {
+		if job, ok := getJob(report.SessionID); ok {
+			record.Job = &job
+		}
+	}
+
+	errorReportsMutex.Lock()
+	errorReports = append(errorReports, record)
+	if len(errorReports) > maxStoredErrorReports {
+		errorReports = errorReports[len(errorReports)-maxStoredErrorReports:]
+	}
+	errorReportsMutex.Unlock()
+
+	persistErrorReport(record)
+	return record
+}
+
+// sendCorrelatedSlackNotification sends the error report with job details attached
+func sendCorrelatedSlackNotification(record CorrelatedErrorReport) error {
+	if record.Job == nil {
+		return sendSlackNotification(record.Report)
+	}
+
+	if slackWebhookURL() == "" {
+		slackLog.Warn("SLACK_WEBHOOK_URL not configured, skipping notification")
+		return nil
+	}
+
+	message := buildErrorSlackMessage(record.Report)
+	job := record.Job
+	message.Attachments[0].Fields = append(message.Attachments[0].Fields,
+		SlackField{
+			Title: "Job URL",
+			Value: job.URL,
+			Short: false,
+		},
+		SlackField{
+			Title: "Job Format",
+			Value: job.Format,
+			Short: true,
+		},
+		SlackField{
+			Title: "Job Status",
+			Value: job.Status,
+			Short: true,
+		},
+	)
+
+	if job.Error != "" {
+		message.Attachments[0].Fields = append(message.Attachments[0].Fields, SlackField{
+			Title: "Job Error",
+			Value: job.Error,
+			Short: false,
+		})
+	}
+
+	if len(job.LogLines) > 0 {
+		logText := strings.Join(job.LogLines, "\n")
+		if len(logText) > maxSlackLogChars {
+			logText = "..." + logText[len(logText)-maxSlackLogChars:]
+		}
+		message.Attachments[0].Fields = append(message.Attachments[0].Fields, SlackField{
+			Title: fmt.Sprintf("Job Log (last %d lines)", len(job.LogLines)),
+			Value: fmt.Sprintf("```%s```", logText),
+			Short: false,
+		})
+	}
+
+	if err := postSlackMessage(message); err != nil {
+		return err
+	}
+
+	slackLog.Info("Error report sent", "report", record.ID, "session", record.Report.SessionID)
+	return nil
+}
+
+// handleListErrorReports returns the stored error reports, newest first. They carry
+// URLs, stacks and job logs, so like /admin/error-reports they need ADMIN_TOKEN.
+func handleListErrorReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	sessionID := r.URL.Query().Get("session")
+
+	errorReportsMutex.RLock()
+	records := make([]CorrelatedErrorReport, 0, len(errorReports))
+	for i := len(errorReports) - 1; i >= 0; i-- {
+		if sessionID != "" && errorReports[i].Report.SessionID != sessionID {
+			continue
+		}
+		records = append(records, errorReports[i])
+	}
+	errorReportsMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"reports": records,
+	})
+}
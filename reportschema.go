@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Error reports carry a schemaVersion, so the frontend can change their shape without
+// breaking /report-error. Each version is decoded with its own type and mapped onto
+// ErrorReport; unknown fields are kept under "extra" instead of rejecting the report.
+//
+//	1 (or no version): the flat shape of the bundled UI, errorMessage, errorStack, url,
+//	  userAgent, timestamp, sessionId, lastActions and browserInfo
+//	2: {"error": {"message", "stack", "type"}, "page", "userAgent", "timestamp",
+//	  "sessionId", "breadcrumbs", "context"}
+//
+// Context values may be any JSON; everything but strings is stored as JSON text.
+// Reports of a newer version than the server knows are read as the newest one.
+const errorReportSchemaVersion = 2
+
+// errorReportV1 is the schema of the bundled UI
+type errorReportV1 struct {
+	ErrorMessage string            `json:"errorMessage"`
+	ErrorStack   string            `json:"errorStack"`
+	URL          string            `json:"url"`
+	UserAgent    string            `json:"userAgent"`
+	Timestamp    string            `json:"timestamp"`
+	SessionID    string            `json:"sessionId"`
+	LastActions  lenientStrings    `json:"lastActions"`
+	BrowserInfo  lenientStringsMap `json:"browserInfo"`
+}
+
+type errorReportV2 struct {
+	Error struct {
+		Message string `json:"message"`
+		Stack   string `json:"stack"`
+		Type    string `json:"type"`
+	} `json:"error"`
+	Page        string            `json:"page"`
+	UserAgent   string            `json:"userAgent"`
+	Timestamp   string            `json:"timestamp"`
+	SessionID   string            `json:"sessionId"`
+	Breadcrumbs lenientStrings    `json:"breadcrumbs"`
+	Context     lenientStringsMap `json:"context"`
+}
+
+// errorReportFields are the top-level fields of each version
+var errorReportFields = map[int][]string{
+	1: {"errorMessage", "errorStack", "url", "userAgent", "timestamp", "sessionId", "lastActions", "browserInfo"},
+	2: {"error", "page", "userAgent", "timestamp", "sessionId", "breadcrumbs", "context"},
+}
+
+// parseErrorReport maps a report of any known schema version onto ErrorReport
+func parseErrorReport(raw map[string]json.RawMessage) (ErrorReport, error) {
+	version := 1
+	if value, ok := raw["schemaVersion"]; ok {
+		if err := json.Unmarshal(value, &version); err != nil || version < 1 {
+			return ErrorReport{}, fmt.Errorf("schemaVersion muss eine positive Zahl sein")
+		}
+	}
+	schema := version
+	if schema > errorReportSchemaVersion {
+		errorReportLog.Info("Error report from a newer schema, reading it as the newest known", "version", version, "known", errorReportSchemaVersion)
+		schema = errorReportSchemaVersion
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return ErrorReport{}, err
+	}
+	var report ErrorReport
+	switch schema {
+	case 1:
+		var v1 errorReportV1
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return ErrorReport{}, reportFieldError(err)
+		}
+		report = ErrorReport{
+			ErrorMessage: v1.ErrorMessage,
+			ErrorStack:   v1.ErrorStack,
+			URL:          v1.URL,
+			UserAgent:    v1.UserAgent,
+			Timestamp:    v1.Timestamp,
+			SessionID:    v1.SessionID,
+			LastActions:  v1.LastActions,
+			BrowserInfo:  v1.BrowserInfo,
+		}
+	case 2:
+		var v2 errorReportV2
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return ErrorReport{}, reportFieldError(err)
+		}
+		report = ErrorReport{
+			ErrorMessage: v2.Error.Message,
+			ErrorStack:   v2.Error.Stack,
+			URL:          v2.Page,
+			UserAgent:    v2.UserAgent,
+			Timestamp:    v2.Timestamp,
+			SessionID:    v2.SessionID,
+			LastActions:  v2.Breadcrumbs,
+			BrowserInfo:  v2.Context,
+		}
+		if v2.Error.Type != "" {
+			if report.BrowserInfo == nil {
+				report.BrowserInfo = make(map[string]string)
+			}
+			report.BrowserInfo["type"] = v2.Error.Type
+		}
+	}
+	report.SchemaVersion = version
+	report.Extra = unknownReportFields(raw, errorReportFields[schema])
+	return report, nil
+}
+
+// unknownReportFields returns the fields the schema doesn't know, as JSON text
+func unknownReportFields(raw map[string]json.RawMessage, known []string) map[string]string {
+	isKnown := map[string]bool{"schemaVersion": true}
+	for _, field := range known {
+		isKnown[field] = true
+	}
+	var extra map[string]string
+	for field, value := range raw {
+		if isKnown[field] {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]string)
+		}
+		extra[field] = lenientString(value)
+	}
+	return extra
+}
+
+func reportFieldError(err error) error {
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		return fmt.Errorf("Ungültiger Wert für Feld %q (erwartet: %s)", typeErr.Field, typeErr.Type)
+	}
+	return err
+}
+
+// lenientString returns a JSON string as is and any other value as JSON text
+func lenientString(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	return string(value)
+}
+
+// lenientStrings accepts a list of any JSON values
+type lenientStrings []string
+
+func (l *lenientStrings) UnmarshalJSON(data []byte) error {
+	var values []json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*l = make(lenientStrings, 0, len(values))
+	for _, value := range values {
+		*l = append(*l, lenientString(value))
+	}
+	return nil
+}
+
+// lenientStringsMap accepts an object with any JSON values, e.g. line numbers
+type lenientStringsMap map[string]string
+
+func (m *lenientStringsMap) UnmarshalJSON(data []byte) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*m = make(lenientStringsMap, len(values))
+	for key, value := range values {
+		(*m)[key] = lenientString(value)
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Frontend error reports are kept in the job store, so they can be reviewed later
+// under /admin/error-reports (ADMIN_TOKEN). Reports with the same message, ignoring
+// numbers, form a group. Every report is counted in its group, but only the first of
+// a group is always stored: later ones are stored with ERROR_REPORTS_SAMPLE_PERCENT
+// and at most ERROR_REPORTS_PER_GROUP per group. ERROR_REPORTS_MAX caps the stored
+// reports overall, dropping the oldest. Without the job store nothing is stored and
+// the admin views show the reports still in memory.
+const (
+	errorReportBucket      = "error_reports"
+	errorReportGroupBucket = "error_report_groups"
+	errorReportGroupLength = 12 // Hex digits of the message hash
+)
+
+var (
+	errorReportSamplePercent = min(parseEnvInt("ERROR_REPORTS_SAMPLE_PERCENT", 100), 100)
+	errorReportsPerGroup     = parseEnvInt("ERROR_REPORTS_PER_GROUP", 20)
+	maxPersistedErrorReports = parseEnvInt("ERROR_REPORTS_MAX", 2000)
+
+	errorReportGroups      = make(map[string]*ErrorReportGroup) // Keyed by hash
+	errorReportGroupsMutex sync.Mutex
+
+	// Numbers, hex IDs and the like differ between reports of the same error
+	errorReportNumbers = regexp.MustCompile(`0x[0-9a-fA-F]+|\b[0-9a-fA-F]{8,}\b|\d+`)
+)
+
+// ErrorReportGroup counts the reports with the same message
+type ErrorReportGroup struct {
+	Hash      string    `json:"hash"`
+	Message   string    `json:"message"` // Of the first report
+	Count     int       `json:"count"`   // Reports received
+	Stored    int       `json:"stored"`  // Reports kept
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// ErrorReportSummary is a stored report without its stack, job and context
+type ErrorReportSummary struct {
+	ID         string    `json:"id"`
+	Group      string    `json:"group"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	Message    string    `json:"message"`
+	SessionID  string    `json:"sessionId,omitempty"`
+	URL        string    `json:"url,omitempty"`
+}
+
+// errorReportGroupHash identifies reports with the same message
+func errorReportGroupHash(message string) string {
+	normalized := errorReportNumbers.ReplaceAllString(strings.TrimSpace(message), "#")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])[:errorReportGroupLength]
+}
+
+// persistErrorReport counts the report in its group and stores it if it is sampled
+func persistErrorReport(record CorrelatedErrorReport) {
+	errorReportGroupsMutex.Lock()
+	defer errorReportGroupsMutex.Unlock()
+
+	group, ok := errorReportGroups[record.Group]
+	if !ok {
+		group = &ErrorReportGroup{Hash: record.Group, Message: record.Report.ErrorMessage, FirstSeen: record.ReceivedAt}
+		errorReportGroups[record.Group] = group
+	}
+	group.Count++
+	group.LastSeen = record.ReceivedAt
+	store := jobStore != nil && group.Stored < errorReportsPerGroup &&
+		(group.Stored == 0 || rand.Intn(100) < errorReportSamplePercent)
+	if store {
+		group.Stored++
+	}
+	if jobStore == nil {
+		return
+	}
+
+	var dropped []string
+	err := jobStore.Update(func(tx *bolt.Tx) error {
+		reports := tx.Bucket([]byte(errorReportBucket))
+		if store {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := reports.Put([]byte(record.ID), data); err != nil {
+				return err
+			}
+			dropped = dropOldErrorReports(reports)
+		}
+		return saveErrorReportGroups(tx, group)
+	})
+	if err != nil {
+		errorReportLog.Error("Failed to store error report", "report", record.ID, "error", err)
+		return
+	}
+	if len(dropped) > 0 {
+		for _, hash := range dropped {
+			if g, ok := errorReportGroups[hash]; ok && g.Stored > 0 {
+				g.Stored--
+			}
+		}
+		jobStore.Update(func(tx *bolt.Tx) error {
+			return saveErrorReportGroups(tx, groupsByHash(dropped)...)
+		})
+	}
+}
+
+// dropOldErrorReports deletes the oldest reports above ERROR_REPORTS_MAX and returns
+// their groups. The IDs are nanosecond timestamps, so the keys sort by age.
+func dropOldErrorReports(reports *bolt.Bucket) []string {
+	cursor := reports.Cursor()
+	excess := -maxPersistedErrorReports
+	for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+		excess++
+	}
+	var groups []string
+	for key, value := cursor.First(); key != nil && excess > 0; key, value = cursor.First() {
+		var record CorrelatedErrorReport
+		if json.Unmarshal(value, &record) == nil {
+			groups = append(groups, record.Group)
+		}
+		if err := cursor.Delete(); err != nil {
+			break
+		}
+		excess--
+	}
+	return groups
+}
+
+// groupsByHash returns the groups; caller must hold errorReportGroupsMutex
+func groupsByHash(hashes []string) []*ErrorReportGroup {
+	var groups []*ErrorReportGroup
+	for _, hash := range hashes {
+		if group, ok := errorReportGroups[hash]; ok {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func saveErrorReportGroups(tx *bolt.Tx, groups ...*ErrorReportGroup) error {
+	bucket := tx.Bucket([]byte(errorReportGroupBucket))
+	for _, group := range groups {
+		data, err := json.Marshal(group)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(group.Hash), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadErrorReportGroups reads the groups of earlier runs from the job store
+func loadErrorReportGroups() {
+	errorReportGroupsMutex.Lock()
+	defer errorReportGroupsMutex.Unlock()
+	jobStore.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(errorReportGroupBucket)).ForEach(func(key, value []byte) error {
+			var group ErrorReportGroup
+			if err := json.Unmarshal(value, &group); err != nil {
+				jobStoreLog.Warn("Skipping unreadable error report group", "group", string(key), "error", err)
+				return nil
+			}
+			errorReportGroups[group.Hash] = &group
+			return nil
+		})
+	})
+}
+
+// storedErrorReports returns the kept reports of a group (or all), newest first
+func storedErrorReports(group string, limit int) []CorrelatedErrorReport {
+	var records []CorrelatedErrorReport
+	if jobStore == nil {
+		errorReportsMutex.RLock()
+		for i := len(errorReports) - 1; i >= 0 && len(records) < limit; i-- {
+			if group == "" || errorReports[i].Group == group {
+				records = append(records, errorReports[i])
+			}
+		}
+		errorReportsMutex.RUnlock()
+		return records
+	}
+	jobStore.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(errorReportBucket)).Cursor()
+		for key, value := cursor.Last(); key != nil && len(records) < limit; key, value = cursor.Prev() {
+			var record CorrelatedErrorReport
+			if json.Unmarshal(value, &record) == nil && (group == "" || record.Group == group) {
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	return records
+}
+
+// storedErrorReport returns one kept report
+func storedErrorReport(id string) (CorrelatedErrorReport, bool) {
+	var record CorrelatedErrorReport
+	found := false
+	if jobStore == nil {
+		errorReportsMutex.RLock()
+		for _, candidate := range errorReports {
+			if candidate.ID == id {
+				record, found = candidate, true
+			}
+		}
+		errorReportsMutex.RUnlock()
+		return record, found
+	}
+	jobStore.View(func(tx *bolt.Tx) error {
+		if value := tx.Bucket([]byte(errorReportBucket)).Get([]byte(id)); value != nil {
+			found = json.Unmarshal(value, &record) == nil
+		}
+		return nil
+	})
+	return record, found
+}
+
+// deleteErrorReportGroup forgets a group and its kept reports, e.g. once it is fixed
+func deleteErrorReportGroup(hash string) bool {
+	errorReportGroupsMutex.Lock()
+	defer errorReportGroupsMutex.Unlock()
+	if _, ok := errorReportGroups[hash]; !ok {
+		return false
+	}
+	delete(errorReportGroups, hash)
+	if jobStore == nil {
+		return true
+	}
+	err := jobStore.Update(func(tx *bolt.Tx) error {
+		reports := tx.Bucket([]byte(errorReportBucket))
+		var keys [][]byte
+		reports.ForEach(func(key, value []byte) error {
+			var record CorrelatedErrorReport
+			if json.Unmarshal(value, &record) == nil && record.Group == hash {
+				keys = append(keys, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		for _, key := range keys {
+			if err := reports.Delete(key); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket([]byte(errorReportGroupBucket)).Delete([]byte(hash))
+	})
+	if err != nil {
+		errorReportLog.Error("Failed to delete error report group", "group", hash, "error", err)
+	}
+	return true
+}
+
+// listErrorReportGroups returns the groups, most recently seen first
+func listErrorReportGroups() []ErrorReportGroup {
+	errorReportGroupsMutex.Lock()
+	groups := make([]ErrorReportGroup, 0, len(errorReportGroups))
+	for _, group := range errorReportGroups {
+		groups = append(groups, *group)
+	}
+	errorReportGroupsMutex.Unlock()
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].LastSeen.After(groups[j].LastSeen)
+	})
+	return groups
+}
+
+// handleAdminErrorReportGroups lists the groups: GET /admin/error-reports/groups
+func handleAdminErrorReportGroups(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"groups":  listErrorReportGroups(),
+	})
+}
+
+// handleAdminErrorReports lists kept reports: GET /admin/error-reports?group=&limit=
+func handleAdminErrorReports(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Ungültiges Limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	records := storedErrorReports(r.URL.Query().Get("group"), limit)
+	summaries := make([]ErrorReportSummary, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, ErrorReportSummary{
+			ID:         record.ID,
+			Group:      record.Group,
+			ReceivedAt: record.ReceivedAt,
+			Message:    record.Report.ErrorMessage,
+			SessionID:  record.Report.SessionID,
+			URL:        record.Report.URL,
+		})
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"reports": summaries,
+	})
+}
+
+// handleAdminErrorReport returns one report with stack and job: GET /admin/error-reports/{id}
+func handleAdminErrorReport(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	record, ok := storedErrorReport(pathParam(r, "id"))
+	if !ok {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"message": "Fehlerbericht nicht gefunden",
+		})
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"report":  record,
+	})
+}
+
+// handleDeleteErrorReportGroup removes a group: DELETE /admin/error-reports/groups/{hash}
+func handleDeleteErrorReportGroup(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if !deleteErrorReportGroup(pathParam(r, "hash")) {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"message": "Fehlergruppe nicht gefunden",
+		})
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true})
+}
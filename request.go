@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Body size limits per route
+const (
+	maxJSONBodyBytes        = 16 << 10  // 16 KiB for download/resolve/check-formats
+	maxErrorReportBodyBytes = 256 << 10 // 256 KiB, stack traces can be large
+)
+
+// requestError describes why a request body was rejected
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// decodeJSONBody strictly decodes a JSON request body into dst.
+// It enforces the Content-Type, a maximum body size, rejects unknown fields
+// and trailing data, and returns a user-facing German message on failure.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) *requestError {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return &requestError{
+			status:  http.StatusUnsupportedMediaType,
+			message: "Content-Type muss application/json sein",
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		var maxBytesErr *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxErr):
+			return &requestError{
+				status:  http.StatusBadRequest,
+				message: fmt.Sprintf("Ungültiges JSON (Position %d)", syntaxErr.Offset),
+			}
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return &requestError{status: http.StatusBadRequest, message: "Ungültiges JSON (unvollständig)"}
+		case errors.As(err, &typeErr):
+			return &requestError{
+				status:  http.StatusBadRequest,
+				message: fmt.Sprintf("Ungültiger Wert für Feld %q (erwartet: %s)", typeErr.Field, typeErr.Type),
+			}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return &requestError{status: http.StatusBadRequest, message: fmt.Sprintf("Unbekanntes Feld %s", field)}
+		case errors.Is(err, io.EOF):
+			return &requestError{status: http.StatusBadRequest, message: "Anfrage ist leer"}
+		case errors.As(err, &maxBytesErr):
+			return &requestError{
+				status:  http.StatusRequestEntityTooLarge,
+				message: fmt.Sprintf("Anfrage ist zu groß (max. %d KB)", maxBytes>>10),
+			}
+		default:
+			return &requestError{status: http.StatusBadRequest, message: "Ungültige Anfrage"}
+		}
+	}
+
+	// Only a single JSON object is allowed
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return &requestError{status: http.StatusBadRequest, message: "Anfrage darf nur ein JSON-Objekt enthalten"}
+	}
+
+	return nil
+}
+
+// writeJSONStatus writes v as JSON with the given status code
+func writeJSONStatus(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
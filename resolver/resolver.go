@@ -0,0 +1,244 @@
+// Package resolver recognizes YouTube URLs and normalizes their many shapes
+// (youtu.be, shorts, live, embed, nocookie, music, attribution links, clips) into
+// https://www.youtube.com/watch?v=ID, following HTTP redirects only when needed.
+// It has no dependencies on the server so it can be tested and fuzzed on its own.
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	videoIDPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	clipPathPattern = regexp.MustCompile(`^/clip/([A-Za-z0-9_-]+)/?$`)
+
+	// Client follows redirects for Resolve; it never follows them on its own
+	Client = &http.Client{
+		Timeout: 15 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+// youtubeHosts are the accepted domains; subdomains (m., music., www.) are accepted too
+var youtubeHosts = []string{
+	"youtube.com",
+	"youtu.be",
+	"youtube-nocookie.com",
+}
+
+// normalizedHost returns the lowercase host without port and "www." prefix
+func normalizedHost(parsed *url.URL) string {
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+func isHost(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// IsYouTubeURL validates that the URL is from YouTube (including all variants and mobile)
+func IsYouTubeURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := normalizedHost(parsed)
+	for _, domain := range youtubeHosts {
+		if isHost(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanonicalClip returns the canonical form of a clip URL
+func CanonicalClip(parsed *url.URL) (string, bool) {
+	match := clipPathPattern.FindStringSubmatch(parsed.Path)
+	if match == nil {
+		return "", false
+	}
+	return "https://www.youtube.com/clip/" + match[1], true
+}
+
+// IsClipURL reports whether the URL points to a YouTube clip
+func IsClipURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !IsYouTubeURL(rawURL) {
+		return false
+	}
+	_, ok := CanonicalClip(parsed)
+	return ok
+}
+
+// VideoID returns the v parameter of a canonical watch URL
+func VideoID(watchURL string) string {
+	parsed, err := url.Parse(watchURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Query().Get("v")
+}
+
+// watchURL builds the canonical watch URL; t is kept if set
+func watchURL(id, t string) (string, bool) {
+	if !videoIDPattern.MatchString(id) {
+		return "", false
+	}
+	q := url.Values{}
+	q.Set("v", id)
+	if t != "" {
+		q.Set("t", t)
+	}
+	return (&url.URL{
+		Scheme:   "https",
+		Host:     "www.youtube.com",
+		Path:     "/watch",
+		RawQuery: q.Encode(),
+	}).String(), true
+}
+
+// Canonical normalizes many YouTube URL shapes into https://www.youtube.com/watch?v=ID
+// without network access. Only v and optionally t (timestamp) are kept; clips keep
+// their own canonical URL because they are resolved to video + range when downloading.
+func Canonical(raw string) (string, bool) {
+	return canonical(raw, true)
+}
+
+// canonical does the work of Canonical; attribution links may nest only once
+func canonical(raw string, followAttribution bool) (string, bool) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", false
+	}
+
+	host := normalizedHost(parsed)
+	query := parsed.Query()
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+
+	// youtu.be/ID
+	if isHost(host, "youtu.be") {
+		if len(parts) != 1 {
+			return "", false
+		}
+		return watchURL(parts[0], query.Get("t"))
+	}
+
+	if !isHost(host, "youtube.com") && !isHost(host, "youtube-nocookie.com") {
+		return "", false
+	}
+
+	if clip, ok := CanonicalClip(parsed); ok {
+		return clip, true
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "watch":
+		return watchURL(query.Get("v"), query.Get("t"))
+
+	// shorts/live → watch
+	case len(parts) == 2 && (parts[0] == "shorts" || parts[0] == "live"):
+		return watchURL(parts[1], query.Get("t"))
+
+	// embed uses start=seconds; map to t
+	case len(parts) == 2 && parts[0] == "embed":
+		t := query.Get("start")
+		if t != "" {
+			t += "s"
+		}
+		return watchURL(parts[1], t)
+
+	// Shared links: /attribution_link?u=/watch%3Fv%3DID%26feature%3Dshare
+	case len(parts) == 1 && parts[0] == "attribution_link" && followAttribution:
+		target := query.Get("u")
+		if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+			return "", false
+		}
+		return canonical("https://www.youtube.com"+target, false)
+	}
+
+	return "", false
+}
+
+// FollowRedirects follows HTTP redirects manually (HEAD first, then GET fallback)
+// and returns the final URL after up to maxHops hops. It stops early at a URL that
+// Canonical understands, so YouTube itself is never asked.
+func FollowRedirects(start string, maxHops int) (string, error) {
+	u := start
+	for i := 0; i < maxHops; i++ {
+		if _, ok := Canonical(u); ok && i > 0 {
+			return u, nil
+		}
+
+		req, err := http.NewRequest(http.MethodHead, u, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("User-Agent", "yt-url-resolver/1.0 (+https://example.local)")
+
+		resp, err := Client.Do(req)
+		if err != nil {
+			// Some servers don't like HEAD; try GET
+			req.Method = http.MethodGet
+			resp, err = Client.Do(req)
+			if err != nil {
+				return "", err
+			}
+		}
+		resp.Body.Close()
+
+		// 3xx → follow Location
+		if resp.StatusCode/100 == 3 {
+			loc := resp.Header.Get("Location")
+			if loc == "" {
+				return "", errors.New("redirect without Location header")
+			}
+			// Resolve relative locations
+			next, err := url.Parse(loc)
+			if err != nil {
+				return "", err
+			}
+			base, _ := url.Parse(u)
+			u = base.ResolveReference(next).String()
+			continue
+		}
+
+		// Non-redirect → done
+		return u, nil
+	}
+	return "", fmt.Errorf("too many redirects (>%d)", maxHops)
+}
+
+// Resolve combines canonicalization and HTTP redirect resolution. It returns the
+// resolved URL and whether a redirect was followed and the result is canonical.
+func Resolve(input string) (string, bool, bool, error) {
+	// First: try canonicalize without network (works for youtu.be, shorts, etc.)
+	if canon, ok := Canonical(input); ok {
+		return canon, false, true, nil
+	}
+
+	// Otherwise: resolve HTTP redirects, then try canonicalize again.
+	final, err := FollowRedirects(input, 10)
+	if err != nil {
+		// if redirect resolving failed, still return what we have
+		return input, false, false, err
+	}
+
+	wasRedirect := final != input
+
+	if canon, ok := Canonical(final); ok {
+		return canon, wasRedirect, true, nil
+	}
+
+	// Fallback: return the final resolved URL
+	return final, wasRedirect, false, nil
+}
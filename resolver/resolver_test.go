@@ -0,0 +1,265 @@
+package resolver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// canonicalCases maps input URLs to their canonical form; "" means not canonicalizable.
+// The cases also seed the fuzz corpus.
+var canonicalCases = []struct {
+	name, in, want string
+}{
+	// Watch URLs
+	{"watch", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch without www", "https://youtube.com/watch?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch http", "http://www.youtube.com/watch?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch uppercase host", "https://WWW.YouTube.COM/watch?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch with port", "https://www.youtube.com:443/watch?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch trailing slash", "https://www.youtube.com/watch/?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch playlist", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123&index=4", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch tracking", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&feature=share&si=abc", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch timestamp", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42s", "https://www.youtube.com/watch?t=42s&v=dQw4w9WgXcQ"},
+	{"watch fragment", "https://www.youtube.com/watch?v=dQw4w9WgXcQ#comments", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"mobile", "https://m.youtube.com/watch?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"music", "https://music.youtube.com/watch?v=dQw4w9WgXcQ&feature=share", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"watch without id", "https://www.youtube.com/watch", ""},
+	{"watch empty id", "https://www.youtube.com/watch?v=", ""},
+	{"watch invalid id", "https://www.youtube.com/watch?v=abc%2Fdef", ""},
+	{"watch prefix path", "https://www.youtube.com/watch_videos?video_ids=dQw4w9WgXcQ", ""},
+
+	// Short links
+	{"youtu.be", "https://youtu.be/dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"youtu.be www", "https://www.youtu.be/dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"youtu.be share id", "https://youtu.be/dQw4w9WgXcQ?si=xyz", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"youtu.be timestamp", "https://youtu.be/dQw4w9WgXcQ?t=90", "https://www.youtube.com/watch?t=90&v=dQw4w9WgXcQ"},
+	{"youtu.be trailing slash", "https://youtu.be/dQw4w9WgXcQ/", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"youtu.be empty", "https://youtu.be/", ""},
+	{"youtu.be nested path", "https://youtu.be/dQw4w9WgXcQ/extra", ""},
+
+	// Shorts, live, embed
+	{"shorts", "https://www.youtube.com/shorts/abcDEF12345", "https://www.youtube.com/watch?v=abcDEF12345"},
+	{"shorts share", "https://youtube.com/shorts/abcDEF12345?feature=share", "https://www.youtube.com/watch?v=abcDEF12345"},
+	{"shorts empty", "https://www.youtube.com/shorts/", ""},
+	{"live", "https://www.youtube.com/live/abcDEF12345?si=x", "https://www.youtube.com/watch?v=abcDEF12345"},
+	{"live timestamp", "https://www.youtube.com/live/abcDEF12345?t=3600", "https://www.youtube.com/watch?t=3600&v=abcDEF12345"},
+	{"channel live page", "https://www.youtube.com/@channel/live", ""},
+	{"embed", "https://www.youtube.com/embed/dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"embed start", "https://www.youtube.com/embed/dQw4w9WgXcQ?start=30&autoplay=1", "https://www.youtube.com/watch?t=30s&v=dQw4w9WgXcQ"},
+	{"embed empty", "https://www.youtube.com/embed/", ""},
+	{"nocookie embed", "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+
+	// Attribution links
+	{"attribution", "https://www.youtube.com/attribution_link?a=x&u=%2Fwatch%3Fv%3DdQw4w9WgXcQ%26feature%3Dshare", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"attribution shorts", "https://youtube.com/attribution_link?u=/shorts/abcDEF12345", "https://www.youtube.com/watch?v=abcDEF12345"},
+	{"attribution absolute", "https://www.youtube.com/attribution_link?u=https://evil.example/watch%3Fv%3DdQw4w9WgXcQ", ""},
+	{"attribution protocol relative", "https://www.youtube.com/attribution_link?u=//evil.example/watch%3Fv%3DdQw4w9WgXcQ", ""},
+	{"attribution nested", "https://www.youtube.com/attribution_link?u=/attribution_link%3Fu%3D/watch%253Fv%253DdQw4w9WgXcQ", ""},
+	{"attribution missing", "https://www.youtube.com/attribution_link", ""},
+
+	// Clips keep their own URL
+	{"clip", "https://www.youtube.com/clip/UgkxAbCdEf?si=x", "https://www.youtube.com/clip/UgkxAbCdEf"},
+	{"clip trailing slash", "https://youtube.com/clip/UgkxAbCdEf/", "https://www.youtube.com/clip/UgkxAbCdEf"},
+
+	// Foreign hosts and malformed input
+	{"lookalike host", "https://notyoutube.com/watch?v=dQw4w9WgXcQ", ""},
+	{"lookalike suffix", "https://youtube.com.evil.example/watch?v=dQw4w9WgXcQ", ""},
+	{"lookalike short", "https://notyoutu.be/dQw4w9WgXcQ", ""},
+	{"userinfo trick", "https://youtube.com@evil.example/watch?v=dQw4w9WgXcQ", ""},
+	{"no scheme", "youtube.com/watch?v=dQw4w9WgXcQ", ""},
+	{"other scheme", "javascript://youtube.com/watch?v=dQw4w9WgXcQ", ""},
+	{"channel", "https://www.youtube.com/@channel", ""},
+	{"playlist", "https://www.youtube.com/playlist?list=PL123", ""},
+	{"empty", "", ""},
+	{"garbage", "%%%", ""},
+	{"control characters", "https://youtu.be/\x00", ""},
+}
+
+func TestCanonical(t *testing.T) {
+	for _, tc := range canonicalCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := Canonical(tc.in)
+			if ok != (tc.want != "") || got != tc.want {
+				t.Errorf("Canonical(%q) = %q, %v; want %q", tc.in, got, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsYouTubeURL(t *testing.T) {
+	cases := map[string]bool{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":  true,
+		"https://m.youtube.com/watch?v=dQw4w9WgXcQ":    true,
+		"https://music.youtube.com/watch?v=x":          true,
+		"https://youtu.be/dQw4w9WgXcQ":                 true,
+		"https://www.youtube-nocookie.com/embed/x":     true,
+		"https://YOUTUBE.com/":                         true,
+		"https://youtube.com:8443/watch?v=x":           true,
+		"https://notyoutube.com/watch?v=x":             false,
+		"https://youtube.com.evil.example/":            false,
+		"https://youtube.com@evil.example/watch?v=x":   false,
+		"https://evil.example/?u=https://youtube.com/": false,
+		"youtube.com/watch?v=x":                        false,
+		"":                                             false,
+		"%%%":                                          false,
+	}
+	for in, want := range cases {
+		if got := IsYouTubeURL(in); got != want {
+			t.Errorf("IsYouTubeURL(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestIsClipURL(t *testing.T) {
+	if !IsClipURL("https://www.youtube.com/clip/UgkxAbCdEf") {
+		t.Error("clip URL not recognized")
+	}
+	if IsClipURL("https://evil.example/clip/UgkxAbCdEf") {
+		t.Error("clip on a foreign host recognized")
+	}
+	if IsClipURL("https://www.youtube.com/watch?v=dQw4w9WgXcQ") {
+		t.Error("watch URL recognized as clip")
+	}
+}
+
+func TestVideoID(t *testing.T) {
+	cases := map[string]string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":       "dQw4w9WgXcQ",
+		"https://www.youtube.com/watch?t=42s&v=dQw4w9WgXcQ": "dQw4w9WgXcQ",
+		"https://www.youtube.com/clip/UgkxAbCdEf":           "",
+		"%%%": "",
+	}
+	for in, want := range cases {
+		if got := VideoID(in); got != want {
+			t.Errorf("VideoID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// redirectServer answers /hop/N with a redirect to /hop/N-1 and /hop/0 with a
+// redirect to target; other paths are served with 200
+func redirectServer(t *testing.T, target string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/hop/0":
+			http.Redirect(w, r, target, http.StatusFound)
+		case strings.HasPrefix(r.URL.Path, "/hop/"):
+			var n int
+			for _, c := range strings.TrimPrefix(r.URL.Path, "/hop/") {
+				n = n*10 + int(c-'0')
+			}
+			http.Redirect(w, r, "/hop/"+string(rune('0'+n-1)), http.StatusMovedPermanently)
+		case r.URL.Path == "/no-location":
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == "/no-head" && r.Method == http.MethodHead:
+			panic(http.ErrAbortHandler) // Drops the connection
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolve(t *testing.T) {
+	server := redirectServer(t, "https://youtu.be/dQw4w9WgXcQ?si=share")
+
+	// Canonical input never touches the network
+	got, redirected, canonical, err := Resolve("https://youtu.be/dQw4w9WgXcQ")
+	if err != nil || redirected || !canonical || got != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("Resolve(short link) = %q, %v, %v, %v", got, redirected, canonical, err)
+	}
+
+	// Short link services redirect to YouTube
+	got, redirected, canonical, err = Resolve(server.URL + "/hop/3")
+	if err != nil || !redirected || !canonical || got != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("Resolve(redirect chain) = %q, %v, %v, %v", got, redirected, canonical, err)
+	}
+
+	// A page that does not redirect is returned unchanged and not canonical
+	got, redirected, canonical, err = Resolve(server.URL + "/page")
+	if err != nil || redirected || canonical || got != server.URL+"/page" {
+		t.Errorf("Resolve(plain page) = %q, %v, %v, %v", got, redirected, canonical, err)
+	}
+
+	// Errors keep the input
+	got, _, canonical, err = Resolve(server.URL + "/no-location")
+	if err == nil || canonical || got != server.URL+"/no-location" {
+		t.Errorf("Resolve(redirect without Location) = %q, %v, %v", got, canonical, err)
+	}
+}
+
+func TestFollowRedirects(t *testing.T) {
+	server := redirectServer(t, "/final")
+
+	if got, err := FollowRedirects(server.URL+"/hop/2", 10); err != nil || got != server.URL+"/final" {
+		t.Errorf("relative redirect chain = %q, %v", got, err)
+	}
+	if _, err := FollowRedirects(server.URL+"/hop/9", 5); err == nil {
+		t.Error("redirect chain longer than maxHops accepted")
+	}
+	if got, err := FollowRedirects(server.URL+"/no-head", 10); err != nil || got != server.URL+"/no-head" {
+		t.Errorf("GET fallback = %q, %v", got, err)
+	}
+	if _, err := FollowRedirects("http://[::1", 10); err == nil {
+		t.Error("malformed URL accepted")
+	}
+}
+
+// FuzzCanonical checks the invariants every canonical URL must satisfy:
+// it is a https://www.youtube.com watch or clip URL with a plain video ID, it is
+// stable under canonicalization, and only YouTube input is ever canonicalized.
+// Run with: go test ./resolver -run='^$' -fuzz=FuzzCanonical
+func FuzzCanonical(f *testing.F) {
+	for _, tc := range canonicalCases {
+		f.Add(tc.in)
+	}
+
+	f.Fuzz(func(t *testing.T, in string) {
+		got, ok := Canonical(in)
+		if !ok {
+			if got != "" {
+				t.Fatalf("Canonical(%q) failed but returned %q", in, got)
+			}
+			return
+		}
+
+		if !IsYouTubeURL(in) {
+			t.Fatalf("Canonical(%q) = %q for a foreign host", in, got)
+		}
+		parsed, err := url.Parse(got)
+		if err != nil {
+			t.Fatalf("Canonical(%q) = %q does not parse: %v", in, got, err)
+		}
+		if parsed.Scheme != "https" || parsed.Host != "www.youtube.com" || parsed.User != nil || parsed.Fragment != "" {
+			t.Fatalf("Canonical(%q) = %q is not a https://www.youtube.com URL", in, got)
+		}
+
+		switch {
+		case parsed.Path == "/watch":
+			if !videoIDPattern.MatchString(VideoID(got)) {
+				t.Fatalf("Canonical(%q) = %q has an invalid video ID", in, got)
+			}
+			for key := range parsed.Query() {
+				if key != "v" && key != "t" {
+					t.Fatalf("Canonical(%q) = %q keeps parameter %q", in, got, key)
+				}
+			}
+		case IsClipURL(got):
+			if parsed.RawQuery != "" {
+				t.Fatalf("Canonical(%q) = %q keeps a query", in, got)
+			}
+		default:
+			t.Fatalf("Canonical(%q) = %q is neither a watch nor a clip URL", in, got)
+		}
+
+		again, ok := Canonical(got)
+		if !ok || again != got {
+			t.Fatalf("Canonical is not idempotent: %q -> %q -> %q (%v)", in, got, again, ok)
+		}
+	})
+}
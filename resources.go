@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Every job records what it cost the server, so operators can attribute load to
+// users and collections: CPU time and peak memory of yt-dlp (including the ffmpeg it
+// runs), local conversions and transcriptions, the bytes yt-dlp fetched and the bytes
+// sent to clients via download links, previews and shares. /jobs/{id} shows a job's
+// usage, /stats the totals since the server started.
+type JobResources struct {
+	CPUSeconds      float64 `json:"cpuSeconds"`      // User and system time of the job's processes
+	PeakRSSBytes    int64   `json:"peakRssBytes"`    // Largest resident set of one of its processes
+	DownloadedBytes int64   `json:"downloadedBytes"` // Fetched from YouTube, from yt-dlp's download summaries
+	ServedBytes     int64   `json:"servedBytes"`     // Sent to clients
+}
+
+// ResourceStats are the totals of all finished jobs and their grouping
+type ResourceStats struct {
+	Total         JobResources            `json:"total"`
+	ByUser        map[string]JobResources `json:"byUser"`
+	ByCollection  map[string]JobResources `json:"byCollection"`
+	JobsAccounted int                     `json:"jobsAccounted"`
+}
+
+// anonymousResourceUser groups jobs started without an authenticated user or API key.
+// Client addresses are never used as keys, as /stats is public.
+const anonymousResourceUser = "anonymous"
+
+var (
+	resourceTotals = ResourceStats{
+		ByUser:       make(map[string]JobResources),
+		ByCollection: make(map[string]JobResources),
+	}
+	resourceTotalsMutex sync.Mutex
+)
+
+func (r *JobResources) add(delta JobResources) {
+	r.CPUSeconds += delta.CPUSeconds
+	r.PeakRSSBytes = max(r.PeakRSSBytes, delta.PeakRSSBytes)
+	r.DownloadedBytes += delta.DownloadedBytes
+	r.ServedBytes += delta.ServedBytes
+}
+
+// processResources returns the usage of a finished process and the children it waited for
+func processResources(state *os.ProcessState) JobResources {
+	if state == nil {
+		return JobResources{}
+	}
+	return JobResources{
+		CPUSeconds:   (state.UserTime() + state.SystemTime()).Seconds(),
+		PeakRSSBytes: peakRSS(state),
+	}
+}
+
+// addJobResources adds usage to a job. Usage after the job finished, i.e. served
+// bytes, goes straight into the totals; the rest is added when the job finishes.
+func addJobResources(sessionID string, delta JobResources) {
+	var job Job
+	found := false
+	updateJob(sessionID, func(current *Job) {
+		// Replaced rather than changed, as snapshots of the job share the pointer
+		resources := JobResources{}
+		if current.Resources != nil {
+			resources = *current.Resources
+		}
+		resources.add(delta)
+		current.Resources = &resources
+		job, found = *current, true
+	})
+	if found && !job.isActive() {
+		addResourceTotals(job, delta, false)
+	}
+}
+
+// recordProcessResources adds the usage of a finished process to a job
+func recordProcessResources(sessionID string, state *os.ProcessState) {
+	if resources := processResources(state); resources.CPUSeconds > 0 || resources.PeakRSSBytes > 0 {
+		addJobResources(sessionID, resources)
+	}
+}
+
+// recordDownloadedLine counts the size of a yt-dlp download summary line
+func recordDownloadedLine(sessionID, line string) {
+	match := speedPattern.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	if size, ok := parseYtDlpSize(match[1]); ok && size > 0 {
+		addJobResources(sessionID, JobResources{DownloadedBytes: int64(size)})
+	}
+}
+
+// recordServedFile counts bytes sent of a file in the downloads directory
+func recordServedFile(path string, written int64) {
+	if written <= 0 {
+		return
+	}
+	relPath, err := filepath.Rel(downloadsDir, path)
+	if err != nil {
+		return
+	}
+	if job, ok := findJobByFilename(filepath.ToSlash(relPath)); ok {
+		addJobResources(job.SessionID, JobResources{ServedBytes: written})
+	}
+}
+
+// recordResourcesEvent adds the usage of a finished job to the totals
+func recordResourcesEvent(event LifecycleEvent) {
+	if event.Job.Resources != nil {
+		addResourceTotals(event.Job, *event.Job.Resources, true)
+	}
+}
+
+func addResourceTotals(job Job, delta JobResources, finished bool) {
+	user := anonymousResourceUser
+	if strings.HasPrefix(job.Owner, "user:") || strings.HasPrefix(job.Owner, "key:") {
+		user = job.Owner
+	}
+
+	resourceTotalsMutex.Lock()
+	defer resourceTotalsMutex.Unlock()
+
+	resourceTotals.Total.add(delta)
+	byUser := resourceTotals.ByUser[user]
+	byUser.add(delta)
+	resourceTotals.ByUser[user] = byUser
+	if job.Collection != "" {
+		byCollection := resourceTotals.ByCollection[job.Collection]
+		byCollection.add(delta)
+		resourceTotals.ByCollection[job.Collection] = byCollection
+	}
+	if finished {
+		resourceTotals.JobsAccounted++
+	}
+}
+
+// snapshotResourceStats returns a copy of the totals
+func snapshotResourceStats() ResourceStats {
+	resourceTotalsMutex.Lock()
+	defer resourceTotalsMutex.Unlock()
+
+	snapshot := ResourceStats{
+		Total:         resourceTotals.Total,
+		ByUser:        make(map[string]JobResources, len(resourceTotals.ByUser)),
+		ByCollection:  make(map[string]JobResources, len(resourceTotals.ByCollection)),
+		JobsAccounted: resourceTotals.JobsAccounted,
+	}
+	for user, resources := range resourceTotals.ByUser {
+		snapshot.ByUser[user] = resources
+	}
+	for collection, resources := range resourceTotals.ByCollection {
+		snapshot.ByCollection[collection] = resources
+	}
+	return snapshot
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Router is a small replacement for http.ServeMux with path parameters, method
+// matching, route groups and a middleware chain.
+//
+// Patterns are "[METHOD ]/path" where a segment can be a literal, a parameter like
+// {id} (exactly one non-empty segment) or a trailing * (the rest of the path).
+// Without a method the route matches every method; GET routes also answer HEAD.
+// When several routes match, routes without * win, then the one with more literal
+// segments. Like http.ServeMux, requests for unclean paths such as "//jobs" or
+// "/a/./b" are redirected to the cleaned path first.
+type Router struct {
+	routes     *[]route
+	prefix     string
+	middleware []Middleware // Group middleware, applied when a route is added
+	global     []Middleware // Router middleware, applied to every request incl. 404s
+}
+
+// Middleware wraps a handler, e.g. for logging or authentication
+type Middleware func(http.Handler) http.Handler
+
+type route struct {
+	method   string
+	segments []string
+	wildcard bool
+	literals int
+	handler  http.Handler
+}
+
+type routeParamsKey struct{}
+
+// NewRouter creates an empty router
+func NewRouter() *Router {
+	return &Router{routes: &[]route{}}
+}
+
+// Use adds middleware that runs for every request, in the order given
+func (rt *Router) Use(middleware ...Middleware) {
+	rt.global = append(rt.global, middleware...)
+}
+
+// Group returns a router for routes below prefix that additionally run middleware
+func (rt *Router) Group(prefix string, middleware ...Middleware) *Router {
+	return &Router{
+		routes:     rt.routes,
+		prefix:     rt.prefix + strings.TrimSuffix(prefix, "/"),
+		middleware: append(append([]Middleware(nil), rt.middleware...), middleware...),
+	}
+}
+
+// Handle registers a handler for a pattern like "GET /jobs/{id}"
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+
+	r := route{method: method, handler: chain(handler, rt.middleware)}
+	for _, segment := range splitPath(rt.prefix + path) {
+		switch {
+		case segment == "*":
+			r.wildcard = true
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"):
+			r.segments = append(r.segments, segment)
+		default:
+			r.segments = append(r.segments, segment)
+			r.literals++
+		}
+	}
+	*rt.routes = append(*rt.routes, r)
+}
+
+// HandleFunc registers a handler function for a pattern
+func (rt *Router) HandleFunc(pattern string, handler http.HandlerFunc) {
+	rt.Handle(pattern, handler)
+}
+
+// ServeHTTP dispatches the request to the best matching route
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	chain(http.HandlerFunc(rt.dispatch), rt.global).ServeHTTP(w, r)
+}
+
+func (rt *Router) dispatch(w http.ResponseWriter, r *http.Request) {
+	if cleaned := cleanPath(r.URL.Path); cleaned != r.URL.Path {
+		target := *r.URL
+		target.Path = cleaned
+		target.RawPath = ""
+		// 308 keeps method and body of non-GET requests
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, target.RequestURI(), status)
+		return
+	}
+	segments := splitPath(r.URL.Path)
+
+	var candidates []route
+	var params []map[string]string
+	for _, candidate := range *rt.routes {
+		if values, ok := candidate.match(segments); ok {
+			candidates = append(candidates, candidate)
+			params = append(params, values)
+		}
+	}
+	if len(candidates) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := candidates[order[i]], candidates[order[j]]
+		if a.wildcard != b.wildcard {
+			return !a.wildcard
+		}
+		return a.literals > b.literals
+	})
+
+	var allowed []string
+	for _, i := range order {
+		candidate := candidates[i]
+		if candidate.allows(r.Method) {
+			ctx := context.WithValue(r.Context(), routeParamsKey{}, params[i])
+			candidate.handler.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		allowed = append(allowed, candidate.method)
+	}
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+func (r route) allows(method string) bool {
+	return r.method == "" || r.method == method || (r.method == http.MethodGet && method == http.MethodHead)
+}
+
+// match compares the request path with the route and returns the path parameters
+func (r route) match(segments []string) (map[string]string, bool) {
+	if len(segments) < len(r.segments) || (!r.wildcard && len(segments) != len(r.segments)) {
+		return nil, false
+	}
+
+	values := make(map[string]string)
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			values[segment[1:len(segment)-1]] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// cleanPath resolves "." and ".." and removes duplicate slashes; a trailing slash is kept
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// splitPath splits "/jobs/123/cast" into its segments; "/" has none
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// chain wraps handler so that the first middleware runs first
+func chain(handler http.Handler, middleware []Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// pathParam returns a path parameter of the matched route, e.g. pathParam(r, "id")
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(routeParamsKey{}).(map[string]string)
+	return params[name]
+}
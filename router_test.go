@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestRouter registers routes that answer with their own pattern and parameters
+func newTestRouter() *Router {
+	router := NewRouter()
+	for _, pattern := range []string{
+		"GET /jobs",
+		"GET /jobs/{id}",
+		"DELETE /jobs/{id}",
+		"GET /jobs/active",
+		"POST /jobs/{id}/steps/{step}/retry",
+		"/download-file/*",
+		"GET /download-file/special",
+		"/*",
+	} {
+		pattern := pattern
+		router.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(pattern + "|" + pathParam(r, "id") + "|" + pathParam(r, "step")))
+		})
+	}
+
+	admin := router.Group("/admin/", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Group", "admin")
+			next.ServeHTTP(w, r)
+		})
+	})
+	admin.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("GET /admin/stats||"))
+	})
+	return router
+}
+
+func TestRouterMatching(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/jobs", 200, "GET /jobs||"},
+		{"GET", "/jobs/42", 200, "GET /jobs/{id}|42|"},
+		{"DELETE", "/jobs/42", 200, "DELETE /jobs/{id}|42|"},
+		// Literal segments beat parameters
+		{"GET", "/jobs/active", 200, "GET /jobs/active||"},
+		{"POST", "/jobs/42/steps/transfer/retry", 200, "POST /jobs/{id}/steps/{step}/retry|42|transfer"},
+		// A parameter is exactly one non-empty segment
+		{"GET", "/jobs/", 200, "/*||"},
+		{"GET", "/jobs/42/extra", 200, "/*||"},
+		// Routes without * beat wildcard routes
+		{"GET", "/download-file/special", 200, "GET /download-file/special||"},
+		{"GET", "/download-file/a/b.mp3", 200, "/download-file/*||"},
+		{"POST", "/download-file/special", 200, "/download-file/*||"},
+		// GET routes answer HEAD
+		{"HEAD", "/jobs/42", 200, "GET /jobs/{id}|42|"},
+		// A method mismatch falls back to a route without method
+		{"PUT", "/jobs/42", 200, "/*||"},
+		{"GET", "/admin/stats", 200, "GET /admin/stats||"},
+		{"GET", "/admin/other", 200, "/*||"},
+	}
+
+	router := newTestRouter()
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("DELETE /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("PUT", "/jobs/42", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, DELETE" {
+		t.Errorf("PUT /jobs/42 = %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/other", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /other = %d, want 404", rec.Code)
+	}
+}
+
+func TestRouterGroupMiddleware(t *testing.T) {
+	router := newTestRouter()
+	for path, group := range map[string]string{"/admin/stats": "admin", "/jobs": ""} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := rec.Header().Get("X-Group"); got != group {
+			t.Errorf("GET %s ran group middleware %q, want %q", path, got, group)
+		}
+	}
+}
+
+func TestRouterCleansPath(t *testing.T) {
+	tests := []struct {
+		method   string
+		target   string
+		status   int
+		location string
+	}{
+		{"GET", "//jobs", 301, "/jobs"},
+		{"GET", "/jobs/./42", 301, "/jobs/42"},
+		{"GET", "/admin/../jobs/42?token=x", 301, "/jobs/42?token=x"},
+		{"GET", "/download-file//a.mp3", 301, "/download-file/a.mp3"},
+		{"DELETE", "/jobs//42", 308, "/jobs/42"},
+		// A trailing slash is kept
+		{"GET", "/download-file/a/./", 301, "/download-file/a/"},
+		{"GET", "/jobs/42", 200, ""},
+	}
+
+	router := newTestRouter()
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		req.URL.Path, req.URL.RawQuery, _ = strings.Cut(tt.target, "?")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.status || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.target, rec.Code, rec.Header().Get("Location"), tt.status, tt.location)
+		}
+	}
+}
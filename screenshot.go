@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"ytdownloader/resolver"
+)
+
+const (
+	screenshotTimeout   = 60 * time.Second
+	screenshotMaxBytes  = 20 << 20 // A 4K PNG frame stays well below this
+	screenshotSelector  = "bestvideo[vcodec!=none]/best[vcodec!=none]"
+	screenshotUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+// screenshotEncoders maps the requested image format to ffmpeg codec args and content type
+var screenshotEncoders = map[string]struct {
+	args        []string
+	contentType string
+}{
+	"png":  {[]string{"-c:v", "png"}, "image/png"},
+	"jpeg": {[]string{"-c:v", "mjpeg", "-q:v", "2"}, "image/jpeg"},
+}
+
+// parseTimestamp accepts seconds ("95", "95.5") or clock time ("1:35", "1:01:35")
+func parseTimestamp(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("empty timestamp")
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	seconds := 0.0
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+// handleScreenshot extracts a single frame: GET /screenshot?url=...&t=1:23&format=png|jpeg
+// ffmpeg seeks in the direct stream URL, so only the data around the frame is fetched.
+func handleScreenshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	if !resolver.IsYouTubeURL(params.Get("url")) {
+		http.Error(w, "Nur YouTube URLs sind erlaubt", http.StatusBadRequest)
+		return
+	}
+	cleanedURL, err := cleanURL(params.Get("url"))
+	if err != nil {
+		http.Error(w, "Ungültige URL", http.StatusBadRequest)
+		return
+	}
+	if entry, blocked := blockedURL(params.Get("url"), cleanedURL); blocked {
+		writeBlocked(w, r, cleanedURL, entry)
+		return
+	}
+
+	position := 0.0
+	if t := params.Get("t"); t != "" {
+		if position, err = parseTimestamp(t); err != nil {
+			http.Error(w, "Ungültiger Zeitpunkt, erwartet Sekunden oder mm:ss", http.StatusBadRequest)
+			return
+		}
+	}
+
+	format := strings.ToLower(params.Get("format"))
+	switch format {
+	case "":
+		format = "png"
+	case "jpg":
+		format = "jpeg"
+	}
+	encoder, ok := screenshotEncoders[format]
+	if !ok {
+		http.Error(w, "Ungültiges Bildformat, erlaubt sind png und jpeg", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), screenshotTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ytdlpBinary,
+		"--user-agent", screenshotUserAgent,
+		"--no-playlist",
+		"--no-warnings",
+		"-f", screenshotSelector,
+		"-g",
+		cleanedURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		rule := classifyYtDlpError(stderr.String())
+		ytdlpLog.Warn("yt-dlp -g failed", "code", rule.Code, "error", err)
+		message := rule.Message
+		if rule.Hint != "" {
+			message += ". " + rule.Hint
+		}
+		http.Error(w, message, http.StatusBadGateway)
+		return
+	}
+	streamURL := strings.TrimSpace(strings.SplitN(stdout.String(), "\n", 2)[0])
+	if streamURL == "" {
+		http.Error(w, "Kein Videostream gefunden", http.StatusBadGateway)
+		return
+	}
+
+	// -ss before -i seeks via HTTP range requests instead of reading from the start
+	args := []string{
+		"-v", "error",
+		"-user_agent", screenshotUserAgent,
+		"-ss", strconv.FormatFloat(position, 'f', 3, 64),
+		"-i", streamURL,
+		"-frames:v", "1",
+		"-f", "image2pipe",
+	}
+	args = append(args, encoder.args...)
+	args = append(args, "-")
+
+	var image bytes.Buffer
+	stderr.Reset()
+	ffmpeg := exec.CommandContext(ctx, "ffmpeg", args...)
+	ffmpeg.Stdout = &limitedBuffer{buf: &image, limit: screenshotMaxBytes}
+	ffmpeg.Stderr = &stderr
+	if err := ffmpeg.Run(); err != nil || image.Len() == 0 {
+		ytdlpLog.Warn("Screenshot failed", "url", cleanedURL, "position", position, "error", err, "stderr", truncateString(stderr.String(), 500))
+		http.Error(w, "Bild konnte nicht erstellt werden. Liegt der Zeitpunkt innerhalb des Videos?", http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", encoder.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(image.Len()))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(image.Bytes())
+}
+
+// limitedBuffer fails writes once more than limit bytes were written
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("output exceeds %d bytes", b.limit)
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Limits for free-form job tags
+const (
+	maxJobTags      = 20
+	maxJobTagLength = 50
+)
+
+type setTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// normalizeTags lowercases, trims and deduplicates tags
+func normalizeTags(tags []string) ([]string, string) {
+	seen := make(map[string]bool, len(tags))
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxJobTagLength {
+			return nil, "Tags dürfen höchstens 50 Zeichen lang sein"
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxJobTags {
+		return nil, "Höchstens 20 Tags pro Job erlaubt"
+	}
+	return normalized, ""
+}
+
+// handleSetTags replaces the tags of a job: PUT /jobs/{id}/tags
+func handleSetTags(w http.ResponseWriter, r *http.Request, sessionID string) {
+	var body setTagsRequest
+	if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+		return
+	}
+	tags, msg := normalizeTags(body.Tags)
+	if msg != "" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": msg})
+		return
+	}
+	if _, ok := getJob(sessionID); !ok {
+		respondJobAction(w, errJobNotFound)
+		return
+	}
+
+	updateJob(sessionID, func(job *Job) { job.Tags = tags })
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "tags": tags})
+}
+
+// historyQuery are the /history search filters; all given filters must match
+type historyQuery struct {
+	Text       string // Substring of title, URL or filename
+	Tag        string
+	Uploader   string
+	Format     string
+	Collection string
+	Language   string
+}
+
+// matches checks a job in memory like the index checks the stored history
+func (q historyQuery) matches(job Job) bool {
+	text, uploader := jobSearchText(job)
+	if !wordsMatch(text, q.Text) || !wordsMatch(uploader, q.Uploader) {
+		return false
+	}
+	if q.Format != "" && !strings.EqualFold(job.Format, q.Format) {
+		return false
+	}
+	if q.Collection != "" && !strings.EqualFold(job.Collection, q.Collection) {
+		return false
+	}
+	if q.Language != "" && job.Language != normalizeLanguageCode(q.Language) {
+		return false
+	}
+	if q.Tag != "" {
+		tag := strings.ToLower(strings.TrimSpace(q.Tag))
+		for _, t := range job.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// handleHistory searches the job history: GET /history?q=&tag=&uploader=&format=&collection=&language=&from=&to=
+// Trashed jobs and jobs of other clients are excluded. The jobs in memory are scanned, the stored
+// history is searched through the index, see searchindex.go.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	// MeTube clients poll /history without parameters
+	if metubeCompat && len(params) == 0 {
+		handleMeTubeHistory(w, r)
+		return
+	}
+
+	query := historyQuery{
+		Text:       params.Get("q"),
+		Tag:        params.Get("tag"),
+		Uploader:   params.Get("uploader"),
+		Format:     params.Get("format"),
+		Collection: params.Get("collection"),
+		Language:   params.Get("language"),
+	}
+	from, err := parseOptionalHistoryTime(params.Get("from"), false)
+	if err != nil {
+		http.Error(w, "Ungültiges Datum für from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseOptionalHistoryTime(params.Get("to"), true)
+	if err != nil {
+		http.Error(w, "Ungültiges Datum für to", http.StatusBadRequest)
+		return
+	}
+
+	results := []Job{}
+	inMemory := make(map[string]bool)
+	for _, job := range listJobs() {
+		inMemory[job.SessionID] = true
+		if job.DeletedAt == nil && jobVisibleTo(r, job) && inHistoryRange(job, from, to) && query.matches(job) {
+			results = append(results, job)
+		}
+	}
+	for _, job := range searchStoredJobs(query) {
+		if !inMemory[job.SessionID] && jobVisibleTo(r, job) && inHistoryRange(job, from, to) {
+			results = append(results, job)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"jobs":    results,
+	})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The stored history is searched through an inverted index in the job store: each
+// word of title, URL and filename, each word of uploader and channel, and the tags,
+// format, collection and language of a job are keys "<field><term>\x00<session ID>"
+// in the search bucket. A search looks up the jobs of every filter (words by prefix,
+// so "rick" finds "Rick Astley") and only loads the jobs found in all of them. The
+// jobs in memory are scanned instead, since tags set there are saved with the next sync.
+const (
+	searchTermsBucket = "search"
+	searchDocsBucket  = "searchdocs" // Index terms of each job, to remove them again
+)
+
+// Index fields, the prefix of each term
+const (
+	searchFieldWord       = "w:"
+	searchFieldUploader   = "u:"
+	searchFieldTag        = "t:"
+	searchFieldFormat     = "f:"
+	searchFieldCollection = "c:"
+	searchFieldLanguage   = "l:"
+)
+
+// searchWords splits text into lowercase words
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordsMatch reports whether every word of query starts a word of text
+func wordsMatch(text, query string) bool {
+	words := searchWords(text)
+	for _, term := range searchWords(query) {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchTerms returns the index terms of a job
+func searchTerms(job Job) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(field, term string) {
+		if term != "" && !seen[field+term] {
+			seen[field+term] = true
+			terms = append(terms, field+term)
+		}
+	}
+
+	title, uploader := jobSearchText(job)
+	for _, word := range searchWords(title) {
+		add(searchFieldWord, word)
+	}
+	for _, word := range searchWords(uploader) {
+		add(searchFieldUploader, word)
+	}
+	for _, tag := range job.Tags {
+		add(searchFieldTag, tag)
+	}
+	add(searchFieldFormat, strings.ToLower(job.Format))
+	add(searchFieldCollection, strings.ToLower(job.Collection))
+	add(searchFieldLanguage, job.Language)
+	return terms
+}
+
+// jobSearchText returns the text searched by q (title, URL and filename) and by uploader
+func jobSearchText(job Job) (string, string) {
+	text := job.URL + " " + job.Filename
+	var uploader string
+	if job.Metadata != nil {
+		text = job.Metadata.Title + " " + text
+		uploader = job.Metadata.Uploader + " " + job.Metadata.Channel
+	}
+	return text, uploader
+}
+
+// indexStoredJob replaces the index terms of a job; trashed jobs are not searched
+func indexStoredJob(tx *bolt.Tx, job Job) error {
+	if err := unindexStoredJob(tx, job.SessionID); err != nil {
+		return err
+	}
+	if job.DeletedAt != nil {
+		return nil
+	}
+	terms := searchTerms(job)
+	bucket := tx.Bucket([]byte(searchTermsBucket))
+	for _, term := range terms {
+		if err := bucket.Put([]byte(term+"\x00"+job.SessionID), []byte{}); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(terms)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(searchDocsBucket)).Put([]byte(job.SessionID), data)
+}
+
+// unindexStoredJob removes the index terms of a job
+func unindexStoredJob(tx *bolt.Tx, sessionID string) error {
+	docs := tx.Bucket([]byte(searchDocsBucket))
+	data := docs.Get([]byte(sessionID))
+	if data == nil {
+		return nil
+	}
+	var terms []string
+	if err := json.Unmarshal(data, &terms); err != nil {
+		return err
+	}
+	bucket := tx.Bucket([]byte(searchTermsBucket))
+	for _, term := range terms {
+		if err := bucket.Delete([]byte(term + "\x00" + sessionID)); err != nil {
+			return err
+		}
+	}
+	return docs.Delete([]byte(sessionID))
+}
+
+// indexMissingJobs indexes the stored jobs without index terms, e.g. the history
+// written before the index existed
+func indexMissingJobs() {
+	indexed := 0
+	err := jobStore.Update(func(tx *bolt.Tx) error {
+		docs := tx.Bucket([]byte(searchDocsBucket))
+		return tx.Bucket([]byte(jobStoreBucket)).ForEach(func(key, value []byte) error {
+			if docs.Get(key) != nil {
+				return nil
+			}
+			var stored storedJob
+			if json.Unmarshal(value, &stored) != nil {
+				return nil
+			}
+			indexed++
+			return indexStoredJob(tx, stored.job())
+		})
+	})
+	if err != nil {
+		jobStoreLog.Error("Building the search index failed", "error", err)
+		return
+	}
+	if indexed > 0 {
+		jobStoreLog.Info("Indexed history for search", "jobs", indexed)
+	}
+}
+
+// lookupSearchTerm returns the session IDs indexed under a term, or under all terms
+// starting with it
+func lookupSearchTerm(bucket *bolt.Bucket, term string, prefix bool) map[string]bool {
+	seek := []byte(term)
+	if !prefix {
+		seek = append(seek, 0)
+	}
+	found := make(map[string]bool)
+	cursor := bucket.Cursor()
+	for key, _ := cursor.Seek(seek); key != nil && bytes.HasPrefix(key, seek); key, _ = cursor.Next() {
+		if i := bytes.LastIndexByte(key, 0); i >= 0 {
+			found[string(key[i+1:])] = true
+		}
+	}
+	return found
+}
+
+// searchStoredJobs returns the stored jobs matching the filters of a query, without
+// trashed jobs. Owner and date range are checked by the caller.
+func searchStoredJobs(query historyQuery) []Job {
+	if jobStore == nil {
+		return nil
+	}
+	var list []Job
+	jobStore.View(func(tx *bolt.Tx) error {
+		terms := tx.Bucket([]byte(searchTermsBucket))
+		var ids map[string]bool // nil until a filter is applied
+		narrow := func(found map[string]bool) {
+			if ids == nil {
+				ids = found
+				return
+			}
+			for id := range ids {
+				if !found[id] {
+					delete(ids, id)
+				}
+			}
+		}
+		for _, word := range searchWords(query.Text) {
+			narrow(lookupSearchTerm(terms, searchFieldWord+word, true))
+		}
+		for _, word := range searchWords(query.Uploader) {
+			narrow(lookupSearchTerm(terms, searchFieldUploader+word, true))
+		}
+		if query.Tag != "" {
+			narrow(lookupSearchTerm(terms, searchFieldTag+strings.ToLower(strings.TrimSpace(query.Tag)), false))
+		}
+		if query.Format != "" {
+			narrow(lookupSearchTerm(terms, searchFieldFormat+strings.ToLower(query.Format), false))
+		}
+		if query.Collection != "" {
+			narrow(lookupSearchTerm(terms, searchFieldCollection+strings.ToLower(query.Collection), false))
+		}
+		if query.Language != "" {
+			narrow(lookupSearchTerm(terms, searchFieldLanguage+normalizeLanguageCode(query.Language), false))
+		}
+
+		stored := tx.Bucket([]byte(jobStoreBucket))
+		add := func(value []byte) {
+			var job storedJob
+			if json.Unmarshal(value, &job) == nil && job.DeletedAt == nil {
+				full := job.job()
+				full.LogLines = nil // Like listJobs
+				list = append(list, full)
+			}
+		}
+		if ids == nil {
+			return stored.ForEach(func(_, value []byte) error {
+				add(value)
+				return nil
+			})
+		}
+		for id := range ids {
+			if value := stored.Get([]byte(id)); value != nil {
+				add(value)
+			}
+		}
+		return nil
+	})
+	return list
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+)
+
+// Webhooks, API tokens and S3 keys can be kept in an age-encrypted file instead of
+// the environment. SECRETS_KEY (or SECRETS_KEY_FILE, e.g. a Docker secret) holds the
+// master key, an X25519 identity as printed by age-keygen; the file can also be
+// edited with the age CLI. Values in the file win over environment variables and
+// are read on every use, so PUT /admin/secrets/{name} rotates a secret without a
+// restart. Only the names in rotatableSecrets are accepted.
+var (
+	secretsFile     = getEnvDefault("SECRETS_FILE", metadataDir+"/secrets.age")
+	secretsIdentity = loadSecretsIdentity()
+	secretValues    = loadSecrets()
+	secretsMutex    sync.RWMutex
+	secretsLog      = componentLogger("secrets")
+)
+
+// rotatableSecrets are the settings that may live in the secrets file
+var rotatableSecrets = map[string]bool{
+	"SLACK_WEBHOOK_URL":          true,
+	"HOME_ASSISTANT_WEBHOOK_URL": true,
+	"PROGRESS_WEBHOOK_URL":       true,
+	"NOTIFY_WEBHOOK_URL":         true,
+	"S3_ACCESS_KEY_ID":           true,
+	"S3_SECRET_ACCESS_KEY":       true,
+	"ADMIN_TOKEN":                true,
+	"YTDLP_PO_TOKEN":             true,
+	"DISCORD_BOT_TOKEN":          true,
+	"MATRIX_ACCESS_TOKEN":        true,
+	"JELLYFIN_TOKEN":             true,
+	"PLEX_TOKEN":                 true,
+	"ACOUSTID_API_KEY":           true,
+	"SUMMARIZER_TOKEN":           true,
+	"METRICS_TOKEN":              true,
+}
+
+// The rotatable secrets are read through these functions on every use
+func slackWebhookURL() string         { return secret("SLACK_WEBHOOK_URL") }
+func homeAssistantWebhookURL() string { return secret("HOME_ASSISTANT_WEBHOOK_URL") }
+func s3AccessKey() string             { return secret("S3_ACCESS_KEY_ID") }
+func s3SecretKey() string             { return secret("S3_SECRET_ACCESS_KEY") }
+func adminToken() string              { return secret("ADMIN_TOKEN") }
+func poToken() string                 { return secret("YTDLP_PO_TOKEN") }    // e.g. "web.gvs+TOKEN"
+func discordBotToken() string         { return secret("DISCORD_BOT_TOKEN") } // Only needed to register the commands
+func matrixAccessToken() string       { return secret("MATRIX_ACCESS_TOKEN") }
+func jellyfinToken() string           { return secret("JELLYFIN_TOKEN") }
+func plexToken() string               { return secret("PLEX_TOKEN") }
+func acoustIDAPIKey() string          { return secret("ACOUSTID_API_KEY") }
+func summarizerToken() string         { return secret("SUMMARIZER_TOKEN") } // Optional bearer token
+
+var errSecretsDisabled = errors.New("Der Secret-Speicher ist nicht eingerichtet (SECRETS_KEY fehlt)")
+
+// storedSecret is one entry of the encrypted file
+type storedSecret struct {
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SecretInfo describes where a secret comes from, never its value
+type SecretInfo struct {
+	Name      string     `json:"name"`
+	Source    string     `json:"source"` // file, env or unset
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+func loadSecretsIdentity() *age.X25519Identity {
+	key := getenv("SECRETS_KEY")
+	if path := getenv("SECRETS_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			configLog.Warn("Cannot read SECRETS_KEY_FILE", "error", err)
+			return nil
+		}
+		key = string(data)
+	}
+	// Key files from age-keygen contain comment lines
+	for _, line := range strings.Split(key, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		identity, err := age.ParseX25519Identity(line)
+		if err != nil {
+			configLog.Warn("Invalid secrets key, secrets are read from the environment only", "error", err)
+			return nil
+		}
+		return identity
+	}
+	return nil
+}
+
+// loadSecrets decrypts the secrets file; a missing file is an empty store
+func loadSecrets() map[string]storedSecret {
+	values := make(map[string]storedSecret)
+	if secretsIdentity == nil {
+		if _, err := os.Stat(secretsFile); err == nil {
+			configLog.Warn("Secrets file exists but SECRETS_KEY is not set, ignoring it", "path", secretsFile)
+		}
+		return values
+	}
+
+	values, err := readSecretsFile()
+	if err != nil {
+		configLog.Warn("Secrets file not loaded", "error", err)
+		return make(map[string]storedSecret)
+	}
+	if len(values) > 0 {
+		secretsLog.Info("Loaded secrets", "count", len(values), "path", secretsFile)
+	}
+	return values
+}
+
+func readSecretsFile() (map[string]storedSecret, error) {
+	values := make(map[string]storedSecret)
+	file, err := os.Open(secretsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %v", secretsFile, err)
+	}
+	defer file.Close()
+
+	plain, err := age.Decrypt(file, secretsIdentity)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s: %v", secretsFile, err)
+	}
+	data, err := io.ReadAll(plain)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s: %v", secretsFile, err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid secrets in %s: %v", secretsFile, err)
+	}
+	for name := range values {
+		if !rotatableSecrets[name] {
+			configLog.Warn("Ignoring unknown secret", "name", name, "path", secretsFile)
+			delete(values, name)
+		}
+	}
+	return values, nil
+}
+
+// writeSecretsLocked encrypts the values to the master key; secretsMutex must be held
+func writeSecretsLocked(values map[string]storedSecret) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	var sealed bytes.Buffer
+	writer, err := age.Encrypt(&sealed, secretsIdentity.Recipient())
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(secretsFile), 0755); err != nil {
+		return err
+	}
+	tmp := secretsFile + ".tmp"
+	if err := os.WriteFile(tmp, sealed.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, secretsFile)
+}
+
+// secret returns the value from the secrets file, or the environment variable of the same name
+func secret(name string) string {
+	secretsMutex.RLock()
+	stored, ok := secretValues[name]
+	secretsMutex.RUnlock()
+	if ok {
+		return stored.Value
+	}
+	return getenv(name)
+}
+
+// setSecret stores or, with an empty value, removes a secret from the file
+func setSecret(name, value string) error {
+	if secretsIdentity == nil {
+		return errSecretsDisabled
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+
+	values := make(map[string]storedSecret, len(secretValues)+1)
+	for key, stored := range secretValues {
+		values[key] = stored
+	}
+	if value == "" {
+		delete(values, name)
+	} else {
+		values[name] = storedSecret{Value: value, UpdatedAt: time.Now()}
+	}
+	if err := writeSecretsLocked(values); err != nil {
+		return err
+	}
+	secretValues = values
+	return nil
+}
+
+// reloadSecrets rereads the file, e.g. after it was edited with the age CLI
+func reloadSecrets() (int, error) {
+	if secretsIdentity == nil {
+		return 0, errSecretsDisabled
+	}
+	values, err := readSecretsFile()
+	if err != nil {
+		return 0, err
+	}
+	secretsMutex.Lock()
+	secretValues = values
+	secretsMutex.Unlock()
+	return len(values), nil
+}
+
+func listSecrets() []SecretInfo {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+
+	list := make([]SecretInfo, 0, len(rotatableSecrets))
+	for name := range rotatableSecrets {
+		info := SecretInfo{Name: name, Source: "unset"}
+		if stored, ok := secretValues[name]; ok {
+			updatedAt := stored.UpdatedAt
+			info.Source = "file"
+			info.UpdatedAt = &updatedAt
+		} else if getenv(name) != "" {
+			info.Source = "env"
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// handleListSecrets lists the rotatable secrets and their source: GET /admin/secrets
+func handleListSecrets(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"enabled": secretsIdentity != nil,
+		"secrets": listSecrets(),
+	})
+}
+
+type secretRequest struct {
+	Value string `json:"value"`
+}
+
+// handleSecret rotates a secret with PUT {"value": "..."}; DELETE falls back to the environment
+func handleSecret(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	name := strings.ToUpper(pathParam(r, "name"))
+	if !rotatableSecrets[name] {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Unbekanntes Secret"})
+		return
+	}
+
+	var body secretRequest
+	if r.Method == http.MethodPut {
+		if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+			writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+			return
+		}
+		body.Value = strings.TrimSpace(body.Value)
+		if body.Value == "" {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "value fehlt"})
+			return
+		}
+	}
+
+	err := setSecret(name, body.Value)
+	if err == errSecretsDisabled {
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		secretsLog.Error("Could not write the secrets file", "path", secretsFile, "error", err)
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Secret konnte nicht gespeichert werden"})
+		return
+	}
+	if body.Value == "" {
+		secretsLog.Info("Secret removed from the secrets file", "name", name, "ip", remoteIP(r))
+	} else {
+		secretsLog.Info("Secret rotated", "name", name, "ip", remoteIP(r))
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// handleReloadSecrets rereads the secrets file: POST /admin/secrets/reload
+func handleReloadSecrets(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	count, err := reloadSecrets()
+	if err == errSecretsDisabled {
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		secretsLog.Error("Reload failed", "error", err)
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Secrets konnten nicht neu geladen werden"})
+		return
+	}
+	secretsLog.Info("Reloaded secrets", "count", count, "path", secretsFile)
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "secrets": count})
+}
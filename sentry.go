@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Sentry/GlitchTip error reporting.
+// Events are sent directly to the store endpoint of the DSN, so no SDK is needed
+// and both Sentry and GlitchTip work as a sink.
+
+var (
+	sentryDSN         = getenv("SENTRY_DSN")         // Set via environment variable
+	sentryEnvironment = getenv("SENTRY_ENVIRONMENT") // e.g. "production"
+	sentry            *sentryClient                  // nil if Sentry is not configured
+	sentryLog         = componentLogger("sentry")
+)
+
+// sentryTagKeys are context keys sent as searchable tags instead of extra data
+var sentryTagKeys = map[string]bool{
+	"format":        true,
+	"code":          true,
+	"ytdlp_version": true,
+	"handler":       true,
+}
+
+type sentryClient struct {
+	storeURL   string
+	authHeader string
+	httpClient *http.Client
+}
+
+type SentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Logger      string                 `json:"logger,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Message     string                 `json:"message,omitempty"`
+	Exception   *SentryExceptionList   `json:"exception,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+type SentryExceptionList struct {
+	Values []SentryException `json:"values"`
+}
+
+type SentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *SentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type SentryStacktrace struct {
+	Frames []SentryFrame `json:"frames"`
+}
+
+type SentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// initSentry parses SENTRY_DSN (https://<key>@<host>/<project>) and enables the Sentry sink
+func initSentry() error {
+	if sentryDSN == "" {
+		return nil
+	}
+
+	dsn, err := url.Parse(sentryDSN)
+	if err != nil {
+		return fmt.Errorf("invalid SENTRY_DSN: %v", err)
+	}
+	if dsn.User == nil || dsn.User.Username() == "" {
+		return fmt.Errorf("invalid SENTRY_DSN: missing public key")
+	}
+
+	// The project ID is the last path segment; anything before it is a path prefix
+	trimmed := strings.Trim(dsn.Path, "/")
+	if trimmed == "" {
+		return fmt.Errorf("invalid SENTRY_DSN: missing project ID")
+	}
+	prefix, projectID := "", trimmed
+	if i := strings.LastIndex(trimmed, "/"); i >= 0 {
+		prefix, projectID = "/"+trimmed[:i], trimmed[i+1:]
+	}
+
+	sentry = &sentryClient{
+		storeURL: fmt.Sprintf("%s://%s%s/api/%s/store/", dsn.Scheme, dsn.Host, prefix, projectID),
+		authHeader: fmt.Sprintf("Sentry sentry_version=7, sentry_client=ytdownloader/1.0, sentry_key=%s",
+			dsn.User.Username()),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	sentryLog.Info("Error reporting enabled", "host", dsn.Host)
+	return nil
+}
+
+// newSentryEvent creates an event with the common fields filled in
+func newSentryEvent(level string, context map[string]string) SentryEvent {
+	hostname, _ := os.Hostname()
+
+	event := SentryEvent{
+		EventID:     newSentryEventID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       level,
+		Platform:    "go",
+		Logger:      "ytdownloader",
+		ServerName:  hostname,
+		Environment: sentryEnvironment,
+		Tags:        map[string]string{},
+		Extra:       map[string]interface{}{},
+	}
+
+	for key, value := range context {
+		if sentryTagKeys[key] {
+			event.Tags[key] = value
+		} else {
+			event.Extra[key] = value
+		}
+	}
+	if _, ok := event.Tags["ytdlp_version"]; !ok {
+		event.Tags["ytdlp_version"] = getYtDlpVersion()
+	}
+
+	return event
+}
+
+// captureSentryMessage sends a plain error message to Sentry
+func captureSentryMessage(message string, context map[string]string) {
+	if sentry == nil {
+		return
+	}
+
+	event := newSentryEvent("error", context)
+	event.Message = message
+	go sentry.send(event)
+}
+
+// captureSentryPanic sends a recovered panic including the stack trace to Sentry
+func captureSentryPanic(recovered interface{}, context map[string]string) {
+	if sentry == nil {
+		return
+	}
+
+	event := newSentryEvent("fatal", context)
+	event.Exception = &SentryExceptionList{
+		Values: []SentryException{
+			{
+				Type:       "panic",
+				Value:      fmt.Sprint(recovered),
+				Stacktrace: sentryStacktrace(3),
+			},
+		},
+	}
+	go sentry.send(event)
+}
+
+// sentryStacktrace collects the current call stack, oldest frame first as Sentry expects
+func sentryStacktrace(skip int) *SentryStacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var collected []SentryFrame
+	for {
+		frame, more := frames.Next()
+		collected = append(collected, SentryFrame{
+			Function: frame.Function,
+			Filename: frame.File,
+			Lineno:   frame.Line,
+			InApp:    strings.HasPrefix(frame.Function, "main."),
+		})
+		if !more {
+			break
+		}
+	}
+
+	for i, j := 0, len(collected)-1; i < j; i, j = i+1, j-1 {
+		collected[i], collected[j] = collected[j], collected[i]
+	}
+	return &SentryStacktrace{Frames: collected}
+}
+
+// send posts the event to the Sentry store endpoint
+func (c *sentryClient) send(event SentryEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		sentryLog.Error("Failed to marshal event", "error", err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.storeURL, bytes.NewReader(payload))
+	if err != nil {
+		sentryLog.Error("Failed to create request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", c.authHeader)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		sentryLog.Error("Failed to send event", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		sentryLog.Error("Server rejected event", "status", resp.StatusCode, "body", string(body))
+		return
+	}
+
+	sentryLog.Debug("Event sent", "event", event.EventID)
+}
+
+// newSentryEventID returns a random 32 character hex ID
+func newSentryEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
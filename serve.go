@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Finished downloads are sent with http.ServeContent: HEAD and Range requests work,
+// so download managers learn the size and can resume, and the kernel copies the file
+// to the socket (sendfile) unless SERVE_RATE_LIMIT throttles each connection.
+// A file is deleted once a transfer delivered its last byte and no other transfer
+// of the same file is still running.
+var serveRateLimit = parseByteRate(getenv("SERVE_RATE_LIMIT")) // Bytes per second and connection, 0 = unlimited
+
+// fileTransfer tracks the running transfers of one file
+type fileTransfer struct {
+	active     int
+	reachedEnd bool
+}
+
+var (
+	fileTransfers      = make(map[string]*fileTransfer) // Keyed by file path
+	fileTransfersMutex sync.Mutex
+)
+
+// parseByteRate reads a rate like "500K", "2M" or "1048576" (bytes per second)
+func parseByteRate(value string) int64 {
+	value = strings.TrimSpace(strings.ToUpper(value))
+	if value == "" {
+		return 0
+	}
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	number, err := strconv.ParseInt(strings.TrimRight(value, "KMG"), 10, 64)
+	if err != nil || number <= 0 {
+		configLog.Warn("Invalid SERVE_RATE_LIMIT, serving without limit", "value", value)
+		return 0
+	}
+	return number * multiplier
+}
+
+// serveDownload sends the file or the requested range. It reports whether the file has
+// been delivered to its end and this was the last running transfer, i.e. it may be deleted,
+// and the bytes sent.
+func serveDownload(w http.ResponseWriter, r *http.Request, path string, file *os.File, info os.FileInfo) (bool, int64) {
+	fileTransfersMutex.Lock()
+	transfer, ok := fileTransfers[path]
+	if !ok {
+		transfer = &fileTransfer{}
+		fileTransfers[path] = transfer
+	}
+	transfer.active++
+	fileTransfersMutex.Unlock()
+
+	var content io.ReadSeeker = file
+	if serveRateLimit > 0 {
+		content = &throttledReader{ReadSeeker: file, rate: serveRateLimit}
+	}
+	counter := &countingWriter{ResponseWriter: w}
+	http.ServeContent(counter, r, info.Name(), info.ModTime(), content)
+	reachedEnd := counter.reachedEnd(info.Size())
+	servedBytes.Add(float64(counter.written))
+
+	fileTransfersMutex.Lock()
+	defer fileTransfersMutex.Unlock()
+	transfer.active--
+	transfer.reachedEnd = transfer.reachedEnd || reachedEnd
+	if transfer.active > 0 {
+		return false, counter.written
+	}
+	delete(fileTransfers, path)
+	return transfer.reachedEnd, counter.written
+}
+
+// countingWriter counts the body bytes actually written. ReadFrom keeps the
+// sendfile path of the underlying connection available.
+type countingWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (cw *countingWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	n, err := cw.ResponseWriter.Write(b)
+	cw.written += int64(n)
+	return n, err
+}
+
+func (cw *countingWriter) ReadFrom(src io.Reader) (int64, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	n, err := io.Copy(cw.ResponseWriter, src)
+	cw.written += n
+	return n, err
+}
+
+// reachedEnd reports whether the complete response was sent and it contained the last byte of the file
+func (cw *countingWriter) reachedEnd(size int64) bool {
+	length, err := strconv.ParseInt(cw.Header().Get("Content-Length"), 10, 64)
+	if err != nil || cw.written != length {
+		return false // Aborted by the client, or a multipart range response
+	}
+	switch cw.status {
+	case http.StatusOK:
+		return true
+	case http.StatusPartialContent:
+		var start, end, total int64
+		_, err := fmt.Sscanf(cw.Header().Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+		return err == nil && end == size-1
+	}
+	return false
+}
+
+// throttledReader limits how fast ServeContent reads the file, and thereby the connection
+type throttledReader struct {
+	io.ReadSeeker
+	rate  int64 // Bytes per second
+	start time.Time
+	read  int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	// Small chunks keep the transfer smooth at low rates
+	if chunk := t.rate/10 + 1; int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.ReadSeeker.Read(p)
+	t.read += int64(n)
+
+	due := time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second))
+	if wait := due - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
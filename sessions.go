@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"sync"
+)
+
+// Session IDs are not secret: they show up in logs and webhooks. Every job therefore
+// gets a token when it is created, and only the request that started it (/download,
+// /convert) receives the token in its response. Session-scoped endpoints (/progress,
+// /preview/{id}, /audit?session= and /jobs/{id}/...) require it as ?token= or
+// X-Session-Token header.
+
+var (
+	sessionTokens      = make(map[string]string) // Token by session ID
+	sessionTokensMutex sync.RWMutex
+)
+
+// issueSessionToken creates the owner token for a session
+func issueSessionToken(sessionID string) {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+
+	sessionTokensMutex.Lock()
+	defer sessionTokensMutex.Unlock()
+	sessionTokens[sessionID] = hex.EncodeToString(buf)
+}
+
+// restoreSessionToken puts back the token of a job loaded from the job store
+func restoreSessionToken(sessionID, token string) {
+	sessionTokensMutex.Lock()
+	defer sessionTokensMutex.Unlock()
+	sessionTokens[sessionID] = token
+}
+
+// sessionToken returns the token to hand to whoever started the session
+func sessionToken(sessionID string) string {
+	sessionTokensMutex.RLock()
+	defer sessionTokensMutex.RUnlock()
+	return sessionTokens[sessionID]
+}
+
+// sessionTokenFromRequest returns the token sent by the client. EventSource cannot
+// set headers, so the query parameter is accepted as well.
+func sessionTokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get("X-Session-Token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// sessionAccessAllowed reports whether the request may access the session. Sessions
+// without a token (unknown, or purged from memory) are only open to the admin.
+func sessionAccessAllowed(r *http.Request, sessionID string) bool {
+	return sessionTokenMatches(sessionID, sessionTokenFromRequest(r)) || isAdminRequest(r)
+}
+
+// sessionTokenMatches reports whether token is the owner token of a known session
+func sessionTokenMatches(sessionID, token string) bool {
+	expected := sessionToken(sessionID)
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// requireSessionOwner writes 403 and returns false if the request lacks the session token
+func requireSessionOwner(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	if sessionAccessAllowed(r, sessionID) {
+		return true
+	}
+	httpLog.Warn("Rejected request: missing or wrong session token", "method", r.Method, "path", r.URL.Path, "session", sessionID, "ip", remoteIP(r))
+	writeJSONStatus(w, http.StatusForbidden, map[string]interface{}{
+		"success": false,
+		"message": "Kein Zugriff auf diese Sitzung",
+	})
+	return false
+}
+
+// requestOwner identifies who starts a job: the authenticated user, the API key or
+// else the client address. Job lists only show a client its own jobs.
+func requestOwner(r *http.Request) string {
+	if user := authenticatedUser(r); user != "" {
+		return "user:" + user
+	}
+	if label := apiKeyLabel(r); label != "" {
+		return "key:" + label
+	}
+	return "ip:" + remoteIP(r)
+}
+
+// jobVisibleTo reports whether a job is listed for the request; the admin sees all
+func jobVisibleTo(r *http.Request, job Job) bool {
+	return isAdminRequest(r) || (job.Owner != "" && job.Owner == requestOwner(r))
+}
+
+// forgetSessionToken drops the token once the job is removed from the store
+func forgetSessionToken(event LifecycleEvent) {
+	sessionTokensMutex.Lock()
+	defer sessionTokensMutex.Unlock()
+	delete(sessionTokens, event.SessionID)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Share links hand a completed file to someone else without downloading it from
+// YouTube again: POST /jobs/{id}/shares creates a link /s/{share} with an optional
+// password and an expiry. While a share is active the file is not deleted when the
+// owner fetches it via /download-file; it is removed once the last share expires.
+// Shares are kept in memory and do not survive a restart.
+
+const (
+	defaultShareHours = 24
+	maxShareHours     = 30 * 24
+	maxSharesPerJob   = 10
+	maxSharePassword  = 128
+)
+
+var (
+	shareRequestLimiter  = newRateLimiter(60, time.Minute)   // Requests to /s/ per IP
+	sharePasswordLimiter = newRateLimiter(5, 15*time.Minute) // Wrong passwords per share and IP
+	sharesLog            = componentLogger("shares")
+)
+
+// Share is a link to the file of a completed job
+type Share struct {
+	ID           string    `json:"id"`
+	SessionID    string    `json:"sessionId"`
+	URL          string    `json:"url"`
+	Protected    bool      `json:"protected"` // A password is required
+	Downloads    int       `json:"downloads"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	filename     string    // Relative to ./downloads
+	salt         []byte
+	passwordHash []byte
+	fileServed   bool // The owner fetched the file; delete it when the share ends
+}
+
+// shareSettings is the body of POST /jobs/{id}/shares
+type shareSettings struct {
+	Password     string `json:"password"`
+	ExpiresHours int    `json:"expiresHours"` // Default 24, at most 30 days
+}
+
+var (
+	shares      = make(map[string]*Share) // By share ID
+	sharesMutex sync.Mutex
+)
+
+// createShare adds a share for the job's file
+func createShare(job Job, settings shareSettings) (Share, error) {
+	if settings.ExpiresHours == 0 {
+		settings.ExpiresHours = defaultShareHours
+	}
+	if settings.ExpiresHours < 0 || settings.ExpiresHours > maxShareHours {
+		return Share{}, fmt.Errorf("Ablauf muss zwischen 1 und %d Stunden liegen", maxShareHours)
+	}
+	if len(settings.Password) > maxSharePassword {
+		return Share{}, fmt.Errorf("Passwort ist zu lang (max. %d Zeichen)", maxSharePassword)
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	now := time.Now()
+	share := &Share{
+		ID:        hex.EncodeToString(id),
+		SessionID: job.SessionID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(settings.ExpiresHours) * time.Hour),
+		filename:  job.Filename,
+	}
+	share.URL = publicBaseURL + "/s/" + share.ID
+	if settings.Password != "" {
+		share.Protected = true
+		share.salt = make([]byte, 16)
+		rand.Read(share.salt)
+		share.passwordHash = hashSharePassword(share.salt, settings.Password)
+	}
+
+	sharesMutex.Lock()
+	defer sharesMutex.Unlock()
+
+	count := 0
+	for _, existing := range shares {
+		if existing.SessionID == job.SessionID {
+			count++
+		}
+	}
+	if count >= maxSharesPerJob {
+		return Share{}, fmt.Errorf("Maximal %d Freigaben pro Download", maxSharesPerJob)
+	}
+	shares[share.ID] = share
+	return *share, nil
+}
+
+// hashSharePassword derives the password hash with Argon2id (OWASP parameters: 19 MiB,
+// two passes), so a leaked hash cannot be brute-forced quickly
+func hashSharePassword(salt []byte, password string) []byte {
+	return argon2.IDKey([]byte(password), salt, 2, 19*1024, 1, 32)
+}
+
+// listShares returns the active shares of a job, newest first
+func listShares(sessionID string) []Share {
+	sharesMutex.Lock()
+	list := []Share{}
+	for _, share := range shares {
+		if share.SessionID == sessionID {
+			list = append(list, *share)
+		}
+	}
+	sharesMutex.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// removeShare ends a share early; it reports false if the share does not belong to the job
+func removeShare(sessionID, shareID string) bool {
+	sharesMutex.Lock()
+	share, ok := shares[shareID]
+	if !ok || share.SessionID != sessionID {
+		sharesMutex.Unlock()
+		return false
+	}
+	delete(shares, shareID)
+	sharesMutex.Unlock()
+
+	releaseSharedFile(share)
+	return true
+}
+
+// shareKeepsFile reports whether an active share still needs the file. It is called
+// when the owner fetched the file, which is then deleted once the shares end.
+func shareKeepsFile(filename string) bool {
+	sharesMutex.Lock()
+	defer sharesMutex.Unlock()
+
+	kept := false
+	for _, share := range shares {
+		if share.filename == filename && time.Now().Before(share.ExpiresAt) {
+			share.fileServed = true
+			kept = true
+		}
+	}
+	return kept
+}
+
+// releaseSharedFile deletes the file of an ended share if the owner already fetched
+// it and no other share uses it
+func releaseSharedFile(ended *Share) {
+	if !ended.fileServed {
+		return
+	}
+	sharesMutex.Lock()
+	for _, share := range shares {
+		if share.filename == ended.filename {
+			share.fileServed = true // The remaining share deletes it when it ends
+			sharesMutex.Unlock()
+			return
+		}
+	}
+	sharesMutex.Unlock()
+
+	filePath := downloadPath(ended.filename)
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		sharesLog.Error("Could not delete shared file", "file", ended.filename, "error", err)
+		return
+	}
+	os.Remove(waveformPath(filePath))
+	os.Remove(lyricsPath(filePath))
+	sharesLog.Info("Deleted file after its last share ended", "file", ended.filename)
+}
+
+// cleanupShares removes expired shares
+func cleanupShares() {
+	sharesMutex.Lock()
+	var expired []*Share
+	now := time.Now()
+	for id, share := range shares {
+		if now.After(share.ExpiresAt) {
+			expired = append(expired, share)
+			delete(shares, id)
+		}
+	}
+	sharesMutex.Unlock()
+
+	for _, share := range expired {
+		sharesLog.Info("Share expired", "share", share.ID, "session", share.SessionID)
+		releaseSharedFile(share)
+	}
+	shareRequestLimiter.cleanup()
+	sharePasswordLimiter.cleanup()
+}
+
+// revokeJobShares ends all shares of a purged job; the job's files are gone already
+func revokeJobShares(event LifecycleEvent) {
+	sharesMutex.Lock()
+	defer sharesMutex.Unlock()
+
+	for id, share := range shares {
+		if share.SessionID == event.SessionID {
+			delete(shares, id)
+		}
+	}
+}
+
+// handleJobShares lists (GET) or creates (POST) the shares of a job: /jobs/{id}/shares
+func handleJobShares(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, ok := getJob(jobID)
+	if !ok || job.DeletedAt != nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Job nicht gefunden"})
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true, "shares": listShares(jobID)})
+		return
+	}
+
+	if job.Status != JobStatusCompleted || job.Filename == "" {
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{"success": false, "message": "Download ist noch nicht abgeschlossen"})
+		return
+	}
+	if _, err := os.Stat(downloadPath(job.Filename)); err != nil {
+		writeJSONStatus(w, http.StatusGone, map[string]interface{}{"success": false, "message": "Datei nicht mehr vorhanden"})
+		return
+	}
+
+	var settings shareSettings
+	if r.ContentLength != 0 {
+		if reqErr := decodeJSONBody(w, r, &settings, maxJSONBodyBytes); reqErr != nil {
+			writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+			return
+		}
+	}
+
+	share, err := createShare(job, settings)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": err.Error()})
+		return
+	}
+	sharesLog.Info("Created share", "share", share.ID, "session", jobID, "expires", share.ExpiresAt, "password", share.Protected)
+	writeJSONStatus(w, http.StatusCreated, map[string]interface{}{"success": true, "share": share})
+}
+
+// handleDeleteJobShare ends a share early: DELETE /jobs/{id}/shares/{share}
+func handleDeleteJobShare(w http.ResponseWriter, r *http.Request, jobID string) {
+	if !removeShare(jobID, pathParam(r, "share")) {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Freigabe nicht gefunden"})
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// sharePasswordPage asks for the password of a protected share
+const sharePasswordPage = `<!DOCTYPE html>
+<html lang="de"><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Geschützter Download</title></head>
+<body style="font-family: sans-serif; max-width: 24rem; margin: 4rem auto;">
+<h1>Geschützter Download</h1>
+<p>%s</p>
+<form method="post">
+<input type="password" name="password" placeholder="Passwort" autofocus required>
+<button type="submit">Herunterladen</button>
+</form>
+</body></html>`
+
+// handleShare serves a shared file: GET /s/{share}, or POST with the password form
+func handleShare(w http.ResponseWriter, r *http.Request) {
+	ip := remoteIP(r)
+	if !shareRequestLimiter.allow(ip) {
+		http.Error(w, "Zu viele Anfragen, bitte später erneut versuchen", http.StatusTooManyRequests)
+		return
+	}
+
+	shareID := pathParam(r, "share")
+	sharesMutex.Lock()
+	found, ok := shares[shareID]
+	var share Share
+	if ok {
+		share = *found
+	}
+	sharesMutex.Unlock()
+	if !ok || time.Now().After(share.ExpiresAt) {
+		http.Error(w, "Freigabe nicht gefunden oder abgelaufen", http.StatusNotFound)
+		return
+	}
+
+	if share.Protected {
+		attemptKey := shareID + "|" + ip
+		if sharePasswordLimiter.blocked(attemptKey) {
+			http.Error(w, "Zu viele falsche Passwörter, bitte später erneut versuchen", http.StatusTooManyRequests)
+			return
+		}
+
+		password := r.Header.Get("X-Share-Password")
+		if password == "" && r.Method == http.MethodPost {
+			r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+			password = r.PostFormValue("password")
+		}
+		if password == "" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, sharePasswordPage, "Dieser Download ist mit einem Passwort geschützt.")
+			return
+		}
+		if subtle.ConstantTimeCompare(hashSharePassword(share.salt, password), share.passwordHash) != 1 {
+			sharePasswordLimiter.allow(attemptKey)
+			sharesLog.Warn("Wrong password", "share", shareID, "ip", ip)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, sharePasswordPage, "Falsches Passwort.")
+			return
+		}
+	}
+
+	file, err := os.Open(downloadPath(share.filename))
+	if err != nil {
+		sharesLog.Warn("Shared file not available", "share", shareID, "error", err)
+		http.Error(w, "Datei nicht mehr vorhanden", http.StatusGone)
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Fehler beim Lesen der Dateiinformationen", http.StatusInternalServerError)
+		return
+	}
+
+	// Only count the first request of a download, not every Range request of a player
+	if r.Header.Get("Range") == "" && r.Method != http.MethodHead {
+		sharesMutex.Lock()
+		if current, ok := shares[shareID]; ok {
+			current.Downloads++
+		}
+		sharesMutex.Unlock()
+		if job, ok := getJob(share.SessionID); ok {
+			publishEvent(LifecycleEvent{Type: EventJobServed, SessionID: job.SessionID, Job: job, Detail: fmt.Sprintf("shared via %s to %s", shareID, ip)})
+		}
+	}
+
+	name := filepath.Base(share.filename)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	w.Header().Set("Cache-Control", "private, no-store")
+	counter := &countingWriter{ResponseWriter: w}
+	http.ServeContent(counter, r, name, fileInfo.ModTime(), file)
+	addJobResources(share.SessionID, JobResources{ServedBytes: counter.written})
+}
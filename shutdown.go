@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SIGTERM or SIGINT shut the server down gracefully: new downloads are refused with
+// 503, queued jobs stay queued and running downloads get SHUTDOWN_GRACE_PERIOD to
+// finish (0 = none). yt-dlp processes still running then are killed; their jobs stay
+// active in the job store and are picked up again on the next start, see recovery.go.
+// The progress streams get their last updates before the HTTP server closes. A second
+// signal ends the server immediately.
+const (
+	jobExitTimeout     = 10 * time.Second // For the jobs to notice their killed process
+	streamCloseTimeout = 5 * time.Second  // For the progress streams to flush and close
+	shutdownPoll       = 250 * time.Millisecond
+)
+
+var (
+	shutdownGracePeriod = parseEnvDurationOrOff("SHUTDOWN_GRACE_PERIOD", 30*time.Second)
+
+	shuttingDown atomic.Bool
+
+	// streamsCtx ends the progress streams once the running jobs are done
+	streamsCtx, closeStreams = context.WithCancel(context.Background())
+
+	interruptedJobs  = make(map[string]bool) // Keyed by session ID
+	interruptedMutex sync.Mutex
+)
+
+var errShutdownInterrupted = errors.New("interrupted by the shutdown")
+
+const shuttingDownMessage = "Der Server wird gerade neu gestartet. Bitte versuche es in einer Minute erneut."
+
+// refuseWhileShuttingDown answers 503 once the shutdown began and reports whether it did
+func refuseWhileShuttingDown(w http.ResponseWriter) bool {
+	if !shuttingDown.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", "60")
+	writeJSONStatus(w, http.StatusServiceUnavailable, DownloadResponse{Success: false, Message: shuttingDownMessage})
+	return true
+}
+
+// shutdown drains the job queue, closes the progress streams and then the server
+func shutdown(server *http.Server) {
+	shuttingDown.Store(true)
+	waiting, running := queueLength()
+	serverLog.Info("Shutting down", "gracePeriod", shutdownGracePeriod.String(), "running", running, "queued", waiting)
+
+	for _, sessionID := range stopJobQueue() {
+		sendProgress(sessionID, 0, restartStatus())
+	}
+	if !waitForRunningJobs(shutdownGracePeriod) {
+		killed := interruptRunningJobs()
+		serverLog.Warn("Grace period over, killed running downloads", "jobs", killed)
+		if !waitForRunningJobs(jobExitTimeout) {
+			_, running := queueLength()
+			serverLog.Warn("Jobs still busy, leaving them to recovery", "jobs", running)
+		}
+	}
+
+	closeStreams()
+	ctx, cancel := context.WithTimeout(context.Background(), streamCloseTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		serverLog.Warn("HTTP server did not close cleanly", "error", err)
+	}
+	if jobStore != nil {
+		if err := jobStore.Close(); err != nil {
+			jobStoreLog.Warn("Cannot close the job store", "error", err)
+		}
+	}
+	serverLog.Info("Shutdown complete")
+}
+
+// waitForRunningJobs waits up to timeout for the workers to become idle
+func waitForRunningJobs(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, running := queueLength(); running == 0 {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(shutdownPoll)
+	}
+}
+
+// interruptRunningJobs kills the yt-dlp processes of all downloading jobs and returns
+// how many were killed. The jobs end without being finished, so recovery requeues them.
+func interruptRunningJobs() int {
+	cancelMutex.Lock()
+	var killed []string
+	for sessionID, state := range cancellableJobs {
+		if state.cmd == nil {
+			continue
+		}
+		interruptedMutex.Lock()
+		interruptedJobs[sessionID] = true
+		interruptedMutex.Unlock()
+		killProcessGroup(state.cmd)
+		killed = append(killed, sessionID)
+	}
+	cancelMutex.Unlock()
+
+	for _, sessionID := range killed {
+		job, _ := getJob(sessionID)
+		sendProgress(sessionID, job.Progress, restartStatus())
+	}
+	return len(killed)
+}
+
+// restartStatus tells the clients of unfinished jobs what happens to them
+func restartStatus() string {
+	if jobStore != nil && jobRecovery == "requeue" {
+		return "Der Server wird neu gestartet, der Download geht danach weiter"
+	}
+	return "Der Server wird neu gestartet, der Download wird abgebrochen"
+}
+
+// interruptedByShutdown reports whether the job's process was killed by the shutdown
+func interruptedByShutdown(sessionID string) bool {
+	interruptedMutex.Lock()
+	defer interruptedMutex.Unlock()
+	return interruptedJobs[sessionID]
+}
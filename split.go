@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var splitLog = componentLogger("split")
+
+// splitSizeMargin keeps size-capped parts safely below the limit since bitrates vary
+const splitSizeMargin = 0.95
+
+// probeDuration returns the media duration in seconds using ffprobe
+func probeDuration(mediaPath string) (float64, error) {
+	output, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		mediaPath).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %v", err)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+}
+
+// splitSegmentSeconds converts the requested split options into a segment length
+func splitSegmentSeconds(mediaPath string, splitMinutes, splitMB int) (float64, error) {
+	segment := 0.0
+	if splitMinutes > 0 {
+		segment = float64(splitMinutes) * 60
+	}
+
+	if splitMB > 0 {
+		fileInfo, err := os.Stat(mediaPath)
+		if err != nil {
+			return 0, err
+		}
+		duration, err := probeDuration(mediaPath)
+		if err != nil {
+			return 0, err
+		}
+		bytesPerSecond := float64(fileInfo.Size()) / duration
+		bySize := float64(splitMB) * 1024 * 1024 * splitSizeMargin / bytesPerSecond
+		if segment == 0 || bySize < segment {
+			segment = bySize
+		}
+	}
+
+	return segment, nil
+}
+
+// splitRequested reports whether the request asks for the output to be split
+func splitRequested(req DownloadRequest) bool {
+	return req.SplitChapters || req.SplitMinutes > 0 || req.SplitMB > 0
+}
+
+// splitJobFile is the split step: it cuts the file at the chapters found by the
+// post-processing or into parts of the requested length, and returns the first part
+func splitJobFile(sessionID string, req DownloadRequest, filename string) (string, error) {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return filename, errJobNotFound
+	}
+	byChapters := req.SplitChapters && len(job.Chapters) > 1
+	if !byChapters && req.SplitMinutes == 0 && req.SplitMB == 0 {
+		return filename, nil // Chapter split of a video without chapters
+	}
+
+	sendProgress(sessionID, 96, "Datei wird aufgeteilt...")
+	mediaPath := downloadPath(filename)
+	var parts []string
+	var err error
+	if byChapters {
+		parts, err = splitByChapters(mediaPath, job.Chapters)
+	} else {
+		parts, err = splitMedia(mediaPath, req.SplitMinutes, req.SplitMB)
+	}
+	if err != nil {
+		jobLogger(splitLog, sessionID, StepSplit).Warn("Split failed", "error", err)
+		return filename, err
+	}
+	if len(parts) < 2 {
+		return filename, nil
+	}
+	dir := filepath.Dir(filename) // Collection folder or "."
+	for i := range parts {
+		parts[i] = filepath.ToSlash(filepath.Join(dir, parts[i]))
+	}
+	updateJob(sessionID, func(job *Job) { job.Parts = parts })
+	return parts[0], nil
+}
+
+// splitMedia cuts the file into parts with the ffmpeg segment muxer and removes the original.
+// It returns the part filenames in order; a file shorter than one segment is left untouched.
+func splitMedia(mediaPath string, splitMinutes, splitMB int) ([]string, error) {
+	segment, err := splitSegmentSeconds(mediaPath, splitMinutes, splitMB)
+	if err != nil {
+		return nil, err
+	}
+	if segment < 1 {
+		return nil, fmt.Errorf("segment length too short (%.2fs)", segment)
+	}
+
+	if duration, err := probeDuration(mediaPath); err == nil && duration <= segment {
+		return []string{filepath.Base(mediaPath)}, nil
+	}
+
+	ext := filepath.Ext(mediaPath)
+	base := strings.TrimSuffix(mediaPath, ext)
+	// The segment muxer reads % in the name as a format directive
+	pattern := strings.ReplaceAll(base, "%", "%%") + "_part%03d" + ext
+
+	output, err := exec.Command("ffmpeg",
+		"-v", "error",
+		"-y",
+		"-i", mediaPath,
+		"-map", "0",
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", fmt.Sprintf("%.3f", segment),
+		"-segment_start_number", "1",
+		"-reset_timestamps", "1",
+		pattern).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg segment failed: %v: %s", err, truncateString(string(output), 500))
+	}
+
+	// Not a glob: titles like "[Official Video]" would be read as a pattern
+	entries, err := os.ReadDir(filepath.Dir(mediaPath))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(base) + "_part"
+	var names []string
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ext) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no parts were written")
+	}
+	sort.Strings(names)
+
+	if err := os.Remove(mediaPath); err != nil {
+		splitLog.Warn("Could not remove original", "path", mediaPath, "error", err)
+	}
+
+	splitLog.Info("Split into parts", "file", filepath.Base(mediaPath), "parts", len(names), "seconds", segment)
+	return names, nil
+}
+
+// serveParts streams all parts of a split job as an uncompressed zip: /jobs/{id}/parts.zip
+func serveParts(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, ok := getJob(jobID)
+	if !ok {
+		http.Error(w, "Job nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if len(job.Parts) == 0 {
+		http.Error(w, "Dieser Job wurde nicht aufgeteilt", http.StatusNotFound)
+		return
+	}
+
+	archiveName := filepath.Base(job.Parts[0])
+	archiveName = strings.TrimSuffix(archiveName, filepath.Ext(archiveName))
+	archiveName = strings.TrimSuffix(archiveName, "_part001") + ".zip"
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", archiveName))
+
+	archive := zip.NewWriter(w)
+	for _, part := range job.Parts {
+		file, err := os.Open(downloadPath(part))
+		if err != nil {
+			splitLog.Error("Part missing", "session", jobID, "part", part, "error", err)
+			continue
+		}
+
+		// Media is already compressed, so store the parts as-is
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: filepath.Base(part), Method: zip.Store})
+		if err == nil {
+			_, err = io.Copy(entry, file)
+		}
+		file.Close()
+		if err != nil {
+			splitLog.Warn("Streaming the archive failed", "session", jobID, "error", err)
+			return
+		}
+	}
+	archive.Close()
+}
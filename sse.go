@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Progress is streamed to browsers with Server-Sent Events, or a WebSocket (see
+// websocket.go). Every client has its own bounded queue: a slow client loses
+// intermediate progress updates, but never warnings or the final update. Clients are
+// removed as soon as a write fails or the request context ends.
+
+// CompletedDownload is the final update of a finished session, kept for reconnects
+type CompletedDownload struct {
+	FinalUpdate ProgressUpdate
+	CompletedAt time.Time
+}
+
+const (
+	maxProgressBacklog = 50 // Updates kept per session for late clients
+	maxClientQueue     = 16 // Updates queued per client before old progress is dropped
+)
+
+var (
+	progressClients    = make(map[string][]*sseClient)       // Multiple clients per session
+	completedDownloads = make(map[string]*CompletedDownload) // Cache completed downloads for reconnect
+	progressBacklog    = make(map[string][]ProgressUpdate)   // Recent updates, replayed to clients that connect late
+	progressMutex      sync.Mutex
+	sseLog             = componentLogger("sse")
+)
+
+// sseClient is the queue between the publisher and one connected browser, also used
+// for the subscriptions of a WebSocket connection
+type sseClient struct {
+	mu       sync.Mutex
+	queue    []ProgressUpdate
+	finished bool          // The final update is queued; the stream ends after it
+	wake     chan struct{} // Signals new entries, capacity 1
+}
+
+func newSSEClient() *sseClient {
+	return &sseClient{wake: make(chan struct{}, 1)}
+}
+
+// push queues an update without ever blocking the publisher
+func (c *sseClient) push(update ProgressUpdate, final bool) {
+	c.mu.Lock()
+	if !c.finished {
+		c.queue = trimUpdates(append(c.queue, update), maxClientQueue)
+		c.finished = final
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the queued updates and whether the stream is complete
+func (c *sseClient) take() ([]ProgressUpdate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	updates := c.queue
+	c.queue = nil
+	return updates, c.finished
+}
+
+// trimUpdates drops the oldest plain progress updates beyond max. Warnings and the
+// final update are only dropped if nothing else is left.
+func trimUpdates(updates []ProgressUpdate, max int) []ProgressUpdate {
+	for len(updates) > max {
+		drop := 0
+		for i, update := range updates[:len(updates)-1] {
+			if update.Warning == nil && !update.Error && update.Progress != 100 {
+				drop = i
+				break
+			}
+		}
+		updates = append(updates[:drop], updates[drop+1:]...)
+	}
+	return updates
+}
+
+func handleProgress(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session")
+	if sessionID == "" {
+		sseLog.Warn("No session ID provided", "ip", remoteIP(r))
+		http.Error(w, "Session ID required", http.StatusBadRequest)
+		return
+	}
+	// Unknown sessions are refused, so nobody can subscribe to an ID before it is issued
+	if sessionToken(sessionID) == "" {
+		sseLog.Warn("Unknown session", "session", sessionID, "ip", remoteIP(r))
+		http.Error(w, "Unknown session", http.StatusNotFound)
+		return
+	}
+	if !requireSessionOwner(w, r, sessionID) {
+		return
+	}
+
+	// Server-Sent Events Headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+
+	client, backlog, clientCount := subscribeProgress(sessionID)
+	if client == nil {
+		// Replay what happened, ending with the final update, and close
+		sseLog.Info("Reconnect to completed session", "session", sessionID, "replayed", len(backlog))
+		for _, update := range backlog {
+			if writeSSEUpdate(w, update) != nil {
+				return
+			}
+		}
+		return
+	}
+
+	sseLog.Info("Client connected", "session", sessionID, "clients", clientCount, "replayed", len(backlog))
+	defer removeSSEClient(sessionID, client)
+
+	for _, update := range backlog {
+		if err := writeSSEUpdate(w, update); err != nil {
+			sseLog.Info("Write failed, dropping client", "session", sessionID, "error", err)
+			return
+		}
+	}
+
+	// Send updates to client
+	updateCount := 0
+	for {
+		select {
+		case <-client.wake:
+		case <-r.Context().Done():
+			sseLog.Info("Client went away", "session", sessionID, "updates", updateCount)
+			return
+		case <-streamsCtx.Done():
+			// The server shuts down: send what is left, the client reconnects after the restart
+			updates, _ := client.take()
+			for _, update := range updates {
+				if writeSSEUpdate(w, update) != nil {
+					break
+				}
+			}
+			sseLog.Info("Closing stream for shutdown", "session", sessionID, "updates", updateCount+len(updates))
+			return
+		}
+
+		updates, finished := client.take()
+		for _, update := range updates {
+			updateCount++
+			sseLog.Debug("Sending update", "session", sessionID, "update", updateCount, "progress", update.Progress, "status", update.Status)
+			if err := writeSSEUpdate(w, update); err != nil {
+				sseLog.Info("Write failed, dropping client", "session", sessionID, "error", err)
+				return
+			}
+		}
+		if finished {
+			sseLog.Info("Finished sending updates", "session", sessionID, "updates", updateCount)
+			return
+		}
+	}
+}
+
+// subscribeProgress takes the backlog and registers a client atomically, so no update
+// is missed or sent twice. It returns the number of clients of the session. For a
+// completed session no client is registered and the backlog ends with the final update.
+func subscribeProgress(sessionID string) (*sseClient, []ProgressUpdate, int) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	backlog := append([]ProgressUpdate(nil), progressBacklog[sessionID]...)
+	if completed, ok := completedDownloads[sessionID]; ok {
+		if len(backlog) == 0 {
+			backlog = []ProgressUpdate{completed.FinalUpdate}
+		}
+		return nil, backlog, len(progressClients[sessionID])
+	}
+	client := newSSEClient()
+	progressClients[sessionID] = append(progressClients[sessionID], client)
+	return client, backlog, len(progressClients[sessionID])
+}
+
+// progressClientCount returns the number of connected clients over all sessions
+func progressClientCount() int {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	count := 0
+	for _, clients := range progressClients {
+		count += len(clients)
+	}
+	return count
+}
+
+// removeSSEClient unregisters a client once its stream ended
+func removeSSEClient(sessionID string, client *sseClient) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	clients := progressClients[sessionID]
+	for i, c := range clients {
+		if c == client {
+			progressClients[sessionID] = append(clients[:i], clients[i+1:]...)
+			break
+		}
+	}
+	if len(progressClients[sessionID]) == 0 {
+		delete(progressClients, sessionID)
+	}
+	sseLog.Info("Client disconnected", "session", sessionID, "remaining", len(progressClients[sessionID]))
+}
+
+// writeSSEUpdate writes one update as an SSE message; warnings use their own event type.
+// An error means the client is gone.
+func writeSSEUpdate(w http.ResponseWriter, update ProgressUpdate) error {
+	data, _ := json.Marshal(update)
+	var err error
+	if update.Warning != nil {
+		_, err = fmt.Fprintf(w, "event: warning\ndata: %s\n\n", data)
+	} else {
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	if err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// appendBacklog stores an update for replay. Caller must hold progressMutex.
+func appendBacklog(sessionID string, update ProgressUpdate) {
+	progressBacklog[sessionID] = trimUpdates(append(progressBacklog[sessionID], update), maxProgressBacklog)
+}
+
+// publishProgress delivers an update to all SSE clients of the session
+// and keeps it for clients that connect later. A 100% update ends the streams.
+func publishProgress(sessionID string, update ProgressUpdate) {
+	publishUpdate(sessionID, update, update.Progress == 100)
+}
+
+// publishError delivers the error to all SSE clients of the session and ends their streams
+func publishError(sessionID string, update ProgressUpdate) {
+	publishUpdate(sessionID, update, true)
+}
+
+func publishUpdate(sessionID string, update ProgressUpdate, final bool) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	appendBacklog(sessionID, update)
+	for _, client := range progressClients[sessionID] {
+		client.push(update, final)
+	}
+
+	if final {
+		// Clients unregister themselves once they sent the final update
+		completedDownloads[sessionID] = &CompletedDownload{
+			FinalUpdate: update,
+			CompletedAt: time.Now(),
+		}
+		sseLog.Debug("Final update queued", "session", sessionID)
+	}
+}
+
+// cleanupProgress forgets finished sessions after completedCacheTTL
+func cleanupProgress() {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	now := time.Now()
+	for sessionID, completed := range completedDownloads {
+		if now.Sub(completed.CompletedAt) > completedCacheTTL {
+			delete(completedDownloads, sessionID)
+			delete(progressBacklog, sessionID)
+			sseLog.Debug("Removed old completed download", "session", sessionID)
+		}
+	}
+}
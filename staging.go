@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stagingRoot holds one directory per running job. yt-dlp and ffmpeg write there,
+// so the downloads directory only ever contains complete files. It lives inside it to
+// keep the final move a same-filesystem rename.
+var stagingRoot = filepath.Join(downloadsDir, ".staging")
+
+// incompleteSuffixes are yt-dlp/ffmpeg intermediates that must never be served
+var incompleteSuffixes = []string{".part", ".ytdl", ".temp", ".tmp"}
+
+// jobStagingDir returns the staging directory of a job
+func jobStagingDir(sessionID string) string {
+	return filepath.Join(stagingRoot, sessionID)
+}
+
+// cleanupStaging removes staging directories left behind by a previous run, except
+// those of jobs that were queued again and continue their partial files
+func cleanupStaging() {
+	entries, err := os.ReadDir(stagingRoot)
+	if err != nil {
+		return
+	}
+	var removed int
+	var partialBytes int64
+	for _, entry := range entries {
+		if job, ok := getJob(entry.Name()); ok && job.isActive() {
+			continue
+		}
+		dir := filepath.Join(stagingRoot, entry.Name())
+		filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if info, err := d.Info(); err == nil {
+					partialBytes += info.Size()
+				}
+			}
+			return nil
+		})
+		if err := os.RemoveAll(dir); err != nil {
+			jobLog.Warn("Could not clean up staging directory", "path", dir, "error", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		jobLog.Info("Removed unfinished downloads of the previous run", "downloads", removed, "bytes", partialBytes)
+	}
+}
+
+// findStagedFile returns the finished media file in a staging directory,
+// preferring the expected extension when yt-dlp left more than one file
+func findStagedFile(dir, format string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	for _, entry := range entries {
+		// Hidden files are job inputs like personal cookies, never output
+		if !entry.Type().IsRegular() || isIncompleteFile(entry.Name()) || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if strings.EqualFold(filepath.Ext(entry.Name()), "."+format) {
+			return filepath.Join(dir, entry.Name()), nil
+		}
+		candidates = append(candidates, filepath.Join(dir, entry.Name()))
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no finished file in %s", dir)
+	}
+	return candidates[0], nil
+}
+
+func isIncompleteFile(name string) bool {
+	for _, suffix := range incompleteSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncFile flushes a file's contents to disk
+func syncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// syncDir flushes directory entries so a completed rename survives a crash
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// insideDir reports whether path stays within dir once cleaned
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// publishStagedFile moves a finished staged file into ./downloads, or the folder of the
+// request's collection, and returns its path relative to ./downloads
+func publishStagedFile(sessionID string, req DownloadRequest, stagedPath, name string) (string, error) {
+	// Collections are subfolders of ./downloads
+	collectionDir, err := collectionOutputDir(req.Collection)
+	if err != nil {
+		return "", err
+	}
+	targetDir := filepath.Join(downloadsDir, collectionDir)
+	if !insideDir(downloadsDir, filepath.Join(targetDir, name)) {
+		return "", fmt.Errorf("Ungültiger Dateiname: %s", name)
+	}
+
+	// Move the complete file into targetDir without clobbering an existing one
+	finalFilename, err := placeFile(stagedPath, targetDir, name, jobVideoID(sessionID))
+	if err != nil {
+		if err == errFileExists {
+			return "", err
+		}
+		return "", fmt.Errorf("Fehler beim Speichern der Datei: %v", err)
+	}
+	syncDir(targetDir)
+
+	// "<collection>/<file>" for collections
+	return filepath.ToSlash(filepath.Join(collectionDir, finalFilename)), nil
+}
@@ -139,4 +139,4 @@ Error generating stack: `+s.message+`
  *
  * This source code is licensed under the ISC license.
  * See the LICENSE file in the root directory of this source tree.
- */const wP=[["path",{d:"M18 6 6 18",key:"1bl5f8"}],["path",{d:"m6 6 12 12",key:"d8bk6v"}]],SP=At("x",wP),TP=({children:t,className:e="",spotlightColor:n="rgba(255, 255, 255, 0.25)",onClick:r})=>{const i=C.useRef(null),[s,o]=C.useState(!1),[a,l]=C.useState({x:0,y:0}),[u,c]=C.useState(0),f=x=>{if(!i.current||s)return;const y=i.current.getBoundingClientRect();l({x:x.clientX-y.left,y:x.clientY-y.top})},d=()=>{o(!0),c(.6)},h=()=>{o(!1),c(0)},v=()=>{c(.6)},p=()=>{c(0)};return R.jsxs("div",{ref:i,onMouseMove:f,onFocus:d,onBlur:h,onMouseEnter:v,onMouseLeave:p,onClick:r,className:`relative rounded-2xl border overflow-hidden cursor-pointer ${e}`,style:{borderColor:"rgba(255, 255, 255, 0.08)",backgroundColor:"#1a1a1a",padding:"24px 16px 48px 16px"},children:[R.jsx("div",{className:"pointer-events-none absolute inset-0 opacity-0 transition-opacity duration-500 ease-in-out",style:{opacity:u,background:`radial-gradient(circle at ${a.x}px ${a.y}px, ${n}, transparent 80%)`}}),t]})},kP=({as:t,className:e="",color:n="white",speed:r="6s",thickness:i=1,children:s,...o})=>{const a=t||"button";return R.jsxs(a,{className:`relative inline-block overflow-hidden rounded-[20px] ${e}`,...o,style:{padding:`${i}px 0`,...o.style},children:[R.jsx("div",{className:"absolute w-[300%] h-[50%] opacity-70 bottom-[-11px] right-[-250%] rounded-full animate-star-movement-bottom z-0",style:{background:`radial-gradient(circle, ${n}, transparent 10%)`,animationDuration:r}}),R.jsx("div",{className:"absolute w-[300%] h-[50%] opacity-70 top-[-10px] left-[-250%] rounded-full animate-star-movement-top z-0",style:{background:`radial-gradient(circle, ${n}, transparent 10%)`,animationDuration:r}}),R.jsx("div",{className:"relative z-1 bg-gradient-to-b from-black to-gray-900 border border-gray-800 text-white text-center text-[16px] py-[16px] px-[26px] rounded-[20px]",children:s})]})},PP=({text:t,disabled:e=!1,speed:n=5,className:r=""})=>{const i=`${n}s`;return R.jsx("div",{className:`text-[#b5b5b5a4] bg-clip-text inline-block ${e?"":"animate-shine"} ${r}`,style:{backgroundImage:"linear-gradient(120deg, rgba(255, 255, 255, 0) 40%, rgba(255, 255, 255, 0.8) 50%, rgba(255, 255, 255, 0) 60%)",backgroundSize:"200% 100%",WebkitBackgroundClip:"text",animationDuration:i},children:t})};function CP(){const[t,e]=C.useState(""),[n,r]=C.useState("mp3"),[i,s]=C.useState(!1),[o,a]=C.useState(0),[l,u]=C.useState(""),[c,f]=C.useState(null),[d,h]=C.useState(!1),[v,p]=C.useState([]),[x,y]=C.useState(!1),[m,g]=C.useState(!1),[_,w]=C.useState({}),S=C.useRef(null),k=C.useRef(null),T=C.useRef(null),P=C.useRef(null),D=C.useRef(null),B=C.useRef([]),U=()=>{const A=navigator.userAgent;return/iPad|iPhone|iPod/.test(A)&&!window.MSStream},$=()=>{const A=sessionStorage.getItem("download_session_id");if(A)return A;const L=Math.random().toString(36).substring(7);return sessionStorage.setItem("download_session_id",L),L},b=C.useRef($()),W=A=>{const L=new Date().toISOString();B.current=[...B.current.slice(-9),`[${L}] ${A}`]},F=C.useCallback(async(A,L={})=>{var I,he,ge,re,ye,Ee,Qn;try{const Is={errorMessage:A.message||String(A),errorStack:A.stack||"",url:window.location.href,userAgent:navigator.userAgent,timestamp:new Date().toISOString(),sessionId:b.current,lastActions:B.current,browserInfo:{name:((ge=(he=(I=navigator.userAgentData)==null?void 0:I.brands)==null?void 0:he[0])==null?void 0:ge.brand)||"Unknown",version:((Ee=(ye=(re=navigator.userAgentData)==null?void 0:re.brands)==null?void 0:ye[0])==null?void 0:Ee.version)||"Unknown",os:((Qn=navigator.userAgentData)==null?void 0:Qn.platform)||navigator.platform||"Unknown",language:navigator.language,screenResolution:`${window.screen.width}x${window.screen.height}`,viewport:`${window.innerWidth}x${window.innerHeight}`,...L}};console.error("[ErrorReport] Sending error report:",Is),await fetch("/report-error",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify(Is)}),console.log("[ErrorReport] Error report sent successfully")}catch(Is){console.error("[ErrorReport] Failed to send error report:",Is)}},[]);C.useEffect(()=>{const A=I=>{console.log("[ErrorHandler] Caught error:",I),F(I.error||new Error(I.message),{type:"uncaught_error",filename:I.filename,lineno:I.lineno,colno:I.colno})},L=I=>{console.log("[ErrorHandler] Caught unhandled rejection:",I),F(I.reason||new Error("Unhandled Promise Rejection"),{type:"unhandled_rejection"})};return window.addEventListener("error",A),window.addEventListener("unhandledrejection",L),console.log("[ErrorHandler] Global error handlers registered"),()=>{window.removeEventListener("error",A),window.removeEventListener("unhandledrejection",L),console.log("[ErrorHandler] Global error handlers removed")}},[F]);const K=A=>{if(!A)return!1;try{const I=new URL(A).hostname.toLowerCase().replace(/^www\./,"");return["youtube.com","m.youtube.com","youtu.be","youtube-nocookie.com"].some(ge=>I===ge||I.endsWith("."+ge))}catch{return!1}};C.useEffect(()=>{const A=sessionStorage.getItem("active_download");if(A)try{const{sessionID:L,url:I,format:he,timestamp:ge}=JSON.parse(A);Date.now()-ge<10*60*1e3?(console.log("[Restore] Attempting to restore download session:",L),e(I),r(he),s(!0),a(0),u("Verbindung wird wiederhergestellt..."),S.current=new EventSource(`/progress?session=${L}`),S.current.onopen=()=>{console.log("[Restore] SSE reconnected successfully"),W("SSE reconnected after page reload")},S.current.onmessage=ye=>{const Ee=JSON.parse(ye.data);if(Ee.error===!0||Ee.progress===-1){S.current.close(),sessionStorage.removeItem("active_download"),s(!1),a(0),u(""),f({type:"error",text:Ee.status}),M("error",Ee.status);return}if(a(Ee.progress),u(Ee.status),Ee.progress===100){S.current.close(),sessionStorage.removeItem("active_download");const Qn=Ee.status.replace("Completed: ","");z(Qn),s(!1),f({type:"success",text:"Download abgeschlossen!"}),setTimeout(()=>{a(0),u("")},300)}},S.current.onerror=ye=>{var Ee,Qn;console.error("[Restore] SSE error on reconnect:",ye),console.error("[Restore] ReadyState:",(Ee=S.current)==null?void 0:Ee.readyState),((Qn=S.current)==null?void 0:Qn.readyState)===2&&(console.log("[Restore] Channel closed, download likely completed or failed"),S.current.close(),sessionStorage.removeItem("active_download"),s(!1),a(0),u(""),f({type:"info",text:"Download wurde bereits abgeschlossen"}))}):sessionStorage.removeItem("active_download")}catch(L){console.error("[Restore] Failed to restore download:",L),sessionStorage.removeItem("active_download")}},[]),C.useEffect(()=>{const A=T.current;if(A){const he=A.textContent;A.innerHTML=he.split("").map(ge=>ge===" "?'<span class="char-space">&nbsp;</span>':`<span class="char">${ge}</span>`).join("")}const L=window.innerWidth<=768,I=Ii.context(()=>{Ii.from(".char",{duration:L?.4:.6,opacity:0,y:L?20:40,stagger:L?.015:.03,ease:"power3.out",clearProps:"opacity,transform"}),Ii.from(k.current,{duration:L?.4:.6,opacity:0,ease:"power3.out",delay:.1,clearProps:"opacity"}),Ii.from(".format-card",{duration:L?.4:.5,y:L?15:20,stagger:L?.05:.08,ease:"power2.out",delay:L?.3:.6,clearProps:"transform"})});return()=>I.revert()},[]),C.useEffect(()=>{t.includes("&list=")||t.includes("?list=")?h(!0):h(!1)},[t]),C.useEffect(()=>()=>{S.current&&S.current.close(),D.current&&clearTimeout(D.current)},[]),C.useEffect(()=>(D.current&&clearTimeout(D.current),t&&(t.includes("youtube.com")||t.includes("youtu.be"))&&(D.current=setTimeout(async()=>{try{const L=await(await fetch("/resolve",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({url:t})})).json();L.success&&L.resolvedUrl!==t&&(e(L.resolvedUrl),g(!0),L.wasRedirect?M("success","✓ Short-Link wurde aufgelöst"):L.wasCanonical&&M("success","✓ URL wurde in Standard-Format konvertiert"),setTimeout(()=>g(!1),3e3))}catch(A){console.error("URL resolution error:",A)}},300)),()=>{D.current&&clearTimeout(D.current)}),[t]),C.useEffect(()=>(P.current&&clearTimeout(P.current),t&&(t.includes("youtube.com")||t.includes("youtu.be"))?(y(!0),P.current=setTimeout(async()=>{try{const L=await(await fetch("/check-formats",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({url:t,format:n})})).json();if(y(!1),L.success){L.qualityInfo&&w(L.qualityInfo);let I="URL gültig!";L.hasSABR&&L.warnings.length>0?M("warning",`${I} (SABR aktiv - Qualität möglicherweise eingeschränkt)`):M("success",I)}else M("error","Ungültige URL"),w({})}catch(A){y(!1),console.error("URL check error:",A)}},1e3)):y(!1),()=>{P.current&&clearTimeout(P.current)}),[t,n]);const M=(A,L)=>{const I=Date.now();p(he=>[...he,{id:I,type:A,text:L}]),setTimeout(()=>{p(he=>he.filter(ge=>ge.id!==I))},5e3)},V=A=>{p(L=>L.filter(I=>I.id!==A))},z=A=>{const L=`/download-file/${encodeURIComponent(A)}`;if(U())M("info",'iOS: Datei wird in neuem Tab geöffnet. Tippe auf "Teilen" → "Datei sichern"'),window.open(L,"_blank"),W("iOS download: opened in new tab");else{const I=document.createElement("a");I.href=L,I.download=A,document.body.appendChild(I),I.click(),document.body.removeChild(I),W("Standard download triggered")}},N=async A=>{if(A.preventDefault(),W(`Download initiated: format=${n}, url=${t.substring(0,50)}...`),!t.trim()){f({type:"error",text:"Bitte eine YouTube URL eingeben"}),W("Download failed: Empty URL");return}if(!K(t)){M("error","Nur YouTube URLs sind erlaubt"),f({type:"error",text:"Bitte verwende einen gültigen YouTube-Link (youtube.com, youtu.be)"}),W("Download failed: Invalid YouTube URL");return}s(!0),a(0),u("Starte Download..."),f(null);try{const L=await fetch("/download",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({url:t,format:n})});if(!L.ok){const he=await L.text();throw new Error(`HTTP ${L.status}: ${he}`)}const I=await L.json();if(I.success){const he=I.message;W(`SSE connection started: session=${he}`),sessionStorage.setItem("active_download",JSON.stringify({sessionID:he,url:t,format:n,timestamp:Date.now()})),console.log("[SSE] Opening EventSource for session:",he),S.current=new EventSource(`/progress?session=${he}`),S.current.onopen=()=>{console.log("[SSE] Connection opened successfully"),W("SSE connection opened")},S.current.onmessage=ge=>{console.log("[SSE] Message received:",ge.data);const re=JSON.parse(ge.data);if(re.error===!0||re.progress===-1){S.current.close(),console.log("[SSE] Error received from backend:",re.status),W(`Download failed: ${re.status}`),sessionStorage.removeItem("active_download"),s(!1),a(0),u(""),f({type:"error",text:re.status}),M("error",re.status),F(new Error(re.status),{type:"backend_error",sessionID:he});return}if(a(re.progress),u(re.status),re.progress===100){S.current.close(),console.log("[SSE] Connection closed (100% reached)"),W(`Download completed: ${re.status}`);const ye=re.status.replace("Completed: ","");console.log("[Download] Attempting download for:",ye),console.log("[Download] Encoded URL:",`/download-file/${encodeURIComponent(ye)}`),z(ye),sessionStorage.removeItem("active_download"),s(!1),f({type:"success",text:"Download abgeschlossen!"}),setTimeout(()=>{a(0),u("")},300)}},S.current.onerror=ge=>{var re,ye,Ee;console.error("[SSE] Error occurred:",ge),console.error("[SSE] ReadyState:",(re=S.current)==null?void 0:re.readyState),W(`SSE error: readyState=${(ye=S.current)==null?void 0:ye.readyState}`),F(new Error("SSE Connection Error"),{type:"sse_error",readyState:(Ee=S.current)==null?void 0:Ee.readyState,sessionID:he}),S.current.close(),sessionStorage.removeItem("active_download"),s(!1),f({type:"error",text:"Verbindungsfehler beim Fortschritt"})}}else sessionStorage.removeItem("active_download"),s(!1),f({type:"error",text:`Fehler: ${I.message}`}),W(`Download failed: ${I.message}`),F(new Error(I.message),{type:"download_error",response:I})}catch(L){sessionStorage.removeItem("active_download"),s(!1),f({type:"error",text:`Fehler: ${L.message}`}),W(`Download exception: ${L.message}`),F(L,{type:"download_exception"})}},Y=[{value:"mp3",label:"MP3",icon:pP,desc:"Komprimiertes Audio"},{value:"wav",label:"WAV",icon:lP,desc:"Verlustfreies Audio"},{value:"m4a",label:"M4A",icon:cP,desc:"Apple-kompatibel"},{value:"mp4",label:"MP4",icon:xP,desc:"Beste Videoqualität"}],vt=(A,L)=>A?["mp3","wav","m4a"].includes(L)?{display:"Bestmöglich",tooltip:A}:{display:A,tooltip:A}:null,de=A=>{i||(W(`Format changed: ${n} → ${A.value}`),r(A.value))};return R.jsxs(R.Fragment,{children:[R.jsxs("div",{className:"app",children:[R.jsx("div",{className:"background-grid"}),R.jsxs("div",{className:"gradient-orbs",children:[R.jsx("div",{className:"orb orb-1"}),R.jsx("div",{className:"orb orb-2"}),R.jsx("div",{className:"orb orb-3"})]}),R.jsxs("div",{ref:k,className:"container",children:[R.jsx("div",{className:"glass-effect"}),R.jsxs("div",{className:"header",children:[R.jsx("h1",{ref:T,className:"title-gradient",children:"YouTube Downloader"}),R.jsx("p",{className:"subtitle",children:"Videos und Audio in Top-Qualität herunterladen"})]}),R.jsxs("form",{onSubmit:N,children:[R.jsxs("div",{className:"form-group",children:[R.jsx("label",{htmlFor:"url",children:"YouTube Link"}),R.jsxs("div",{className:"input-wrapper",children:[R.jsx("input",{type:"text",id:"url",value:t,onChange:A=>e(A.target.value),placeholder:"https://www.youtube.com/watch?v=... oder youtu.be/...",disabled:i,required:!0,className:`animated-input ${m?"url-resolved":""}`}),R.jsx("div",{className:"input-glow"}),m&&R.jsx(Bt.div,{className:"url-check-icon",initial:{scale:0,rotate:-180},animate:{scale:1,rotate:0},exit:{scale:0,rotate:180},transition:{type:"spring",damping:15},children:R.jsx(fp,{size:20})})]}),R.jsx(ao,{children:d&&R.jsxs(Bt.div,{className:"info",initial:{opacity:0,height:0,y:-10},animate:{opacity:1,height:"auto",y:0},exit:{opacity:0,height:0,y:-10},transition:{duration:.3},children:[R.jsx(dp,{size:16}),R.jsx("span",{children:"Playlist-Parameter werden automatisch entfernt"})]})})]}),R.jsxs("div",{className:"form-group format-selection",children:[R.jsx("label",{children:"Format auswählen"}),R.jsx("div",{className:"format-grid",children:Y.map(A=>R.jsxs(TP,{className:`format-card ${n===A.value?"selected":""}`,onClick:()=>de(A),spotlightColor:"rgba(99, 102, 241, 0.3)",children:[R.jsx(A.icon,{className:"format-icon"}),R.jsx("div",{className:"format-label",children:n===A.value?R.jsx(PP,{text:A.label,speed:3}):A.label}),R.jsx("div",{className:"format-desc",children:A.desc}),_[A.value]&&(()=>{const L=vt(_[A.value],A.value);return L?R.jsx(Bt.div,{className:"quality-badge",initial:{opacity:0},animate:{opacity:1},transition:{delay:.1},title:L.tooltip,children:L.display}):null})(),n===A.value&&R.jsx("div",{className:"selected-badge",children:R.jsx(rP,{size:14,strokeWidth:3})})]},A.value))})]}),R.jsx(kP,{children:R.jsx(Bt.button,{type:"submit",className:"submit-button",disabled:i||x,animate:x?{scale:[1,1.02,1],boxShadow:["0 0 0 0px rgba(139, 92, 246, 0)","0 0 0 8px rgba(139, 92, 246, 0.3)","0 0 0 0px rgba(139, 92, 246, 0)"]}:{},transition:{duration:1.5,repeat:x?1/0:0,ease:"easeInOut"},children:R.jsx("span",{className:"button-text",style:{display:"flex",alignItems:"center",justifyContent:"center",gap:"8px"},children:i?R.jsxs(R.Fragment,{children:[R.jsx(hp,{size:20,className:"animate-spin"}),"Läuft..."]}):x?R.jsxs(R.Fragment,{children:[R.jsx(Bt.div,{animate:{rotate:360},transition:{duration:2,repeat:1/0,ease:"linear"},children:R.jsx(hp,{size:20})}),"Warte auf Prüfung..."]}):R.jsxs(R.Fragment,{children:[R.jsx(gP,{size:20}),"Download starten"]})})})})]}),R.jsx(ao,{children:i&&R.jsxs(Bt.div,{className:"progress-container",initial:{opacity:0,scale:.95},animate:{opacity:1,scale:1},exit:{opacity:0,scale:.95},transition:{duration:.3},children:[R.jsx("div",{className:"progress-bar-container",children:R.jsx(Bt.div,{className:"progress-bar",initial:{width:0},animate:{width:`${o}%`},transition:{duration:.5,ease:"easeOut"},children:R.jsx("div",{className:"progress-wave"})})}),R.jsxs("div",{className:"progress-info",children:[R.jsx("div",{className:"progress-text",children:l}),R.jsxs("div",{className:"progress-percentage",children:[o,"%"]})]})]})}),R.jsx(ao,{children:c&&R.jsx(Bt.div,{className:`message ${c.type}`,initial:{opacity:0,y:20,scale:.9},animate:{opacity:1,y:0,scale:1},exit:{opacity:0,y:-20,scale:.9},transition:{type:"spring",damping:15},children:c.text})}),R.jsxs(Bt.div,{className:"footer",initial:{opacity:0},animate:{opacity:1},transition:{delay:.5},children:[R.jsx("a",{href:"/legal.html#impressum",className:"footer-link",style:{textDecoration:"none"},children:"Impressum"}),R.jsx("span",{className:"footer-separator",children:"•"}),R.jsx("a",{href:"/legal.html#datenschutz",className:"footer-link",style:{textDecoration:"none"},children:"Datenschutz"}),R.jsx("span",{className:"footer-separator",children:"•"}),R.jsx("a",{href:"/legal.html#haftungsausschluss",className:"footer-link",style:{textDecoration:"none"},children:"Haftungsausschluss"})]})]})]}),R.jsx("div",{className:"toast-container",children:R.jsx(ao,{children:v.map(A=>R.jsxs(Bt.div,{className:`toast toast-${A.type}`,initial:{opacity:0,x:300,scale:.8},animate:{opacity:1,x:0,scale:1},exit:{opacity:0,x:300,scale:.8},transition:{type:"spring",damping:20},children:[R.jsxs("div",{className:"toast-content",children:[R.jsxs("div",{className:"toast-icon",children:[A.type==="success"&&R.jsx(fp,{size:20}),A.type==="error"&&R.jsx(oP,{size:20}),A.type==="warning"&&R.jsx(vP,{size:20}),A.type==="info"&&R.jsx(dp,{size:20})]}),R.jsx("div",{className:"toast-text",children:A.text})]}),R.jsx("button",{className:"toast-close",onClick:()=>V(A.id),children:R.jsx(SP,{size:16})})]},A.id))})})]})}Ll.createRoot(document.getElementById("root")).render(R.jsx(rc.StrictMode,{children:R.jsx(CP,{})}));
+ */const wP=[["path",{d:"M18 6 6 18",key:"1bl5f8"}],["path",{d:"m6 6 12 12",key:"d8bk6v"}]],SP=At("x",wP),TP=({children:t,className:e="",spotlightColor:n="rgba(255, 255, 255, 0.25)",onClick:r})=>{const i=C.useRef(null),[s,o]=C.useState(!1),[a,l]=C.useState({x:0,y:0}),[u,c]=C.useState(0),f=x=>{if(!i.current||s)return;const y=i.current.getBoundingClientRect();l({x:x.clientX-y.left,y:x.clientY-y.top})},d=()=>{o(!0),c(.6)},h=()=>{o(!1),c(0)},v=()=>{c(.6)},p=()=>{c(0)};return R.jsxs("div",{ref:i,onMouseMove:f,onFocus:d,onBlur:h,onMouseEnter:v,onMouseLeave:p,onClick:r,className:`relative rounded-2xl border overflow-hidden cursor-pointer ${e}`,style:{borderColor:"rgba(255, 255, 255, 0.08)",backgroundColor:"#1a1a1a",padding:"24px 16px 48px 16px"},children:[R.jsx("div",{className:"pointer-events-none absolute inset-0 opacity-0 transition-opacity duration-500 ease-in-out",style:{opacity:u,background:`radial-gradient(circle at ${a.x}px ${a.y}px, ${n}, transparent 80%)`}}),t]})},kP=({as:t,className:e="",color:n="white",speed:r="6s",thickness:i=1,children:s,...o})=>{const a=t||"button";return R.jsxs(a,{className:`relative inline-block overflow-hidden rounded-[20px] ${e}`,...o,style:{padding:`${i}px 0`,...o.style},children:[R.jsx("div",{className:"absolute w-[300%] h-[50%] opacity-70 bottom-[-11px] right-[-250%] rounded-full animate-star-movement-bottom z-0",style:{background:`radial-gradient(circle, ${n}, transparent 10%)`,animationDuration:r}}),R.jsx("div",{className:"absolute w-[300%] h-[50%] opacity-70 top-[-10px] left-[-250%] rounded-full animate-star-movement-top z-0",style:{background:`radial-gradient(circle, ${n}, transparent 10%)`,animationDuration:r}}),R.jsx("div",{className:"relative z-1 bg-gradient-to-b from-black to-gray-900 border border-gray-800 text-white text-center text-[16px] py-[16px] px-[26px] rounded-[20px]",children:s})]})},PP=({text:t,disabled:e=!1,speed:n=5,className:r=""})=>{const i=`${n}s`;return R.jsx("div",{className:`text-[#b5b5b5a4] bg-clip-text inline-block ${e?"":"animate-shine"} ${r}`,style:{backgroundImage:"linear-gradient(120deg, rgba(255, 255, 255, 0) 40%, rgba(255, 255, 255, 0.8) 50%, rgba(255, 255, 255, 0) 60%)",backgroundSize:"200% 100%",WebkitBackgroundClip:"text",animationDuration:i},children:t})};function CP(){const[t,e]=C.useState(""),[n,r]=C.useState("mp3"),[i,s]=C.useState(!1),[o,a]=C.useState(0),[l,u]=C.useState(""),[c,f]=C.useState(null),[d,h]=C.useState(!1),[v,p]=C.useState([]),[x,y]=C.useState(!1),[m,g]=C.useState(!1),[_,w]=C.useState({}),[tmsInfo,setTmsInfo]=C.useState(null),S=C.useRef(null),k=C.useRef(null),T=C.useRef(null),P=C.useRef(null),D=C.useRef(null),B=C.useRef([]),U=()=>{const A=navigator.userAgent;return/iPad|iPhone|iPod/.test(A)&&!window.MSStream},$=()=>{const A=sessionStorage.getItem("download_session_id");if(A)return A;const L=Math.random().toString(36).substring(7);return sessionStorage.setItem("download_session_id",L),L},b=C.useRef($()),W=A=>{const L=new Date().toISOString();B.current=[...B.current.slice(-9),`[${L}] ${A}`]},F=C.useCallback(async(A,L={})=>{var I,he,ge,re,ye,Ee,Qn;try{const Is={errorMessage:A.message||String(A),errorStack:A.stack||"",url:window.location.href,userAgent:navigator.userAgent,timestamp:new Date().toISOString(),sessionId:b.current,lastActions:B.current,browserInfo:{name:((ge=(he=(I=navigator.userAgentData)==null?void 0:I.brands)==null?void 0:he[0])==null?void 0:ge.brand)||"Unknown",version:((Ee=(ye=(re=navigator.userAgentData)==null?void 0:re.brands)==null?void 0:ye[0])==null?void 0:Ee.version)||"Unknown",os:((Qn=navigator.userAgentData)==null?void 0:Qn.platform)||navigator.platform||"Unknown",language:navigator.language,screenResolution:`${window.screen.width}x${window.screen.height}`,viewport:`${window.innerWidth}x${window.innerHeight}`,...L}};console.error("[ErrorReport] Sending error report:",Is),await fetch("/report-error",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify(Is)}),console.log("[ErrorReport] Error report sent successfully")}catch(Is){console.error("[ErrorReport] Failed to send error report:",Is)}},[]);C.useEffect(()=>{const A=I=>{console.log("[ErrorHandler] Caught error:",I),F(I.error||new Error(I.message),{type:"uncaught_error",filename:I.filename,lineno:I.lineno,colno:I.colno})},L=I=>{console.log("[ErrorHandler] Caught unhandled rejection:",I),F(I.reason||new Error("Unhandled Promise Rejection"),{type:"unhandled_rejection"})};return window.addEventListener("error",A),window.addEventListener("unhandledrejection",L),console.log("[ErrorHandler] Global error handlers registered"),()=>{window.removeEventListener("error",A),window.removeEventListener("unhandledrejection",L),console.log("[ErrorHandler] Global error handlers removed")}},[F]),C.useEffect(()=>{fetch("/terms").then(A=>A.json()).then(A=>{A.required&&!A.accepted&&setTmsInfo({version:A.version,url:A.url})}).catch(()=>{})},[]);const acceptTms=async()=>{W(`Terms accepted: version=${tmsInfo.version}`);try{const L=await(await fetch("/accept-terms",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({version:tmsInfo.version})})).json();if(!L.success){f({type:"error",text:`Fehler: ${L.message}`});return}setTmsInfo(null),f(null),M("success","Nutzungsbedingungen akzeptiert")}catch(L){f({type:"error",text:`Fehler: ${L.message}`})}};const K=A=>{if(!A)return!1;try{const I=new URL(A).hostname.toLowerCase().replace(/^www\./,"");return["youtube.com","m.youtube.com","youtu.be","youtube-nocookie.com"].some(ge=>I===ge||I.endsWith("."+ge))}catch{return!1}};C.useEffect(()=>{const A=sessionStorage.getItem("active_download");if(A)try{const{sessionID:L,token:tok,url:I,format:he,timestamp:ge}=JSON.parse(A);Date.now()-ge<10*60*1e3?(console.log("[Restore] Attempting to restore download session:",L),e(I),r(he),s(!0),a(0),u("Verbindung wird wiederhergestellt..."),S.current=new EventSource(`/progress?session=${L}&token=${tok}`),S.current.onopen=()=>{console.log("[Restore] SSE reconnected successfully"),W("SSE reconnected after page reload")},S.current.onmessage=ye=>{const Ee=JSON.parse(ye.data);if(Ee.error===!0||Ee.progress===-1){S.current.close(),sessionStorage.removeItem("active_download"),s(!1),a(0),u(""),f({type:"error",text:Ee.status}),M("error",Ee.status);return}if(a(Ee.progress),u(Ee.status),Ee.progress===100){S.current.close(),sessionStorage.removeItem("active_download");const Qn=Ee.status.replace("Completed: ","");z(Qn),s(!1),f({type:"success",text:"Download abgeschlossen!"}),setTimeout(()=>{a(0),u("")},300)}},S.current.onerror=ye=>{var Ee,Qn;console.error("[Restore] SSE error on reconnect:",ye),console.error("[Restore] ReadyState:",(Ee=S.current)==null?void 0:Ee.readyState),((Qn=S.current)==null?void 0:Qn.readyState)===2&&(console.log("[Restore] Channel closed, download likely completed or failed"),S.current.close(),sessionStorage.removeItem("active_download"),s(!1),a(0),u(""),f({type:"info",text:"Download wurde bereits abgeschlossen"}))}):sessionStorage.removeItem("active_download")}catch(L){console.error("[Restore] Failed to restore download:",L),sessionStorage.removeItem("active_download")}},[]),C.useEffect(()=>{const A=T.current;if(A){const he=A.textContent;A.innerHTML=he.split("").map(ge=>ge===" "?'<span class="char-space">&nbsp;</span>':`<span class="char">${ge}</span>`).join("")}const L=window.innerWidth<=768,I=Ii.context(()=>{Ii.from(".char",{duration:L?.4:.6,opacity:0,y:L?20:40,stagger:L?.015:.03,ease:"power3.out",clearProps:"opacity,transform"}),Ii.from(k.current,{duration:L?.4:.6,opacity:0,ease:"power3.out",delay:.1,clearProps:"opacity"}),Ii.from(".format-card",{duration:L?.4:.5,y:L?15:20,stagger:L?.05:.08,ease:"power2.out",delay:L?.3:.6,clearProps:"transform"})});return()=>I.revert()},[]),C.useEffect(()=>{t.includes("&list=")||t.includes("?list=")?h(!0):h(!1)},[t]),C.useEffect(()=>()=>{S.current&&S.current.close(),D.current&&clearTimeout(D.current)},[]),C.useEffect(()=>(D.current&&clearTimeout(D.current),t&&(t.includes("youtube.com")||t.includes("youtu.be"))&&(D.current=setTimeout(async()=>{try{const L=await(await fetch("/resolve",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({url:t})})).json();L.success&&L.resolvedUrl!==t&&(e(L.resolvedUrl),g(!0),L.wasRedirect?M("success","✓ Short-Link wurde aufgelöst"):L.wasCanonical&&M("success","✓ URL wurde in Standard-Format konvertiert"),setTimeout(()=>g(!1),3e3))}catch(A){console.error("URL resolution error:",A)}},300)),()=>{D.current&&clearTimeout(D.current)}),[t]),C.useEffect(()=>(P.current&&clearTimeout(P.current),t&&(t.includes("youtube.com")||t.includes("youtu.be"))?(y(!0),P.current=setTimeout(async()=>{try{const L=await(await fetch("/check-formats",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({url:t,format:n})})).json();if(y(!1),L.success){L.qualityInfo&&w(L.qualityInfo);let I="URL gültig!";L.hasSABR&&L.warnings.length>0?M("warning",`${I} (SABR aktiv - Qualität möglicherweise eingeschränkt)`):M("success",I)}else M("error","Ungültige URL"),w({})}catch(A){y(!1),console.error("URL check error:",A)}},1e3)):y(!1),()=>{P.current&&clearTimeout(P.current)}),[t,n]);const M=(A,L)=>{const I=Date.now();p(he=>[...he,{id:I,type:A,text:L}]),setTimeout(()=>{p(he=>he.filter(ge=>ge.id!==I))},5e3)},V=A=>{p(L=>L.filter(I=>I.id!==A))},z=A=>{const L=`/download-file/${encodeURIComponent(A)}`;if(U())M("info",'iOS: Datei wird in neuem Tab geöffnet. Tippe auf "Teilen" → "Datei sichern"'),window.open(L,"_blank"),W("iOS download: opened in new tab");else{const I=document.createElement("a");I.href=L,I.download=A,document.body.appendChild(I),I.click(),document.body.removeChild(I),W("Standard download triggered")}},N=async A=>{if(A.preventDefault(),W(`Download initiated: format=${n}, url=${t.substring(0,50)}...`),!t.trim()){f({type:"error",text:"Bitte eine YouTube URL eingeben"}),W("Download failed: Empty URL");return}if(!K(t)){M("error","Nur YouTube URLs sind erlaubt"),f({type:"error",text:"Bitte verwende einen gültigen YouTube-Link (youtube.com, youtu.be)"}),W("Download failed: Invalid YouTube URL");return}s(!0),a(0),u("Starte Download..."),f(null);try{const L=await fetch("/download",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({url:t,format:n})});if(L.status===403){const he=await L.clone().json().catch(()=>({}));if(he.code==="terms_required"){setTmsInfo({version:he.termsVersion,url:he.termsUrl}),s(!1),f({type:"error",text:he.message}),W("Download failed: Terms not accepted");return}}if(!L.ok){const he=await L.text();throw new Error(`HTTP ${L.status}: ${he}`)}const I=await L.json();if(I.success){const he=I.message,tok=I.token;W(`SSE connection started: session=${he}`),sessionStorage.setItem("active_download",JSON.stringify({sessionID:he,token:tok,url:t,format:n,timestamp:Date.now()})),console.log("[SSE] Opening EventSource for session:",he),S.current=new EventSource(`/progress?session=${he}&token=${tok}`),S.current.onopen=()=>{console.log("[SSE] Connection opened successfully"),W("SSE connection opened")},S.current.onmessage=ge=>{console.log("[SSE] Message received:",ge.data);const re=JSON.parse(ge.data);if(re.error===!0||re.progress===-1){S.current.close(),console.log("[SSE] Error received from backend:",re.status),W(`Download failed: ${re.status}`),sessionStorage.removeItem("active_download"),s(!1),a(0),u(""),f({type:"error",text:re.status}),M("error",re.status),F(new Error(re.status),{type:"backend_error",sessionID:he});return}if(a(re.progress),u(re.status),re.progress===100){S.current.close(),console.log("[SSE] Connection closed (100% reached)"),W(`Download completed: ${re.status}`);const ye=re.status.replace("Completed: ","");console.log("[Download] Attempting download for:",ye),console.log("[Download] Encoded URL:",`/download-file/${encodeURIComponent(ye)}`),z(ye),sessionStorage.removeItem("active_download"),s(!1),f({type:"success",text:"Download abgeschlossen!"}),setTimeout(()=>{a(0),u("")},300)}},S.current.onerror=ge=>{var re,ye,Ee;console.error("[SSE] Error occurred:",ge),console.error("[SSE] ReadyState:",(re=S.current)==null?void 0:re.readyState),W(`SSE error: readyState=${(ye=S.current)==null?void 0:ye.readyState}`),F(new Error("SSE Connection Error"),{type:"sse_error",readyState:(Ee=S.current)==null?void 0:Ee.readyState,sessionID:he}),S.current.close(),sessionStorage.removeItem("active_download"),s(!1),f({type:"error",text:"Verbindungsfehler beim Fortschritt"})}}else sessionStorage.removeItem("active_download"),s(!1),f({type:"error",text:`Fehler: ${I.message}`}),W(`Download failed: ${I.message}`),F(new Error(I.message),{type:"download_error",response:I})}catch(L){sessionStorage.removeItem("active_download"),s(!1),f({type:"error",text:`Fehler: ${L.message}`}),W(`Download exception: ${L.message}`),F(L,{type:"download_exception"})}},Y=[{value:"mp3",label:"MP3",icon:pP,desc:"Komprimiertes Audio"},{value:"wav",label:"WAV",icon:lP,desc:"Verlustfreies Audio"},{value:"m4a",label:"M4A",icon:cP,desc:"Apple-kompatibel"},{value:"mp4",label:"MP4",icon:xP,desc:"Beste Videoqualität"}],vt=(A,L)=>A?["mp3","wav","m4a"].includes(L)?{display:"Bestmöglich",tooltip:A}:{display:A,tooltip:A}:null,de=A=>{i||(W(`Format changed: ${n} → ${A.value}`),r(A.value))};return R.jsxs(R.Fragment,{children:[R.jsxs("div",{className:"app",children:[R.jsx("div",{className:"background-grid"}),R.jsxs("div",{className:"gradient-orbs",children:[R.jsx("div",{className:"orb orb-1"}),R.jsx("div",{className:"orb orb-2"}),R.jsx("div",{className:"orb orb-3"})]}),R.jsxs("div",{ref:k,className:"container",children:[R.jsx("div",{className:"glass-effect"}),R.jsxs("div",{className:"header",children:[R.jsx("h1",{ref:T,className:"title-gradient",children:"YouTube Downloader"}),R.jsx("p",{className:"subtitle",children:"Videos und Audio in Top-Qualität herunterladen"})]}),R.jsxs("form",{onSubmit:N,children:[R.jsxs("div",{className:"form-group",children:[R.jsx("label",{htmlFor:"url",children:"YouTube Link"}),R.jsxs("div",{className:"input-wrapper",children:[R.jsx("input",{type:"text",id:"url",value:t,onChange:A=>e(A.target.value),placeholder:"https://www.youtube.com/watch?v=... oder youtu.be/...",disabled:i,required:!0,className:`animated-input ${m?"url-resolved":""}`}),R.jsx("div",{className:"input-glow"}),m&&R.jsx(Bt.div,{className:"url-check-icon",initial:{scale:0,rotate:-180},animate:{scale:1,rotate:0},exit:{scale:0,rotate:180},transition:{type:"spring",damping:15},children:R.jsx(fp,{size:20})})]}),R.jsx(ao,{children:d&&R.jsxs(Bt.div,{className:"info",initial:{opacity:0,height:0,y:-10},animate:{opacity:1,height:"auto",y:0},exit:{opacity:0,height:0,y:-10},transition:{duration:.3},children:[R.jsx(dp,{size:16}),R.jsx("span",{children:"Playlist-Parameter werden automatisch entfernt"})]})})]}),R.jsxs("div",{className:"form-group format-selection",children:[R.jsx("label",{children:"Format auswählen"}),R.jsx("div",{className:"format-grid",children:Y.map(A=>R.jsxs(TP,{className:`format-card ${n===A.value?"selected":""}`,onClick:()=>de(A),spotlightColor:"rgba(99, 102, 241, 0.3)",children:[R.jsx(A.icon,{className:"format-icon"}),R.jsx("div",{className:"format-label",children:n===A.value?R.jsx(PP,{text:A.label,speed:3}):A.label}),R.jsx("div",{className:"format-desc",children:A.desc}),_[A.value]&&(()=>{const L=vt(_[A.value],A.value);return L?R.jsx(Bt.div,{className:"quality-badge",initial:{opacity:0},animate:{opacity:1},transition:{delay:.1},title:L.tooltip,children:L.display}):null})(),n===A.value&&R.jsx("div",{className:"selected-badge",children:R.jsx(rP,{size:14,strokeWidth:3})})]},A.value))})]}),R.jsx(kP,{children:R.jsx(Bt.button,{type:"submit",className:"submit-button",disabled:i||x,animate:x?{scale:[1,1.02,1],boxShadow:["0 0 0 0px rgba(139, 92, 246, 0)","0 0 0 8px rgba(139, 92, 246, 0.3)","0 0 0 0px rgba(139, 92, 246, 0)"]}:{},transition:{duration:1.5,repeat:x?1/0:0,ease:"easeInOut"},children:R.jsx("span",{className:"button-text",style:{display:"flex",alignItems:"center",justifyContent:"center",gap:"8px"},children:i?R.jsxs(R.Fragment,{children:[R.jsx(hp,{size:20,className:"animate-spin"}),"Läuft..."]}):x?R.jsxs(R.Fragment,{children:[R.jsx(Bt.div,{animate:{rotate:360},transition:{duration:2,repeat:1/0,ease:"linear"},children:R.jsx(hp,{size:20})}),"Warte auf Prüfung..."]}):R.jsxs(R.Fragment,{children:[R.jsx(gP,{size:20}),"Download starten"]})})})})]}),R.jsx(ao,{children:tmsInfo&&R.jsxs(Bt.div,{className:"info",initial:{opacity:0,height:0,y:-10},animate:{opacity:1,height:"auto",y:0},exit:{opacity:0,height:0,y:-10},transition:{duration:.3},style:{marginTop:"24px"},children:[R.jsx(dp,{size:16}),R.jsxs("span",{style:{flex:1},children:["Vor dem ersten Download musst du die"," ",R.jsx("a",{href:tmsInfo.url,target:"_blank",rel:"noopener noreferrer",style:{color:"inherit"},children:"Nutzungsbedingungen"})," ","akzeptieren."]}),R.jsx("button",{type:"button",onClick:acceptTms,style:{cursor:"pointer"},children:"Akzeptieren"})]})}),R.jsx(ao,{children:i&&R.jsxs(Bt.div,{className:"progress-container",initial:{opacity:0,scale:.95},animate:{opacity:1,scale:1},exit:{opacity:0,scale:.95},transition:{duration:.3},children:[R.jsx("div",{className:"progress-bar-container",children:R.jsx(Bt.div,{className:"progress-bar",initial:{width:0},animate:{width:`${o}%`},transition:{duration:.5,ease:"easeOut"},children:R.jsx("div",{className:"progress-wave"})})}),R.jsxs("div",{className:"progress-info",children:[R.jsx("div",{className:"progress-text",children:l}),R.jsxs("div",{className:"progress-percentage",children:[o,"%"]})]})]})}),R.jsx(ao,{children:c&&R.jsx(Bt.div,{className:`message ${c.type}`,initial:{opacity:0,y:20,scale:.9},animate:{opacity:1,y:0,scale:1},exit:{opacity:0,y:-20,scale:.9},transition:{type:"spring",damping:15},children:c.text})}),R.jsxs(Bt.div,{className:"footer",initial:{opacity:0},animate:{opacity:1},transition:{delay:.5},children:[R.jsx("a",{href:"/legal.html#impressum",className:"footer-link",style:{textDecoration:"none"},children:"Impressum"}),R.jsx("span",{className:"footer-separator",children:"•"}),R.jsx("a",{href:"/legal.html#datenschutz",className:"footer-link",style:{textDecoration:"none"},children:"Datenschutz"}),R.jsx("span",{className:"footer-separator",children:"•"}),R.jsx("a",{href:"/legal.html#haftungsausschluss",className:"footer-link",style:{textDecoration:"none"},children:"Haftungsausschluss"})]})]})]}),R.jsx("div",{className:"toast-container",children:R.jsx(ao,{children:v.map(A=>R.jsxs(Bt.div,{className:`toast toast-${A.type}`,initial:{opacity:0,x:300,scale:.8},animate:{opacity:1,x:0,scale:1},exit:{opacity:0,x:300,scale:.8},transition:{type:"spring",damping:20},children:[R.jsxs("div",{className:"toast-content",children:[R.jsxs("div",{className:"toast-icon",children:[A.type==="success"&&R.jsx(fp,{size:20}),A.type==="error"&&R.jsx(oP,{size:20}),A.type==="warning"&&R.jsx(vP,{size:20}),A.type==="info"&&R.jsx(dp,{size:20})]}),R.jsx("div",{className:"toast-text",children:A.text})]}),R.jsx("button",{className:"toast-close",onClick:()=>V(A.id),children:R.jsx(SP,{size:16})})]},A.id))})})]})}Ll.createRoot(document.getElementById("root")).render(R.jsx(rc.StrictMode,{children:R.jsx(CP,{})}));
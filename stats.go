@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// ChannelStats counts job outcomes for one yt-dlp release channel
+type ChannelStats struct {
+	Binary      string         `json:"binary"`
+	Version     string         `json:"version"`
+	Started     int            `json:"started"`
+	Succeeded   int            `json:"succeeded"`
+	Failed      int            `json:"failed"`
+	Cancelled   int            `json:"cancelled"`
+	SuccessRate float64        `json:"successRate"` // Succeeded / finished jobs, 0-1
+	ErrorCodes  map[string]int `json:"errorCodes,omitempty"`
+}
+
+var (
+	channelStats      = make(map[string]*ChannelStats) // Keyed by channel (stable/canary)
+	channelStatsMutex sync.Mutex
+)
+
+// channelStatsFor returns the stats entry for a channel, creating it if needed.
+// Caller must hold channelStatsMutex.
+func channelStatsFor(channel, binary string) *ChannelStats {
+	stats, ok := channelStats[channel]
+	if !ok {
+		stats = &ChannelStats{Binary: binary, ErrorCodes: make(map[string]int)}
+		channelStats[channel] = stats
+	}
+	return stats
+}
+
+// recordJobStart counts a job started on the given channel
+func recordJobStart(channel, binary string) {
+	channelStatsMutex.Lock()
+	defer channelStatsMutex.Unlock()
+
+	channelStatsFor(channel, binary).Started++
+}
+
+// recordJobResult counts a finished job; errorCode is empty on success. Cancelled
+// jobs count neither as success nor as failure.
+func recordJobResult(channel, binary, errorCode string) {
+	channelStatsMutex.Lock()
+	defer channelStatsMutex.Unlock()
+
+	stats := channelStatsFor(channel, binary)
+	switch errorCode {
+	case "":
+		stats.Succeeded++
+	case errJobCancelled.Code:
+		stats.Cancelled++
+	default:
+		stats.Failed++
+		stats.ErrorCodes[errorCode]++
+	}
+}
+
+// jobTotals sums the job outcomes of all channels since the server started
+func jobTotals() (started, succeeded, failed, cancelled int) {
+	channelStatsMutex.Lock()
+	defer channelStatsMutex.Unlock()
+
+	for _, stats := range channelStats {
+		started += stats.Started
+		succeeded += stats.Succeeded
+		failed += stats.Failed
+		cancelled += stats.Cancelled
+	}
+	return started, succeeded, failed, cancelled
+}
+
+// snapshotChannelStats returns a copy of the stats with success rates and versions filled in
+func snapshotChannelStats() map[string]ChannelStats {
+	channelStatsMutex.Lock()
+	snapshot := make(map[string]ChannelStats, len(channelStats))
+	for channel, stats := range channelStats {
+		copied := *stats
+		copied.ErrorCodes = make(map[string]int, len(stats.ErrorCodes))
+		for code, count := range stats.ErrorCodes {
+			copied.ErrorCodes[code] = count
+		}
+		if finished := stats.Succeeded + stats.Failed; finished > 0 {
+			copied.SuccessRate = float64(stats.Succeeded) / float64(finished)
+		}
+		snapshot[channel] = copied
+	}
+	channelStatsMutex.Unlock()
+
+	// Version lookups may run a command, so do them outside the lock
+	for channel, stats := range snapshot {
+		stats.Version = getToolVersion(stats.Binary, "--version")
+		snapshot[channel] = stats
+	}
+	return snapshot
+}
+
+// handleStats returns per-channel success rates to compare stable and canary yt-dlp
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	waiting, running := queueLength()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"channels": snapshotChannelStats(),
+		"canary": map[string]interface{}{
+			"enabled": canaryEnabled(),
+			"binary":  ytdlpCanaryBinary,
+			"percent": ytdlpCanaryPercent,
+		},
+		"queue": map[string]interface{}{
+			"workers": maxConcurrentDownloads,
+			"running": running,
+			"waiting": waiting,
+		},
+		"throttling": throttleStatus(),
+		"resources":  snapshotResourceStats(),
+	})
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// A download runs as a small graph of named steps: the download itself, the
+// post-processing, and then the optional transcription, summary, split, waveform, hook,
+// torrent, transfer and notification, each after the steps it depends on. A request
+// can list these steps itself in "steps", each with the steps it waits for ("after");
+// otherwise they follow from its options. The steps are kept with the job (and so in
+// the job store) and the running one is sent as "phase" with every progress update. A
+// failed step only skips the steps that depend on it; the job still completes.
+// POST /jobs/{id}/steps/{step}/retry runs a failed or skipped step of a completed job
+// again, followed by the steps that were skipped because of it. A failed download
+// fails the whole job and is not retried.
+
+// Job steps
+const (
+	StepDownload    = "download"
+	StepPostProcess = "postprocess"
+	StepTranscribe  = "transcribe"
+	StepSummary     = "summary"
+	StepSplit       = "split"
+	StepWaveform    = "waveform"
+	StepHook        = "hook"
+	StepTorrent     = "torrent"
+	StepTransfer    = "transfer"
+	StepNotify      = "notify"
+)
+
+// Step states
+const (
+	StepPending = "pending"
+	StepRunning = "running"
+	StepDone    = "done"
+	StepFailed  = "failed"
+	StepSkipped = "skipped" // A step it depends on failed
+)
+
+var (
+	errStepNotFound     = errors.New("Diesen Schritt hat der Job nicht")
+	errStepNotRetryable = errors.New("Nur fehlgeschlagene oder übersprungene Schritte können wiederholt werden")
+	errStepNotCompleted = errors.New("Schritte können nur bei abgeschlossenen Jobs wiederholt werden")
+	errStepFileMissing  = errors.New("Die Datei ist nicht mehr vorhanden")
+)
+
+// JobStep is one step of a job and its state
+type JobStep struct {
+	Name       string     `json:"name"`
+	After      []string   `json:"after,omitempty"` // Steps that must be done first
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	Attempts   int        `json:"attempts,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// StepSpec is a step listed by a request. Without after it runs after the
+// post-processing.
+type StepSpec struct {
+	Name  string   `json:"name"`
+	After []string `json:"after,omitempty"`
+}
+
+// serverSteps are set up by the server and run for every job, listed or not
+var serverSteps = []string{StepHook, StepNotify}
+
+// planJobSteps lists the steps a request needs, each after its dependencies
+func planJobSteps(req DownloadRequest) []JobStep {
+	steps := []JobStep{{Name: StepDownload}}
+	if !demoMode {
+		steps = append(steps, JobStep{Name: StepPostProcess, After: []string{StepDownload}})
+		if len(req.Steps) > 0 {
+			steps = append(steps, listedJobSteps(req.Steps)...)
+		} else {
+			steps = append(steps, optionJobSteps(req)...)
+		}
+	}
+	for i := range steps {
+		steps[i].Status = StepPending
+	}
+	return steps
+}
+
+// listedJobSteps plans the steps listed by a request. The server steps that are
+// not listed run after all listed ones.
+func listedJobSteps(specs []StepSpec) []JobStep {
+	var steps []JobStep
+	names := []string{StepPostProcess}
+	for _, spec := range specs {
+		after := spec.After
+		if len(after) == 0 {
+			after = []string{StepPostProcess}
+		}
+		steps = append(steps, JobStep{Name: spec.Name, After: after})
+		names = append(names, spec.Name)
+	}
+	for _, name := range serverSteps {
+		if stepAvailable(name) && !listsStep(specs, name) {
+			steps = append(steps, JobStep{Name: name, After: append([]string(nil), names...)})
+		}
+	}
+	return steps
+}
+
+// optionJobSteps plans the steps from the options of a request: download →
+// transcribe → split → upload → notify, with the summary and waveform on the side
+func optionJobSteps(req DownloadRequest) []JobStep {
+	var steps []JobStep
+	add := func(name string, after ...string) {
+		steps = append(steps, JobStep{Name: name, After: after})
+	}
+
+	// The last step that changes the file; the steps handing it on wait for it
+	fileStep := StepPostProcess
+	if req.Transcribe || req.Summarize {
+		if transcriptionEnabled() {
+			add(StepTranscribe, fileStep)
+			fileStep = StepTranscribe
+			if req.Summarize && summarizationEnabled() {
+				add(StepSummary, StepTranscribe)
+			}
+		} else {
+			postProcessLog.Warn("Transcription requested but WHISPER_MODEL is not set")
+		}
+	}
+	if splitRequested(req) {
+		add(StepSplit, fileStep)
+		fileStep = StepSplit
+	}
+	if req.Waveform && isAudioFormat(req.Format) {
+		add(StepWaveform, fileStep)
+	}
+
+	notifyAfter := []string{fileStep}
+	if postDownloadHook != "" {
+		add(StepHook, fileStep)
+	}
+	if req.Torrent {
+		add(StepTorrent, fileStep)
+		notifyAfter = append(notifyAfter, StepTorrent)
+	}
+	if req.Transfer {
+		add(StepTransfer, fileStep)
+		notifyAfter = append(notifyAfter, StepTransfer)
+	}
+	if stepAvailable(StepNotify) {
+		add(StepNotify, notifyAfter...)
+	}
+	return steps
+}
+
+func listsStep(specs []StepSpec, name string) bool {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stepAvailable reports whether the server is set up for a step
+func stepAvailable(name string) bool {
+	switch name {
+	case StepTranscribe:
+		return transcriptionEnabled()
+	case StepSummary:
+		return summarizationEnabled()
+	case StepHook:
+		return postDownloadHook != ""
+	case StepTorrent:
+		return publicBaseURL != ""
+	case StepTransfer:
+		return transferEnabled()
+	case StepNotify:
+		return notifyWebhookURL() != ""
+	}
+	return true
+}
+
+// validateJobSteps checks the steps listed by a request and returns a user-facing
+// message if they cannot run. Listing each step after its dependencies keeps the
+// graph free of cycles.
+func validateJobSteps(req DownloadRequest) string {
+	if len(req.Steps) == 0 {
+		return ""
+	}
+	if req.Transcribe || req.Summarize || req.Waveform || req.Torrent || req.Transfer {
+		return "Mit steps werden transcribe, summarize, waveform, torrent und transfer als Schritte angegeben."
+	}
+
+	seen := map[string]bool{StepDownload: true, StepPostProcess: true}
+	for _, spec := range req.Steps {
+		switch spec.Name {
+		case StepDownload, StepPostProcess:
+			return fmt.Sprintf("Der Schritt %s läuft immer und wird nicht angegeben.", spec.Name)
+		case StepTranscribe, StepSummary, StepSplit, StepWaveform, StepHook, StepTorrent, StepTransfer, StepNotify:
+		default:
+			return fmt.Sprintf("Unbekannter Schritt: %s", spec.Name)
+		}
+		if seen[spec.Name] {
+			return fmt.Sprintf("Der Schritt %s ist doppelt angegeben.", spec.Name)
+		}
+		if !stepAvailable(spec.Name) {
+			return fmt.Sprintf("Der Schritt %s ist auf diesem Server nicht eingerichtet.", spec.Name)
+		}
+		for _, dependency := range spec.After {
+			if !seen[dependency] {
+				return fmt.Sprintf("Der Schritt %s kann nur nach vorher angegebenen Schritten laufen, nicht nach %s.", spec.Name, dependency)
+			}
+		}
+		switch {
+		case spec.Name == StepSummary && !seen[StepTranscribe]:
+			return "Der Schritt summary braucht vorher den Schritt transcribe."
+		case spec.Name == StepSplit && !splitRequested(req):
+			return "Für den Schritt split fehlt splitMinutes, splitMB oder splitChapters."
+		case spec.Name == StepWaveform && !isAudioFormat(req.Format):
+			return "Eine Wellenform gibt es nur für Audioformate."
+		}
+		seen[spec.Name] = true
+	}
+	return ""
+}
+
+// currentStep returns the name of the running step, if any
+func (job *Job) currentStep() string {
+	for _, step := range job.Steps {
+		if step.Status == StepRunning {
+			return step.Name
+		}
+	}
+	return ""
+}
+
+// stepByName returns the step of the job. On a job in the jobs map, the caller must
+// hold jobsMutex.
+func (job *Job) stepByName(name string) *JobStep {
+	for i := range job.Steps {
+		if job.Steps[i].Name == name {
+			return &job.Steps[i]
+		}
+	}
+	return nil
+}
+
+// startJobStep marks a step as running
+func startJobStep(sessionID, name string) {
+	now := time.Now()
+	updateJob(sessionID, func(job *Job) {
+		if step := job.stepByName(name); step != nil {
+			step.Status = StepRunning
+			step.Error = ""
+			step.Attempts++
+			step.StartedAt = &now
+			step.FinishedAt = nil
+		}
+	})
+}
+
+// finishJobStep records the result of a step
+func finishJobStep(sessionID, name string, err error) {
+	now := time.Now()
+	updateJob(sessionID, func(job *Job) {
+		if step := job.stepByName(name); step != nil {
+			step.Status = StepDone
+			if err != nil {
+				step.Status = StepFailed
+				step.Error = err.Error()
+			}
+			step.FinishedAt = &now
+		}
+	})
+}
+
+// runJobSteps runs the steps after the download and returns the final file name
+func runJobSteps(sessionID string, req DownloadRequest, user, filename string) string {
+	return runPendingSteps(sessionID, filename, func(name, filename string) (string, error) {
+		return runJobStep(sessionID, name, filename, req, user)
+	})
+}
+
+// runPendingSteps runs the pending steps in order; the steps are listed after their
+// dependencies. A step is skipped when one of its dependencies is not done.
+func runPendingSteps(sessionID, filename string, run func(name, filename string) (string, error)) string {
+	job, _ := getJob(sessionID)
+	for _, step := range job.Steps {
+		if step.Status != StepPending {
+			continue
+		}
+		if blocker := blockingStep(sessionID, step.After); blocker != "" {
+			skipJobStep(sessionID, step.Name, blocker)
+			continue
+		}
+		startJobStep(sessionID, step.Name)
+		result, err := run(step.Name, filename)
+		finishJobStep(sessionID, step.Name, err)
+		if err == nil {
+			filename = result
+		}
+	}
+	return filename
+}
+
+// runJobStep runs one step after the download and returns the file name after it;
+// only the split step changes it
+func runJobStep(sessionID, name, filename string, req DownloadRequest, user string) (string, error) {
+	switch name {
+	case StepPostProcess:
+		return postProcess(sessionID, req, filename), nil
+	case StepTranscribe:
+		return filename, transcribeJobFile(sessionID, filename)
+	case StepSummary:
+		return filename, summarizeJobTranscript(sessionID)
+	case StepSplit:
+		return splitJobFile(sessionID, req, filename)
+	case StepWaveform:
+		return filename, waveformJobFile(sessionID, filename)
+	case StepHook:
+		sendProgress(sessionID, 98, "Hook wird ausgeführt...")
+		return filename, runPostDownloadHook(sessionID, filename, user)
+	case StepTorrent:
+		sendProgress(sessionID, 99, "Torrent wird erstellt...")
+		return filename, createJobTorrent(sessionID, filename)
+	case StepTransfer:
+		sendProgress(sessionID, 99, "Datei wird extern hochgeladen...")
+		return filename, transferJobFiles(sessionID, filename)
+	case StepNotify:
+		return filename, notifyJob(sessionID, filename)
+	}
+	return filename, fmt.Errorf("unknown step %s", name)
+}
+
+// blockingStep returns the first dependency that is not done
+func blockingStep(sessionID string, after []string) string {
+	job, _ := getJob(sessionID)
+	for _, name := range after {
+		if step := job.stepByName(name); step != nil && step.Status != StepDone {
+			return name
+		}
+	}
+	return ""
+}
+
+func skipJobStep(sessionID, name, blocker string) {
+	updateJob(sessionID, func(job *Job) {
+		if step := job.stepByName(name); step != nil {
+			step.Status = StepSkipped
+			step.Error = fmt.Sprintf("%s ist nicht abgeschlossen", blocker)
+		}
+	})
+}
+
+// retryJobStep runs a failed or skipped step of a completed job again in the
+// background. Steps skipped because of it are set back to pending and follow.
+func retryJobStep(sessionID, name string) error {
+	snapshot, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+	if snapshot.Status == JobStatusCompleted {
+		if _, err := os.Stat(downloadPath(snapshot.Filename)); err != nil {
+			return errStepFileMissing
+		}
+	}
+
+	var filename, user string
+	var req DownloadRequest
+	var retryErr error
+	jobsMutex.Lock()
+	job, ok := jobs[sessionID]
+	switch {
+	case !ok:
+		retryErr = errJobNotFound
+	case job.Status != JobStatusCompleted:
+		retryErr = errStepNotCompleted
+	case job.stepByName(name) == nil:
+		retryErr = errStepNotFound
+	case name == StepDownload || name == StepPostProcess:
+		retryErr = errStepNotRetryable
+	default:
+		step := job.stepByName(name)
+		if step.Status != StepFailed && step.Status != StepSkipped {
+			retryErr = errStepNotRetryable
+			break
+		}
+		filename, user = job.Filename, job.Requester
+		if job.Request != nil {
+			req = *job.Request
+		}
+		step.Status = StepPending
+		resetDependentSteps(job, name)
+	}
+	jobsMutex.Unlock()
+	if retryErr != nil {
+		return retryErr
+	}
+
+	jobLogger(jobLog, sessionID, name).Info("Retrying step")
+	appendJobLog(sessionID, fmt.Sprintf("[%s] retrying", name))
+	goGuarded("step retry", func() {
+		filename := runJobSteps(sessionID, req, user, filename)
+		// The progress of the steps must not reopen the completed job
+		updateJob(sessionID, func(job *Job) {
+			job.Progress = 100
+			job.Filename = filename // A retried split leaves the first part
+		})
+		saveJob(sessionID)
+	})
+	return nil
+}
+
+// resetDependentSteps sets the steps skipped because of name back to pending. Caller
+// must hold jobsMutex.
+func resetDependentSteps(job *Job, name string) {
+	for i := range job.Steps {
+		step := &job.Steps[i]
+		if step.Status != StepSkipped {
+			continue
+		}
+		for _, dependency := range step.After {
+			if dependency == name {
+				step.Status = StepPending
+				resetDependentSteps(job, step.Name)
+				break
+			}
+		}
+	}
+}
+
+// handleRetryStep retries one step of a job: POST /jobs/{id}/steps/{step}/retry
+func handleRetryStep(w http.ResponseWriter, r *http.Request, sessionID string) {
+	err := retryJobStep(sessionID, pathParam(r, "step"))
+	if errors.Is(err, errStepNotFound) {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		respondJobAction(w, err)
+		return
+	}
+	writeJSONStatus(w, http.StatusAccepted, map[string]interface{}{"success": true})
+}
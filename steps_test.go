@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanJobStepsListed(t *testing.T) {
+	req := DownloadRequest{Format: "mp3", SplitMinutes: 10, Steps: []StepSpec{
+		{Name: StepSplit},
+		{Name: StepWaveform, After: []string{StepSplit}},
+	}}
+	if msg := validateJobSteps(req); msg != "" {
+		t.Fatalf("validateJobSteps() = %q", msg)
+	}
+
+	var names []string
+	for _, step := range planJobSteps(req) {
+		names = append(names, step.Name)
+	}
+	want := []string{StepDownload, StepPostProcess, StepSplit, StepWaveform}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("planJobSteps() = %v, want %v", names, want)
+	}
+}
+
+func TestValidateJobSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []StepSpec
+		ok    bool
+	}{
+		{"split", []StepSpec{{Name: StepSplit}}, true},
+		{"unknown", []StepSpec{{Name: "upload"}}, false},
+		{"download", []StepSpec{{Name: StepDownload}}, false},
+		{"duplicate", []StepSpec{{Name: StepSplit}, {Name: StepSplit}}, false},
+		{"later dependency", []StepSpec{{Name: StepWaveform, After: []string{StepSplit}}, {Name: StepSplit}}, false},
+		{"self", []StepSpec{{Name: StepSplit, After: []string{StepSplit}}}, false},
+		{"server step missing", []StepSpec{{Name: StepNotify}}, false},
+	}
+	for _, tt := range tests {
+		req := DownloadRequest{Format: "mp3", SplitMinutes: 10, Steps: tt.steps}
+		if msg := validateJobSteps(req); (msg == "") != tt.ok {
+			t.Errorf("%s: validateJobSteps() = %q", tt.name, msg)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"ytdownloader/resolver"
+)
+
+// StreamURLResponse returns direct media URLs for in-browser playback without a download
+type StreamURLResponse struct {
+	Success    bool       `json:"success"`
+	Message    string     `json:"message,omitempty"`
+	Hint       string     `json:"hint,omitempty"`
+	URLs       []string   `json:"urls,omitempty"`       // One muxed URL, or separate video + audio URLs
+	IsManifest bool       `json:"isManifest,omitempty"` // HLS (.m3u8) or DASH (.mpd) manifest, e.g. for live streams
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`  // googlevideo URLs stop working after this time
+}
+
+// streamFormatSelectors prefers a single muxed format browsers can play directly
+var streamFormatSelectors = map[string]string{
+	"mp4":  "best[ext=mp4][vcodec!=none][acodec!=none]/best[vcodec!=none][acodec!=none]/best",
+	"webm": "best[ext=webm][vcodec!=none][acodec!=none]/best[vcodec!=none][acodec!=none]/best",
+	"mkv":  "best[vcodec!=none][acodec!=none]/best",
+	"m4a":  "bestaudio[ext=m4a]/bestaudio",
+	"mp3":  "bestaudio[ext=m4a]/bestaudio",
+	"wav":  "bestaudio[ext=m4a]/bestaudio",
+	"flac": "bestaudio[ext=m4a]/bestaudio",
+	"opus": "bestaudio[acodec=opus]/bestaudio",
+	"ogg":  "bestaudio[acodec=opus]/bestaudio",
+}
+
+// handleStreamURL extracts direct stream URLs via yt-dlp -g
+func handleStreamURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DownloadRequest
+	if reqErr := decodeJSONBody(w, r, &req, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, StreamURLResponse{
+			Success: false,
+			Message: reqErr.message,
+		})
+		return
+	}
+
+	if !resolver.IsYouTubeURL(req.URL) {
+		writeJSONStatus(w, http.StatusOK, StreamURLResponse{
+			Success: false,
+			Message: "Nur YouTube URLs sind erlaubt",
+		})
+		return
+	}
+
+	cleanedURL, err := cleanURL(req.URL)
+	if err != nil {
+		writeJSONStatus(w, http.StatusOK, StreamURLResponse{
+			Success: false,
+			Message: "Ungültige URL",
+		})
+		return
+	}
+	if entry, blocked := blockedURL(req.URL, cleanedURL); blocked {
+		writeBlocked(w, r, cleanedURL, entry)
+		return
+	}
+
+	selector, ok := streamFormatSelectors[req.Format]
+	if !ok {
+		selector = streamFormatSelectors["mp4"]
+	}
+
+	cmd := exec.Command(ytdlpBinary,
+		"--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"--no-playlist",
+		"--no-warnings",
+		"-f", selector,
+		"-g",
+		cleanedURL)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		rule := classifyYtDlpError(stderr.String())
+		ytdlpLog.Warn("yt-dlp -g failed", "code", rule.Code, "error", err)
+		writeJSONStatus(w, http.StatusOK, StreamURLResponse{
+			Success: false,
+			Message: rule.Message,
+			Hint:    rule.Hint,
+		})
+		return
+	}
+
+	response := StreamURLResponse{Success: true}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		response.URLs = append(response.URLs, line)
+
+		if isManifestURL(line) {
+			response.IsManifest = true
+		}
+		if expires, ok := streamURLExpiry(line); ok && (response.ExpiresAt == nil || expires.Before(*response.ExpiresAt)) {
+			response.ExpiresAt = &expires
+		}
+	}
+
+	if len(response.URLs) == 0 {
+		writeJSONStatus(w, http.StatusOK, StreamURLResponse{
+			Success: false,
+			Message: "Keine abspielbaren Streams gefunden",
+		})
+		return
+	}
+
+	writeJSONStatus(w, http.StatusOK, response)
+}
+
+// isManifestURL detects HLS and DASH manifests
+func isManifestURL(rawURL string) bool {
+	return strings.Contains(rawURL, ".m3u8") || strings.Contains(rawURL, "/manifest/") || strings.Contains(rawURL, ".mpd")
+}
+
+// streamURLExpiry reads the expiry timestamp googlevideo encodes in the URL
+func streamURLExpiry(rawURL string) (time.Time, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	expire := parsed.Query().Get("expire")
+	if expire == "" {
+		// Manifest URLs carry the expiry as a path segment: .../expire/1700000000/...
+		parts := strings.Split(parsed.Path, "/")
+		for i := 0; i < len(parts)-1; i++ {
+			if parts[i] == "expire" {
+				expire = parts[i+1]
+				break
+			}
+		}
+	}
+
+	seconds, err := strconv.ParseInt(expire, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// The summarizer is any HTTP endpoint (e.g. a small wrapper around a local LLM server)
+// that accepts summaryRequest as JSON and answers with {"summary": "..."}.
+// It only runs for jobs that request it and only when SUMMARIZER_URL is set.
+var (
+	summarizerURL    = getenv("SUMMARIZER_URL")
+	summarizerClient = &http.Client{
+		Timeout: parseEnvDuration("SUMMARIZER_TIMEOUT", 60*time.Second),
+	}
+)
+
+const (
+	maxSummaryInput  = 100_000 // Transcript characters sent to the summarizer
+	maxSummaryLength = 4000    // Summary characters kept on the job
+)
+
+type summaryRequest struct {
+	JobID      string `json:"jobId"`
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	Transcript string `json:"transcript"`
+	Truncated  bool   `json:"truncated"` // Transcript was cut to maxSummaryInput
+}
+
+type summaryResponse struct {
+	Summary string `json:"summary"`
+}
+
+// summarizationEnabled reports whether a summarizer endpoint is configured
+func summarizationEnabled() bool {
+	return summarizerURL != ""
+}
+
+// summarizeJobTranscript is the summary step, which runs after the transcribe step
+func summarizeJobTranscript(sessionID string) error {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+	if job.TranscriptFile == "" {
+		return fmt.Errorf("job has no transcript")
+	}
+	sendProgress(sessionID, 96, "Zusammenfassung wird erstellt...")
+	summary, err := summarizeTranscript(job, downloadPath(job.TranscriptFile)+".txt")
+	if err != nil {
+		jobLogger(postProcessLog, sessionID, StepSummary).Warn("Summary failed", "error", err)
+		return err
+	}
+	updateJob(sessionID, func(job *Job) { job.Summary = summary })
+	return nil
+}
+
+// summarizeTranscript sends the plain text transcript to the summarizer and returns its summary
+func summarizeTranscript(job Job, transcriptPath string) (string, error) {
+	data, err := os.ReadFile(transcriptPath)
+	if err != nil {
+		return "", err
+	}
+
+	body := summaryRequest{JobID: job.SessionID, URL: job.URL, Transcript: strings.TrimSpace(string(data))}
+	if job.Metadata != nil {
+		body.Title = job.Metadata.Title
+	}
+	if body.Transcript == "" {
+		return "", fmt.Errorf("transcript is empty")
+	}
+	if len(body.Transcript) > maxSummaryInput {
+		body.Transcript = truncateString(body.Transcript, maxSummaryInput)
+		body.Truncated = true
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, summarizerURL, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if summarizerToken() != "" {
+		req.Header.Set("Authorization", "Bearer "+summarizerToken())
+	}
+
+	resp, err := summarizerClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("summarizer request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return "", fmt.Errorf("summarizer returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var result summaryResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse summarizer response: %v", err)
+	}
+	summary := strings.TrimSpace(result.Summary)
+	if summary == "" {
+		return "", fmt.Errorf("summarizer returned no summary")
+	}
+	return truncateString(summary, maxSummaryLength), nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Public instances can require users to accept their terms of use once before
+// /download works. With TERMS_VERSION set, POST /accept-terms {"version": "..."}
+// records the acceptance for the authenticated user, or the client IP without auth
+// proxy, and returns a token (also set as the terms_token cookie) for clients whose IP
+// changes; it is sent back as the cookie or the X-Terms-Token header. A new
+// TERMS_VERSION asks everyone again. TERMS_URL points to the text, /legal.html by
+// default. Requests with an API key are trusted parties and need no acceptance.
+// Acceptances are kept in the job store and written to the audit log.
+const (
+	termsBucket        = "terms_acceptances"
+	termsCookie        = "terms_token"
+	termsRequiredCode  = "terms_required"
+	EventTermsAccepted = "terms.accepted"
+)
+
+var (
+	termsVersion = getenv("TERMS_VERSION")
+	termsURL     = getEnvDefault("TERMS_URL", "/legal.html")
+	termsLog     = componentLogger("terms")
+
+	termsAcceptances = make(map[string]TermsAcceptance) // Keyed by identity
+	termsTokens      = make(map[string]string)          // Identity by token
+	termsMutex       sync.RWMutex
+)
+
+// TermsAcceptance records who accepted which version of the terms
+type TermsAcceptance struct {
+	Identity   string    `json:"identity"` // "user:<name>" or "ip:<address>"
+	Version    string    `json:"version"`
+	Token      string    `json:"token"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	AcceptedAt time.Time `json:"acceptedAt"`
+}
+
+func termsRequired() bool {
+	return termsVersion != ""
+}
+
+// termsIdentity is who accepts the terms: the authenticated user or the client IP
+func termsIdentity(r *http.Request) string {
+	if user := authenticatedUser(r); user != "" {
+		return "user:" + user
+	}
+	return "ip:" + remoteIP(r)
+}
+
+func termsTokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get("X-Terms-Token"); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(termsCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// termsAccepted reports whether the request's identity or token accepted the current version
+func termsAccepted(r *http.Request) bool {
+	termsMutex.RLock()
+	defer termsMutex.RUnlock()
+
+	if acceptance, ok := termsAcceptances[termsIdentity(r)]; ok && acceptance.Version == termsVersion {
+		return true
+	}
+	token := termsTokenFromRequest(r)
+	if token == "" {
+		return false
+	}
+	for known, identity := range termsTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			return termsAcceptances[identity].Version == termsVersion
+		}
+	}
+	return false
+}
+
+// requireTerms lets requests through once the terms are accepted
+func requireTerms(next http.Handler) http.Handler {
+	if !termsRequired() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKeyLabel(r) != "" || termsAccepted(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		termsLog.Debug("Download refused, terms not accepted", "ip", remoteIP(r))
+		writeJSONStatus(w, http.StatusForbidden, map[string]interface{}{
+			"success":      false,
+			"message":      "Bitte akzeptiere zuerst die Nutzungsbedingungen.",
+			"code":         termsRequiredCode,
+			"termsVersion": termsVersion,
+			"termsUrl":     termsURL,
+		})
+	})
+}
+
+// loadTermsAcceptances restores the acceptances from the job store
+func loadTermsAcceptances() {
+	err := jobStore.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(termsBucket)).ForEach(func(key, value []byte) error {
+			var acceptance TermsAcceptance
+			if err := json.Unmarshal(value, &acceptance); err != nil {
+				return nil
+			}
+			termsMutex.Lock()
+			termsAcceptances[acceptance.Identity] = acceptance
+			termsTokens[acceptance.Token] = acceptance.Identity
+			termsMutex.Unlock()
+			return nil
+		})
+	})
+	if err != nil {
+		termsLog.Error("Failed to load terms acceptances", "error", err)
+	}
+}
+
+// handleTerms tells clients whether they have to accept the terms: GET /terms
+func handleTerms(w http.ResponseWriter, r *http.Request) {
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"required": termsRequired(),
+		"version":  termsVersion,
+		"url":      termsURL,
+		"accepted": !termsRequired() || termsAccepted(r),
+	})
+}
+
+type acceptTermsRequest struct {
+	Version string `json:"version"`
+}
+
+// handleAcceptTerms records the acceptance: POST /accept-terms {"version": "..."}
+func handleAcceptTerms(w http.ResponseWriter, r *http.Request) {
+	if !termsRequired() {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Auf diesem Server gibt es keine Nutzungsbedingungen zu akzeptieren"})
+		return
+	}
+	var body acceptTermsRequest
+	if reqErr := decodeJSONBody(w, r, &body, maxJSONBodyBytes); reqErr != nil {
+		writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+		return
+	}
+	// The version proves the client showed the current text, not an outdated one
+	if body.Version != termsVersion {
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{
+			"success":      false,
+			"message":      "Die Nutzungsbedingungen wurden geändert, bitte lies die aktuelle Fassung.",
+			"termsVersion": termsVersion,
+			"termsUrl":     termsURL,
+		})
+		return
+	}
+
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	acceptance := TermsAcceptance{
+		Identity:   termsIdentity(r),
+		Version:    termsVersion,
+		Token:      hex.EncodeToString(buf),
+		IP:         remoteIP(r),
+		UserAgent:  truncateString(r.UserAgent(), 200),
+		AcceptedAt: time.Now(),
+	}
+
+	termsMutex.Lock()
+	if previous, ok := termsAcceptances[acceptance.Identity]; ok {
+		delete(termsTokens, previous.Token)
+	}
+	termsAcceptances[acceptance.Identity] = acceptance
+	termsTokens[acceptance.Token] = acceptance.Identity
+	termsMutex.Unlock()
+
+	if jobStore != nil {
+		data, err := json.Marshal(acceptance)
+		if err == nil {
+			err = jobStore.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket([]byte(termsBucket)).Put([]byte(acceptance.Identity), data)
+			})
+		}
+		if err != nil {
+			termsLog.Error("Failed to store acceptance", "identity", acceptance.Identity, "error", err)
+		}
+	}
+	appendAuditEntry(AuditEntry{
+		At:     acceptance.AcceptedAt,
+		Event:  EventTermsAccepted,
+		Detail: fmt.Sprintf("version %s by %s from %s", acceptance.Version, acceptance.Identity, acceptance.IP),
+	})
+	termsLog.Info("Terms accepted", "identity", acceptance.Identity, "version", acceptance.Version)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     termsCookie,
+		Value:    acceptance.Token,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"version": acceptance.Version,
+		"token":   acceptance.Token,
+	})
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// YouTube throttles addresses that download a lot: requests fail with HTTP 429 or
+// downloads crawl at a fraction of the usual speed. Every download reports its 429s
+// and its average speed (yt-dlp's final "100% of ... at .../s" line) into hourly
+// buckets per egress, the server's own address or a proxy. An egress counts as
+// throttled when the current and previous hour saw THROTTLE_429_THRESHOLD rate
+// limits, or a speed below THROTTLE_SPEED_RATIO of the rest of the day. /stats shows
+// a banner then. With THROTTLE_MITIGATION=auto, jobs started while the server is
+// throttled sleep between requests, use THROTTLE_PLAYER_CLIENT and go through the
+// proxies in YTDLP_PROXIES that are not throttled themselves.
+const (
+	directEgress            = "direct"
+	throttleHistory         = 24 * time.Hour
+	minRecentSpeedSamples   = 3       // Downloads in the recent hours before the speed counts
+	minBaselineSpeedSamples = 5       // Downloads before that to compare with
+	minSpeedSampleBytes     = 1 << 20 // Smaller downloads never reach full speed
+)
+
+var (
+	throttleMitigation   = strings.ToLower(getEnvDefault("THROTTLE_MITIGATION", "off")) // off or auto
+	throttle429Threshold = parseEnvInt("THROTTLE_429_THRESHOLD", 3)
+	throttleSpeedRatio   = parseThrottleSpeedRatio(getenv("THROTTLE_SPEED_RATIO"))
+	throttlePlayerClient = getEnvDefault("THROTTLE_PLAYER_CLIENT", "android")
+	throttleProxies      = parseProxyList(getenv("YTDLP_PROXIES"))
+
+	egressStates  = make(map[string]*egressState) // Keyed by egress
+	nextProxy     int                             // Round robin over throttleProxies
+	throttleMutex sync.Mutex
+	throttleLog   = componentLogger("throttle")
+)
+
+// speedPattern matches yt-dlp's summary line: "[download] 100% of   12.34MiB in 00:00:05 at 2.46MiB/s"
+var speedPattern = regexp.MustCompile(`\[download\]\s+100(?:\.0+)?% of\s+~?\s*(\S+) in \S+ at\s+(\S+)/s`)
+
+// ThrottleHour is the hourly record of one egress
+type ThrottleHour struct {
+	Hour        time.Time `json:"hour"`
+	RateLimited int       `json:"rateLimited"`
+	Downloads   int       `json:"downloads"`         // Downloads with a measured speed
+	AvgSpeed    int64     `json:"avgBytesPerSecond"` // Filled in by snapshots
+	speedSum    float64
+}
+
+// EgressStatus is the throttling state of one egress
+type EgressStatus struct {
+	Throttled bool           `json:"throttled"`
+	Reason    string         `json:"reason,omitempty"`
+	Since     *time.Time     `json:"since,omitempty"`
+	Hours     []ThrottleHour `json:"hours"`
+}
+
+// ThrottleStatus is the throttling section of /stats
+type ThrottleStatus struct {
+	Throttled  bool                    `json:"throttled"`
+	Banner     string                  `json:"banner,omitempty"` // Shown by the UI while throttled
+	Mitigation string                  `json:"mitigation"`       // off, standby or active
+	Egresses   map[string]EgressStatus `json:"egresses"`
+}
+
+type egressState struct {
+	hours     []*ThrottleHour
+	throttled bool
+	reason    string
+	since     time.Time
+}
+
+// throttlePlan is how a job reaches YouTube
+type throttlePlan struct {
+	egress      string
+	pacing      requestPacing
+	args        []string // Proxy arguments
+	youtubeArgs []string // Merged with the feature flags into --extractor-args youtube:...
+}
+
+func parseThrottleSpeedRatio(value string) float64 {
+	if value == "" {
+		return 0.3
+	}
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio <= 0 || ratio >= 1 {
+		configLog.Warn("Invalid THROTTLE_SPEED_RATIO, using 0.3", "value", value)
+		return 0.3
+	}
+	return ratio
+}
+
+func parseProxyList(value string) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// egressName hides the credentials of a proxy URL
+func egressName(proxy string) string {
+	parsed, err := url.Parse(proxy)
+	if err != nil || parsed.Host == "" {
+		return "proxy"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// hourFor returns the bucket of the current hour, pruning old ones. Caller must hold throttleMutex.
+func (e *egressState) hourFor(now time.Time) *ThrottleHour {
+	hour := now.Truncate(time.Hour)
+	if n := len(e.hours); n > 0 && e.hours[n-1].Hour.Equal(hour) {
+		return e.hours[n-1]
+	}
+	for len(e.hours) > 0 && now.Sub(e.hours[0].Hour) > throttleHistory {
+		e.hours = e.hours[1:]
+	}
+	bucket := &ThrottleHour{Hour: hour}
+	e.hours = append(e.hours, bucket)
+	return bucket
+}
+
+// refresh re-evaluates the state and logs changes. Caller must hold throttleMutex.
+func (e *egressState) refresh(name string, now time.Time) {
+	recentFrom := now.Truncate(time.Hour).Add(-time.Hour)
+	var rateLimited, recentCount, baselineCount int
+	var recentSum, baselineSum float64
+	for _, hour := range e.hours {
+		if now.Sub(hour.Hour) > throttleHistory {
+			continue
+		}
+		if hour.Hour.Before(recentFrom) {
+			baselineCount += hour.Downloads
+			baselineSum += hour.speedSum
+			continue
+		}
+		rateLimited += hour.RateLimited
+		recentCount += hour.Downloads
+		recentSum += hour.speedSum
+	}
+
+	throttled, reason := false, ""
+	switch {
+	case rateLimited >= throttle429Threshold:
+		throttled, reason = true, fmt.Sprintf("%d× HTTP 429 seit %s Uhr", rateLimited, recentFrom.Format("15:04"))
+	case recentCount >= minRecentSpeedSamples && baselineCount >= minBaselineSpeedSamples:
+		recent, baseline := recentSum/float64(recentCount), baselineSum/float64(baselineCount)
+		if recent < baseline*throttleSpeedRatio {
+			throttled = true
+			reason = fmt.Sprintf("nur %s/s statt sonst %s/s", formatByteSize(int64(recent)), formatByteSize(int64(baseline)))
+		}
+	}
+
+	switch {
+	case throttled && !e.throttled:
+		e.since = now
+		throttleLog.Warn("YouTube is throttling", "egress", name, "reason", reason)
+	case !throttled && e.throttled:
+		throttleLog.Info("No longer throttled", "egress", name, "since", e.since)
+	}
+	e.throttled, e.reason = throttled, reason
+}
+
+// egressFor returns the state of an egress, creating it if needed. Caller must hold throttleMutex.
+func egressFor(name string) *egressState {
+	state, ok := egressStates[name]
+	if !ok {
+		state = &egressState{}
+		egressStates[name] = state
+	}
+	return state
+}
+
+// recordRateLimit counts an HTTP 429 of a download
+func recordRateLimit(egress string) {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	now := time.Now()
+	state := egressFor(egress)
+	state.hourFor(now).RateLimited++
+	state.refresh(egress, now)
+}
+
+// recordThroughputLine records the average speed from yt-dlp's summary line of a download
+func recordThroughputLine(egress, line string) {
+	match := speedPattern.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	size, okSize := parseYtDlpSize(match[1])
+	speed, okSpeed := parseYtDlpSize(match[2])
+	if !okSize || !okSpeed || size < minSpeedSampleBytes || speed <= 0 {
+		return
+	}
+
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	now := time.Now()
+	state := egressFor(egress)
+	hour := state.hourFor(now)
+	hour.Downloads++
+	hour.speedSum += speed
+	state.refresh(egress, now)
+}
+
+// parseYtDlpSize parses sizes like "12.34MiB" or "980.00KiB" into bytes
+func parseYtDlpSize(value string) (float64, bool) {
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1},
+	}
+	for _, unit := range units {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			parsed, err := strconv.ParseFloat(number, 64)
+			return parsed * unit.factor, err == nil
+		}
+	}
+	return 0, false
+}
+
+// planThrottleMitigation picks the egress of a new job and, while the server is
+// throttled and THROTTLE_MITIGATION=auto, the arguments that ease the throttling
+func planThrottleMitigation() throttlePlan {
+	plan := throttlePlan{egress: directEgress}
+	if throttleMitigation != "auto" {
+		return plan
+	}
+
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	now := time.Now()
+	direct := egressFor(directEgress)
+	direct.refresh(directEgress, now)
+	if !direct.throttled {
+		return plan
+	}
+
+	plan.pacing = throttlePacing
+	if throttlePlayerClient != "" {
+		plan.youtubeArgs = append(plan.youtubeArgs, "player_client="+throttlePlayerClient)
+	}
+	for range throttleProxies {
+		proxy := throttleProxies[nextProxy%len(throttleProxies)]
+		nextProxy++
+		name := egressName(proxy)
+		state := egressFor(name)
+		state.refresh(name, now)
+		if !state.throttled {
+			plan.egress = name
+			plan.args = append(plan.args, "--proxy", proxy)
+			break
+		}
+	}
+	return plan
+}
+
+func (plan throttlePlan) mitigated() bool {
+	return !plan.pacing.isZero() || len(plan.args) > 0 || len(plan.youtubeArgs) > 0
+}
+
+// describe explains the mitigation for the job log, without the proxy credentials
+func (plan throttlePlan) describe() string {
+	description := "YouTube drosselt den Server: Pausen zwischen den Anfragen"
+	if len(plan.youtubeArgs) > 0 {
+		description += ", Client " + throttlePlayerClient
+	}
+	return description + ", Download über " + plan.egress
+}
+
+// throttleStatus returns the state of all egresses for /stats
+func throttleStatus() ThrottleStatus {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+
+	now := time.Now()
+	status := ThrottleStatus{Mitigation: "off", Egresses: make(map[string]EgressStatus, len(egressStates))}
+	var reasons []string
+	for name, state := range egressStates {
+		state.refresh(name, now)
+		egress := EgressStatus{Throttled: state.throttled, Reason: state.reason}
+		if state.throttled {
+			since := state.since
+			egress.Since = &since
+			reasons = append(reasons, name+": "+state.reason)
+		}
+		for _, hour := range state.hours {
+			copied := *hour
+			if copied.Downloads > 0 {
+				copied.AvgSpeed = int64(copied.speedSum / float64(copied.Downloads))
+			}
+			egress.Hours = append(egress.Hours, copied)
+		}
+		status.Egresses[name] = egress
+	}
+
+	if throttleMitigation == "auto" {
+		status.Mitigation = "standby"
+		if direct, ok := egressStates[directEgress]; ok && direct.throttled {
+			status.Mitigation = "active"
+		}
+	}
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		status.Throttled = true
+		status.Banner = "YouTube drosselt diesen Server (" + strings.Join(reasons, "; ") + ")"
+		if status.Mitigation == "active" {
+			status.Banner += ", Gegenmaßnahmen sind aktiv"
+		}
+	}
+	return status
+}
+
+func logThrottleConfig() {
+	if throttleMitigation != "auto" {
+		return
+	}
+	throttleLog.Info("Automatic mitigation enabled", "playerClient", throttlePlayerClient, "proxies", len(throttleProxies))
+}
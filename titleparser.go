@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// TitleRules configure how video titles are split into artist and title.
+// Noise patterns are removed first, then the first matching pattern with
+// named groups "artist" and "title" wins.
+type TitleRules struct {
+	Noise    []string `json:"noise"`
+	Patterns []string `json:"patterns"`
+}
+
+// defaultTitleRules cover the common YouTube music title shapes
+var defaultTitleRules = TitleRules{
+	Noise: []string{
+		// (Official Video), [Official Music Video], (Lyrics), [4K], (HD) ...
+		`(?i)\s*[\(\[][^\)\]]*\b(official|video|audio|lyrics?|visuali[sz]er|clip|hd|hq|4k|mv|m/v)\b[^\)\]]*[\)\]]`,
+		// Leading "Official Video |" style prefixes
+		`(?i)^\s*official\s+(music\s+)?(video|audio)\s*\|\s*`,
+		// Trailing "| Label Name" or "// Channel"
+		`\s*(\||//)\s*[^|/]*$`,
+	},
+	Patterns: []string{
+		`^(?P<artist>.+?)\s+[-–—]\s+(?P<title>.+)$`,
+		`^(?P<artist>.+?)\s*[-–—:]\s*["“](?P<title>.+?)["”]$`,
+		// Only with the title quoted: a plain "by" is part of titles like "Stand by Me"
+		`^["“](?P<title>.+?)["”]\s+by\s+(?P<artist>.+)$`,
+	},
+}
+
+type compiledTitleRules struct {
+	noise    []*regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+var titleRules = loadTitleRules(getenv("TITLE_RULES_FILE")) // Optional JSON file overriding defaultTitleRules
+
+// loadTitleRules compiles the rules from a JSON file, falling back to the defaults on errors
+func loadTitleRules(path string) *compiledTitleRules {
+	rules := defaultTitleRules
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &rules)
+		}
+		if err != nil {
+			configLog.Warn("Could not load TITLE_RULES_FILE, using defaults", "path", path, "error", err)
+			rules = defaultTitleRules
+		}
+	}
+
+	compiled, err := compileTitleRules(rules)
+	if err != nil {
+		configLog.Warn("Invalid title rule, using defaults", "error", err)
+		compiled, _ = compileTitleRules(defaultTitleRules)
+	}
+	return compiled
+}
+
+func compileTitleRules(rules TitleRules) (*compiledTitleRules, error) {
+	compiled := &compiledTitleRules{}
+	for _, expr := range rules.Noise {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("noise %q: %v", expr, err)
+		}
+		compiled.noise = append(compiled.noise, re)
+	}
+	for _, expr := range rules.Patterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %v", expr, err)
+		}
+		if re.SubexpIndex("artist") < 0 || re.SubexpIndex("title") < 0 {
+			return nil, fmt.Errorf("pattern %q needs named groups artist and title", expr)
+		}
+		compiled.patterns = append(compiled.patterns, re)
+	}
+	return compiled, nil
+}
+
+// parseTitle splits a raw video title into artist and title.
+// The uploader is used as artist when no pattern matches.
+func parseTitle(rawTitle, uploader string) (*AudioTags, bool) {
+	cleaned := rawTitle
+	for _, re := range titleRules.noise {
+		cleaned = re.ReplaceAllString(cleaned, "")
+	}
+	cleaned = strings.TrimSpace(cleaned)
+
+	for _, re := range titleRules.patterns {
+		match := re.FindStringSubmatch(cleaned)
+		if match == nil {
+			continue
+		}
+		artist := strings.TrimSpace(match[re.SubexpIndex("artist")])
+		title := strings.TrimSpace(match[re.SubexpIndex("title")])
+		if artist != "" && title != "" {
+			return &AudioTags{Artist: artist, Title: title, Source: "title-parser"}, true
+		}
+	}
+
+	if uploader == "" || cleaned == "" {
+		return nil, false
+	}
+	return &AudioTags{
+		Artist: strings.TrimSuffix(uploader, " - Topic"),
+		Title:  cleaned,
+		Source: "title-parser",
+	}, true
+}
+
+// pathSeparators must not survive into filenames ("AC/DC")
+var pathSeparators = strings.NewReplacer("/", "_", "\\", "_")
+
+// cleanFilename builds "Artist - Title.ext" from parsed tags
+func cleanFilename(tags *AudioTags, ext string) string {
+	name := pathSeparators.Replace(fmt.Sprintf("%s - %s", tags.Artist, tags.Title))
+	return sanitizeFilename(name) + ext
+}
+
+// smartTitleTags returns clean tags for the job, preferring YouTube Music metadata over parsing
+func smartTitleTags(metadata *VideoMetadata) (*AudioTags, bool) {
+	if metadata == nil {
+		return nil, false
+	}
+	if metadata.Artist != "" && metadata.Track != "" {
+		return &AudioTags{
+			Artist: metadata.Artist,
+			Title:  metadata.Track,
+			Album:  metadata.Album,
+			Source: "youtube",
+		}, true
+	}
+
+	uploader := metadata.Channel
+	if uploader == "" {
+		uploader = metadata.Uploader
+	}
+	return parseTitle(metadata.Title, uploader)
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestParseTitleDefaultRules(t *testing.T) {
+	compiled, err := compileTitleRules(defaultTitleRules)
+	if err != nil {
+		t.Fatalf("default rules: %v", err)
+	}
+	saved := titleRules
+	titleRules = compiled
+	defer func() { titleRules = saved }()
+
+	tests := []struct {
+		raw      string
+		uploader string
+		artist   string
+		title    string
+	}{
+		{"Daft Punk - Get Lucky (Official Video)", "", "Daft Punk", "Get Lucky"},
+		{"AC/DC – Thunderstruck [Official Music Video]", "", "AC/DC", "Thunderstruck"},
+		{"Queen - Bohemian Rhapsody | Queen Official", "", "Queen", "Bohemian Rhapsody"},
+		{"Official Video | Nena - 99 Luftballons", "", "Nena", "99 Luftballons"},
+		{`Adele: "Hello" (Lyrics)`, "", "Adele", "Hello"},
+		{`"Clair de Lune" by Claude Debussy`, "", "Claude Debussy", "Clair de Lune"},
+		// No delimiter: the whole title is kept and the uploader is the artist
+		{"Stand by Me", "Ben E. King - Topic", "Ben E. King", "Stand by Me"},
+		{"Killing Me Softly (HD)", "Fugees", "Fugees", "Killing Me Softly"},
+	}
+
+	for _, tt := range tests {
+		tags, ok := parseTitle(tt.raw, tt.uploader)
+		if !ok {
+			t.Errorf("parseTitle(%q) found nothing, want %q / %q", tt.raw, tt.artist, tt.title)
+			continue
+		}
+		if tags.Artist != tt.artist || tags.Title != tt.title {
+			t.Errorf("parseTitle(%q) = %q / %q, want %q / %q", tt.raw, tags.Artist, tags.Title, tt.artist, tt.title)
+		}
+	}
+
+	if _, ok := parseTitle("Stand by Me", ""); ok {
+		t.Errorf("parseTitle(%q) without uploader should find nothing", "Stand by Me")
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Large results can be exported as a .torrent with this server as web seed (BEP 19),
+// so several recipients can fetch a big file or a split archive from each other.
+// The web seed URL /seed/{key}/... uses a random per-job key and needs no session
+// token; it only serves the job's media files. While the job exists the files are
+// not deleted by /download-file; they are removed when the job is purged.
+var (
+	torrentTrackers = parseTorrentTrackers(getenv("TORRENT_TRACKERS")) // Optional, comma-separated announce URLs
+	torrentLog      = componentLogger("torrent")
+)
+
+const (
+	torrentSuffix         = ".torrent"
+	minTorrentPieceLength = 256 << 10
+	maxTorrentPieceLength = 16 << 20
+	targetTorrentPieces   = 1500
+)
+
+func parseTorrentTrackers(value string) []string {
+	var trackers []string
+	for _, tracker := range strings.Split(value, ",") {
+		if tracker = strings.TrimSpace(tracker); tracker != "" {
+			trackers = append(trackers, tracker)
+		}
+	}
+	return trackers
+}
+
+// createJobTorrent writes {media}.torrent for the finished file, or one torrent
+// covering all parts of a split result, and records it on the job
+func createJobTorrent(sessionID, filename string) error {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+	files := job.Parts
+	if len(files) == 0 {
+		files = []string{filename}
+	}
+
+	key := make([]byte, 16)
+	rand.Read(key)
+	seedKey := hex.EncodeToString(key)
+
+	data, err := buildTorrent(files, publicBaseURL+"/seed/"+seedKey+"/")
+	if err != nil {
+		torrentLog.Error("Could not create torrent", "session", sessionID, "error", err)
+		appendJobLog(sessionID, fmt.Sprintf("[torrent] failed: %v", err))
+		return err
+	}
+
+	torrentFile := filepath.ToSlash(filepath.Join(filepath.Dir(files[0]), torrentName(files)))
+	torrentFile = strings.TrimSuffix(torrentFile, filepath.Ext(files[0])) + torrentSuffix
+	if err := os.WriteFile(downloadPath(torrentFile), data, 0644); err != nil {
+		torrentLog.Error("Could not write torrent", "file", torrentFile, "error", err)
+		return err
+	}
+	updateJob(sessionID, func(job *Job) {
+		job.Torrent = true
+		job.TorrentFile = torrentFile
+		job.SeedKey = seedKey
+	})
+	torrentLog.Info("Created torrent", "file", torrentFile, "session", sessionID, "files", len(files))
+	return nil
+}
+
+// buildTorrent creates a v1 torrent for files relative to ./downloads. A single
+// file becomes a single-file torrent; parts become a multi-file torrent in a
+// directory named after the first part.
+func buildTorrent(files []string, webSeed string) ([]byte, error) {
+	var total int64
+	lengths := make([]int64, len(files))
+	for i, name := range files {
+		info, err := os.Stat(downloadPath(name))
+		if err != nil {
+			return nil, err
+		}
+		lengths[i] = info.Size()
+		total += info.Size()
+	}
+
+	pieceLength := int64(minTorrentPieceLength)
+	for pieceLength < maxTorrentPieceLength && total/pieceLength > targetTorrentPieces {
+		pieceLength *= 2
+	}
+	pieces, err := hashTorrentPieces(files, pieceLength)
+	if err != nil {
+		return nil, err
+	}
+
+	info := map[string]interface{}{
+		"name":         torrentName(files),
+		"piece length": pieceLength,
+		"pieces":       pieces,
+	}
+	if len(files) == 1 {
+		info["length"] = lengths[0]
+	} else {
+		var list []interface{}
+		for i, name := range files {
+			list = append(list, map[string]interface{}{
+				"length": lengths[i],
+				"path":   []interface{}{filepath.Base(name)},
+			})
+		}
+		info["files"] = list
+	}
+
+	torrent := map[string]interface{}{
+		"info":          info,
+		"created by":    "ytdownloader",
+		"creation date": time.Now().Unix(),
+	}
+	// For a single file the web seed URL is the file itself, otherwise the directory above the torrent name
+	if len(files) == 1 {
+		torrent["url-list"] = webSeed + url.PathEscape(filepath.Base(files[0]))
+	} else {
+		torrent["url-list"] = webSeed
+	}
+	if len(torrentTrackers) > 0 {
+		torrent["announce"] = torrentTrackers[0]
+		var tiers []interface{}
+		for _, tracker := range torrentTrackers {
+			tiers = append(tiers, []interface{}{tracker})
+		}
+		torrent["announce-list"] = tiers
+	}
+
+	var buf bytes.Buffer
+	if err := bencode(&buf, torrent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// torrentName is the file name of a single-file torrent, or the directory name of
+// split parts ("Title_part001.mp3" becomes "Title")
+func torrentName(files []string) string {
+	base := filepath.Base(files[0])
+	if len(files) == 1 {
+		return base
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(base, filepath.Ext(base)), "_part001")
+}
+
+// hashTorrentPieces returns the concatenated SHA-1 hashes of all pieces; pieces
+// span file boundaries as the format requires
+func hashTorrentPieces(files []string, pieceLength int64) ([]byte, error) {
+	var readers []io.Reader
+	for _, name := range files {
+		file, err := os.Open(downloadPath(name))
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	stream := io.MultiReader(readers...)
+	buf := make([]byte, pieceLength)
+	var pieces []byte
+	for {
+		n, err := io.ReadFull(stream, buf)
+		if n > 0 {
+			sum := sha1.Sum(buf[:n])
+			pieces = append(pieces, sum[:]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return pieces, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// bencode writes strings, integers, lists and dictionaries with sorted keys
+func bencode(w *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		fmt.Fprintf(w, "%d:%s", len(v), v)
+	case []byte:
+		fmt.Fprintf(w, "%d:", len(v))
+		w.Write(v)
+	case int:
+		fmt.Fprintf(w, "i%de", v)
+	case int64:
+		fmt.Fprintf(w, "i%de", v)
+	case []interface{}:
+		w.WriteByte('l')
+		for _, item := range v {
+			if err := bencode(w, item); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		w.WriteByte('d')
+		for _, key := range keys {
+			bencode(w, key)
+			if err := bencode(w, v[key]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('e')
+	default:
+		return fmt.Errorf("cannot bencode %T", value)
+	}
+	return nil
+}
+
+// torrentKeepsFile reports whether a job with a torrent still seeds the file
+func torrentKeepsFile(filename string) bool {
+	for _, job := range listJobs() {
+		if !job.Torrent || job.DeletedAt != nil {
+			continue
+		}
+		if job.Filename == filename {
+			return true
+		}
+		for _, part := range job.Parts {
+			if part == filename {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeSeededFiles deletes the files of a purged torrent job; /download-file kept them.
+// Trashed jobs were already moved, so there is nothing left to remove for them.
+func removeSeededFiles(event LifecycleEvent) {
+	if !event.Job.Torrent || event.Job.DeletedAt != nil {
+		return
+	}
+	for _, name := range jobFiles(event.Job) {
+		os.Remove(downloadPath(name))
+	}
+	torrentLog.Info("Removed seeded files", "session", event.SessionID)
+}
+
+// serveTorrent returns the .torrent of a job: GET /jobs/{id}/torrent
+func serveTorrent(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, ok := getJob(jobID)
+	if !ok {
+		http.Error(w, "Job nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if !job.Torrent || job.DeletedAt != nil {
+		http.Error(w, "Kein Torrent für diesen Job vorhanden", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-bittorrent")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(job.TorrentFile)))
+	http.ServeFile(w, r, downloadPath(job.TorrentFile))
+}
+
+// handleSeed serves the media of a torrent job to BitTorrent clients: GET /seed/{key}/...
+// Only the last path segment is used, which covers single- and multi-file URL layouts.
+func handleSeed(w http.ResponseWriter, r *http.Request) {
+	key := pathParam(r, "key")
+	name := filepath.Base(r.URL.Path)
+
+	var job *Job
+	for _, candidate := range listJobs() {
+		if candidate.Torrent && candidate.DeletedAt == nil && candidate.SeedKey == key {
+			job = &candidate
+			break
+		}
+	}
+	if job == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	files := job.Parts
+	if len(files) == 0 {
+		files = []string{job.Filename}
+	}
+	for _, file := range files {
+		if filepath.Base(file) == name {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			http.ServeFile(w, r, downloadPath(file))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// whisper.cpp transcription is enabled by pointing WHISPER_MODEL at a ggml model file,
+// e.g. ggml-base.bin from https://huggingface.co/ggerganov/whisper.cpp
+var (
+	whisperBinary   = getEnvDefault("WHISPER_BINARY", "whisper-cli")
+	whisperModel    = getenv("WHISPER_MODEL")
+	whisperLanguage = getEnvDefault("WHISPER_LANGUAGE", "auto")
+	whisperTimeout  = parseEnvDuration("WHISPER_TIMEOUT", 2*time.Hour)
+)
+
+// transcriptionEnabled reports whether a whisper model is configured
+func transcriptionEnabled() bool {
+	return whisperModel != ""
+}
+
+// transcriptBase returns the media path without extension; whisper appends .srt/.txt
+func transcriptBase(mediaPath string) string {
+	return strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath))
+}
+
+// transcribe extracts 16 kHz mono audio and writes .srt and .txt transcripts next to the media file.
+// It returns the language whisper detected when WHISPER_LANGUAGE is "auto".
+func transcribe(sessionID, mediaPath string) (string, error) {
+	base := transcriptBase(mediaPath)
+	wavPath := base + ".whisper.wav"
+	defer os.Remove(wavPath)
+
+	// whisper.cpp only reads 16 kHz wav, so this also covers video downloads
+	extract := exec.Command("ffmpeg",
+		"-v", "error",
+		"-y",
+		"-i", mediaPath,
+		"-vn",
+		"-ac", "1",
+		"-ar", "16000",
+		"-c:a", "pcm_s16le",
+		wavPath)
+	output, err := extract.CombinedOutput()
+	recordProcessResources(sessionID, extract.ProcessState)
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg audio extraction failed: %v: %s", err, truncateString(string(output), 500))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), whisperTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, whisperBinary,
+		"-m", whisperModel,
+		"-f", wavPath,
+		"-l", whisperLanguage,
+		"-osrt",
+		"-otxt",
+		"-of", base)
+	output, err = cmd.CombinedOutput()
+	recordProcessResources(sessionID, cmd.ProcessState)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("whisper timed out after %s", whisperTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("whisper failed: %v: %s", err, truncateString(string(output), 500))
+	}
+	if _, err := os.Stat(base + ".srt"); err != nil {
+		return "", fmt.Errorf("whisper wrote no transcript: %v", err)
+	}
+	return whisperDetectedLanguage(string(output)), nil
+}
+
+// transcribeJobFile is the transcribe step: it transcribes the complete file, so the
+// timestamps match the original, and tags mp3/m4a with the spoken language
+func transcribeJobFile(sessionID, filename string) error {
+	mediaPath := downloadPath(filename)
+	plog := jobLogger(postProcessLog, sessionID, StepTranscribe)
+
+	sendProgress(sessionID, 96, "Wird transkribiert...")
+	lang, err := transcribe(sessionID, mediaPath)
+	if err != nil {
+		plog.Warn("Transcription failed", "error", err)
+		return err
+	}
+	base := strings.TrimSuffix(filepath.ToSlash(filename), filepath.Ext(filename))
+	updateJob(sessionID, func(job *Job) {
+		job.Transcript = true
+		job.TranscriptFile = base
+		if lang != "" {
+			job.Language = lang // The spoken language beats the metadata guess
+		}
+	})
+
+	if ext := strings.ToLower(filepath.Ext(mediaPath)); ext == ".mp3" || ext == ".m4a" {
+		if job, _ := getJob(sessionID); job.Language != "" {
+			if err := rewriteMetadata(mediaPath, map[string]string{"language": languageTag(job.Language)}); err != nil {
+				plog.Warn("Writing language tag failed", "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// serveTranscript serves the transcript of a job: /jobs/{id}/transcript?format=srt|txt
+func serveTranscript(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, ok := getJob(jobID)
+	if !ok {
+		http.Error(w, "Job nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if job.TranscriptFile == "" {
+		http.Error(w, "Kein Transkript für diesen Job vorhanden", http.StatusNotFound)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "txt":
+		format = "txt"
+	case "srt":
+	default:
+		http.Error(w, "Ungültiges Format, erlaubt sind srt und txt", http.StatusBadRequest)
+		return
+	}
+
+	name := filepath.Base(job.TranscriptFile) + "." + format
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	}
+	http.ServeFile(w, r, downloadPath(job.TranscriptFile+"."+format))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Finished files can additionally be pushed to an external service, for users whose
+// own connection to this server is slow. The external URLs end up in the completion
+// update and the job. Requests opt in with "transfer": true.
+//
+// TRANSFER_SERVICE selects the target:
+//   - "0x0": multipart upload to a 0x0.st-style service (TRANSFER_URL, default https://0x0.st)
+//   - "transfer.sh": PUT to a transfer.sh-style service (TRANSFER_URL, default https://transfer.sh)
+//   - "s3": PUT into a publicly readable S3 bucket (S3_* variables, signed with SigV4)
+const (
+	TransferService0x0        = "0x0"
+	TransferServiceTransferSh = "transfer.sh"
+	TransferServiceS3         = "s3"
+)
+
+var (
+	transferService = strings.ToLower(getenv("TRANSFER_SERVICE"))
+	transferClient  = &http.Client{Timeout: parseEnvDuration("TRANSFER_TIMEOUT", 30*time.Minute)}
+
+	s3Endpoint  = strings.TrimSuffix(getenv("S3_ENDPOINT"), "/") // e.g. https://s3.eu-central-1.amazonaws.com
+	s3Bucket    = getenv("S3_BUCKET")
+	s3Region    = getEnvDefault("S3_REGION", "us-east-1")
+	s3Prefix    = getenv("S3_PREFIX")                              // Key prefix, e.g. "ytdown/"
+	s3PublicURL = strings.TrimSuffix(getenv("S3_PUBLIC_URL"), "/") // Defaults to endpoint/bucket
+	transferLog = componentLogger("transfer")
+)
+
+func transferEnabled() bool {
+	switch transferService {
+	case TransferService0x0, TransferServiceTransferSh:
+		return true
+	case TransferServiceS3:
+		return s3Endpoint != "" && s3Bucket != "" && s3AccessKey() != "" && s3SecretKey() != ""
+	}
+	return false
+}
+
+// transferJobFiles uploads the finished file (all parts if it was split) and stores the
+// external URLs on the job. Failures are reported as a warning and only fail the
+// transfer step.
+func transferJobFiles(sessionID, filename string) error {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+	files := job.Parts
+	if len(files) == 0 {
+		files = []string{filename}
+	}
+
+	var urls []string
+	for _, name := range files {
+		started := time.Now()
+		externalURL, err := uploadTransfer(downloadPath(name))
+		if err != nil {
+			transferLog.Error("Upload failed", "file", name, "service", transferService, "session", sessionID, "error", err)
+			appendJobLog(sessionID, fmt.Sprintf("[transfer] %s failed: %v", filepath.Base(name), err))
+			sendWarning(sessionID, WarningTransferFailed)
+			return err
+		}
+		transferLog.Info("Uploaded", "file", name, "session", sessionID, "duration", time.Since(started).Round(time.Second).String(), "url", externalURL)
+		urls = append(urls, externalURL)
+	}
+	updateJob(sessionID, func(job *Job) { job.TransferURLs = urls })
+	return nil
+}
+
+// uploadTransfer sends one file to the configured service and returns its public URL
+func uploadTransfer(filePath string) (string, error) {
+	switch transferService {
+	case TransferService0x0:
+		return uploadMultipartTransfer(getEnvDefault("TRANSFER_URL", "https://0x0.st"), filePath)
+	case TransferServiceTransferSh:
+		return uploadPutTransfer(getEnvDefault("TRANSFER_URL", "https://transfer.sh"), filePath)
+	case TransferServiceS3:
+		return uploadS3(filePath)
+	}
+	return "", fmt.Errorf("unknown TRANSFER_SERVICE %q", transferService)
+}
+
+// uploadMultipartTransfer posts the file as form field "file"; the response body is the URL
+func uploadMultipartTransfer(endpoint, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Stream the form instead of buffering files of several GB
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		part, err := form.CreateFormFile("file", filepath.Base(filePath))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		body.Close()
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return doTransferRequest(req)
+}
+
+// uploadPutTransfer PUTs the file to endpoint/{name}; the response body is the URL
+func uploadPutTransfer(endpoint, filePath string) (string, error) {
+	file, info, err := openForUpload(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(endpoint, "/")+"/"+url.PathEscape(info.Name()), file)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	return doTransferRequest(req)
+}
+
+func doTransferRequest(req *http.Request) (string, error) {
+	resp, err := transferClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	externalURL := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(externalURL, "http://") && !strings.HasPrefix(externalURL, "https://") {
+		return "", fmt.Errorf("unexpected response %q", externalURL)
+	}
+	return externalURL, nil
+}
+
+func openForUpload(filePath string) (*os.File, os.FileInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// uploadS3 PUTs the file under a random key into S3_BUCKET (path-style) and returns
+// its public URL. The bucket policy must allow anonymous reads.
+func uploadS3(filePath string) (string, error) {
+	file, info, err := openForUpload(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	random := make([]byte, 8)
+	rand.Read(random)
+	key := s3Prefix + hex.EncodeToString(random) + "/" + info.Name()
+	objectPath := "/" + s3Bucket + "/" + awsURIEncode(key)
+
+	req, err := http.NewRequest(http.MethodPut, s3Endpoint+objectPath, file)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	signS3Request(req, objectPath, time.Now().UTC())
+
+	resp, err := transferClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if s3PublicURL != "" {
+		return s3PublicURL + "/" + awsURIEncode(key), nil
+	}
+	return s3Endpoint + objectPath, nil
+}
+
+// signS3Request adds an AWS Signature Version 4 for an unsigned, streamed payload
+func signS3Request(req *http.Request, canonicalPath string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		"", // No query string
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD",
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	scope := date + "/" + s3Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+s3SecretKey()), date)
+	signingKey = hmacSHA256(signingKey, s3Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3AccessKey(), scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEncode escapes an object key as SigV4 requires: everything except unreserved
+// characters and slashes
+func awsURIEncode(value string) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deleted jobs go to the trash first: their files move to trashDir/{id} and the job
+// stays restorable until it is purged after TRASH_RETENTION_DAYS.
+var trashDir = filepath.Join(downloadsDir, ".trash")
+
+var errJobNotFound = errors.New("Job nicht gefunden")
+
+var trashLog = componentLogger("trash")
+
+var trashRetention = time.Duration(parseTrashRetentionDays(getenv("TRASH_RETENTION_DAYS"))) * 24 * time.Hour
+
+func parseTrashRetentionDays(value string) int {
+	if value == "" {
+		return 30
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		configLog.Warn("Invalid TRASH_RETENTION_DAYS, using 30", "value", value)
+		return 30
+	}
+	return days
+}
+
+// jobFiles returns the names of all files in ./downloads belonging to a job
+func jobFiles(job Job) []string {
+	var files []string
+	if len(job.Parts) > 0 {
+		files = append(files, job.Parts...)
+	} else if job.Filename != "" {
+		files = append(files, job.Filename)
+	}
+	if job.Waveform && job.Filename != "" {
+		files = append(files, job.Filename+waveformSuffix)
+	}
+	if job.TorrentFile != "" {
+		files = append(files, job.TorrentFile)
+	}
+	if job.LyricsFile != "" {
+		files = append(files, job.LyricsFile)
+	}
+	if job.TranscriptFile != "" {
+		files = append(files, job.TranscriptFile+".srt", job.TranscriptFile+".txt")
+	}
+	return files
+}
+
+// trashJob hides a finished job and moves its files out of the serving directory
+func trashJob(sessionID string) error {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+	if job.isActive() {
+		return fmt.Errorf("Laufende Jobs können nicht gelöscht werden")
+	}
+	if job.DeletedAt != nil {
+		return fmt.Errorf("Job ist bereits im Papierkorb")
+	}
+
+	dir := filepath.Join(trashDir, sessionID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, name := range jobFiles(job) {
+		dst := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		err := os.Rename(downloadPath(name), dst)
+		if err != nil && !os.IsNotExist(err) {
+			return err // Files already served and removed are fine
+		}
+	}
+
+	now := time.Now()
+	updateJob(sessionID, func(job *Job) { job.DeletedAt = &now })
+	trashLog.Info("Job moved to trash", "session", sessionID)
+	return nil
+}
+
+// restoreJob moves the files back (renaming on collisions) and makes the job visible again
+func restoreJob(sessionID string) error {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+	if job.DeletedAt == nil {
+		return fmt.Errorf("Job ist nicht im Papierkorb")
+	}
+
+	dir := filepath.Join(trashDir, sessionID)
+	restore := func(name, target string) string {
+		src := filepath.Join(dir, name)
+		if _, err := os.Stat(src); err != nil {
+			return target
+		}
+		targetDir := filepath.Dir(downloadPath(target))
+		if err := os.MkdirAll(targetDir, 0755); err != nil {
+			trashLog.Error("Could not restore file", "session", sessionID, "file", name, "error", err)
+			return target
+		}
+		placed, err := placeFile(src, targetDir, filepath.Base(target), jobVideoID(sessionID))
+		if err != nil {
+			trashLog.Error("Could not restore file", "session", sessionID, "file", name, "error", err)
+			return target
+		}
+		return filepath.ToSlash(filepath.Join(filepath.Dir(target), placed))
+	}
+
+	filename := job.Filename
+	parts := append([]string(nil), job.Parts...)
+	if len(parts) > 0 {
+		for i := range parts {
+			parts[i] = restore(parts[i], parts[i])
+		}
+		filename = parts[0]
+	} else if filename != "" {
+		filename = restore(job.Filename, job.Filename)
+	}
+	if job.Waveform && job.Filename != "" {
+		// Keep the sidecar next to the possibly renamed media file
+		restore(job.Filename+waveformSuffix, filename+waveformSuffix)
+	}
+	lyricsFile := job.LyricsFile
+	if lyricsFile != "" {
+		lyricsFile = restore(job.LyricsFile, job.LyricsFile)
+	}
+	transcriptFile := job.TranscriptFile
+	if transcriptFile != "" {
+		// Both transcripts share one base name, so restore them under the same one
+		srt := restore(transcriptFile+".srt", transcriptFile+".srt")
+		transcriptFile = strings.TrimSuffix(srt, ".srt")
+		restore(job.TranscriptFile+".txt", transcriptFile+".txt")
+	}
+	os.RemoveAll(dir)
+
+	updateJob(sessionID, func(job *Job) {
+		job.DeletedAt = nil
+		job.Filename = filename
+		if len(parts) > 0 {
+			job.Parts = parts
+		}
+		job.LyricsFile = lyricsFile
+		job.TranscriptFile = transcriptFile
+	})
+	trashLog.Info("Job restored", "session", sessionID)
+	return nil
+}
+
+// purgeJob permanently removes a finished job and all of its files
+func purgeJob(sessionID string) error {
+	job, ok := getJob(sessionID)
+	if !ok {
+		return errJobNotFound
+	}
+	if job.isActive() {
+		return fmt.Errorf("Laufende Jobs können nicht gelöscht werden")
+	}
+
+	if job.DeletedAt == nil {
+		for _, name := range jobFiles(job) {
+			os.Remove(downloadPath(name))
+		}
+	}
+	os.RemoveAll(filepath.Join(trashDir, sessionID))
+	deleteJob(sessionID)
+	trashLog.Info("Job purged", "session", sessionID)
+	return nil
+}
+
+// cleanupTrash purges jobs that have been in the trash longer than trashRetention
+func cleanupTrash() {
+	for _, job := range listJobs() {
+		if job.DeletedAt != nil && time.Since(*job.DeletedAt) > trashRetention {
+			purgeJob(job.SessionID)
+		}
+	}
+}
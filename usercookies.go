@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Members-only and Premium videos need the cookies of an account that has access.
+// Behind an authenticating reverse proxy (Authelia, oauth2-proxy, ...) every user can
+// store their own cookies.txt and optionally a PO token; they are only used for that
+// user's jobs, so nobody has to share one server-wide account. AUTH_USER_HEADER names
+// the header with the user name; it is only believed from TRUSTED_PROXIES. Bundles are
+// encrypted with AES-256-GCM under a key derived from USER_COOKIES_KEY.
+const (
+	maxCookieBundleBytes  = 256 << 10
+	userCookiesFileSuffix = ".cookies"
+)
+
+var (
+	userCookiesDir   = metadataDir + "/users"
+	userCookiesIndex = userCookiesDir + "/index"
+	authUserHeader   = getenv("AUTH_USER_HEADER") // e.g. "Remote-User"
+	userCookiesAEAD  = newCookiesAEAD(getenv("USER_COOKIES_KEY"))
+	userCookiesMutex sync.Mutex
+	cookiesLog       = componentLogger("cookies")
+)
+
+var errNoCookieBundle = errors.New("Keine Cookies hinterlegt")
+
+// CookieBundle is what a user uploads; it is only ever written encrypted
+type CookieBundle struct {
+	Cookies   string    `json:"cookies"`           // Netscape cookies.txt
+	POToken   string    `json:"poToken,omitempty"` // Sent as youtube:po_token extractor argument
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CookieStatus describes a stored bundle without revealing it
+type CookieStatus struct {
+	Configured bool         `json:"configured"`
+	Cookies    int          `json:"cookies"`
+	Domains    []string     `json:"domains,omitempty"`
+	HasPOToken bool         `json:"hasPoToken"`
+	UpdatedAt  *time.Time   `json:"updatedAt,omitempty"`
+	Check      *CookieCheck `json:"check,omitempty"` // Last freshness check, see cookiecheck.go
+}
+
+type authUserKey struct{}
+
+// newCookiesAEAD derives the AES-256 key from the configured secret; nil disables the feature
+func newCookiesAEAD(secret string) cipher.AEAD {
+	if secret == "" {
+		return nil
+	}
+	if len(secret) < 16 {
+		configLog.Warn("USER_COOKIES_KEY is shorter than 16 characters, per-user cookies are disabled")
+		return nil
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		configLog.Warn("Per-user cookies disabled", "error", err)
+		return nil
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		configLog.Warn("Per-user cookies disabled", "error", err)
+		return nil
+	}
+	return aead
+}
+
+func userCookiesEnabled() bool {
+	return authUserHeader != "" && userCookiesAEAD != nil
+}
+
+// authUserMiddleware stores the user name sent by a trusted proxy in the request
+// context. It must run before realIPMiddleware, which replaces the proxy address.
+func authUserMiddleware(next http.Handler) http.Handler {
+	if authUserHeader == "" {
+		return next
+	}
+	if len(trustedProxies) == 0 {
+		configLog.Warn("AUTH_USER_HEADER is set but TRUSTED_PROXIES is empty, no user will be authenticated")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := strings.TrimSpace(r.Header.Get(authUserHeader))
+		if user != "" && isTrustedProxy(remoteIP(r)) {
+			r = r.WithContext(context.WithValue(r.Context(), authUserKey{}, user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticatedUser returns the user name from the auth proxy, "" if there is none
+func authenticatedUser(r *http.Request) string {
+	user, _ := r.Context().Value(authUserKey{}).(string)
+	return user
+}
+
+// userCookiesPath hashes the user name, so file names leak nothing and need no escaping
+func userCookiesPath(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return filepath.Join(userCookiesDir, hex.EncodeToString(sum[:16])+userCookiesFileSuffix)
+}
+
+// sealCookieData encrypts with the user name (or another label) as authenticated
+// data, so a file copied to another user's name does not decrypt
+func sealCookieData(plain []byte, label string) ([]byte, error) {
+	nonce := make([]byte, userCookiesAEAD.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return userCookiesAEAD.Seal(nonce, nonce, plain, []byte(label)), nil
+}
+
+func openCookieData(sealed []byte, label string) ([]byte, error) {
+	nonceSize := userCookiesAEAD.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("truncated")
+	}
+	return userCookiesAEAD.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(label))
+}
+
+// writeSealedFile replaces a file atomically; userCookiesMutex must be held
+func writeSealedFile(path string, plain []byte, label string) error {
+	sealed, err := sealCookieData(plain, label)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(userCookiesDir, 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func saveCookieBundle(user string, bundle CookieBundle) error {
+	plain, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	userCookiesMutex.Lock()
+	defer userCookiesMutex.Unlock()
+	if err := writeSealedFile(userCookiesPath(user), plain, user); err != nil {
+		return err
+	}
+	return updateCookieUsersLocked(user, true)
+}
+
+func loadCookieBundle(user string) (CookieBundle, error) {
+	var bundle CookieBundle
+	userCookiesMutex.Lock()
+	sealed, err := os.ReadFile(userCookiesPath(user))
+	userCookiesMutex.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return bundle, errNoCookieBundle
+	}
+	if err != nil {
+		return bundle, err
+	}
+
+	plain, err := openCookieData(sealed, user)
+	if err != nil {
+		return bundle, fmt.Errorf("cannot decrypt cookie bundle of %s (USER_COOKIES_KEY changed?)", user)
+	}
+	err = json.Unmarshal(plain, &bundle)
+	return bundle, err
+}
+
+func deleteCookieBundle(user string) error {
+	userCookiesMutex.Lock()
+	defer userCookiesMutex.Unlock()
+	err := os.Remove(userCookiesPath(user))
+	if errors.Is(err, os.ErrNotExist) {
+		return errNoCookieBundle
+	}
+	if err != nil {
+		return err
+	}
+	return updateCookieUsersLocked(user, false)
+}
+
+// cookieUsers returns the users with a stored bundle. File names are hashes, so the
+// names are kept in an index that is sealed like the bundles.
+func cookieUsers() []string {
+	userCookiesMutex.Lock()
+	defer userCookiesMutex.Unlock()
+	users, err := readCookieUsersLocked()
+	if err != nil {
+		cookiesLog.Error("Cannot read the user index", "error", err)
+	}
+	return users
+}
+
+func readCookieUsersLocked() ([]string, error) {
+	sealed, err := os.ReadFile(userCookiesIndex)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	plain, err := openCookieData(sealed, userCookiesIndex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s (USER_COOKIES_KEY changed?)", userCookiesIndex)
+	}
+	var users []string
+	err = json.Unmarshal(plain, &users)
+	return users, err
+}
+
+// updateCookieUsersLocked adds or removes a user from the index; userCookiesMutex must be held
+func updateCookieUsersLocked(user string, present bool) error {
+	users, err := readCookieUsersLocked()
+	if err != nil {
+		return err
+	}
+	var updated []string
+	for _, existing := range users {
+		if existing != user {
+			updated = append(updated, existing)
+		}
+	}
+	if present {
+		updated = append(updated, user)
+	}
+	sort.Strings(updated)
+	plain, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	return writeSealedFile(userCookiesIndex, plain, userCookiesIndex)
+}
+
+// parseCookieFile reads the cookies of a Netscape cookies.txt, skipping invalid lines
+func parseCookieFile(cookies string) []http.Cookie {
+	var parsed []http.Cookie
+	scanner := bufio.NewScanner(strings.NewReader(cookies))
+	scanner.Buffer(make([]byte, 0, 64<<10), maxCookieBundleBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// HttpOnly cookies are written as comments with this prefix
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		cookie := http.Cookie{Domain: strings.TrimPrefix(fields[0], "."), Name: fields[5], Value: fields[6]}
+		// 0 marks a session cookie
+		if expires, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		parsed = append(parsed, cookie)
+	}
+	return parsed
+}
+
+// cookieDomains validates a Netscape cookies.txt and returns the cookie count and domains
+func cookieDomains(cookies string) (int, []string) {
+	parsed := parseCookieFile(cookies)
+	seen := make(map[string]bool)
+	for _, cookie := range parsed {
+		seen[cookie.Domain] = true
+	}
+	domains := make([]string, 0, len(seen))
+	for domain := range seen {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return len(parsed), domains
+}
+
+func cookieStatus(user string, bundle CookieBundle) CookieStatus {
+	count, domains := cookieDomains(bundle.Cookies)
+	updatedAt := bundle.UpdatedAt
+	return CookieStatus{
+		Configured: true,
+		Cookies:    count,
+		Domains:    domains,
+		HasPOToken: bundle.POToken != "",
+		UpdatedAt:  &updatedAt,
+		Check:      lastCookieCheck(user),
+	}
+}
+
+// handleUserCookies manages the cookies of the authenticated user:
+// GET shows what is stored, PUT replaces it, DELETE removes it
+func handleUserCookies(w http.ResponseWriter, r *http.Request) {
+	if !userCookiesEnabled() {
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Persönliche Cookies sind auf diesem Server nicht eingerichtet"})
+		return
+	}
+	user := authenticatedUser(r)
+	if user == "" {
+		writeJSONStatus(w, http.StatusUnauthorized, map[string]interface{}{"success": false, "message": "Nicht angemeldet"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		bundle, err := loadCookieBundle(user)
+		if err == errNoCookieBundle {
+			writeJSONStatus(w, http.StatusOK, CookieStatus{})
+			return
+		}
+		if err != nil {
+			cookiesLog.Error("Cannot read cookies", "user", user, "error", err)
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Cookies konnten nicht gelesen werden"})
+			return
+		}
+		writeJSONStatus(w, http.StatusOK, cookieStatus(user, bundle))
+	case http.MethodPut:
+		var bundle CookieBundle
+		if reqErr := decodeJSONBody(w, r, &bundle, maxCookieBundleBytes); reqErr != nil {
+			writeJSONStatus(w, reqErr.status, map[string]interface{}{"success": false, "message": reqErr.message})
+			return
+		}
+		bundle.POToken = strings.TrimSpace(bundle.POToken)
+		if count, _ := cookieDomains(bundle.Cookies); count == 0 {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "Keine gültigen Cookies gefunden. Erwartet wird eine cookies.txt im Netscape-Format"})
+			return
+		}
+		bundle.UpdatedAt = time.Now()
+		if err := saveCookieBundle(user, bundle); err != nil {
+			cookiesLog.Error("Could not save cookies", "user", user, "error", err)
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Cookies konnten nicht gespeichert werden"})
+			return
+		}
+		cookiesLog.Info("Stored cookies", "user", user)
+		forgetCookieCheck(user)
+		goGuarded("cookie check", func() { checkUserCookies(user) })
+		writeJSONStatus(w, http.StatusOK, cookieStatus(user, bundle))
+	case http.MethodDelete:
+		switch err := deleteCookieBundle(user); err {
+		case nil:
+			forgetCookieCheck(user)
+			cookiesLog.Info("Deleted cookies", "user", user)
+			writeJSONStatus(w, http.StatusOK, map[string]interface{}{"success": true})
+		case errNoCookieBundle:
+			writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"success": false, "message": err.Error()})
+		default:
+			cookiesLog.Error("Could not delete cookies", "user", user, "error", err)
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Cookies konnten nicht gelöscht werden"})
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// userCookieArgs writes the cookies of the job's user into the staging directory,
+// which is removed with the job, and returns the yt-dlp arguments using them.
+// Without a stored bundle the job runs without cookies.
+func userCookieArgs(user, stagingDir string) []string {
+	if user == "" || !userCookiesEnabled() {
+		return nil
+	}
+	bundle, err := loadCookieBundle(user)
+	if err != nil {
+		if err != errNoCookieBundle {
+			cookiesLog.Warn("Running without personal cookies", "user", user, "error", err)
+		}
+		return nil
+	}
+
+	path := filepath.Join(stagingDir, ".cookies.txt")
+	if err := os.WriteFile(path, []byte(bundle.Cookies), 0600); err != nil {
+		cookiesLog.Warn("Running without personal cookies, cannot write them", "user", user, "path", path, "error", err)
+		return nil
+	}
+	args := []string{"--cookies", path}
+	if bundle.POToken != "" {
+		args = append(args, "--extractor-args", "youtube:po_token="+bundle.POToken)
+	}
+	return args
+}
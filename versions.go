@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ToolVersions records which external tool versions produced a download
+type ToolVersions struct {
+	YtDlp  string `json:"ytdlp"`
+	FFmpeg string `json:"ffmpeg"`
+}
+
+type cachedVersion struct {
+	version   string
+	checkedAt time.Time
+}
+
+var (
+	toolVersions      = make(map[string]cachedVersion) // Keyed by tool name
+	toolVersionsMutex sync.Mutex
+	toolVersionTTL    = 10 * time.Minute // Re-check so in-place updates show up
+)
+
+// getToolVersion runs the version command for a tool, cached for toolVersionTTL
+func getToolVersion(name string, args ...string) string {
+	toolVersionsMutex.Lock()
+	defer toolVersionsMutex.Unlock()
+
+	if cached, ok := toolVersions[name]; ok && time.Since(cached.checkedAt) < toolVersionTTL {
+		return cached.version
+	}
+
+	version := "unknown"
+	if output, err := exec.Command(name, args...).Output(); err == nil {
+		// Only the first line is relevant (ffmpeg prints build info after it)
+		firstLine := strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0]
+		version = strings.TrimSpace(firstLine)
+	}
+
+	toolVersions[name] = cachedVersion{version: version, checkedAt: time.Now()}
+	return version
+}
+
+// getYtDlpVersion returns the installed yt-dlp version
+func getYtDlpVersion() string {
+	return getToolVersion(ytdlpBinary, "--version")
+}
+
+// getFFmpegVersion returns the installed ffmpeg version, e.g. "6.1.1"
+func getFFmpegVersion() string {
+	version := getToolVersion("ffmpeg", "-version")
+	// "ffmpeg version 6.1.1 Copyright (c) ..." → "6.1.1"
+	if fields := strings.Fields(version); len(fields) >= 3 && fields[0] == "ffmpeg" && fields[1] == "version" {
+		return fields[2]
+	}
+	return version
+}
+
+// toolVersionsFor returns the versions used for a job starting now with the given yt-dlp binary
+func toolVersionsFor(ytdlp string) ToolVersions {
+	return ToolVersions{
+		YtDlp:  getToolVersion(ytdlp, "--version"),
+		FFmpeg: getFFmpegVersion(),
+	}
+}
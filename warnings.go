@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Warnings are non-fatal problems during a job. They are kept with the job and sent
+// as "warning" events on the SSE stream, so clients that only listen to plain
+// messages are not affected.
+
+// Warning codes
+const (
+	WarningNsigFailed     = "nsig_failed"
+	WarningRateLimited    = "rate_limited"
+	WarningFormatsMissing = "formats_missing"
+	WarningRetry          = "retry"
+	WarningRemuxFailed    = "remux_failed"
+	WarningTransferFailed = "transfer_failed"
+	WarningRecovered      = "recovered"
+)
+
+// warningMessages are the user-facing texts; %s is filled with details like the attempt
+var warningMessages = map[string]string{
+	WarningNsigFailed:     "Signatur-Extraktion fehlgeschlagen - einige Formate fehlen möglicherweise",
+	WarningRateLimited:    "YouTube drosselt die Anfragen, der Download kann länger dauern",
+	WarningFormatsMissing: "Nicht alle Formate verfügbar (SABR) - es wird eventuell eine niedrigere Qualität geladen",
+	WarningRetry:          "Verbindung unterbrochen, neuer Versuch (%s)",
+	WarningRemuxFailed:    "Die Datei musste neu kodiert werden, das dauert länger",
+	WarningTransferFailed: "Upload zum externen Dienst fehlgeschlagen - die Datei ist nur hier verfügbar",
+	WarningRecovered:      "Der Server wurde neu gestartet, der Download wird fortgesetzt",
+}
+
+// maxJobWarnings limits how many warnings are kept per job
+const maxJobWarnings = 20
+
+var retryPattern = regexp.MustCompile(`Retrying \((\d+/\d+)\)`)
+
+// JobWarning is a non-fatal problem, shown as a banner by the UI
+type JobWarning struct {
+	Code    string    `json:"code"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// detectWarning recognizes yt-dlp stderr lines that deserve a warning
+func detectWarning(line string) (string, []interface{}, bool) {
+	switch {
+	case strings.Contains(line, "nsig extraction failed"):
+		return WarningNsigFailed, nil, true
+	case strings.Contains(line, "HTTP Error 429"):
+		return WarningRateLimited, nil, true
+	case strings.Contains(line, "SABR") || strings.Contains(line, "missing a url"):
+		return WarningFormatsMissing, nil, true
+	}
+	if match := retryPattern.FindStringSubmatch(line); match != nil {
+		return WarningRetry, []interface{}{match[1]}, true
+	}
+	return "", nil, false
+}
+
+// sendWarning records a warning with the job and publishes it to SSE clients.
+// Repeated identical warnings are only sent once.
+func sendWarning(sessionID, code string, args ...interface{}) {
+	message := warningMessages[code]
+	if len(args) > 0 {
+		message = fmt.Sprintf(message, args...)
+	}
+	warning := JobWarning{Code: code, Message: message, At: time.Now()}
+
+	added := false
+	progress := 0
+	updateJob(sessionID, func(job *Job) {
+		progress = job.Progress
+		if len(job.Warnings) >= maxJobWarnings {
+			return
+		}
+		for _, existing := range job.Warnings {
+			if existing.Code == code && existing.Message == message {
+				return
+			}
+		}
+		job.Warnings = append(job.Warnings, warning)
+		added = true
+	})
+	if !added {
+		return
+	}
+
+	jobLog.Warn(message, "session", sessionID, "code", code)
+	eventType := EventJobWarning
+	if code == WarningRetry {
+		eventType = EventJobRetried
+	}
+	emitJobEvent(eventType, sessionID, &ProgressUpdate{Progress: progress, Status: message, Warning: &warning}, "")
+}
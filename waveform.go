@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+)
+
+// Waveform peaks are generated in the audiowaveform JSON format (version 2, 8 bit)
+// so existing player libraries like peaks.js / wavesurfer can render them directly.
+const (
+	waveformSuffix          = ".waveform.json"
+	waveformSampleRate      = 8000
+	waveformSamplesPerPixel = 400 // 20 peaks per second of audio
+)
+
+// WaveformData is the audiowaveform JSON structure
+type WaveformData struct {
+	Version         int    `json:"version"`
+	Channels        int    `json:"channels"`
+	SampleRate      int    `json:"sample_rate"`
+	SamplesPerPixel int    `json:"samples_per_pixel"`
+	Bits            int    `json:"bits"`
+	Length          int    `json:"length"`
+	Data            []int8 `json:"data"` // Alternating min/max per pixel
+}
+
+// isAudioFormat reports whether the output format is audio only
+func isAudioFormat(format string) bool {
+	switch format {
+	case "mp3", "wav", "m4a", "flac", "opus", "ogg":
+		return true
+	}
+	return false
+}
+
+// waveformPath returns where the peaks file for a media file is stored
+func waveformPath(mediaPath string) string {
+	return mediaPath + waveformSuffix
+}
+
+// waveformJobFile is the waveform step; for a split file it covers the first part
+func waveformJobFile(sessionID, filename string) error {
+	sendProgress(sessionID, 97, "Wellenform wird erstellt...")
+	if err := generateWaveform(downloadPath(filename)); err != nil {
+		jobLogger(postProcessLog, sessionID, StepWaveform).Warn("Waveform failed", "error", err)
+		return err
+	}
+	updateJob(sessionID, func(job *Job) { job.Waveform = true })
+	return nil
+}
+
+// generateWaveform decodes the audio with ffmpeg and writes min/max peaks next to the media file
+func generateWaveform(mediaPath string) error {
+	cmd := exec.Command("ffmpeg",
+		"-v", "error",
+		"-i", mediaPath,
+		"-ac", "1",
+		"-ar", fmt.Sprintf("%d", waveformSampleRate),
+		"-f", "s16le",
+		"-")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("ffmpeg konnte nicht gestartet werden: %v", err)
+	}
+
+	waveform := WaveformData{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      waveformSampleRate,
+		SamplesPerPixel: waveformSamplesPerPixel,
+		Bits:            8,
+		Data:            []int8{},
+	}
+
+	// Decode little-endian 16 bit samples in chunks and keep min/max per pixel
+	reader := bufio.NewReaderSize(stdout, 64*1024)
+	buf := make([]byte, 64*1024)
+	var min, max int16
+	count := 0
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		for i := 0; i+1 < n; i += 2 {
+			sample := int16(binary.LittleEndian.Uint16(buf[i:]))
+			if count == 0 || sample < min {
+				min = sample
+			}
+			if count == 0 || sample > max {
+				max = sample
+			}
+			count++
+			if count == waveformSamplesPerPixel {
+				waveform.Data = append(waveform.Data, int8(min>>8), int8(max>>8))
+				count = 0
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			cmd.Wait()
+			return readErr
+		}
+	}
+	if count > 0 {
+		waveform.Data = append(waveform.Data, int8(min>>8), int8(max>>8))
+	}
+	waveform.Length = len(waveform.Data) / 2
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg fehlgeschlagen: %v", err)
+	}
+
+	payload, err := json.Marshal(waveform)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(waveformPath(mediaPath), payload, 0644)
+}
+
+// serveWaveform serves the peaks JSON of a completed job: /jobs/{id}/waveform.json
+func serveWaveform(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, ok := getJob(jobID)
+	if !ok {
+		http.Error(w, "Job nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if !job.Waveform {
+		http.Error(w, "Keine Wellenform für diesen Job vorhanden", http.StatusNotFound)
+		return
+	}
+
+	peaksPath := waveformPath(downloadPath(job.Filename))
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, r, peaksPath)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Some proxies and mobile clients cope better with WebSockets than with EventSource.
+// /ws/progress carries the same updates as /progress, for any number of sessions on
+// one connection, and takes control messages from the client:
+//
+//	{"type": "subscribe", "sessionId": "...", "token": "..."}
+//	{"type": "unsubscribe", "sessionId": "..."}
+//	{"type": "cancel" | "pause" | "resume", "sessionId": "..."}
+//
+// Control messages need a subscribe with the session's token first. Updates arrive as
+// {"type": "progress" | "warning", "sessionId": "...", "update": {...}}; after the final
+// update the subscription ends with {"type": "done"}. Every command is answered with
+// {"type": "ok"} or {"type": "error", "message": "..."}, echoing its optional "id".
+const (
+	maxWSSubscriptions = 50 // Per connection
+	maxWSMessageBytes  = 4 << 10
+	wsPingInterval     = 30 * time.Second
+	wsWriteTimeout     = 10 * time.Second
+)
+
+var (
+	errWSNotAuthorized        = errors.New("Kein Zugriff auf diese Sitzung")
+	errWSTooManySubscriptions = errors.New("Zu viele Sitzungen auf dieser Verbindung")
+	wsLog                     = componentLogger("websocket")
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin:     wsOriginAllowed,
+}
+
+// wsOriginAllowed accepts the own origin and those in CORS_ORIGINS; the session
+// tokens protect the data, this only keeps foreign pages from using the socket
+func wsOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Not a browser
+	}
+	if parsed, err := url.Parse(origin); err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	return corsOrigins["*"] || corsOrigins[strings.TrimSuffix(origin, "/")]
+}
+
+type wsClientMessage struct {
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"` // Echoed in the answer
+	SessionID string `json:"sessionId"`
+	Token     string `json:"token,omitempty"` // Only for subscribe
+}
+
+type wsServerMessage struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Update    *ProgressUpdate `json:"update,omitempty"`
+	Message   string          `json:"message,omitempty"`
+}
+
+// wsConnection is one WebSocket client and its subscriptions
+type wsConnection struct {
+	conn          *websocket.Conn
+	remote        string
+	writeMutex    sync.Mutex // gorilla/websocket allows one concurrent writer
+	mu            sync.Mutex
+	subscriptions map[string]chan struct{} // Closed to end the subscription
+	authorized    map[string]bool          // Sessions whose token was checked
+	streams       sync.WaitGroup           // Running subscription streams
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+// handleWSProgress upgrades to a WebSocket and serves subscriptions and commands: GET /ws/progress
+func handleWSProgress(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already answered with an HTTP error
+		wsLog.Info("Upgrade failed", "ip", remoteIP(r), "error", err)
+		return
+	}
+	ws := &wsConnection{
+		conn:          conn,
+		remote:        remoteIP(r),
+		subscriptions: make(map[string]chan struct{}),
+		authorized:    make(map[string]bool),
+		closed:        make(chan struct{}),
+	}
+	wsLog.Info("Client connected", "ip", ws.remote)
+	defer ws.close()
+
+	goGuarded("websocket ping", ws.keepAlive)
+	ws.readLoop()
+}
+
+// readLoop handles client messages until the connection fails or misses its pongs
+func (ws *wsConnection) readLoop() {
+	ws.conn.SetReadLimit(maxWSMessageBytes)
+	extendDeadline := func() error { return ws.conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval)) }
+	extendDeadline()
+	ws.conn.SetPongHandler(func(string) error { return extendDeadline() })
+
+	for {
+		_, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				wsLog.Info("Connection failed", "ip", ws.remote, "error", err)
+			}
+			return
+		}
+		extendDeadline()
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			ws.send(wsServerMessage{Type: "error", Message: "Ungültige Nachricht"})
+			continue
+		}
+		ws.handleMessage(msg)
+	}
+}
+
+func (ws *wsConnection) handleMessage(msg wsClientMessage) {
+	reply := func(err error) {
+		if err != nil {
+			ws.send(wsServerMessage{Type: "error", ID: msg.ID, SessionID: msg.SessionID, Message: err.Error()})
+			return
+		}
+		ws.send(wsServerMessage{Type: "ok", ID: msg.ID, SessionID: msg.SessionID})
+	}
+	if msg.SessionID == "" {
+		ws.send(wsServerMessage{Type: "error", ID: msg.ID, Message: "sessionId fehlt"})
+		return
+	}
+
+	switch msg.Type {
+	case "subscribe":
+		ws.subscribe(msg, reply)
+	case "unsubscribe":
+		ws.mu.Lock()
+		if stop, ok := ws.subscriptions[msg.SessionID]; ok {
+			close(stop)
+			delete(ws.subscriptions, msg.SessionID)
+		}
+		ws.mu.Unlock()
+		reply(nil)
+	case "cancel", "pause", "resume":
+		ws.mu.Lock()
+		authorized := ws.authorized[msg.SessionID]
+		ws.mu.Unlock()
+		if !authorized {
+			reply(errWSNotAuthorized)
+			return
+		}
+		wsLog.Info("Job command", "command", msg.Type, "session", msg.SessionID, "ip", ws.remote)
+		switch msg.Type {
+		case "cancel":
+			reply(cancelJob(msg.SessionID))
+		case "pause":
+			reply(pauseJob(msg.SessionID, true))
+		default:
+			reply(pauseJob(msg.SessionID, false))
+		}
+	default:
+		ws.send(wsServerMessage{Type: "error", ID: msg.ID, Message: "Unbekannter Nachrichtentyp: " + msg.Type})
+	}
+}
+
+// subscribe checks the token and starts streaming the session's updates
+func (ws *wsConnection) subscribe(msg wsClientMessage, reply func(error)) {
+	if !sessionTokenMatches(msg.SessionID, msg.Token) {
+		wsLog.Warn("Rejected subscription: unknown session or wrong token", "ip", ws.remote, "session", msg.SessionID)
+		reply(errWSNotAuthorized)
+		return
+	}
+
+	ws.mu.Lock()
+	ws.authorized[msg.SessionID] = true
+	_, subscribed := ws.subscriptions[msg.SessionID]
+	if !subscribed && len(ws.subscriptions) >= maxWSSubscriptions {
+		ws.mu.Unlock()
+		reply(errWSTooManySubscriptions)
+		return
+	}
+	stop := make(chan struct{})
+	if !subscribed {
+		ws.subscriptions[msg.SessionID] = stop
+	}
+	ws.mu.Unlock()
+
+	reply(nil)
+	if !subscribed {
+		ws.streams.Add(1)
+		goGuarded("websocket stream", func() {
+			defer ws.streams.Done()
+			ws.stream(msg.SessionID, stop)
+		})
+	}
+}
+
+// stream sends the backlog and then the live updates of one session
+func (ws *wsConnection) stream(sessionID string, stop chan struct{}) {
+	client, backlog, _ := subscribeProgress(sessionID)
+	if client != nil {
+		defer removeSSEClient(sessionID, client)
+	}
+	for _, update := range backlog {
+		if !ws.sendUpdate(sessionID, update) {
+			return
+		}
+	}
+
+	finished := client == nil
+	for !finished {
+		select {
+		case <-client.wake:
+		case <-stop:
+			return
+		case <-ws.closed:
+			return
+		case <-streamsCtx.Done():
+			// The server shuts down: send what is left, keepAlive closes the connection
+			updates, _ := client.take()
+			for _, update := range updates {
+				if !ws.sendUpdate(sessionID, update) {
+					break
+				}
+			}
+			return
+		}
+
+		var updates []ProgressUpdate
+		updates, finished = client.take()
+		for _, update := range updates {
+			if !ws.sendUpdate(sessionID, update) {
+				return
+			}
+		}
+	}
+
+	ws.mu.Lock()
+	if ws.subscriptions[sessionID] == stop {
+		delete(ws.subscriptions, sessionID)
+	}
+	ws.mu.Unlock()
+	ws.send(wsServerMessage{Type: "done", SessionID: sessionID})
+}
+
+func (ws *wsConnection) sendUpdate(sessionID string, update ProgressUpdate) bool {
+	msgType := "progress"
+	if update.Warning != nil {
+		msgType = "warning"
+	}
+	return ws.send(wsServerMessage{Type: msgType, SessionID: sessionID, Update: &update})
+}
+
+// send writes one message; on failure the connection is closed, which ends the read loop
+func (ws *wsConnection) send(msg wsServerMessage) bool {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := ws.conn.WriteJSON(msg); err != nil {
+		wsLog.Info("Write failed, dropping connection", "ip", ws.remote, "error", err)
+		ws.conn.Close()
+		return false
+	}
+	return true
+}
+
+// keepAlive pings the client, so dead connections are noticed and proxies keep idle ones open
+func (ws *wsConnection) keepAlive() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ws.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				ws.conn.Close()
+				return
+			}
+		case <-ws.closed:
+			return
+		case <-streamsCtx.Done():
+			// After the streams sent their last updates, so the client knows to reconnect
+			ws.streams.Wait()
+			message := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "Server wird neu gestartet")
+			ws.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteTimeout))
+			ws.close()
+			return
+		}
+	}
+}
+
+// close ends all subscriptions and the connection
+func (ws *wsConnection) close() {
+	ws.closeOnce.Do(func() {
+		close(ws.closed)
+		ws.conn.Close()
+		ws.mu.Lock()
+		count := len(ws.subscriptions)
+		ws.mu.Unlock()
+		wsLog.Info("Client disconnected", "ip", ws.remote, "subscriptions", count)
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// yt-dlp failures are classified by a rule table: the first rule whose pattern
+// matches stderr wins. YTDLP_ERROR_RULES names a JSON file with additional rules
+// (same fields as ErrorRule) that are checked before the built-in ones, so new
+// YouTube messages can be handled without a release.
+
+// ErrorRule maps a yt-dlp error message to a classification
+type ErrorRule struct {
+	Code        string `json:"code"`
+	Pattern     string `json:"pattern"`               // Regular expression matched against stderr
+	Message     string `json:"message"`               // User-facing message
+	Hint        string `json:"hint,omitempty"`        // User-facing next step
+	Transient   bool   `json:"transient,omitempty"`   // Trying again later may succeed
+	Remediation string `json:"remediation,omitempty"` // What the operator can do about it, for reports
+
+	pattern *regexp.Regexp
+}
+
+// unknownErrorRule is used when no rule matches
+var unknownErrorRule = ErrorRule{
+	Code:    "unknown",
+	Message: "Download fehlgeschlagen. Bitte überprüfe die URL und versuche es erneut",
+}
+
+// defaultErrorRules are the built-in rules; more specific messages come first
+var defaultErrorRules = []ErrorRule{
+	{
+		Code:    "format_unavailable",
+		Pattern: `Requested format is not available`,
+		Message: "Das gewählte Format ist für dieses Video nicht verfügbar",
+		Hint:    "Wähle ein anderes Format oder eine niedrigere Qualität",
+	},
+	{
+		Code:    "images_only",
+		Pattern: `Only images are available`,
+		Message: "Dieses Video enthält nur Bilder und kann nicht heruntergeladen werden",
+	},
+	{
+		Code:        "members_only",
+		Pattern:     `(?i)members[- ]only|available to this channel's members`,
+		Message:     "Dieses Video ist nur für Kanalmitglieder verfügbar",
+		Hint:        "Der Betreiber muss Cookies eines Kontos mit Kanalmitgliedschaft hinterlegen",
+		Remediation: "Provide cookies of an account with a channel membership",
+	},
+	{
+		Code:      "premiere",
+		Pattern:   `Premieres in|This live event will begin in`,
+		Message:   "Das Video ist noch nicht veröffentlicht (Premiere oder geplanter Livestream)",
+		Hint:      "Versuche es nach der Veröffentlichung erneut",
+		Transient: true,
+	},
+	{
+		Code:        "live_ended",
+		Pattern:     `This live event has ended`,
+		Message:     "Der Livestream ist beendet und die Aufzeichnung ist noch nicht verfügbar",
+		Hint:        "Versuche es in einigen Stunden erneut, sobald die Aufzeichnung verfügbar ist",
+		Transient:   true,
+		Remediation: "Retry once YouTube has processed the recording",
+	},
+	{
+		Code:    "video_unavailable",
+		Pattern: `Video unavailable`,
+		Message: "Video ist nicht verfügbar oder wurde gelöscht",
+		Hint:    "Prüfe, ob sich das Video im Browser abspielen lässt",
+	},
+	{
+		Code:    "private_video",
+		Pattern: `Private video`,
+		Message: "Video ist privat und kann nicht heruntergeladen werden",
+	},
+	{
+		Code:        "geo_blocked",
+		Pattern:     `(?i)available in your country|geo[- ]?(restrict|block)`,
+		Message:     "Video ist in deinem Land nicht verfügbar (Geo-Blocking)",
+		Hint:        "Der Betreiber kann Downloads über einen Proxy in einem anderen Land leiten",
+		Remediation: "Route yt-dlp through a proxy in a country where the video is available",
+	},
+	{
+		Code:    "copyright",
+		Pattern: `(?i)copyright`,
+		Message: "Video ist urheberrechtlich geschützt und kann nicht heruntergeladen werden",
+	},
+	{
+		Code:        "bot_check",
+		Pattern:     `(?i)confirm you.re not a bot`,
+		Message:     "YouTube verlangt eine Bestätigung, dass kein Bot anfragt. Bitte versuche es später erneut",
+		Hint:        "Versuche es später erneut. Dauerhaft hilft es, wenn der Betreiber Cookies oder ein PO-Token konfiguriert",
+		Transient:   true,
+		Remediation: "Configure cookies or a PO token (YTDLP_PO_TOKEN) for the server",
+	},
+	{
+		Code:        "sign_in_required",
+		Pattern:     `(?i)sign in|age[- ]restrict|confirm your age|inappropriate for some users`,
+		Message:     "Video erfordert Altersbeschränkung oder Anmeldung",
+		Hint:        "Versuche es erneut, sobald der Betreiber Cookies eines angemeldeten Kontos hinterlegt hat",
+		Remediation: "Provide cookies of a signed-in account",
+	},
+	{
+		Code:      "network",
+		Pattern:   `(?i)network|connection|timed out|name resolution`,
+		Message:   "Netzwerkfehler. Bitte überprüfe deine Internetverbindung",
+		Hint:      "Versuche es in ein paar Minuten erneut",
+		Transient: true,
+	},
+	{
+		Code:        "rate_limited",
+		Pattern:     `\b429\b|Too Many Requests`,
+		Message:     "Zu viele Anfragen. Bitte versuche es in einigen Minuten erneut",
+		Hint:        "Warte einige Minuten, bevor du den nächsten Download startest",
+		Transient:   true,
+		Remediation: "Lower the request rate or add sleep intervals between downloads",
+	},
+	{
+		Code:        "extractor_outdated",
+		Pattern:     `(?i)unable to extract|please report this issue|update to the latest version`,
+		Message:     "Das Video konnte nicht ausgelesen werden. Bitte versuche es später erneut",
+		Hint:        "Der Betreiber muss yt-dlp aktualisieren",
+		Remediation: "Update yt-dlp",
+	},
+}
+
+var errorRules = loadErrorRules(getenv("YTDLP_ERROR_RULES"))
+
+// compileErrorRules compiles the patterns; rules without code or with an invalid pattern are skipped
+func compileErrorRules(rules []ErrorRule, source string) []ErrorRule {
+	compiled := make([]ErrorRule, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil || rule.Code == "" || rule.Pattern == "" {
+			configLog.Warn("Skipping error rule: invalid code or pattern", "code", rule.Code, "source", source)
+			continue
+		}
+		if rule.Message == "" {
+			rule.Message = unknownErrorRule.Message
+		}
+		rule.pattern = pattern
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+// loadErrorRules returns the rules from path followed by the built-in rules
+func loadErrorRules(path string) []ErrorRule {
+	rules := compileErrorRules(defaultErrorRules, "built-in rules")
+	if path == "" {
+		return rules
+	}
+
+	custom, err := readErrorRules(path)
+	if err != nil {
+		configLog.Warn("Custom error rules not loaded", "error", err)
+		return rules
+	}
+	configLog.Info("Loaded error rules", "rules", len(custom), "path", path)
+	return append(custom, rules...)
+}
+
+func readErrorRules(path string) ([]ErrorRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read YTDLP_ERROR_RULES: %v", err)
+	}
+	var rules []ErrorRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid YTDLP_ERROR_RULES %s: %v", path, err)
+	}
+	return compileErrorRules(rules, path), nil
+}
+
+// classifyYtDlpError returns the first rule matching the yt-dlp stderr output
+func classifyYtDlpError(stderr string) ErrorRule {
+	for _, rule := range errorRules {
+		if rule.pattern.MatchString(stderr) {
+			return rule
+		}
+	}
+	return unknownErrorRule
+}
+
+// downloadError converts the classification into a job error
+func (rule ErrorRule) downloadError() *downloadError {
+	return &downloadError{Code: rule.Code, Message: rule.Message, Hint: rule.Hint, Transient: rule.Transient}
+}
+
+// errorHint returns the user-facing next step for err, "" if there is none
+func errorHint(err error) string {
+	var dlErr *downloadError
+	if errors.As(err, &dlErr) {
+		return dlErr.Hint
+	}
+	return ""
+}
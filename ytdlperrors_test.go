@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyYtDlpError(t *testing.T) {
+	tests := []struct {
+		stderr    string
+		code      string
+		transient bool
+	}{
+		{"ERROR: [youtube] AAAAAAAAAAA: Private video. Sign in if you've been granted access to this video", "private_video", false},
+		{"ERROR: [youtube] AAAAAAAAAAA: Video unavailable. This video has been removed by the uploader", "video_unavailable", false},
+		{"ERROR: [youtube] AAAAAAAAAAA: Join this channel to get access to members-only content like this video, and other exclusive perks.", "members_only", false},
+		{"ERROR: [youtube] AAAAAAAAAAA: Premieres in 5 hours", "premiere", true},
+		{"ERROR: [youtube] AAAAAAAAAAA: This live event will begin in a few moments.", "premiere", true},
+		{"ERROR: [youtube] AAAAAAAAAAA: This live event has ended.", "live_ended", true},
+		{"ERROR: [youtube] AAAAAAAAAAA: The uploader has not made this video available in your country", "geo_blocked", false},
+		{"ERROR: [youtube] AAAAAAAAAAA: Sign in to confirm you’re not a bot. Use --cookies-from-browser", "bot_check", true},
+		{"ERROR: [youtube] AAAAAAAAAAA: Sign in to confirm your age. This video may be inappropriate for some users.", "sign_in_required", false},
+		{"ERROR: Requested format is not available. Use --list-formats for a list of available formats", "format_unavailable", false},
+		{"ERROR: unable to download video data: HTTP Error 429: Too Many Requests", "rate_limited", true},
+		{"ERROR: [youtube] AAAAAAAAAAA: Unable to extract uploader id; please report this issue on https://github.com/yt-dlp/yt-dlp/issues", "extractor_outdated", false},
+		{"ERROR: unable to download video data: <urlopen error [Errno -3] Temporary failure in name resolution>", "network", true},
+		// Words that merely contain "age" or "geo" must not match
+		{"ERROR: [youtube] AAAAAAAAAAA: Downloading webpage failed, message from the geometry engine", "unknown", false},
+		{"", "unknown", false},
+	}
+
+	for _, tt := range tests {
+		rule := classifyYtDlpError(tt.stderr)
+		if rule.Code != tt.code || rule.Transient != tt.transient {
+			t.Errorf("classifyYtDlpError(%q) = %s (transient %v), want %s (transient %v)", tt.stderr, rule.Code, rule.Transient, tt.code, tt.transient)
+		}
+		if rule.Message == "" {
+			t.Errorf("classifyYtDlpError(%q) has no message", tt.stderr)
+		}
+	}
+}
+
+func TestLoadErrorRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	rules := `[
+		{"code": "custom_block", "pattern": "(?i)blocked by the operator", "message": "Gesperrt", "transient": true},
+		{"code": "broken", "pattern": "("},
+		{"code": "private_override", "pattern": "Private video"}
+	]`
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := loadErrorRules(path)
+	if len(loaded) != len(defaultErrorRules)+2 {
+		t.Fatalf("loaded %d rules, want the built-in ones plus 2 valid custom rules", len(loaded))
+	}
+	if loaded[0].Code != "custom_block" || !loaded[0].Transient || loaded[0].pattern == nil {
+		t.Errorf("first rule = %+v", loaded[0])
+	}
+	// Custom rules win over built-in ones and get a default message
+	if loaded[1].Code != "private_override" || loaded[1].Message != unknownErrorRule.Message {
+		t.Errorf("second rule = %+v", loaded[1])
+	}
+
+	// A missing file keeps the built-in rules
+	if fallback := loadErrorRules(filepath.Join(t.TempDir(), "missing.json")); len(fallback) != len(defaultErrorRules) {
+		t.Errorf("missing file: %d rules, want %d", len(fallback), len(defaultErrorRules))
+	}
+}
+
+func TestErrorHint(t *testing.T) {
+	rule := classifyYtDlpError("ERROR: [youtube] AAAAAAAAAAA: Unable to extract uploader id")
+	if hint := errorHint(fmt.Errorf("fetch: %w", rule.downloadError())); hint == "" || hint != rule.Hint {
+		t.Errorf("errorHint(wrapped %s) = %q, want %q", rule.Code, hint, rule.Hint)
+	}
+	if hint := errorHint(errors.New("plain")); hint != "" {
+		t.Errorf("errorHint(plain error) = %q, want none", hint)
+	}
+}